@@ -0,0 +1,140 @@
+package app
+
+import (
+	"regexp"
+	"time"
+)
+
+// apiKeyTypeNamePattern restricts API key type names to characters that need no escaping in a URL path
+var apiKeyTypeNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// APIKeyType is a kind of API key that a tenant issues to its own customers, e.g. "free" or "partner". Keygo login
+// tokens are unrelated.
+type APIKeyType struct {
+	ID          string
+	TenantID    string
+	Name        string
+	Description string
+
+	// Metadata is returned when a key of this type is verified, merged with the key's own metadata
+	Metadata map[string]string
+
+	// TTL is the lifetime of keys of this type, e.g. "8760h", or empty if they do not expire
+	TTL string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// APIKeyTypeInput is a set of fields to define an API key type. Changes to Metadata apply to keys already issued;
+// changes to TTL do not.
+type APIKeyTypeInput struct {
+	Name        string
+	Description string
+	Metadata    map[string]string
+	TTL         string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (at *APIKeyTypeInput) Validate() error {
+	if !apiKeyTypeNamePattern.MatchString(at.Name) {
+		return Errorf(ERR_INVALID, "API key type name must be 1 to 64 letters, digits, '-' or '_'")
+	}
+	if at.TTL != "" {
+		if _, err := ParseTTL(at.TTL); err != nil {
+			return err
+		}
+	}
+	if at.Metadata == nil {
+		at.Metadata = map[string]string{}
+	}
+	return validateMetadata(at.Metadata)
+}
+
+// APIKey is a key issued by a tenant to one of its customers. Only a hash of the key is stored.
+type APIKey struct {
+	ID       string
+	TenantID string
+	Type     string
+	Name     string
+
+	// Prefix is the start of the key, to recognize it without revealing it
+	Prefix string
+
+	// Key is the plaintext key. It is only returned when the key is issued.
+	Key string `json:",omitempty"`
+
+	// Metadata is the key's own metadata, which takes precedence over that of its type
+	Metadata map[string]string
+
+	ExpiresAt  *time.Time
+	RevokedAt  *time.Time
+	IssuedByID string
+	CreatedAt  time.Time
+}
+
+// APIKeyIssueInput is a set of fields to issue an API key. Name identifies the customer or purpose of the key. TTL
+// defaults to that of the type, and must not be longer.
+type APIKeyIssueInput struct {
+	Type     string
+	Name     string
+	Metadata map[string]string
+	TTL      string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (ai *APIKeyIssueInput) Validate() error {
+	if ai.Type == "" {
+		return Errorf(ERR_INVALID, "Type is required")
+	}
+	if ai.Name == "" {
+		return Errorf(ERR_INVALID, "Name is required")
+	}
+	if ai.TTL != "" {
+		if _, err := ParseTTL(ai.TTL); err != nil {
+			return err
+		}
+	}
+	if ai.Metadata == nil {
+		ai.Metadata = map[string]string{}
+	}
+	return validateMetadata(ai.Metadata)
+}
+
+// APIKeyFilter is a filter passed to FindAPIKeys()
+type APIKeyFilter struct {
+	Type    *string
+	Revoked *bool
+}
+
+// APIKeyVerifyInput is a plaintext key presented by a customer of a tenant
+type APIKeyVerifyInput struct {
+	Key string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (av *APIKeyVerifyInput) Validate() error {
+	if av.Key == "" {
+		return Errorf(ERR_INVALID, "Key is required")
+	}
+	return nil
+}
+
+// APIKeyVerifyOutput is the result of verifying an API key. A key that is unknown, revoked or expired is not valid,
+// and no other fields are set.
+type APIKeyVerifyOutput struct {
+	Valid     bool
+	KeyID     string            `json:",omitempty"`
+	Type      string            `json:",omitempty"`
+	Name      string            `json:",omitempty"`
+	Metadata  map[string]string `json:",omitempty"`
+	ExpiresAt *time.Time        `json:",omitempty"`
+}
+
+// validateMetadata returns an error if a metadata map has an empty key
+func validateMetadata(metadata map[string]string) error {
+	if _, ok := metadata[""]; ok {
+		return Errorf(ERR_INVALID, "Metadata keys must not be empty")
+	}
+	return nil
+}
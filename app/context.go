@@ -13,6 +13,15 @@ const (
 
 	// ContextKeyToken stores the Token passed by the client
 	ContextKeyToken = "token"
+
+	// ContextKeyEmailQueued is set when email is queued in the request transaction
+	ContextKeyEmailQueued = "email_queued"
+
+	// ContextKeyRLSBypass stores the RLS bypass of the request until it is recorded
+	ContextKeyRLSBypass = "rls_bypass"
+
+	// ContextKeySessionDiscarded is set when the session cookie of the request could not be decoded, and was discarded
+	ContextKeySessionDiscarded = "session_discarded"
 )
 
 // NewContextWithUser returns a new context with the given user.
@@ -26,3 +35,9 @@ func CurrentUser(ctx echo.Context) User {
 	user, _ := ctx.Get(ContextKeyUser).(User)
 	return user
 }
+
+// CurrentToken returns the token of the current request.
+func CurrentToken(ctx echo.Context) Token {
+	token, _ := ctx.Get(ContextKeyToken).(Token)
+	return token
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"time"
+)
+
+// MaxElevationHours is the longest duration that can be requested for an elevation
+const MaxElevationHours = 24
+
+const (
+	ElevationStatusPending = "pending"
+	ElevationStatusActive  = "active"
+	ElevationStatusExpired = "expired"
+	ElevationStatusDenied  = "denied"
+	ElevationStatusRevoked = "revoked"
+)
+
+// Elevation is a request by a user to hold a role temporarily, in addition to their own role. Once approved, the
+// role applies until ExpiresAt, unless revoked earlier.
+type Elevation struct {
+	ID            string
+	UserID        string
+	UserEmail     string
+	RoleID        string
+	Role          string
+	Hours         int
+	Justification string
+	Status        string
+
+	// ApproverID is the user who approved or denied the request
+	ApproverID   string
+	DecisionNote string
+	ApprovedAt   *time.Time
+	DeniedAt     *time.Time
+	ExpiresAt    *time.Time
+
+	RevokedAt *time.Time
+	RevokerID string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// ElevationCreateInput is a set of fields to request an elevation via CreateElevation()
+type ElevationCreateInput struct {
+	RoleID        string
+	Hours         int
+	Justification string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (ec *ElevationCreateInput) Validate() error {
+	if ec.RoleID == "" {
+		return Errorf(ERR_INVALID, "RoleID is required")
+	}
+	if ec.Hours < 1 || ec.Hours > MaxElevationHours {
+		return Errorf(ERR_INVALID, "Hours must be between 1 and %d", MaxElevationHours)
+	}
+	if ec.Justification == "" {
+		return Errorf(ERR_INVALID, "Justification is required")
+	}
+	return nil
+}
+
+// ElevationDecisionInput is an optional note recorded with the approval or denial of an elevation request
+type ElevationDecisionInput struct {
+	Note string
+}
+
+// ElevationFilter is a filter passed to FindElevations()
+type ElevationFilter struct {
+	UserID *string
+
+	// Status is one of the ElevationStatus values
+	Status *string
+}
@@ -0,0 +1,14 @@
+package app
+
+// Email is a message to a single recipient, with plain text and HTML versions of the body
+type Email struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// EmailSender delivers email. The sender determines the From address.
+type EmailSender interface {
+	SendEmail(email Email) error
+}
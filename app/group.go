@@ -0,0 +1,87 @@
+package app
+
+import (
+	"time"
+)
+
+// Group is a team of tenant members. Members of a group are also members of its ancestor groups, and receive the
+// grants of the group and all its ancestors within the tenant.
+type Group struct {
+	ID          string
+	TenantID    string
+	ParentID    string
+	Name        string
+	Description string
+
+	// RoleID optionally grants the permissions of a role
+	RoleID string
+	Role   string
+
+	// Permissions are granted in addition to those of the role
+	Permissions []string
+
+	MemberIDs []string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// GroupCreateInput is a set of fields to define a new group for CreateGroup()
+type GroupCreateInput struct {
+	Name        string
+	Description string
+	ParentID    string
+	RoleID      string
+	Permissions []string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (gc *GroupCreateInput) Validate() error {
+	if gc.Name == "" {
+		return Errorf(ERR_INVALID, "Group name is required")
+	}
+	return validateGroupPermissions(gc.Permissions)
+}
+
+// GroupUpdateInput is a set of fields to be updated via UpdateGroup(). An empty ParentID or RoleID clears it.
+type GroupUpdateInput struct {
+	Name        *string
+	Description *string
+	ParentID    *string
+	RoleID      *string
+	Permissions *[]string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (gu *GroupUpdateInput) Validate() error {
+	if gu.Name != nil && *gu.Name == "" {
+		return Errorf(ERR_INVALID, "Group name is required")
+	}
+	if gu.Permissions != nil {
+		return validateGroupPermissions(*gu.Permissions)
+	}
+	return nil
+}
+
+// GroupMemberAddInput identifies a tenant member to add to a group
+type GroupMemberAddInput struct {
+	UserID string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (ga *GroupMemberAddInput) Validate() error {
+	if ga.UserID == "" {
+		return Errorf(ERR_INVALID, "UserID is required")
+	}
+	return nil
+}
+
+// validateGroupPermissions requires permissions granted by a group to be own-tenant permissions, since groups
+// belong to a tenant
+func validateGroupPermissions(permissions []string) error {
+	for _, p := range permissions {
+		if !IsOwnTenantPermission(p) {
+			return Errorf(ERR_INVALID, "Permission %q cannot be granted by a group, only own_tenant permissions", p)
+		}
+	}
+	return nil
+}
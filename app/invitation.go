@@ -0,0 +1,75 @@
+package app
+
+import (
+	"net/mail"
+	"time"
+)
+
+// InvitationLifetime is how long an invitation can be accepted after it is sent
+const InvitationLifetime = time.Hour * 24 * 7
+
+const (
+	InvitationStatusPending  = "pending"
+	InvitationStatusAccepted = "accepted"
+	InvitationStatusRevoked  = "revoked"
+	InvitationStatusExpired  = "expired"
+)
+
+// Invitation is an offer of tenant membership, sent to an email address. It is accepted by the user who logs in
+// with that address and presents the invitation token.
+type Invitation struct {
+	ID         string
+	TenantID   string
+	TenantName string
+	Email      string
+	RoleID     string
+	Role       string
+	InviterID  string
+	Status     string
+
+	SentAt       time.Time
+	ExpiresAt    time.Time
+	AcceptedAt   *time.Time
+	AcceptedByID string
+	RevokedAt    *time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// InvitationCreateInput is a set of fields to define a new invitation for CreateTenantInvitation()
+type InvitationCreateInput struct {
+	Email string
+
+	// RoleID is the membership role granted on acceptance. Defaults to UserRoleBasic.
+	RoleID string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (ic *InvitationCreateInput) Validate() error {
+	if ic.Email == "" {
+		return Errorf(ERR_INVALID, "Email is required")
+	}
+	if _, err := mail.ParseAddress(ic.Email); err != nil {
+		return Errorf(ERR_INVALID, "Email %q is not a valid address", ic.Email)
+	}
+	return nil
+}
+
+// InvitationFilter is a filter for FindTenantInvitations()
+type InvitationFilter struct {
+	TenantID *string
+	Email    *string
+}
+
+// InvitationAcceptInput is the token from an invitation, for AcceptTenantInvitation()
+type InvitationAcceptInput struct {
+	Token string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (ia *InvitationAcceptInput) Validate() error {
+	if ia.Token == "" {
+		return Errorf(ERR_INVALID, "Token is required")
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package app
+
+import (
+	"encoding/base64"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// keyRingNamePattern restricts key ring names to characters that need no escaping in a URL path
+var keyRingNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Key ring types. An encryption key encrypts and decrypts; the others are signing key pairs, which sign and verify.
+const (
+	KeyTypeAES256GCM = "aes256-gcm"
+	KeyTypeEd25519   = "ed25519"
+	KeyTypeECDSAP256 = "ecdsa-p256"
+	KeyTypeRSAPSS    = "rsa-pss"
+)
+
+// KeyTypes are the valid key ring types
+var KeyTypes = []string{KeyTypeAES256GCM, KeyTypeEd25519, KeyTypeECDSAP256, KeyTypeRSAPSS}
+
+// IsSigningKeyType returns true if keys of the given type sign rather than encrypt
+func IsSigningKeyType(keyType string) bool {
+	return keyType == KeyTypeEd25519 || keyType == KeyTypeECDSAP256 || keyType == KeyTypeRSAPSS
+}
+
+// KeyRing is a named, versioned key of a tenant. Data is encrypted or signed with the latest version, and older
+// versions are kept to decrypt data encrypted, or verify signatures made, before a rotation.
+type KeyRing struct {
+	ID            string
+	TenantID      string
+	Name          string
+	Type          string
+	LatestVersion int
+	Versions      []KeyVersion
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// KeyVersion is one generation of the key material of a key ring. The key material itself is never exposed.
+type KeyVersion struct {
+	Version   int
+	CreatedAt time.Time
+}
+
+// KeyWrapper encrypts and decrypts tenant key material with a master key, so that the keys are never stored in the
+// clear. The context is authenticated with the key, so a wrapped key only unwraps with the context it was wrapped
+// with.
+type KeyWrapper interface {
+	WrapKey(key, context []byte) ([]byte, error)
+	UnwrapKey(wrapped, context []byte) ([]byte, error)
+}
+
+// KeyRingCreateInput is a set of fields to define a new key ring for CreateKeyRing(). Type defaults to an
+// encryption key.
+type KeyRingCreateInput struct {
+	Name string
+	Type string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (kc *KeyRingCreateInput) Validate() error {
+	if !keyRingNamePattern.MatchString(kc.Name) {
+		return Errorf(ERR_INVALID, "Key name must be 1 to 64 letters, digits, '-' or '_'")
+	}
+	if kc.Type == "" {
+		kc.Type = KeyTypeAES256GCM
+	}
+	for _, t := range KeyTypes {
+		if kc.Type == t {
+			return nil
+		}
+	}
+	return Errorf(ERR_INVALID, "Key type must be one of %s", strings.Join(KeyTypes, ", "))
+}
+
+// EncryptInput is data to encrypt with a key ring. Plaintext and Context are base64 encoded. Context is optional
+// additional data, which is not encrypted but must be given again to decrypt.
+type EncryptInput struct {
+	Plaintext string
+	Context   string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (ei *EncryptInput) Validate() error {
+	if _, err := base64.StdEncoding.DecodeString(ei.Plaintext); err != nil {
+		return Errorf(ERR_INVALID, "Plaintext must be base64 encoded")
+	}
+	return validateKeyContext(ei.Context)
+}
+
+// EncryptOutput is the result of an encryption. The ciphertext includes the key version it was encrypted with.
+type EncryptOutput struct {
+	Ciphertext string
+	KeyVersion int
+}
+
+// DecryptInput is data to decrypt with a key ring, with the Context it was encrypted with, if any
+type DecryptInput struct {
+	Ciphertext string
+	Context    string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (di *DecryptInput) Validate() error {
+	if di.Ciphertext == "" {
+		return Errorf(ERR_INVALID, "Ciphertext is required")
+	}
+	return validateKeyContext(di.Context)
+}
+
+// DecryptOutput is the result of a decryption. Plaintext is base64 encoded.
+type DecryptOutput struct {
+	Plaintext string
+}
+
+// SignInput is a message to sign with a signing key. Input is base64 encoded.
+type SignInput struct {
+	Input string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (si *SignInput) Validate() error {
+	if _, err := base64.StdEncoding.DecodeString(si.Input); err != nil {
+		return Errorf(ERR_INVALID, "Input must be base64 encoded")
+	}
+	return nil
+}
+
+// SignOutput is the signature of a message. The signature includes the key version that made it.
+type SignOutput struct {
+	Signature  string
+	KeyVersion int
+}
+
+// VerifyInput is a message, base64 encoded, and a signature of it to verify with a signing key
+type VerifyInput struct {
+	Input     string
+	Signature string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (vi *VerifyInput) Validate() error {
+	if _, err := base64.StdEncoding.DecodeString(vi.Input); err != nil {
+		return Errorf(ERR_INVALID, "Input must be base64 encoded")
+	}
+	if vi.Signature == "" {
+		return Errorf(ERR_INVALID, "Signature is required")
+	}
+	return nil
+}
+
+// VerifyOutput is the result of a signature verification
+type VerifyOutput struct {
+	Valid bool
+}
+
+// PublicKey is the public key of a version of a signing key, in PEM form
+type PublicKey struct {
+	Version int
+	PEM     string
+}
+
+func validateKeyContext(context string) error {
+	if _, err := base64.StdEncoding.DecodeString(context); err != nil {
+		return Errorf(ERR_INVALID, "Context must be base64 encoded")
+	}
+	return nil
+}
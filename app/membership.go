@@ -0,0 +1,66 @@
+package app
+
+import (
+	"time"
+)
+
+// TenantMembership is a user's membership in a tenant. The membership role applies within that tenant only.
+type TenantMembership struct {
+	ID         string
+	TenantID   string
+	TenantName string
+	UserID     string
+	UserEmail  string
+	RoleID     string
+	Role       string
+
+	// Permissions are the effective permissions within the tenant, granted by the membership role and by the groups
+	// the user belongs to
+	Permissions []string
+
+	// GroupIDs are the groups the user belongs to, directly or as a member of a subgroup
+	GroupIDs []string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// TenantMembershipCreateInput is a set of fields to define a new membership for CreateTenantMembership()
+type TenantMembershipCreateInput struct {
+	TenantID string
+	UserID   string
+
+	// Role is the name of the membership role. Defaults to UserRoleBasic.
+	Role string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (mc *TenantMembershipCreateInput) Validate() error {
+	if mc.TenantID == "" {
+		return Errorf(ERR_INVALID, "TenantID is required")
+	}
+	if mc.UserID == "" {
+		return Errorf(ERR_INVALID, "UserID is required")
+	}
+	return nil
+}
+
+// TenantMembershipFilter is a filter passed to FindTenantMemberships()
+type TenantMembershipFilter struct {
+	// Filtering fields.
+	TenantID *string
+	UserID   *string
+}
+
+// ActiveTenantInput selects the active tenant of the current session
+type ActiveTenantInput struct {
+	TenantID string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (at *ActiveTenantInput) Validate() error {
+	if at.TenantID == "" {
+		return Errorf(ERR_INVALID, "TenantID is required")
+	}
+	return nil
+}
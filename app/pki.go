@@ -0,0 +1,277 @@
+package app
+
+import (
+	"encoding/pem"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// certificateTemplateNamePattern restricts template names to characters that need no escaping in a URL path
+var certificateTemplateNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// domainPatternPattern matches a DNS name, optionally starting with "*." to allow any subdomain
+var domainPatternPattern = regexp.MustCompile(`^(\*\.)?([A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?\.)*` +
+	`[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+
+// Key usages a certificate template may allow
+const (
+	KeyUsageDigitalSignature = "digital_signature"
+	KeyUsageKeyEncipherment  = "key_encipherment"
+	KeyUsageKeyAgreement     = "key_agreement"
+)
+
+// KeyUsages are the valid key usages
+var KeyUsages = []string{KeyUsageDigitalSignature, KeyUsageKeyEncipherment, KeyUsageKeyAgreement}
+
+// Extended key usages a certificate template may allow
+const (
+	ExtKeyUsageServerAuth = "server_auth"
+	ExtKeyUsageClientAuth = "client_auth"
+)
+
+// ExtKeyUsages are the valid extended key usages
+var ExtKeyUsages = []string{ExtKeyUsageServerAuth, ExtKeyUsageClientAuth}
+
+// defaultCATTL is the validity of a generated CA certificate, if not given
+const defaultCATTL = 10 * 365 * 24 * time.Hour
+
+// CertificateAuthority is the CA of a tenant, which issues its certificates. Its private key is never exposed.
+type CertificateAuthority struct {
+	ID         string
+	TenantID   string
+	CommonName string
+
+	// Certificate is the CA certificate, PEM encoded
+	Certificate string
+
+	// IsRoot is true for a self-signed CA, and false for an intermediate imported with its key
+	IsRoot bool
+
+	NotBefore time.Time
+	NotAfter  time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// CAGenerateInput defines a new self-signed root CA. TTL is a duration, e.g. "87600h", and defaults to ten years.
+type CAGenerateInput struct {
+	CommonName string
+	TTL        string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (cg *CAGenerateInput) Validate() error {
+	if cg.CommonName == "" {
+		return Errorf(ERR_INVALID, "CommonName is required")
+	}
+	if _, err := cg.Duration(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Duration returns the validity of the CA certificate
+func (cg *CAGenerateInput) Duration() (time.Duration, error) {
+	if cg.TTL == "" {
+		return defaultCATTL, nil
+	}
+	return ParseTTL(cg.TTL)
+}
+
+// CAImportInput is an existing root or intermediate CA certificate and its private key, both PEM encoded
+type CAImportInput struct {
+	Certificate string
+	PrivateKey  string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (ci *CAImportInput) Validate() error {
+	if b, _ := pem.Decode([]byte(ci.Certificate)); b == nil {
+		return Errorf(ERR_INVALID, "Certificate must be PEM encoded")
+	}
+	if b, _ := pem.Decode([]byte(ci.PrivateKey)); b == nil {
+		return Errorf(ERR_INVALID, "PrivateKey must be PEM encoded")
+	}
+	return nil
+}
+
+// CertificateTemplate is a named policy for issuing certificates: the names they may be issued for, their longest
+// validity, and the usages of their keys
+type CertificateTemplate struct {
+	ID       string
+	TenantID string
+	Name     string
+
+	// AllowedDomains are the DNS names certificates may be issued for. "*.example.com" allows any subdomain of
+	// example.com.
+	AllowedDomains []string
+
+	// AllowIPSANs allows IP addresses as subject alternative names
+	AllowIPSANs bool
+
+	// MaxTTL is the longest validity of a certificate, e.g. "24h"
+	MaxTTL string
+
+	KeyUsages    []string
+	ExtKeyUsages []string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// CertificateTemplateInput is a set of fields to define a certificate template. KeyUsages defaults to
+// digital_signature and key_encipherment, and ExtKeyUsages to server_auth and client_auth.
+type CertificateTemplateInput struct {
+	Name           string
+	AllowedDomains []string
+	AllowIPSANs    bool
+	MaxTTL         string
+	KeyUsages      []string
+	ExtKeyUsages   []string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (ct *CertificateTemplateInput) Validate() error {
+	if !certificateTemplateNamePattern.MatchString(ct.Name) {
+		return Errorf(ERR_INVALID, "Template name must be 1 to 64 letters, digits, '-' or '_'")
+	}
+	if len(ct.AllowedDomains) == 0 && !ct.AllowIPSANs {
+		return Errorf(ERR_INVALID, "AllowedDomains is required, unless IP SANs are allowed")
+	}
+	for _, d := range ct.AllowedDomains {
+		if !domainPatternPattern.MatchString(d) {
+			return Errorf(ERR_INVALID, "Invalid domain %q, must be a DNS name, optionally starting with \"*.\"", d)
+		}
+	}
+	if _, err := ParseTTL(ct.MaxTTL); err != nil {
+		return err
+	}
+
+	if ct.AllowedDomains == nil {
+		ct.AllowedDomains = []string{}
+	}
+	if ct.KeyUsages == nil {
+		ct.KeyUsages = []string{KeyUsageDigitalSignature, KeyUsageKeyEncipherment}
+	}
+	if ct.ExtKeyUsages == nil {
+		ct.ExtKeyUsages = []string{ExtKeyUsageServerAuth, ExtKeyUsageClientAuth}
+	}
+	for _, u := range ct.KeyUsages {
+		if !contains(KeyUsages, u) {
+			return Errorf(ERR_INVALID, "Key usage must be one of %s", strings.Join(KeyUsages, ", "))
+		}
+	}
+	for _, u := range ct.ExtKeyUsages {
+		if !contains(ExtKeyUsages, u) {
+			return Errorf(ERR_INVALID, "Extended key usage must be one of %s", strings.Join(ExtKeyUsages, ", "))
+		}
+	}
+	return nil
+}
+
+// AllowsDomain returns true if a certificate may be issued for the DNS name
+func (t CertificateTemplate) AllowsDomain(name string) bool {
+	return domainAllowed(name, t.AllowedDomains)
+}
+
+// domainAllowed returns true if the DNS name is one of the allowed domains, or a subdomain of an allowed domain
+// starting with "*."
+func domainAllowed(name string, allowed []string) bool {
+	name = strings.ToLower(name)
+	for _, d := range allowed {
+		d = strings.ToLower(d)
+		if suffix, ok := strings.CutPrefix(d, "*"); ok {
+			if strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+				return true
+			}
+		} else if name == d {
+			return true
+		}
+	}
+	return false
+}
+
+// Certificate is a certificate issued by a tenant CA
+type Certificate struct {
+	ID           string
+	TenantID     string
+	TemplateName string
+
+	// SerialNumber is lowercase hexadecimal, without separators
+	SerialNumber string
+
+	CommonName  string
+	DNSNames    []string
+	IPAddresses []string
+
+	// Certificate is the issued certificate, PEM encoded
+	Certificate string
+
+	NotBefore  time.Time
+	NotAfter   time.Time
+	RevokedAt  *time.Time
+	IssuedByID string
+	CreatedAt  time.Time
+}
+
+// CertificateIssueInput is a certificate signing request, PEM encoded, to issue under a template. The subject
+// common name and alternative names are taken from the request. TTL defaults to the template's MaxTTL.
+type CertificateIssueInput struct {
+	Template string
+	CSR      string
+	TTL      string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (ci *CertificateIssueInput) Validate() error {
+	if ci.Template == "" {
+		return Errorf(ERR_INVALID, "Template is required")
+	}
+	if b, _ := pem.Decode([]byte(ci.CSR)); b == nil || b.Type != "CERTIFICATE REQUEST" {
+		return Errorf(ERR_INVALID, "CSR must be a PEM encoded certificate request")
+	}
+	if ci.TTL != "" {
+		if _, err := ParseTTL(ci.TTL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CertificateFilter is a filter passed to FindCertificates()
+type CertificateFilter struct {
+	// SerialNumber is hexadecimal, with or without ":" separators
+	SerialNumber *string
+
+	ExpiresBefore *time.Time
+	ExpiresAfter  *time.Time
+	Revoked       *bool
+}
+
+// NormalizeSerialNumber returns a hexadecimal serial number in the form of Certificate.SerialNumber
+func NormalizeSerialNumber(serial string) string {
+	serial = strings.ToLower(strings.ReplaceAll(serial, ":", ""))
+	serial = strings.TrimLeft(serial, "0")
+	if serial == "" {
+		return "0"
+	}
+	return serial
+}
+
+// ParseTTL parses a positive duration, e.g. "24h"
+func ParseTTL(ttl string) (time.Duration, error) {
+	d, err := time.ParseDuration(ttl)
+	if err != nil || d <= 0 {
+		return 0, Errorf(ERR_INVALID, "Invalid TTL %q, must be a positive duration such as \"24h\"", ttl)
+	}
+	return d, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
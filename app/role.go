@@ -0,0 +1,268 @@
+package app
+
+import (
+	"time"
+)
+
+// Permissions that can be granted to a role
+const (
+	// PermissionAll grants every permission. It is held by the built-in Admin role and cannot be granted to custom
+	// roles.
+	PermissionAll = "*"
+
+	PermissionTenantsCreate            = "tenants.create"
+	PermissionTenantsList              = "tenants.list"
+	PermissionTenantsRead              = "tenants.read"
+	PermissionTenantsUpdate            = "tenants.update"
+	PermissionTenantsUsersList         = "tenants.users.list"
+	PermissionTenantsUsersCreate       = "tenants.users.create"
+	PermissionTenantsUsersAssignRole   = "tenants.users.assign_role"
+	PermissionTenantsUsersRemove       = "tenants.users.remove"
+	PermissionTenantsGroupsRead        = "tenants.groups.read"
+	PermissionTenantsGroupsManage      = "tenants.groups.manage"
+	PermissionTenantsKeysRead          = "tenants.keys.read"
+	PermissionTenantsKeysManage        = "tenants.keys.manage"
+	PermissionTenantsKeysUse           = "tenants.keys.use"
+	PermissionTenantsSecretsRead       = "tenants.secrets.read"
+	PermissionTenantsSecretsWrite      = "tenants.secrets.write"
+	PermissionTenantsPKIRead           = "tenants.pki.read"
+	PermissionTenantsPKIManage         = "tenants.pki.manage"
+	PermissionTenantsPKIIssue          = "tenants.pki.issue"
+	PermissionTenantsSSHRead           = "tenants.ssh.read"
+	PermissionTenantsSSHManage         = "tenants.ssh.manage"
+	PermissionTenantsSSHIssue          = "tenants.ssh.issue"
+	PermissionTenantsSSHLogin          = "tenants.ssh.login"
+	PermissionTenantsAPIKeysRead       = "tenants.apikeys.read"
+	PermissionTenantsAPIKeysManage     = "tenants.apikeys.manage"
+	PermissionTenantsAPIKeysVerify     = "tenants.apikeys.verify"
+	PermissionOwnTenantRead            = "own_tenant.read"
+	PermissionOwnTenantUpdate          = "own_tenant.update"
+	PermissionOwnTenantUsersList       = "own_tenant.users.list"
+	PermissionOwnTenantUsersCreate     = "own_tenant.users.create"
+	PermissionOwnTenantUsersAssignRole = "own_tenant.users.assign_role"
+	PermissionOwnTenantUsersRemove     = "own_tenant.users.remove"
+	PermissionOwnTenantGroupsRead      = "own_tenant.groups.read"
+	PermissionOwnTenantGroupsManage    = "own_tenant.groups.manage"
+	PermissionOwnTenantKeysRead        = "own_tenant.keys.read"
+	PermissionOwnTenantKeysManage      = "own_tenant.keys.manage"
+	PermissionOwnTenantKeysUse         = "own_tenant.keys.use"
+	PermissionOwnTenantSecretsRead     = "own_tenant.secrets.read"
+	PermissionOwnTenantSecretsWrite    = "own_tenant.secrets.write"
+	PermissionOwnTenantPKIRead         = "own_tenant.pki.read"
+	PermissionOwnTenantPKIManage       = "own_tenant.pki.manage"
+	PermissionOwnTenantPKIIssue        = "own_tenant.pki.issue"
+	PermissionOwnTenantSSHRead         = "own_tenant.ssh.read"
+	PermissionOwnTenantSSHManage       = "own_tenant.ssh.manage"
+	PermissionOwnTenantSSHIssue        = "own_tenant.ssh.issue"
+	PermissionOwnTenantSSHLogin        = "own_tenant.ssh.login"
+	PermissionOwnTenantAPIKeysRead     = "own_tenant.apikeys.read"
+	PermissionOwnTenantAPIKeysManage   = "own_tenant.apikeys.manage"
+	PermissionOwnTenantAPIKeysVerify   = "own_tenant.apikeys.verify"
+
+	// PermissionTenantsNetworkBypass exempts a user from their tenant's network (IP allowlist) restriction
+	PermissionTenantsNetworkBypass = "tenants.network.bypass"
+
+	PermissionUsersList   = "users.list"
+	PermissionUsersRead   = "users.read"
+	PermissionUsersUpdate = "users.update"
+
+	PermissionRolesList   = "roles.list"
+	PermissionRolesCreate = "roles.create"
+	PermissionRolesAssign = "roles.assign"
+
+	// PermissionElevationsList allows viewing the elevation requests of all users, rather than only one's own
+	PermissionElevationsList    = "elevations.list"
+	PermissionElevationsApprove = "elevations.approve"
+
+	// PermissionSystemUnseal and PermissionSystemSeal allow giving the master key to the server and discarding it
+	PermissionSystemUnseal = "system.unseal"
+	PermissionSystemSeal   = "system.seal"
+
+	// PermissionSystemInit and PermissionSystemRekey allow splitting the master key into shares
+	PermissionSystemInit  = "system.init"
+	PermissionSystemRekey = "system.rekey"
+)
+
+// Permissions is the list of permissions that may be granted to custom roles
+var Permissions = []string{
+	PermissionTenantsCreate,
+	PermissionTenantsList,
+	PermissionTenantsRead,
+	PermissionTenantsUpdate,
+	PermissionTenantsUsersList,
+	PermissionTenantsUsersCreate,
+	PermissionTenantsUsersAssignRole,
+	PermissionTenantsUsersRemove,
+	PermissionTenantsGroupsRead,
+	PermissionTenantsGroupsManage,
+	PermissionTenantsKeysRead,
+	PermissionTenantsKeysManage,
+	PermissionTenantsKeysUse,
+	PermissionTenantsSecretsRead,
+	PermissionTenantsSecretsWrite,
+	PermissionTenantsPKIRead,
+	PermissionTenantsPKIManage,
+	PermissionTenantsPKIIssue,
+	PermissionTenantsSSHRead,
+	PermissionTenantsSSHManage,
+	PermissionTenantsSSHIssue,
+	PermissionTenantsSSHLogin,
+	PermissionTenantsAPIKeysRead,
+	PermissionTenantsAPIKeysManage,
+	PermissionTenantsAPIKeysVerify,
+	PermissionOwnTenantRead,
+	PermissionOwnTenantUpdate,
+	PermissionOwnTenantUsersList,
+	PermissionOwnTenantUsersCreate,
+	PermissionOwnTenantUsersAssignRole,
+	PermissionOwnTenantUsersRemove,
+	PermissionOwnTenantGroupsRead,
+	PermissionOwnTenantGroupsManage,
+	PermissionOwnTenantKeysRead,
+	PermissionOwnTenantKeysManage,
+	PermissionOwnTenantKeysUse,
+	PermissionOwnTenantSecretsRead,
+	PermissionOwnTenantSecretsWrite,
+	PermissionOwnTenantPKIRead,
+	PermissionOwnTenantPKIManage,
+	PermissionOwnTenantPKIIssue,
+	PermissionOwnTenantSSHRead,
+	PermissionOwnTenantSSHManage,
+	PermissionOwnTenantSSHIssue,
+	PermissionOwnTenantSSHLogin,
+	PermissionOwnTenantAPIKeysRead,
+	PermissionOwnTenantAPIKeysManage,
+	PermissionOwnTenantAPIKeysVerify,
+	PermissionTenantsNetworkBypass,
+	PermissionUsersList,
+	PermissionUsersRead,
+	PermissionUsersUpdate,
+	PermissionRolesList,
+	PermissionRolesCreate,
+	PermissionRolesAssign,
+	PermissionElevationsList,
+	PermissionElevationsApprove,
+	PermissionSystemUnseal,
+	PermissionSystemSeal,
+	PermissionSystemInit,
+	PermissionSystemRekey,
+}
+
+// ownTenantPermissions maps tenant permissions to their equivalents restricted to the user's own tenant
+var ownTenantPermissions = map[string]string{
+	PermissionTenantsRead:            PermissionOwnTenantRead,
+	PermissionTenantsUpdate:          PermissionOwnTenantUpdate,
+	PermissionTenantsUsersList:       PermissionOwnTenantUsersList,
+	PermissionTenantsUsersCreate:     PermissionOwnTenantUsersCreate,
+	PermissionTenantsUsersAssignRole: PermissionOwnTenantUsersAssignRole,
+	PermissionTenantsUsersRemove:     PermissionOwnTenantUsersRemove,
+	PermissionTenantsGroupsRead:      PermissionOwnTenantGroupsRead,
+	PermissionTenantsGroupsManage:    PermissionOwnTenantGroupsManage,
+	PermissionTenantsKeysRead:        PermissionOwnTenantKeysRead,
+	PermissionTenantsKeysManage:      PermissionOwnTenantKeysManage,
+	PermissionTenantsKeysUse:         PermissionOwnTenantKeysUse,
+	PermissionTenantsSecretsRead:     PermissionOwnTenantSecretsRead,
+	PermissionTenantsSecretsWrite:    PermissionOwnTenantSecretsWrite,
+	PermissionTenantsPKIRead:         PermissionOwnTenantPKIRead,
+	PermissionTenantsPKIManage:       PermissionOwnTenantPKIManage,
+	PermissionTenantsPKIIssue:        PermissionOwnTenantPKIIssue,
+	PermissionTenantsSSHRead:         PermissionOwnTenantSSHRead,
+	PermissionTenantsSSHManage:       PermissionOwnTenantSSHManage,
+	PermissionTenantsSSHIssue:        PermissionOwnTenantSSHIssue,
+	PermissionTenantsSSHLogin:        PermissionOwnTenantSSHLogin,
+	PermissionTenantsAPIKeysRead:     PermissionOwnTenantAPIKeysRead,
+	PermissionTenantsAPIKeysManage:   PermissionOwnTenantAPIKeysManage,
+	PermissionTenantsAPIKeysVerify:   PermissionOwnTenantAPIKeysVerify,
+}
+
+// Role is a named set of permissions
+type Role struct {
+	ID          string
+	Name        string
+	Description string
+	Permissions []string
+
+	// Builtin roles are created by migrations
+	Builtin bool
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// RoleCreateInput is a set of fields to define a new role for CreateRole()
+type RoleCreateInput struct {
+	Name        string
+	Description string
+	Permissions []string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (rc *RoleCreateInput) Validate() error {
+	if rc.Name == "" {
+		return Errorf(ERR_INVALID, "Role name is required")
+	}
+	for _, p := range rc.Permissions {
+		if !isPermission(p) {
+			return Errorf(ERR_INVALID, "Unknown permission %q", p)
+		}
+	}
+	return nil
+}
+
+// RoleFilter is a filter passed to FindRoles()
+type RoleFilter struct {
+	// Filtering fields.
+	Name *string
+
+	// Restrict to subset of results.
+	Offset int
+	Limit  int
+}
+
+// UserRoleAssignInput is the role to assign to a user via AssignUserRole()
+type UserRoleAssignInput struct {
+	RoleID string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (ra *UserRoleAssignInput) Validate() error {
+	if ra.RoleID == "" {
+		return Errorf(ERR_INVALID, "RoleID is required")
+	}
+	return nil
+}
+
+// HasPermission returns true if the permission list grants the given permission
+func HasPermission(permissions []string, permission string) bool {
+	for _, p := range permissions {
+		if p == permission || p == PermissionAll {
+			return true
+		}
+	}
+	return false
+}
+
+// OwnTenantPermission returns the permission granting the given tenant permission on the user's own tenant only,
+// or an empty string if there is none
+func OwnTenantPermission(permission string) string {
+	return ownTenantPermissions[permission]
+}
+
+// IsOwnTenantPermission returns true if the permission applies to the user's own tenant only
+func IsOwnTenantPermission(permission string) bool {
+	for _, p := range ownTenantPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func isPermission(permission string) bool {
+	for _, p := range Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
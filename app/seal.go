@@ -0,0 +1,83 @@
+package app
+
+// SealStatus reports whether the server holds the master key. While sealed, tenant key operations are refused.
+type SealStatus struct {
+	Sealed bool
+
+	// Provider is the configured source of the master key
+	Provider string
+
+	// Initialized is true once a master key is in use
+	Initialized bool
+
+	// Threshold is the number of the ShareCount shares of the master key needed to unseal, or 0 if the master key
+	// is not split into shares. Progress is the number of shares given so far.
+	ShareCount int
+	Threshold  int
+	Progress   int
+}
+
+// UnsealInput is the master key, base64 encoded, the passphrase it is derived from, or one base64-encoded share of
+// it
+type UnsealInput struct {
+	Key        string
+	Passphrase string
+	Share      string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (ui *UnsealInput) Validate() error {
+	n := 0
+	for _, v := range []string{ui.Key, ui.Passphrase, ui.Share} {
+		if v != "" {
+			n++
+		}
+	}
+	if n != 1 {
+		return Errorf(ERR_INVALID, "One of Key, Passphrase or Share is required")
+	}
+	return nil
+}
+
+// MasterKeySharesInput is the number of shares to split the master key into, and the number needed to unseal
+type MasterKeySharesInput struct {
+	ShareCount int
+	Threshold  int
+}
+
+// Validate returns an error if the struct contains invalid information
+func (mi *MasterKeySharesInput) Validate() error {
+	if mi.Threshold < 2 || mi.Threshold > mi.ShareCount || mi.ShareCount > 255 {
+		return Errorf(ERR_INVALID, "Threshold must be at least 2, and no more than ShareCount, which is at most 255")
+	}
+	return nil
+}
+
+// MasterKeyShares are the base64-encoded shares of the master key. They are returned only once, to be distributed
+// to the operators.
+type MasterKeyShares struct {
+	Shares    []string
+	Threshold int
+}
+
+// ShareInput is one base64-encoded share of the master key
+type ShareInput struct {
+	Share string
+}
+
+// RekeyStatus reports the progress of splitting the master key into a new set of shares. The master key, and so
+// all data, is unchanged.
+type RekeyStatus struct {
+	Started bool
+
+	// ShareCount and Threshold are those of the new share set
+	ShareCount int
+	Threshold  int
+
+	// Progress is the number of current shares given so far, of the Required number
+	Progress int
+	Required int
+
+	// Shares are the new shares, returned once when the rekey completes
+	Shares []string
+}
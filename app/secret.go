@@ -0,0 +1,88 @@
+package app
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxSecretPathLength is the longest path of a secret
+const maxSecretPathLength = 256
+
+// secretPathSegmentPattern restricts each "/"-separated segment of a secret path
+var secretPathSegmentPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Secret is a set of key/value pairs stored encrypted at a path within a tenant, e.g. "billing/stripe". Every write
+// creates a new, immutable version.
+type Secret struct {
+	ID             string
+	TenantID       string
+	Path           string
+	CurrentVersion int
+	Versions       []SecretVersion
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// SecretVersion describes one version of a secret, without its data
+type SecretVersion struct {
+	Version     int
+	CreatedByID string
+
+	// RolledBackFrom is the earlier version this version restored, if any
+	RolledBackFrom int
+
+	CreatedAt time.Time
+}
+
+// SecretData is the decrypted data of a version of a secret
+type SecretData struct {
+	Path    string
+	Version int
+	Data    map[string]string
+}
+
+// SecretWriteInput is the data of a new version of a secret, for WriteSecret()
+type SecretWriteInput struct {
+	Data map[string]string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (sw *SecretWriteInput) Validate() error {
+	if len(sw.Data) == 0 {
+		return Errorf(ERR_INVALID, "Data is required")
+	}
+	for k := range sw.Data {
+		if k == "" {
+			return Errorf(ERR_INVALID, "Data keys cannot be empty")
+		}
+	}
+	return nil
+}
+
+// SecretRollbackInput is the earlier version of a secret to restore as a new version, for RollbackSecret()
+type SecretRollbackInput struct {
+	Version int
+}
+
+// Validate returns an error if the struct contains invalid information
+func (sr *SecretRollbackInput) Validate() error {
+	if sr.Version < 1 {
+		return Errorf(ERR_INVALID, "Version is required")
+	}
+	return nil
+}
+
+// ValidateSecretPath returns an error unless the path is one or more "/"-separated segments of letters, digits,
+// '.', '-' or '_'
+func ValidateSecretPath(path string) error {
+	if path == "" || len(path) > maxSecretPathLength {
+		return Errorf(ERR_INVALID, "Secret path must be 1 to %d characters", maxSecretPathLength)
+	}
+	for _, segment := range strings.Split(path, "/") {
+		if !secretPathSegmentPattern.MatchString(segment) || segment == "." || segment == ".." {
+			return Errorf(ERR_INVALID, "Invalid secret path %q", path)
+		}
+	}
+	return nil
+}
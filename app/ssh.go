@@ -0,0 +1,154 @@
+package app
+
+import (
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SSH certificate validity. User certificates are short-lived, so that they need no revocation.
+const (
+	DefaultSSHUserCertificateTTL = time.Hour
+	MaxSSHUserCertificateTTL     = 12 * time.Hour
+	DefaultSSHHostCertificateTTL = 30 * 24 * time.Hour
+	MaxSSHHostCertificateTTL     = 365 * 24 * time.Hour
+)
+
+// hostnamePattern matches a DNS name or an IP address, as a host certificate principal
+var hostnamePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.:-]{0,251}[A-Za-z0-9])?$`)
+
+// principalSeparators are the runs of characters replaced by "-" when deriving a principal from a role name
+var principalSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+
+// SSHCertificateAuthority is the SSH CA of a tenant. Its private key is never exposed.
+type SSHCertificateAuthority struct {
+	ID       string
+	TenantID string
+
+	// PublicKey is in authorized_keys format, for the TrustedUserCAKeys file of sshd or a @cert-authority line in
+	// known_hosts
+	PublicKey string
+
+	// AllowedHostDomains are the DNS names host certificates may be issued for. "*.example.com" allows any subdomain
+	// of example.com.
+	AllowedHostDomains []string
+
+	// AllowHostIPs allows IP addresses as host certificate principals
+	AllowHostIPs bool
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// AllowsHost returns true if a host certificate may be issued for the host name or IP address
+func (ca SSHCertificateAuthority) AllowsHost(name string) bool {
+	if net.ParseIP(name) != nil {
+		return ca.AllowHostIPs
+	}
+	return domainAllowed(name, ca.AllowedHostDomains)
+}
+
+// SSHCAInput is the policy of an SSH CA for issuing host certificates. Host certificates are refused until
+// AllowedHostDomains or AllowHostIPs allows their host names.
+type SSHCAInput struct {
+	AllowedHostDomains []string
+	AllowHostIPs       bool
+}
+
+// Validate returns an error if the struct contains invalid information
+func (sc *SSHCAInput) Validate() error {
+	for _, d := range sc.AllowedHostDomains {
+		if !domainPatternPattern.MatchString(d) {
+			return Errorf(ERR_INVALID, "Invalid domain %q, must be a DNS name, optionally starting with \"*.\"", d)
+		}
+	}
+	if sc.AllowedHostDomains == nil {
+		sc.AllowedHostDomains = []string{}
+	}
+	return nil
+}
+
+// SSHCertificate is a certificate signed by a tenant SSH CA
+type SSHCertificate struct {
+	// Certificate is in authorized_keys format, for saving as the "-cert.pub" file of the key
+	Certificate string
+
+	Serial      uint64
+	KeyID       string
+	Principals  []string
+	ValidAfter  time.Time
+	ValidBefore time.Time
+}
+
+// SSHUserCertificateInput is a public key, in authorized_keys format, to certify for the current user. The
+// principals are derived from the user's role in the tenant, and the roles of the user's groups. TTL defaults to
+// DefaultSSHUserCertificateTTL.
+type SSHUserCertificateInput struct {
+	PublicKey string
+	TTL       string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (su *SSHUserCertificateInput) Validate() error {
+	if strings.TrimSpace(su.PublicKey) == "" {
+		return Errorf(ERR_INVALID, "PublicKey is required")
+	}
+	_, err := su.Duration()
+	return err
+}
+
+// Duration returns the validity of the certificate
+func (su *SSHUserCertificateInput) Duration() (time.Duration, error) {
+	return sshCertificateTTL(su.TTL, DefaultSSHUserCertificateTTL, MaxSSHUserCertificateTTL)
+}
+
+// SSHHostCertificateInput is a host public key, in authorized_keys format, to certify for the given host names, which
+// the SSH CA must allow. TTL defaults to DefaultSSHHostCertificateTTL.
+type SSHHostCertificateInput struct {
+	PublicKey string
+	Hostnames []string
+	TTL       string
+}
+
+// Validate returns an error if the struct contains invalid information
+func (sh *SSHHostCertificateInput) Validate() error {
+	if strings.TrimSpace(sh.PublicKey) == "" {
+		return Errorf(ERR_INVALID, "PublicKey is required")
+	}
+	if len(sh.Hostnames) == 0 {
+		return Errorf(ERR_INVALID, "Hostnames is required")
+	}
+	for _, h := range sh.Hostnames {
+		if !hostnamePattern.MatchString(h) {
+			return Errorf(ERR_INVALID, "Invalid hostname %q", h)
+		}
+	}
+	_, err := sh.Duration()
+	return err
+}
+
+// Duration returns the validity of the certificate
+func (sh *SSHHostCertificateInput) Duration() (time.Duration, error) {
+	return sshCertificateTTL(sh.TTL, DefaultSSHHostCertificateTTL, MaxSSHHostCertificateTTL)
+}
+
+// SSHPrincipal returns the SSH user certificate principal granted by a tenant role, which is the role name in lower
+// case with other characters replaced by "-", e.g. "tenant-admin" for "Tenant Admin"
+func SSHPrincipal(role string) string {
+	return strings.Trim(principalSeparators.ReplaceAllString(strings.ToLower(role), "-"), "-")
+}
+
+func sshCertificateTTL(ttl string, def, max time.Duration) (time.Duration, error) {
+	if ttl == "" {
+		return def, nil
+	}
+	d, err := ParseTTL(ttl)
+	if err != nil {
+		return 0, err
+	}
+	if d > max {
+		return 0, Errorf(ERR_INVALID, "TTL must not be longer than %s", max)
+	}
+	return d, nil
+}
@@ -1,6 +1,8 @@
 package app
 
 import (
+	"net"
+	"net/url"
 	"time"
 )
 
@@ -8,11 +10,14 @@ const minTenantNameLength = 3
 
 // Tenant is the full model that identifies an app Tenant
 type Tenant struct {
-	ID        string
-	Name      string
-	UserIDs   []string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID             string
+	Name           string
+	UserIDs        []string
+	Members        []TenantMembership
+	AllowedOrigins []string
+	AllowedCIDRs   []string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
 }
 
 // TenantCreateInput is a set of fields to define a new tenant for CreateTenant()
@@ -45,6 +50,13 @@ type TenantFilter struct {
 // TenantUpdateInput is a set of fields to be updated via UpdateTenant()
 type TenantUpdateInput struct {
 	Name *string
+
+	// AllowedOrigins are the web origins (e.g. "https://app.example.com") allowed to call the tenant's API routes
+	// from a browser
+	AllowedOrigins *[]string
+
+	// AllowedCIDRs are the networks (e.g. "203.0.113.0/24") tenant users may access the API from. Empty allows any.
+	AllowedCIDRs *[]string
 }
 
 // Validate returns an error if the struct contains invalid information
@@ -55,10 +67,31 @@ func (tu *TenantUpdateInput) Validate() error {
 	if tu.Name != nil && len(*tu.Name) < minTenantNameLength {
 		return Errorf(ERR_INVALID, "Tenant name must be at least %d characters", minTenantNameLength)
 	}
+	if tu.AllowedOrigins != nil {
+		for _, o := range *tu.AllowedOrigins {
+			if !isOrigin(o) {
+				return Errorf(ERR_INVALID, "Invalid origin %q, must be in the form scheme://host[:port]", o)
+			}
+		}
+	}
+	if tu.AllowedCIDRs != nil {
+		for _, cidr := range *tu.AllowedCIDRs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return Errorf(ERR_INVALID, "Invalid CIDR %q, must be in the form 203.0.113.0/24", cidr)
+			}
+		}
+	}
 	return nil
 }
 
-// TenantUserCreateInput is a set of fields to define a new tenant user for tenantsUsersCreateHandler
-type TenantUserCreateInput struct {
-	Email string
+// isOrigin returns true if s is a web origin, i.e. a URL with only a scheme, host, and optional port
+func isOrigin(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	return u.Host != "" && u.User == nil && u.Path == "" && u.RawQuery == "" && u.Fragment == ""
 }
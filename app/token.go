@@ -11,8 +11,9 @@ type Token struct {
 	User   User
 	UserID string
 
-	AuthID    string
-	PlainText string
+	AuthID        string
+	AuthSessionID string
+	PlainText     string
 
 	LastUsedAt *time.Time
 	ExpiresAt  time.Time
@@ -21,9 +22,10 @@ type Token struct {
 }
 
 type TokenCreateInput struct {
-	UserID    string
-	AuthID    string
-	ExpiresAt time.Time
+	UserID        string
+	AuthID        string
+	AuthSessionID string
+	ExpiresAt     time.Time
 }
 
 // Validate returns an error if the struct contains invalid information
@@ -38,8 +40,9 @@ func (tc *TokenCreateInput) Validate() error {
 }
 
 type TokenUpdateInput struct {
-	ExpiresAt  *time.Time
-	LastUsedAt *time.Time
+	ExpiresAt      *time.Time
+	LastUsedAt     *time.Time
+	ActiveTenantID *string
 }
 
 // Validate returns an error if the struct contains invalid information
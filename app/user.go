@@ -4,9 +4,11 @@ import (
 	"time"
 )
 
+// Names of the built-in roles
 const (
-	UserRoleBasic = "Basic"
-	UserRoleAdmin = "Admin"
+	UserRoleBasic       = "Basic"
+	UserRoleAdmin       = "Admin"
+	UserRoleTenantAdmin = "Tenant Admin"
 )
 
 // UserFilter is a filter passed to FindUsers()
@@ -22,13 +24,24 @@ type UserFilter struct {
 
 // User is the full model that identifies an app User
 type User struct {
-	ID          string
-	FirstName   string
-	LastName    string
-	Email       string
-	AvatarURL   string
-	Role        string
+	ID        string
+	FirstName string
+	LastName  string
+	Email     string
+	AvatarURL string
+	Role      string
+	RoleID    string
+
+	// Permissions are granted by the user's role and by any active elevations
+	Permissions []string
+
+	// Elevations are the user's active elevations
+	Elevations []Elevation
+
+	// TenantID is the active tenant: the tenant selected for the current session, or else the user's first tenant
 	TenantID    string
+	Memberships []TenantMembership
+
 	LastLoginAt *time.Time
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
@@ -40,8 +53,13 @@ type UserCreateInput struct {
 	LastName  string
 	Email     string
 	AvatarURL string
-	Role      string
-	TenantID  string
+
+	// Role is the name of the user's global role. Defaults to UserRoleBasic.
+	Role string
+
+	// TenantID optionally adds the new user to a tenant, with the membership role named by TenantRole
+	TenantID   string
+	TenantRole string
 }
 
 // Validate returns an error if the struct contains invalid information
@@ -66,3 +84,45 @@ func (uu *UserUpdateInput) Validate() error {
 	}
 	return nil
 }
+
+// HasPermission returns true if the user's role, or an active elevation, grants the given permission
+func (u User) HasPermission(permission string) bool {
+	return HasPermission(u.Permissions, permission)
+}
+
+// HasTenantPermission returns true if the user's global role grants the given permission, or if the user is a
+// member of the given tenant and the membership role grants its own-tenant equivalent
+func (u User) HasTenantPermission(tenantID, permission string) bool {
+	if u.HasPermission(permission) {
+		return true
+	}
+	own := OwnTenantPermission(permission)
+	if own == "" {
+		return false
+	}
+	m, ok := u.Membership(tenantID)
+	return ok && HasPermission(m.Permissions, own)
+}
+
+// HasRole returns true if the given role is the user's global role, or is held through an active elevation
+func (u User) HasRole(name string) bool {
+	if u.Role == name {
+		return true
+	}
+	for _, e := range u.Elevations {
+		if e.Role == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Membership returns the user's membership in the given tenant, if any
+func (u User) Membership(tenantID string) (TenantMembership, bool) {
+	for _, m := range u.Memberships {
+		if m.TenantID == tenantID {
+			return m, true
+		}
+	}
+	return TenantMembership{}, false
+}
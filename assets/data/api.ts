@@ -13,6 +13,7 @@ type Method = 'delete' | 'get' | 'put' | 'post'
 const call = async (method: Method, urlPath: string, data = null, showError = true): Promise<Response> => {
   const headers = {
     'Content-Type': 'application/json',
+    'X-CSRF-Token': getCookie('_csrf'),
   }
 
   const response = await fetch(urlPath, {
@@ -32,6 +33,16 @@ const call = async (method: Method, urlPath: string, data = null, showError = tr
   return response
 }
 
+/**
+ * @param name -- The cookie name (e.g. '_csrf')
+ * @returns The cookie value, or an empty string if the cookie is not set
+ */
+const getCookie = (name: string): string => {
+  const prefix = name + '='
+  const cookie = document.cookie.split('; ').find((c) => c.startsWith(prefix))
+  return cookie ? decodeURIComponent(cookie.substring(prefix.length)) : ''
+}
+
 /**
  * @throws {ResponseError}
  */
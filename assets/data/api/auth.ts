@@ -1,5 +1,6 @@
 import api from 'data/api'
 import type {AuthStatus} from '../types/auth'
+import type {User} from '../types/user'
 import { writable } from 'svelte/store'
 
 export const authStatus = writable({} as AuthStatus)
@@ -22,3 +23,8 @@ export const getAuthStatus = async (): Promise<AuthStatus> => {
     });
   }
 }
+
+export const switchTenant = async (tenantID: string): Promise<User> => {
+  const response = await api.put('/api/auth/tenant', {TenantID: tenantID})
+  return response.json()
+}
@@ -1,4 +1,4 @@
-import type {Tenant, TenantCreate, TenantUserCreate} from 'data/types/tenant'
+import type {Invitation, InvitationCreate, Tenant, TenantCreate, TenantMembership, TenantUpdate} from 'data/types/tenant'
 import api from '../api'
 
 // TODO: cache tenant list
@@ -21,10 +21,36 @@ export const getTenant = async (id: string): Promise<Tenant> => {
   return response.json()
 }
 
-export const addTenantUser = async (tenantID: string, email: string): Promise<Tenant> => {
-  const body: TenantUserCreate = {
+export const updateTenant = async (id: string, input: TenantUpdate): Promise<Tenant> => {
+  const response = await api.put('/api/tenants/'+encodeURIComponent(id), input)
+  return response.json()
+}
+
+export const inviteTenantUser = async (tenantID: string, email: string): Promise<Invitation> => {
+  const body: InvitationCreate = {
     Email: email,
   }
-  const response = await api.post('/api/tenants/'+encodeURIComponent(tenantID)+'/users', body)
+  const response = await api.post('/api/tenants/'+encodeURIComponent(tenantID)+'/invitations', body)
+  return response.json()
+}
+
+export const listInvitations = async (tenantID: string): Promise<Invitation[]> => {
+  const response = await api.get('/api/tenants/'+encodeURIComponent(tenantID)+'/invitations')
+  return response.json()
+}
+
+export const resendInvitation = async (tenantID: string, id: string): Promise<Invitation> => {
+  const response = await api.post('/api/tenants/'+encodeURIComponent(tenantID)+'/invitations/'+
+    encodeURIComponent(id)+'/resend')
+  return response.json()
+}
+
+export const revokeInvitation = async (tenantID: string, id: string): Promise<Invitation> => {
+  const response = await api.remove('/api/tenants/'+encodeURIComponent(tenantID)+'/invitations/'+encodeURIComponent(id))
+  return response.json()
+}
+
+export const acceptInvitation = async (token: string): Promise<TenantMembership> => {
+  const response = await api.post('/api/invitations/accept', {Token: token})
   return response.json()
 }
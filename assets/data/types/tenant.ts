@@ -1,14 +1,69 @@
 export type Tenant = {
+  AllowedOrigins: string[]
   CreatedAt: string //date
   ID: string
+  Members: TenantMembership[]
   Name: string
   UpdatedAt: string //date
+  UserIDs: string[]
+}
+
+export type TenantMembership = {
+  CreatedAt: string //date
+  GroupIDs: string[]
+  ID: string
+  Permissions: string[]
+  Role: string
+  RoleID: string
+  TenantID: string
+  TenantName: string
+  UpdatedAt: string //date
+  UserEmail: string
+  UserID: string
+}
+
+export type TenantUpdate = {
+  Name?: string
+  AllowedOrigins?: string[]
 }
 
 export type TenantCreate = {
   Name: string
 }
 
-export type TenantUserCreate = {
+export type InvitationCreate = {
   Email: string
+  RoleID?: string
+}
+
+export type Invitation = {
+  AcceptedAt?: string //date
+  AcceptedByID: string
+  CreatedAt: string //date
+  Email: string
+  ExpiresAt: string //date
+  ID: string
+  InviterID: string
+  RevokedAt?: string //date
+  Role: string
+  RoleID: string
+  SentAt: string //date
+  Status: 'pending' | 'accepted' | 'revoked' | 'expired'
+  TenantID: string
+  TenantName: string
+  UpdatedAt: string //date
+}
+
+export type Group = {
+  CreatedAt: string //date
+  Description: string
+  ID: string
+  MemberIDs: string[]
+  Name: string
+  ParentID: string
+  Permissions: string[]
+  Role: string
+  RoleID: string
+  TenantID: string
+  UpdatedAt: string //date
 }
@@ -1,3 +1,5 @@
+import type {TenantMembership} from './tenant'
+
 export type User = {
   AvatarURL: string
   CreatedAt: string //date
@@ -8,7 +10,31 @@ export type User = {
   UpdatedAt: string //date
   LastName: string
   Role: string
+  RoleID: string
+  Permissions: string[]
   TenantID: string
+  Memberships: TenantMembership[]
+  Elevations: Elevation[]
+}
+
+export type Elevation = {
+  ID: string
+  UserID: string
+  UserEmail: string
+  RoleID: string
+  Role: string
+  Hours: number
+  Justification: string
+  Status: 'pending' | 'active' | 'expired' | 'denied' | 'revoked'
+  ApproverID: string
+  DecisionNote: string
+  ApprovedAt: string //date
+  DeniedAt: string //date
+  ExpiresAt: string //date
+  RevokedAt: string //date
+  RevokerID: string
+  CreatedAt: string //date
+  UpdatedAt: string //date
 }
 
 export type UserUpdateInput = {
@@ -17,6 +43,9 @@ export type UserUpdateInput = {
   LastName: string
 }
 
-export const isAdmin = (user: User) => user.Role == Admin
+export const hasPermission = (user: User, permission: string) =>
+  !!user.Permissions?.some(p => p == permission || p == PermissionAll)
+
+export const isAdmin = (user: User) => hasPermission(user, PermissionAll)
 
-const Admin = 'Admin'
+const PermissionAll = '*'
@@ -0,0 +1,140 @@
+// Package cache implements an in-process LRU cache whose entries expire
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU is a cache of at most a fixed number of entries, which evicts the least recently used entry when full.
+// Entries expire after a TTL. A negative entry records that a key has no value, e.g. that a lookup found nothing,
+// and expires after its own TTL. An LRU is safe for concurrent use.
+type LRU[K comparable, V any] struct {
+	mu          sync.Mutex
+	size        int
+	ttl         time.Duration
+	negativeTTL time.Duration
+	entries     map[K]*list.Element
+
+	// order holds the entries, most recently used first
+	order *list.List
+
+	// now returns the current time, and may be replaced for tests
+	now func() time.Time
+}
+
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	negative  bool
+	expiresAt time.Time
+}
+
+// NewLRU returns an empty LRU of the given size. Values expire after ttl, and negative entries after negativeTTL.
+func NewLRU[K comparable, V any](size int, ttl, negativeTTL time.Duration) *LRU[K, V] {
+	return &LRU[K, V]{
+		size:        size,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		entries:     make(map[K]*list.Element, size),
+		order:       list.New(),
+		now:         time.Now,
+	}
+}
+
+// Get returns the cached value of a key. ok is false if the key is not cached or its entry has expired, and found
+// is false if the entry is negative.
+func (c *LRU[K, V]) Get(key K) (value V, found, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return value, false, false
+	}
+	e := el.Value.(*entry[K, V])
+	if !c.now().Before(e.expiresAt) {
+		c.remove(el)
+		return value, false, false
+	}
+	c.order.MoveToFront(el)
+	return e.value, !e.negative, true
+}
+
+// Add caches the value of a key for the TTL
+func (c *LRU[K, V]) Add(key K, value V) {
+	c.AddUntil(key, value, time.Time{})
+}
+
+// AddUntil caches the value of a key for the TTL, or until expiresAt if that is sooner, e.g. when the value itself
+// expires. A zero expiresAt is ignored.
+func (c *LRU[K, V]) AddUntil(key K, value V, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	until := c.now().Add(c.ttl)
+	if !expiresAt.IsZero() && expiresAt.Before(until) {
+		until = expiresAt
+	}
+	c.add(&entry[K, V]{key: key, value: value, expiresAt: until})
+}
+
+// AddNegative caches that a key has no value, for the negative TTL
+func (c *LRU[K, V]) AddNegative(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.add(&entry[K, V]{key: key, negative: true, expiresAt: c.now().Add(c.negativeTTL)})
+}
+
+// Remove drops the entry of a key, if any
+func (c *LRU[K, V]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+}
+
+// Purge drops all entries
+func (c *LRU[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[K]*list.Element, c.size)
+	c.order.Init()
+}
+
+// Len returns the number of entries, including any that have expired but not yet been dropped
+func (c *LRU[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *LRU[K, V]) add(e *entry[K, V]) {
+	if !c.now().Before(e.expiresAt) {
+		// already expired, but an older entry of the key must not outlive it
+		if el, ok := c.entries[e.key]; ok {
+			c.remove(el)
+		}
+		return
+	}
+	if el, ok := c.entries[e.key]; ok {
+		el.Value = e
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[e.key] = c.order.PushFront(e)
+	if c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *LRU[K, V]) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*entry[K, V]).key)
+}
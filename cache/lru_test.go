@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRU(t *testing.T) {
+	now := time.Now()
+	c := NewLRU[string, int](2, time.Minute, 10*time.Second)
+	c.now = func() time.Time { return now }
+
+	_, _, ok := c.Get("a")
+	require.False(t, ok)
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+	v, found, ok := c.Get("a")
+	require.True(t, ok)
+	require.True(t, found)
+	require.Equal(t, 1, v)
+
+	c.Add("c", 3)
+	_, _, ok = c.Get("b")
+	require.False(t, ok, "the least recently used entry is evicted")
+	require.Equal(t, 2, c.Len())
+
+	c.AddNegative("d")
+	_, found, ok = c.Get("d")
+	require.True(t, ok)
+	require.False(t, found, "a negative entry is cached without a value")
+
+	now = now.Add(10 * time.Second)
+	_, _, ok = c.Get("d")
+	require.False(t, ok, "negative entries expire after the negative TTL")
+	_, _, ok = c.Get("c")
+	require.True(t, ok)
+
+	now = now.Add(50 * time.Second)
+	_, _, ok = c.Get("c")
+	require.False(t, ok, "entries expire after the TTL")
+
+	c.AddUntil("e", 5, now.Add(time.Second))
+	now = now.Add(time.Second)
+	_, _, ok = c.Get("e")
+	require.False(t, ok, "an entry expires with its value")
+
+	c.Add("f", 6)
+	c.AddUntil("f", 7, now)
+	_, _, ok = c.Get("f")
+	require.False(t, ok, "an expired value replaces the cached one")
+
+	c.Add("g", 7)
+	c.Remove("g")
+	_, _, ok = c.Get("g")
+	require.False(t, ok)
+
+	c.Add("h", 8)
+	c.Purge()
+	require.Equal(t, 0, c.Len())
+}
+
+func BenchmarkLRU_Get(b *testing.B) {
+	c := NewLRU[string, int](1000, time.Minute, time.Minute)
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		c.Add(keys[i], i)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			c.Get(keys[i%len(keys)])
+			i++
+		}
+	})
+}
@@ -0,0 +1,125 @@
+// Command unseal gives the master key, the passphrase it is derived from, or one share of it, to a sealed keygo
+// server. The key is read from standard input rather than the command line, so that it stays out of the shell
+// history and process list. Authenticate with the bearer token of a user allowed to unseal, in KEYGO_TOKEN.
+//
+//	unseal [-url http://localhost:1323] [-passphrase | -share] < key
+//	unseal -status
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/briskt/keygo/app"
+)
+
+func main() {
+	url := flag.String("url", os.Getenv("HOST"), "base URL of the keygo server")
+	passphrase := flag.Bool("passphrase", false, "read a passphrase rather than a base64-encoded key")
+	share := flag.Bool("share", false, "read one base64-encoded share of the master key rather than the key")
+	status := flag.Bool("status", false, "only report whether the server is sealed")
+	flag.Parse()
+
+	token := os.Getenv("KEYGO_TOKEN")
+	if *url == "" || token == "" {
+		fmt.Fprintln(os.Stderr, "the server URL (-url or HOST) and KEYGO_TOKEN are required")
+		os.Exit(2)
+	}
+
+	var err error
+	var sealStatus app.SealStatus
+	if *status {
+		err = call(http.MethodGet, *url+"/api/sys/seal-status", token, nil, &sealStatus)
+	} else {
+		var input app.UnsealInput
+		if *passphrase && *share {
+			fmt.Fprintln(os.Stderr, "-passphrase and -share cannot be used together")
+			os.Exit(2)
+		}
+		if input, err = readInput(os.Stdin, *passphrase, *share); err == nil {
+			err = call(http.MethodPost, *url+"/api/sys/unseal", token, input, &sealStatus)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	switch {
+	case sealStatus.Sealed && sealStatus.Progress > 0:
+		fmt.Printf("unseal progress %d/%d\n", sealStatus.Progress, sealStatus.Threshold)
+	case sealStatus.Sealed:
+		fmt.Println("sealed")
+	default:
+		fmt.Println("unsealed")
+	}
+}
+
+// readInput reads the key, passphrase or share from the first line of r
+func readInput(r io.Reader, passphrase, share bool) (app.UnsealInput, error) {
+	if f, ok := r.(*os.File); ok {
+		if fi, err := f.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+			switch {
+			case passphrase:
+				fmt.Fprint(os.Stderr, "passphrase: ")
+			case share:
+				fmt.Fprint(os.Stderr, "share: ")
+			default:
+				fmt.Fprint(os.Stderr, "key: ")
+			}
+		}
+	}
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return app.UnsealInput{}, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return app.UnsealInput{}, fmt.Errorf("no key given")
+	}
+	if passphrase {
+		return app.UnsealInput{Passphrase: line}, nil
+	}
+	if share {
+		return app.UnsealInput{Share: line}, nil
+	}
+	return app.UnsealInput{Key: line}, nil
+}
+
+func call(method, url, token string, input, output any) error {
+	var body io.Reader
+	if input != nil {
+		j, err := json.Marshal(input)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(j)
+	}
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(b)))
+	}
+	return json.Unmarshal(b, output)
+}
@@ -0,0 +1,358 @@
+package db
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"github.com/briskt/keygo/app"
+)
+
+// apiKeyPrefix starts every API key, so that leaked keys are easy to recognize
+const apiKeyPrefix = "kgk_"
+
+// apiKeyDisplayLength is the length of the start of a key that is stored in the clear, including apiKeyPrefix
+const apiKeyDisplayLength = 12
+
+// APIKeyType is a kind of API key that a tenant issues to its customers
+type APIKeyType struct {
+	ID          string `gorm:"primaryKey;type:string"`
+	TenantID    string
+	Name        string
+	Description string
+	Metadata    stringMap `gorm:"type:jsonb"`
+	TTL         string    `gorm:"column:ttl"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (APIKeyType) TableName() string {
+	return "api_key_types"
+}
+
+func (t *APIKeyType) BeforeCreate(_ *gorm.DB) error {
+	t.ID = newID()
+	return nil
+}
+
+// APIKey is a key issued by a tenant to a customer. Like a Token, only its hash is stored.
+type APIKey struct {
+	ID         string `gorm:"primaryKey;type:string"`
+	TenantID   string
+	TypeID     string
+	Type       APIKeyType
+	Name       string
+	Prefix     string
+	Hash       string
+	PlainText  string    `gorm:"-"`
+	Metadata   stringMap `gorm:"type:jsonb"`
+	ExpiresAt  *time.Time
+	RevokedAt  *time.Time
+	IssuedByID *string
+	CreatedAt  time.Time
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+func (k *APIKey) BeforeCreate(_ *gorm.DB) error {
+	k.ID = newID()
+	return nil
+}
+
+// stringMap is a map of strings stored as a JSON object
+type stringMap map[string]string
+
+func (m stringMap) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(map[string]string(m))
+	return string(b), err
+}
+
+func (m *stringMap) Scan(value any) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, m)
+	case string:
+		return json.Unmarshal([]byte(v), m)
+	case nil:
+		*m = stringMap{}
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into a string map", value)
+}
+
+// FindAPIKeyTypes retrieves the API key types of a tenant, ordered by name
+func FindAPIKeyTypes(ctx echo.Context, tenantID string) ([]APIKeyType, error) {
+	var types []APIKeyType
+	result := Tx(ctx).Where("tenant_id = ?", tenantID).Order("name").Find(&types)
+	return types, result.Error
+}
+
+// FindAPIKeyTypeByName retrieves an API key type of a tenant by name
+func FindAPIKeyTypeByName(ctx echo.Context, tenantID, name string) (APIKeyType, error) {
+	var keyType APIKeyType
+	result := Tx(ctx).First(&keyType, "tenant_id = ? AND name = ?", tenantID, name)
+	return keyType, result.Error
+}
+
+// CreateAPIKeyType creates an API key type in a tenant
+func CreateAPIKeyType(ctx echo.Context, tenantID string, input app.APIKeyTypeInput) (APIKeyType, error) {
+	if err := input.Validate(); err != nil {
+		return APIKeyType{}, err
+	}
+
+	var count int64
+	err := Tx(ctx).Model(&APIKeyType{}).Where("tenant_id = ? AND name = ?", tenantID, input.Name).Count(&count).Error
+	if err != nil {
+		return APIKeyType{}, err
+	}
+	if count > 0 {
+		return APIKeyType{}, app.Errorf(app.ERR_INVALID, "An API key type named %q already exists", input.Name)
+	}
+
+	keyType := APIKeyType{
+		TenantID:    tenantID,
+		Name:        input.Name,
+		Description: input.Description,
+		Metadata:    input.Metadata,
+		TTL:         input.TTL,
+	}
+	if err = Tx(ctx).Create(&keyType).Error; err != nil {
+		return APIKeyType{}, err
+	}
+	return keyType, nil
+}
+
+// UpdateAPIKeyType replaces the description, metadata and TTL of an API key type. The new metadata applies to keys
+// already issued, but their expiry is unaffected.
+func UpdateAPIKeyType(ctx echo.Context, tenantID, name string, input app.APIKeyTypeInput) (APIKeyType, error) {
+	input.Name = name
+	if err := input.Validate(); err != nil {
+		return APIKeyType{}, err
+	}
+	keyType, err := FindAPIKeyTypeByName(ctx, tenantID, name)
+	if err != nil {
+		return APIKeyType{}, err
+	}
+
+	err = Tx(ctx).Model(&keyType).Updates(map[string]any{
+		"description": input.Description,
+		"metadata":    stringMap(input.Metadata),
+		"ttl":         input.TTL,
+		"updated_at":  time.Now(),
+	}).Error
+	if err != nil {
+		return APIKeyType{}, err
+	}
+
+	// cached verifications include the previous metadata
+	if err = invalidateAPIKeys(ctx); err != nil {
+		return APIKeyType{}, err
+	}
+	return FindAPIKeyTypeByName(ctx, tenantID, name)
+}
+
+// DeleteAPIKeyType deletes an API key type, which must have no keys
+func DeleteAPIKeyType(ctx echo.Context, tenantID, name string) error {
+	keyType, err := FindAPIKeyTypeByName(ctx, tenantID, name)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	if err = Tx(ctx).Model(&APIKey{}).Where("type_id = ?", keyType.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return app.Errorf(app.ERR_INVALID, "API key type %q has %d keys", name, count)
+	}
+	return Tx(ctx).Delete(&keyType).Error
+}
+
+// IssueAPIKey creates a new API key of a type. The plaintext key is only available from the returned key.
+func IssueAPIKey(ctx echo.Context, tenantID, issuerID string, input app.APIKeyIssueInput) (APIKey, error) {
+	if err := input.Validate(); err != nil {
+		return APIKey{}, err
+	}
+	keyType, err := FindAPIKeyTypeByName(ctx, tenantID, input.Type)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return APIKey{}, app.Errorf(app.ERR_INVALID, "API key type %q does not exist", input.Type)
+	}
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	// both TTLs have been validated
+	var expiresAt *time.Time
+	if keyType.TTL != "" || input.TTL != "" {
+		var ttl time.Duration
+		if keyType.TTL != "" {
+			ttl, _ = app.ParseTTL(keyType.TTL)
+		}
+		if input.TTL != "" {
+			requested, _ := app.ParseTTL(input.TTL)
+			if keyType.TTL != "" && requested > ttl {
+				return APIKey{}, app.Errorf(app.ERR_INVALID, "TTL is longer than the TTL of type %q, %s",
+					keyType.Name, keyType.TTL)
+			}
+			ttl = requested
+		}
+		t := time.Now().Add(ttl)
+		expiresAt = &t
+	}
+
+	plainText := apiKeyPrefix + randomString()
+	key := APIKey{
+		TenantID:   tenantID,
+		TypeID:     keyType.ID,
+		Type:       keyType,
+		Name:       input.Name,
+		Prefix:     plainText[:apiKeyDisplayLength],
+		Hash:       hashToken(plainText),
+		PlainText:  plainText,
+		Metadata:   input.Metadata,
+		ExpiresAt:  expiresAt,
+		IssuedByID: &issuerID,
+	}
+	if err = Tx(ctx).Omit("Type").Create(&key).Error; err != nil {
+		return APIKey{}, err
+	}
+	return key, nil
+}
+
+// FindAPIKeys retrieves the API keys of a tenant by filter, newest first
+func FindAPIKeys(ctx echo.Context, tenantID string, filter app.APIKeyFilter) ([]APIKey, error) {
+	var keys []APIKey
+	q := Tx(ctx).Joins("Type").Where("api_keys.tenant_id = ?", tenantID).Order("api_keys.created_at DESC")
+	if filter.Type != nil {
+		q = q.Where(`"Type".name = ?`, *filter.Type)
+	}
+	if filter.Revoked != nil && *filter.Revoked {
+		q = q.Where("api_keys.revoked_at IS NOT NULL")
+	} else if filter.Revoked != nil {
+		q = q.Where("api_keys.revoked_at IS NULL")
+	}
+	result := q.Find(&keys)
+	return keys, result.Error
+}
+
+// FindAPIKeyByID retrieves an API key of a tenant by ID
+func FindAPIKeyByID(ctx echo.Context, tenantID, id string) (APIKey, error) {
+	var key APIKey
+	result := Tx(ctx).Joins("Type").First(&key, "api_keys.tenant_id = ? AND api_keys.id = ?", tenantID, id)
+	return key, result.Error
+}
+
+// RevokeAPIKey revokes an API key, which then fails verification
+func RevokeAPIKey(ctx echo.Context, tenantID, id string) (APIKey, error) {
+	key, err := FindAPIKeyByID(ctx, tenantID, id)
+	if err != nil {
+		return APIKey{}, err
+	}
+	if key.RevokedAt != nil {
+		return APIKey{}, app.Errorf(app.ERR_INVALID, "API key is already revoked")
+	}
+
+	now := time.Now()
+	if err = Tx(ctx).Model(&key).Update("revoked_at", now).Error; err != nil {
+		return APIKey{}, err
+	}
+	key.RevokedAt = &now
+	return key, invalidateAPIKey(ctx, tenantID, key.Hash)
+}
+
+// VerifyAPIKey looks up a plaintext API key of a tenant by its hash. It returns the metadata of the key if it is
+// valid, and Valid false without any details if it is unknown, revoked or expired. If the auth cache is enabled, a
+// cached verification skips the query.
+func VerifyAPIKey(ctx echo.Context, tenantID string, input app.APIKeyVerifyInput) (app.APIKeyVerifyOutput, error) {
+	if err := input.Validate(); err != nil {
+		return app.APIKeyVerifyOutput{}, err
+	}
+
+	hash := hashToken(input.Key)
+	a := authCache.Load()
+	if output, cached := a.getAPIKey(tenantID, hash); cached {
+		return output, nil
+	}
+	output, err := lookupAPIKey(ctx, tenantID, hash)
+	if err != nil {
+		return app.APIKeyVerifyOutput{}, err
+	}
+	a.addAPIKey(tenantID, hash, output)
+	return output, nil
+}
+
+// lookupAPIKey queries an API key of a tenant by hash, and returns the result of its verification
+func lookupAPIKey(ctx echo.Context, tenantID, hash string) (app.APIKeyVerifyOutput, error) {
+	var key APIKey
+	err := Tx(ctx).Joins("Type").First(&key, "api_keys.tenant_id = ? AND api_keys.hash = ?", tenantID, hash).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return app.APIKeyVerifyOutput{}, nil
+	}
+	if err != nil {
+		return app.APIKeyVerifyOutput{}, err
+	}
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && key.ExpiresAt.Before(time.Now())) {
+		return app.APIKeyVerifyOutput{}, nil
+	}
+
+	metadata := make(map[string]string, len(key.Type.Metadata)+len(key.Metadata))
+	for k, v := range key.Type.Metadata {
+		metadata[k] = v
+	}
+	for k, v := range key.Metadata {
+		metadata[k] = v
+	}
+	return app.APIKeyVerifyOutput{
+		Valid:     true,
+		KeyID:     key.ID,
+		Type:      key.Type.Name,
+		Name:      key.Name,
+		Metadata:  metadata,
+		ExpiresAt: key.ExpiresAt,
+	}, nil
+}
+
+func ConvertAPIKeyType(_ echo.Context, t APIKeyType) (app.APIKeyType, error) {
+	return app.APIKeyType{
+		ID:          t.ID,
+		TenantID:    t.TenantID,
+		Name:        t.Name,
+		Description: t.Description,
+		Metadata:    t.Metadata,
+		TTL:         t.TTL,
+		CreatedAt:   t.CreatedAt,
+		UpdatedAt:   t.UpdatedAt,
+	}, nil
+}
+
+func ConvertAPIKey(_ echo.Context, k APIKey) (app.APIKey, error) {
+	key := app.APIKey{
+		ID:        k.ID,
+		TenantID:  k.TenantID,
+		Type:      k.Type.Name,
+		Name:      k.Name,
+		Prefix:    k.Prefix,
+		Key:       k.PlainText,
+		Metadata:  k.Metadata,
+		ExpiresAt: k.ExpiresAt,
+		RevokedAt: k.RevokedAt,
+		CreatedAt: k.CreatedAt,
+	}
+	if key.Metadata == nil {
+		key.Metadata = map[string]string{}
+	}
+	if k.IssuedByID != nil {
+		key.IssuedByID = *k.IssuedByID
+	}
+	return key, nil
+}
@@ -0,0 +1,74 @@
+package db_test
+
+import (
+	"strings"
+	"time"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+)
+
+func (ts *TestSuite) Test_APIKeys() {
+	tenant, err := db.CreateTenant(ts.ctx, app.TenantCreateInput{Name: "tenant"})
+	ts.NoError(err)
+	otherTenant, err := db.CreateTenant(ts.ctx, app.TenantCreateInput{Name: "other tenant"})
+	ts.NoError(err)
+	user := ts.CreateUser(app.UserCreateInput{Email: "apikeys@example.com"})
+
+	_, err = db.IssueAPIKey(ts.ctx, tenant.ID, user.ID, app.APIKeyIssueInput{Type: "partner", Name: "Acme"})
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "the type does not exist yet")
+
+	_, err = db.CreateAPIKeyType(ts.ctx, tenant.ID, app.APIKeyTypeInput{
+		Name:     "partner",
+		Metadata: map[string]string{"plan": "partner", "rate_limit": "1000"},
+		TTL:      "720h",
+	})
+	ts.NoError(err)
+
+	key, err := db.IssueAPIKey(ts.ctx, tenant.ID, user.ID, app.APIKeyIssueInput{
+		Type:     "partner",
+		Name:     "Acme",
+		Metadata: map[string]string{"rate_limit": "5000", "customer_id": "42"},
+	})
+	ts.NoError(err)
+	ts.True(strings.HasPrefix(key.PlainText, key.Prefix))
+	ts.NotContains(key.Hash, key.PlainText)
+	ts.NotNil(key.ExpiresAt)
+	ts.WithinDuration(time.Now().Add(720*time.Hour), *key.ExpiresAt, time.Minute)
+
+	_, err = db.IssueAPIKey(ts.ctx, tenant.ID, user.ID, app.APIKeyIssueInput{
+		Type: "partner", Name: "Acme", TTL: "8760h",
+	})
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "the TTL is limited by the type")
+
+	out, err := db.VerifyAPIKey(ts.ctx, tenant.ID, app.APIKeyVerifyInput{Key: key.PlainText})
+	ts.NoError(err)
+	ts.True(out.Valid)
+	ts.Equal(key.ID, out.KeyID)
+	ts.Equal("partner", out.Type)
+	ts.Equal(map[string]string{"plan": "partner", "rate_limit": "5000", "customer_id": "42"}, out.Metadata)
+
+	out, err = db.VerifyAPIKey(ts.ctx, otherTenant.ID, app.APIKeyVerifyInput{Key: key.PlainText})
+	ts.NoError(err)
+	ts.False(out.Valid, "keys are only valid in their own tenant")
+
+	out, err = db.VerifyAPIKey(ts.ctx, tenant.ID, app.APIKeyVerifyInput{Key: key.PlainText + "x"})
+	ts.NoError(err)
+	ts.False(out.Valid)
+
+	err = db.DeleteAPIKeyType(ts.ctx, tenant.ID, "partner")
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "a type with keys cannot be deleted")
+
+	_, err = db.RevokeAPIKey(ts.ctx, tenant.ID, key.ID)
+	ts.NoError(err)
+	out, err = db.VerifyAPIKey(ts.ctx, tenant.ID, app.APIKeyVerifyInput{Key: key.PlainText})
+	ts.NoError(err)
+	ts.False(out.Valid, "a revoked key is not valid")
+	ts.Empty(out.KeyID)
+
+	revoked := true
+	keys, err := db.FindAPIKeys(ts.ctx, tenant.ID, app.APIKeyFilter{Revoked: &revoked})
+	ts.NoError(err)
+	ts.Len(keys, 1)
+	ts.Equal("partner", keys[0].Type.Name)
+}
@@ -0,0 +1,258 @@
+package db
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/cache"
+)
+
+// authCacheChannel is the notification channel on which revoked tokens and API keys, and changed users, are
+// announced, so that every server instance drops them from its cache
+const authCacheChannel = "keygo_auth_cache"
+
+// Notification payloads: a token hash, a tenant ID and API key hash, a user ID, or a request to drop all API keys or
+// all users
+const (
+	authCacheTokenPrefix  = "token:"
+	authCacheAPIKeyPrefix = "apikey:"
+	authCacheAPIKeysPurge = "apikeys"
+	authCacheUserPrefix   = "user:"
+	authCacheUsersPurge   = "users"
+)
+
+// listenerPingInterval is how often the listener connection is checked, so that a lost connection, and with it any
+// missed notifications, is noticed
+const listenerPingInterval = time.Minute
+
+// AuthCacheConfig sets the size of the cache of each kind, and how long found and not found lookups are cached
+type AuthCacheConfig struct {
+	Size        int
+	TTL         time.Duration
+	NegativeTTL time.Duration
+}
+
+// AuthCache caches token and API key lookups by hash, and the users that tokens authenticate, so that
+// authenticating a request or verifying an API key does not query the database while the entry is fresh. Revoking a
+// token or key, or changing what a user may do, notifies all instances, via Postgres LISTEN/NOTIFY, to drop it. If a
+// notification is lost, the entry is stale for at most the TTL.
+type AuthCache struct {
+	tokens *cache.LRU[string, Token]
+
+	// apiKeys are keyed by tenant ID and hash, e.g. "<tenant ID>/<hash>"
+	apiKeys *cache.LRU[string, app.APIKeyVerifyOutput]
+
+	// users are keyed by ID, with their roles, elevations, and memberships, but no active tenant
+	users *cache.LRU[string, app.User]
+}
+
+// authCache is the cache used by token and API key lookups. It is nil, and every lookup queries the database, until
+// EnableAuthCache is called.
+var authCache atomic.Pointer[AuthCache]
+
+// EnableAuthCache starts caching token and API key lookups, replacing any previous cache. To see revocations made by
+// other instances, call Listen.
+func EnableAuthCache(config AuthCacheConfig) *AuthCache {
+	a := &AuthCache{
+		tokens:  cache.NewLRU[string, Token](config.Size, config.TTL, config.NegativeTTL),
+		apiKeys: cache.NewLRU[string, app.APIKeyVerifyOutput](config.Size, config.TTL, config.NegativeTTL),
+		users:   cache.NewLRU[string, app.User](config.Size, config.TTL, config.NegativeTTL),
+	}
+	authCache.Store(a)
+	return a
+}
+
+// DisableAuthCache stops caching token and API key lookups
+func DisableAuthCache() {
+	authCache.Store(nil)
+}
+
+// Listen drops the entries revoked by other instances, as they are announced, until the returned function is called.
+// It listens on its own connection to the database at dsn, and purges the cache whenever that connection is lost,
+// since notifications may have been missed. Connection errors are reported to onError.
+func (a *AuthCache) Listen(dsn string, onError func(error)) (stop func()) {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if event == pq.ListenerEventDisconnected || event == pq.ListenerEventReconnected {
+			a.Purge()
+		}
+		if err != nil {
+			onError(err)
+		}
+	})
+
+	done := make(chan struct{})
+	go func() {
+		// blocks until connected
+		if err := listener.Listen(authCacheChannel); err != nil {
+			onError(err)
+		}
+	}()
+	go func() {
+		ticker := time.NewTicker(listenerPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case n := <-listener.Notify:
+				// a nil notification follows a reconnection
+				if n == nil {
+					a.Purge()
+				} else {
+					a.invalidate(n.Extra)
+				}
+			case <-ticker.C:
+				go func() { _ = listener.Ping() }()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		_ = listener.Close()
+	}
+}
+
+// Purge drops all entries
+func (a *AuthCache) Purge() {
+	a.tokens.Purge()
+	a.apiKeys.Purge()
+	a.users.Purge()
+}
+
+// getToken returns a cached token lookup. cached is false if the lookup is not cached, or the cache is disabled.
+func (a *AuthCache) getToken(hash string) (token Token, found, cached bool) {
+	if a == nil {
+		return Token{}, false, false
+	}
+	return a.tokens.Get(hash)
+}
+
+// addToken caches a token lookup, until the token expires at the latest
+func (a *AuthCache) addToken(hash string, token Token, found bool) {
+	if a == nil {
+		return
+	}
+	if !found {
+		a.tokens.AddNegative(hash)
+		return
+	}
+	a.tokens.AddUntil(hash, token, token.ExpiresAt)
+}
+
+// getAPIKey returns a cached API key verification. cached is false if the verification is not cached, or the cache
+// is disabled.
+func (a *AuthCache) getAPIKey(tenantID, hash string) (output app.APIKeyVerifyOutput, cached bool) {
+	if a == nil {
+		return app.APIKeyVerifyOutput{}, false
+	}
+	output, _, cached = a.apiKeys.Get(apiKeyCacheKey(tenantID, hash))
+	return output, cached
+}
+
+// addAPIKey caches an API key verification, until the key expires at the latest. An invalid key is cached as a
+// negative entry.
+func (a *AuthCache) addAPIKey(tenantID, hash string, output app.APIKeyVerifyOutput) {
+	if a == nil {
+		return
+	}
+	if !output.Valid {
+		a.apiKeys.AddNegative(apiKeyCacheKey(tenantID, hash))
+		return
+	}
+	var expiresAt time.Time
+	if output.ExpiresAt != nil {
+		expiresAt = *output.ExpiresAt
+	}
+	a.apiKeys.AddUntil(apiKeyCacheKey(tenantID, hash), output, expiresAt)
+}
+
+// getUser returns a cached user. cached is false if the user is not cached, or the cache is disabled.
+func (a *AuthCache) getUser(id string) (user app.User, cached bool) {
+	if a == nil {
+		return app.User{}, false
+	}
+	user, _, cached = a.users.Get(id)
+	return user, cached
+}
+
+// addUser caches a user, until its first elevation expires at the latest
+func (a *AuthCache) addUser(user app.User) {
+	if a == nil {
+		return
+	}
+	var expiresAt time.Time
+	for _, e := range user.Elevations {
+		if e.ExpiresAt != nil && (expiresAt.IsZero() || e.ExpiresAt.Before(expiresAt)) {
+			expiresAt = *e.ExpiresAt
+		}
+	}
+	a.users.AddUntil(user.ID, user, expiresAt)
+}
+
+// invalidate drops the entry named by a notification payload
+func (a *AuthCache) invalidate(payload string) {
+	if hash, ok := strings.CutPrefix(payload, authCacheTokenPrefix); ok {
+		a.tokens.Remove(hash)
+	} else if key, ok := strings.CutPrefix(payload, authCacheAPIKeyPrefix); ok {
+		a.apiKeys.Remove(key)
+	} else if id, ok := strings.CutPrefix(payload, authCacheUserPrefix); ok {
+		a.users.Remove(id)
+	} else if payload == authCacheAPIKeysPurge {
+		a.apiKeys.Purge()
+	} else if payload == authCacheUsersPurge {
+		a.users.Purge()
+	}
+}
+
+// invalidateTokens drops tokens from the cache of this instance, and of all instances once the transaction commits
+func invalidateTokens(ctx echo.Context, hashes ...string) error {
+	for _, hash := range hashes {
+		if err := notifyAuthCache(ctx, authCacheTokenPrefix+hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// invalidateAPIKey drops an API key from the cache of this instance, and of all instances once the transaction
+// commits
+func invalidateAPIKey(ctx echo.Context, tenantID, hash string) error {
+	return notifyAuthCache(ctx, authCacheAPIKeyPrefix+apiKeyCacheKey(tenantID, hash))
+}
+
+// invalidateAPIKeys drops all API keys from the cache of this instance, and of all instances once the transaction
+// commits, e.g. when the metadata of a key type changes
+func invalidateAPIKeys(ctx echo.Context) error {
+	return notifyAuthCache(ctx, authCacheAPIKeysPurge)
+}
+
+// invalidateUser drops a user from the cache of this instance, and of all instances once the transaction commits,
+// e.g. when its role, elevations, or memberships change
+func invalidateUser(ctx echo.Context, id string) error {
+	return notifyAuthCache(ctx, authCacheUserPrefix+id)
+}
+
+// invalidateUsers drops all users from the cache of this instance, and of all instances once the transaction
+// commits, e.g. when a change to a group or tenant affects any number of users
+func invalidateUsers(ctx echo.Context) error {
+	return notifyAuthCache(ctx, authCacheUsersPurge)
+}
+
+// notifyAuthCache applies an invalidation to the cache of this instance right away, and sends it to all instances,
+// including this one, when the transaction commits. The second time prevents a lookup made before the commit from
+// caching the old state.
+func notifyAuthCache(ctx echo.Context, payload string) error {
+	if a := authCache.Load(); a != nil {
+		a.invalidate(payload)
+	}
+	return Tx(ctx).Exec("SELECT pg_notify(?, ?)", authCacheChannel, payload).Error
+}
+
+func apiKeyCacheKey(tenantID, hash string) string {
+	return tenantID + "/" + hash
+}
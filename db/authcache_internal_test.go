@@ -0,0 +1,186 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/briskt/keygo/app"
+)
+
+// countingConnPool counts the statements sent to the database, without a database. Queries fail, and other
+// statements succeed without affecting any rows.
+type countingConnPool struct {
+	queries atomic.Int64
+	execs   atomic.Int64
+}
+
+var errNoDatabase = errors.New("no database")
+
+func (p *countingConnPool) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+	return nil, errNoDatabase
+}
+
+func (p *countingConnPool) ExecContext(context.Context, string, ...any) (sql.Result, error) {
+	p.execs.Add(1)
+	return driver.RowsAffected(0), nil
+}
+
+func (p *countingConnPool) QueryContext(context.Context, string, ...any) (*sql.Rows, error) {
+	p.queries.Add(1)
+	return nil, errNoDatabase
+}
+
+func (p *countingConnPool) QueryRowContext(context.Context, string, ...any) *sql.Row {
+	p.queries.Add(1)
+	return nil
+}
+
+// countingContext returns a request context whose transaction is sent to a countingConnPool
+func countingContext(t testing.TB) (echo.Context, *countingConnPool) {
+	pool := &countingConnPool{}
+	tx, err := gorm.Open(postgres.New(postgres.Config{Conn: pool}), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Discard,
+	})
+	require.NoError(t, err)
+
+	ctx := echo.New().NewContext(httptest.NewRequest("GET", "/", nil), httptest.NewRecorder())
+	ctx.Set(app.ContextKeyTx, tx)
+	return ctx, pool
+}
+
+func TestAuthCache_FindToken(t *testing.T) {
+	ctx, pool := countingContext(t)
+	a := EnableAuthCache(AuthCacheConfig{Size: 10, TTL: time.Minute, NegativeTTL: time.Minute})
+	defer DisableAuthCache()
+
+	_, err := FindToken(ctx, "uncached")
+	require.ErrorIs(t, err, errNoDatabase)
+	require.Equal(t, int64(1), pool.queries.Load(), "a miss queries the database")
+
+	a.addToken(hashToken("valid"), Token{ID: "t1", UserID: "u1", ExpiresAt: time.Now().Add(time.Hour)}, true)
+	token, err := FindToken(ctx, "valid")
+	require.NoError(t, err)
+	require.Equal(t, "t1", token.ID)
+
+	a.addToken(hashToken("unknown"), Token{}, false)
+	_, err = FindToken(ctx, "unknown")
+	require.Equal(t, app.ERR_NOTFOUND, app.ErrorCode(err))
+
+	require.Equal(t, int64(1), pool.queries.Load(), "hits do not query the database")
+
+	require.NoError(t, invalidateTokens(ctx, hashToken("valid")))
+	_, err = FindToken(ctx, "valid")
+	require.ErrorIs(t, err, errNoDatabase, "an invalidated token is looked up again")
+}
+
+func TestAuthCache_VerifyAPIKey(t *testing.T) {
+	ctx, pool := countingContext(t)
+	a := EnableAuthCache(AuthCacheConfig{Size: 10, TTL: time.Minute, NegativeTTL: time.Minute})
+	defer DisableAuthCache()
+
+	a.addAPIKey("tenant", hashToken("valid"), app.APIKeyVerifyOutput{Valid: true, KeyID: "k1"})
+	out, err := VerifyAPIKey(ctx, "tenant", app.APIKeyVerifyInput{Key: "valid"})
+	require.NoError(t, err)
+	require.Equal(t, "k1", out.KeyID)
+
+	a.addAPIKey("tenant", hashToken("revoked"), app.APIKeyVerifyOutput{})
+	out, err = VerifyAPIKey(ctx, "tenant", app.APIKeyVerifyInput{Key: "revoked"})
+	require.NoError(t, err)
+	require.False(t, out.Valid)
+
+	_, err = VerifyAPIKey(ctx, "other tenant", app.APIKeyVerifyInput{Key: "valid"})
+	require.ErrorIs(t, err, errNoDatabase, "keys are cached per tenant")
+	require.Equal(t, int64(1), pool.queries.Load())
+}
+
+func TestAuthCache_ConvertToken(t *testing.T) {
+	ctx, pool := countingContext(t)
+	a := EnableAuthCache(AuthCacheConfig{Size: 10, TTL: time.Minute, NegativeTTL: time.Minute})
+	defer DisableAuthCache()
+
+	tenantID := "tenant"
+	a.addUser(app.User{ID: "u1", Memberships: []app.TenantMembership{{TenantID: tenantID}}})
+	token, err := ConvertToken(ctx, Token{ID: "t1", UserID: "u1", ActiveTenantID: &tenantID})
+	require.NoError(t, err)
+	require.Equal(t, "u1", token.User.ID)
+	require.Equal(t, tenantID, token.User.TenantID)
+	require.Equal(t, int64(0), pool.queries.Load(), "a cached user is not queried")
+
+	require.NoError(t, invalidateUser(ctx, "u1"))
+	_, err = ConvertToken(ctx, Token{ID: "t1", UserID: "u1"})
+	require.ErrorIs(t, err, errNoDatabase, "an invalidated user is queried again")
+
+	expiresAt := time.Now().Add(-time.Second)
+	a.addUser(app.User{ID: "u2", Elevations: []app.Elevation{{ExpiresAt: &expiresAt}}})
+	_, cached := a.getUser("u2")
+	require.False(t, cached, "a user is cached until its first elevation expires")
+}
+
+func TestTouchToken(t *testing.T) {
+	ctx, pool := countingContext(t)
+	a := EnableAuthCache(AuthCacheConfig{Size: 10, TTL: time.Minute, NegativeTTL: time.Minute})
+	defer DisableAuthCache()
+
+	recently := time.Now().Add(-time.Second)
+	token := Token{ID: "t1", Hash: hashToken("valid"), LastUsedAt: &recently, ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, TouchToken(ctx, token))
+	require.Equal(t, int64(0), pool.execs.Load(), "a recently used token is not written")
+
+	earlier := time.Now().Add(-tokenTouchInterval)
+	token.LastUsedAt = &earlier
+	require.NoError(t, TouchToken(ctx, token))
+	require.Equal(t, int64(1), pool.execs.Load())
+
+	cached, found, _ := a.getToken(token.Hash)
+	require.True(t, found, "the touched token is cached")
+	require.WithinDuration(t, time.Now(), *cached.LastUsedAt, time.Second)
+	require.WithinDuration(t, time.Now().Add(app.AuthTokenLifetime), cached.ExpiresAt, time.Second)
+}
+
+// BenchmarkFindToken_Cached measures a cached token lookup. The only statement sent is the set_config that makes
+// the token's user the RLS actor.
+func BenchmarkFindToken_Cached(b *testing.B) {
+	ctx, pool := countingContext(b)
+	a := EnableAuthCache(AuthCacheConfig{Size: 10, TTL: time.Hour, NegativeTTL: time.Hour})
+	defer DisableAuthCache()
+	a.addToken(hashToken("valid"), Token{ID: "t1", UserID: "u1", ExpiresAt: time.Now().Add(time.Hour)}, true)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := FindToken(ctx, "valid"); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(pool.queries.Load())/float64(b.N), "queries/op")
+	b.ReportMetric(float64(pool.execs.Load())/float64(b.N), "execs/op")
+}
+
+// BenchmarkVerifyAPIKey_Cached measures a cached API key verification, which sends no statements
+func BenchmarkVerifyAPIKey_Cached(b *testing.B) {
+	ctx, pool := countingContext(b)
+	a := EnableAuthCache(AuthCacheConfig{Size: 10, TTL: time.Hour, NegativeTTL: time.Hour})
+	defer DisableAuthCache()
+	a.addAPIKey("tenant", hashToken("valid"), app.APIKeyVerifyOutput{Valid: true, KeyID: "k1"})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := VerifyAPIKey(ctx, "tenant", app.APIKeyVerifyInput{Key: "valid"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(pool.queries.Load())/float64(b.N), "queries/op")
+	b.ReportMetric(float64(pool.execs.Load())/float64(b.N), "execs/op")
+}
@@ -0,0 +1,85 @@
+package db_test
+
+import (
+	"time"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+)
+
+func (ts *TestSuite) Test_AuthCache() {
+	db.EnableAuthCache(db.AuthCacheConfig{Size: 100, TTL: time.Minute, NegativeTTL: time.Minute})
+	defer db.DisableAuthCache()
+
+	user := ts.CreateUser(app.UserCreateInput{Email: "authcache@example.com"})
+	token, err := db.CreateToken(ts.ctx, app.TokenCreateInput{
+		AuthID: "a", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour),
+	})
+	ts.NoError(err)
+
+	found, err := db.FindToken(ts.ctx, token.PlainText)
+	ts.NoError(err)
+	ts.Equal(token.ID, found.ID)
+	found, err = db.FindToken(ts.ctx, token.PlainText)
+	ts.NoError(err, "a cached token is found")
+	ts.Equal(token.ID, found.ID)
+
+	ts.NoError(db.DeleteToken(ts.ctx, token.ID))
+	_, err = db.FindToken(ts.ctx, token.PlainText)
+	ts.Equal(app.ERR_NOTFOUND, app.ErrorCode(err), "a deleted token is dropped from the cache")
+
+	tenant, err := db.CreateTenant(ts.ctx, app.TenantCreateInput{Name: "tenant"})
+	ts.NoError(err)
+
+	token, err = db.CreateToken(ts.ctx, app.TokenCreateInput{
+		AuthID: "a", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour),
+	})
+	ts.NoError(err)
+	found, err = db.FindToken(ts.ctx, token.PlainText)
+	ts.NoError(err)
+	converted, err := db.ConvertToken(ts.ctx, found)
+	ts.NoError(err)
+	ts.Empty(converted.User.Memberships)
+
+	_, err = db.CreateTenantMembership(ts.ctx, app.TenantMembershipCreateInput{TenantID: tenant.ID, UserID: user.ID})
+	ts.NoError(err)
+	converted, err = db.ConvertToken(ts.ctx, found)
+	ts.NoError(err)
+	ts.Len(converted.User.Memberships, 1, "a new membership drops the cached user")
+
+	_, err = db.CreateAPIKeyType(ts.ctx, tenant.ID, app.APIKeyTypeInput{
+		Name: "free", Metadata: map[string]string{"plan": "free"},
+	})
+	ts.NoError(err)
+	key, err := db.IssueAPIKey(ts.ctx, tenant.ID, user.ID, app.APIKeyIssueInput{Type: "free", Name: "Acme"})
+	ts.NoError(err)
+
+	out, err := db.VerifyAPIKey(ts.ctx, tenant.ID, app.APIKeyVerifyInput{Key: key.PlainText})
+	ts.NoError(err)
+	ts.True(out.Valid)
+
+	_, err = db.UpdateAPIKeyType(ts.ctx, tenant.ID, "free", app.APIKeyTypeInput{
+		Metadata: map[string]string{"plan": "trial"},
+	})
+	ts.NoError(err)
+	out, err = db.VerifyAPIKey(ts.ctx, tenant.ID, app.APIKeyVerifyInput{Key: key.PlainText})
+	ts.NoError(err)
+	ts.Equal("trial", out.Metadata["plan"], "a type update drops cached keys")
+
+	_, err = db.RevokeAPIKey(ts.ctx, tenant.ID, key.ID)
+	ts.NoError(err)
+	out, err = db.VerifyAPIKey(ts.ctx, tenant.ID, app.APIKeyVerifyInput{Key: key.PlainText})
+	ts.NoError(err)
+	ts.False(out.Valid, "a revoked key is dropped from the cache")
+
+	key, err = db.IssueAPIKey(ts.ctx, tenant.ID, user.ID, app.APIKeyIssueInput{Type: "free", Name: "Acme"})
+	ts.NoError(err)
+	out, err = db.VerifyAPIKey(ts.ctx, tenant.ID, app.APIKeyVerifyInput{Key: key.PlainText})
+	ts.NoError(err)
+	ts.True(out.Valid)
+
+	ts.NoError(db.DeleteTenant(ts.ctx, tenant.ID))
+	out, err = db.VerifyAPIKey(ts.ctx, tenant.ID, app.APIKeyVerifyInput{Key: key.PlainText})
+	ts.NoError(err)
+	ts.False(out.Valid, "the keys of a deleted tenant are dropped from the cache")
+}
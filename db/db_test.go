@@ -27,6 +27,7 @@ type TestSuite struct {
 func (ts *TestSuite) SetupTest() {
 	ts.Assertions = require.New(ts.T())
 	ts.NoError(ts.DB.Exec("TRUNCATE TABLE tenants CASCADE").Error)
+	ts.NoError(ts.DB.Exec("DELETE FROM roles WHERE NOT builtin").Error)
 }
 
 func Test_RunSuite(t *testing.T) {
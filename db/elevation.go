@@ -0,0 +1,240 @@
+package db
+
+import (
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"github.com/briskt/keygo/app"
+)
+
+type Elevation struct {
+	ID            string `gorm:"primaryKey;type:string"`
+	UserID        string
+	User          User
+	RoleID        string
+	Role          Role
+	Hours         int
+	Justification string
+	ApproverID    *string
+	DecisionNote  string
+	ApprovedAt    *time.Time
+	DeniedAt      *time.Time
+	ExpiresAt     *time.Time
+	RevokedAt     *time.Time
+	RevokerID     *string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (Elevation) TableName() string {
+	return "role_elevations"
+}
+
+func (e *Elevation) BeforeCreate(_ *gorm.DB) error {
+	e.ID = newID()
+	return nil
+}
+
+// status returns the state of the elevation at the given time
+func (e Elevation) status(now time.Time) string {
+	switch {
+	case e.RevokedAt != nil:
+		return app.ElevationStatusRevoked
+	case e.DeniedAt != nil:
+		return app.ElevationStatusDenied
+	case e.ApprovedAt == nil:
+		return app.ElevationStatusPending
+	case now.Before(*e.ExpiresAt):
+		return app.ElevationStatusActive
+	}
+	return app.ElevationStatusExpired
+}
+
+// elevationStatusConditions are the query conditions matching each elevation status. Their only argument is the
+// current time.
+var elevationStatusConditions = map[string]string{
+	app.ElevationStatusPending: "approved_at IS NULL AND denied_at IS NULL AND revoked_at IS NULL",
+	app.ElevationStatusActive:  "approved_at IS NOT NULL AND revoked_at IS NULL AND expires_at > @now",
+	app.ElevationStatusExpired: "approved_at IS NOT NULL AND revoked_at IS NULL AND expires_at <= @now",
+	app.ElevationStatusDenied:  "denied_at IS NOT NULL",
+	app.ElevationStatusRevoked: "revoked_at IS NOT NULL",
+}
+
+// FindElevations retrieves a list of elevations by filter, newest first
+func FindElevations(ctx echo.Context, filter app.ElevationFilter) ([]Elevation, error) {
+	var elevations []Elevation
+	q := Tx(ctx).Preload("User").Preload("Role").Order("created_at DESC, id")
+	if filter.UserID != nil {
+		q = q.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Status != nil {
+		cond, ok := elevationStatusConditions[*filter.Status]
+		if !ok {
+			return nil, app.Errorf(app.ERR_INVALID, "Invalid status %q", *filter.Status)
+		}
+		q = q.Where(cond, map[string]any{"now": time.Now()})
+	}
+	result := q.Find(&elevations)
+	return elevations, result.Error
+}
+
+// FindElevationByID retrieves an elevation by ID
+func FindElevationByID(ctx echo.Context, id string) (Elevation, error) {
+	var elevation Elevation
+	result := Tx(ctx).Preload("User").Preload("Role").First(&elevation, "id = ?", id)
+	return elevation, result.Error
+}
+
+// CreateElevation records a request by a user to hold a role temporarily
+func CreateElevation(ctx echo.Context, userID string, input app.ElevationCreateInput) (Elevation, error) {
+	if err := input.Validate(); err != nil {
+		return Elevation{}, err
+	}
+
+	user, err := findUserByID(ctx, userID)
+	if err != nil {
+		return Elevation{}, err
+	}
+	if _, err = FindRoleByID(ctx, input.RoleID); err != nil {
+		return Elevation{}, app.Errorf(app.ERR_INVALID, "Role %q does not exist", input.RoleID)
+	}
+	if user.RoleID == input.RoleID {
+		return Elevation{}, app.Errorf(app.ERR_INVALID, "You already have this role")
+	}
+
+	var count int64
+	err = Tx(ctx).Model(&Elevation{}).Where("user_id = ? AND role_id = ?", userID, input.RoleID).
+		Where(elevationStatusConditions[app.ElevationStatusPending]).Count(&count).Error
+	if err != nil {
+		return Elevation{}, err
+	}
+	if count > 0 {
+		return Elevation{}, app.Errorf(app.ERR_INVALID, "A request for this role is already pending")
+	}
+
+	elevation := Elevation{
+		UserID:        userID,
+		RoleID:        input.RoleID,
+		Hours:         input.Hours,
+		Justification: input.Justification,
+	}
+	if err = Tx(ctx).Omit("User", "Role").Create(&elevation).Error; err != nil {
+		return Elevation{}, err
+	}
+	return FindElevationByID(ctx, elevation.ID)
+}
+
+// ApproveElevation grants a pending elevation, starting the requested number of hours from now
+func ApproveElevation(ctx echo.Context, id, approverID string,
+	input app.ElevationDecisionInput,
+) (Elevation, error) {
+	return decideElevation(ctx, id, approverID, input, func(e Elevation, now time.Time) map[string]any {
+		return map[string]any{
+			"approved_at": now,
+			"expires_at":  now.Add(time.Duration(e.Hours) * time.Hour),
+		}
+	})
+}
+
+// DenyElevation rejects a pending elevation
+func DenyElevation(ctx echo.Context, id, approverID string, input app.ElevationDecisionInput) (Elevation, error) {
+	return decideElevation(ctx, id, approverID, input, func(_ Elevation, now time.Time) map[string]any {
+		return map[string]any{"denied_at": now}
+	})
+}
+
+// RevokeElevation ends a pending or active elevation
+func RevokeElevation(ctx echo.Context, id, revokerID string) (Elevation, error) {
+	elevation, err := FindElevationByID(ctx, id)
+	if err != nil {
+		return Elevation{}, err
+	}
+	now := time.Now()
+	if s := elevation.status(now); s != app.ElevationStatusPending && s != app.ElevationStatusActive {
+		return Elevation{}, app.Errorf(app.ERR_INVALID, "Elevation is %s", s)
+	}
+
+	err = Tx(ctx).Model(&Elevation{}).Where("id = ?", id).
+		Updates(map[string]any{"revoked_at": now, "revoker_id": revokerID, "updated_at": now}).Error
+	if err != nil {
+		return Elevation{}, err
+	}
+	if err = invalidateUser(ctx, elevation.UserID); err != nil {
+		return Elevation{}, err
+	}
+	return FindElevationByID(ctx, id)
+}
+
+// decideElevation records the decision on a pending elevation, with the updates returned by decide
+func decideElevation(ctx echo.Context, id, approverID string, input app.ElevationDecisionInput,
+	decide func(e Elevation, now time.Time) map[string]any,
+) (Elevation, error) {
+	elevation, err := FindElevationByID(ctx, id)
+	if err != nil {
+		return Elevation{}, err
+	}
+	now := time.Now()
+	if s := elevation.status(now); s != app.ElevationStatusPending {
+		return Elevation{}, app.Errorf(app.ERR_INVALID, "Elevation is %s", s)
+	}
+
+	updates := decide(elevation, now)
+	updates["approver_id"] = approverID
+	updates["decision_note"] = input.Note
+	updates["updated_at"] = now
+	if err = Tx(ctx).Model(&Elevation{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return Elevation{}, err
+	}
+	if err = invalidateUser(ctx, elevation.UserID); err != nil {
+		return Elevation{}, err
+	}
+	return FindElevationByID(ctx, id)
+}
+
+// findActiveElevationsOfUsers returns the elevations of the given users that are approved and not expired or
+// revoked, by user ID
+func findActiveElevationsOfUsers(ctx echo.Context, userIDs []string) (map[string][]Elevation, error) {
+	var elevations []Elevation
+	result := Tx(ctx).Preload("User").Preload("Role").Order("created_at DESC, id").
+		Where("user_id IN ?", userIDs).
+		Where(elevationStatusConditions[app.ElevationStatusActive], map[string]any{"now": time.Now()}).
+		Find(&elevations)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	byUser := map[string][]Elevation{}
+	for _, e := range elevations {
+		byUser[e.UserID] = append(byUser[e.UserID], e)
+	}
+	return byUser, nil
+}
+
+func ConvertElevation(_ echo.Context, e Elevation) (app.Elevation, error) {
+	elevation := app.Elevation{
+		ID:            e.ID,
+		UserID:        e.UserID,
+		UserEmail:     e.User.Email,
+		RoleID:        e.RoleID,
+		Role:          e.Role.Name,
+		Hours:         e.Hours,
+		Justification: e.Justification,
+		Status:        e.status(time.Now()),
+		DecisionNote:  e.DecisionNote,
+		ApprovedAt:    e.ApprovedAt,
+		DeniedAt:      e.DeniedAt,
+		ExpiresAt:     e.ExpiresAt,
+		RevokedAt:     e.RevokedAt,
+		CreatedAt:     e.CreatedAt,
+		UpdatedAt:     e.UpdatedAt,
+	}
+	if e.ApproverID != nil {
+		elevation.ApproverID = *e.ApproverID
+	}
+	if e.RevokerID != nil {
+		elevation.RevokerID = *e.RevokerID
+	}
+	return elevation, nil
+}
@@ -0,0 +1,88 @@
+package db_test
+
+import (
+	"time"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+)
+
+func (ts *TestSuite) Test_Elevations() {
+	user := ts.CreateUser(app.UserCreateInput{Email: "elevated@example.com"})
+	approver := ts.CreateUser(app.UserCreateInput{Email: "approver@example.com"})
+	role, err := db.CreateRole(ts.ctx, app.RoleCreateInput{
+		Name:        "Auditor",
+		Permissions: []string{app.PermissionTenantsList, app.PermissionTenantsRead},
+	})
+	ts.NoError(err)
+
+	_, err = db.CreateElevation(ts.ctx, user.ID, app.ElevationCreateInput{RoleID: role.ID, Hours: 2})
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "a justification is required")
+	_, err = db.CreateElevation(ts.ctx, user.ID, app.ElevationCreateInput{
+		RoleID: role.ID, Hours: app.MaxElevationHours + 1, Justification: "audit",
+	})
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "hours are limited")
+
+	input := app.ElevationCreateInput{RoleID: role.ID, Hours: 2, Justification: "quarterly audit"}
+	elevation, err := db.CreateElevation(ts.ctx, user.ID, input)
+	ts.NoError(err)
+	_, err = db.CreateElevation(ts.ctx, user.ID, input)
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "a request is already pending")
+
+	converted, err := db.ConvertUser(ts.ctx, user)
+	ts.NoError(err)
+	ts.False(converted.HasPermission(app.PermissionTenantsList), "a pending elevation grants nothing")
+
+	elevation, err = db.ApproveElevation(ts.ctx, elevation.ID, approver.ID, app.ElevationDecisionInput{Note: "ok"})
+	ts.NoError(err)
+	ts.WithinDuration(time.Now().Add(2*time.Hour), *elevation.ExpiresAt, time.Minute)
+
+	converted, err = db.ConvertUser(ts.ctx, user)
+	ts.NoError(err)
+	ts.True(converted.HasPermission(app.PermissionTenantsList))
+	ts.True(converted.HasRole(role.Name))
+	ts.Equal(app.UserRoleBasic, converted.Role, "the user's own role is unchanged")
+
+	_, err = db.DenyElevation(ts.ctx, elevation.ID, approver.ID, app.ElevationDecisionInput{})
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "an approved elevation cannot be denied")
+
+	// Expire the elevation
+	ts.NoError(ts.DB.Model(&db.Elevation{}).Where("id = ?", elevation.ID).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error)
+	converted, err = db.ConvertUser(ts.ctx, user)
+	ts.NoError(err)
+	ts.False(converted.HasPermission(app.PermissionTenantsList), "an expired elevation grants nothing")
+	ts.Empty(converted.Elevations)
+
+	// A denied request, and a revoked one
+	denied, err := db.CreateElevation(ts.ctx, user.ID, input)
+	ts.NoError(err)
+	_, err = db.DenyElevation(ts.ctx, denied.ID, approver.ID, app.ElevationDecisionInput{Note: "no"})
+	ts.NoError(err)
+	revoked, err := db.CreateElevation(ts.ctx, user.ID, input)
+	ts.NoError(err)
+	_, err = db.ApproveElevation(ts.ctx, revoked.ID, approver.ID, app.ElevationDecisionInput{})
+	ts.NoError(err)
+	_, err = db.RevokeElevation(ts.ctx, revoked.ID, user.ID)
+	ts.NoError(err)
+
+	// The full history is kept
+	all, err := db.FindElevations(ts.ctx, app.ElevationFilter{UserID: &user.ID})
+	ts.NoError(err)
+	ts.Len(all, 3)
+	for status, id := range map[string]string{
+		app.ElevationStatusExpired: elevation.ID,
+		app.ElevationStatusDenied:  denied.ID,
+		app.ElevationStatusRevoked: revoked.ID,
+	} {
+		s := status
+		found, err := db.FindElevations(ts.ctx, app.ElevationFilter{UserID: &user.ID, Status: &s})
+		ts.NoError(err)
+		ts.Len(found, 1, status)
+		ts.Equal(id, found[0].ID, status)
+	}
+
+	bogus := "bogus"
+	_, err = db.FindElevations(ts.ctx, app.ElevationFilter{Status: &bogus})
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err))
+}
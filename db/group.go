@@ -0,0 +1,405 @@
+package db
+
+import (
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+
+	"github.com/briskt/keygo/app"
+)
+
+type Group struct {
+	ID          string `gorm:"primaryKey;type:string"`
+	TenantID    string
+	ParentID    *string
+	Name        string
+	Description string
+	RoleID      *string
+	Role        *Role
+	Permissions pq.StringArray `gorm:"type:text[];default:'{}'"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (Group) TableName() string {
+	return "tenant_groups"
+}
+
+func (g *Group) BeforeCreate(_ *gorm.DB) error {
+	g.ID = newID()
+	return nil
+}
+
+type GroupMember struct {
+	GroupID   string `gorm:"primaryKey;type:string"`
+	UserID    string `gorm:"primaryKey;type:string"`
+	CreatedAt time.Time
+}
+
+func (GroupMember) TableName() string {
+	return "tenant_group_members"
+}
+
+// groupGrant is a group a user belongs to, with the role and permissions it grants. TenantID and UserID are set
+// only by findGroupGrantsOfUsers.
+type groupGrant struct {
+	ID              string
+	TenantID        string
+	UserID          string
+	Permissions     pq.StringArray
+	RoleName        *string
+	RolePermissions pq.StringArray
+}
+
+// memberKey identifies the membership of a user in a tenant
+type memberKey struct {
+	TenantID string
+	UserID   string
+}
+
+// FindGroups retrieves the groups of a tenant, ordered by name
+func FindGroups(ctx echo.Context, tenantID string) ([]Group, error) {
+	var groups []Group
+	result := Tx(ctx).Preload("Role").Where("tenant_id = ?", tenantID).Order("name").Find(&groups)
+	return groups, result.Error
+}
+
+// FindGroupByID retrieves a group of a tenant by ID
+func FindGroupByID(ctx echo.Context, tenantID, id string) (Group, error) {
+	var group Group
+	result := Tx(ctx).Preload("Role").First(&group, "tenant_id = ? AND id = ?", tenantID, id)
+	return group, result.Error
+}
+
+// CreateGroup creates a new group in a tenant
+func CreateGroup(ctx echo.Context, tenantID string, input app.GroupCreateInput) (Group, error) {
+	if err := input.Validate(); err != nil {
+		return Group{}, err
+	}
+
+	if err := checkGroupName(ctx, tenantID, "", input.Name); err != nil {
+		return Group{}, err
+	}
+
+	group := Group{
+		TenantID:    tenantID,
+		Name:        input.Name,
+		Description: input.Description,
+		Permissions: input.Permissions,
+	}
+	if input.ParentID != "" {
+		if _, err := FindGroupByID(ctx, tenantID, input.ParentID); err != nil {
+			return Group{}, app.Errorf(app.ERR_INVALID, "Parent group %q does not exist", input.ParentID)
+		}
+		group.ParentID = &input.ParentID
+	}
+	if input.RoleID != "" {
+		if _, err := FindRoleByID(ctx, input.RoleID); err != nil {
+			return Group{}, app.Errorf(app.ERR_INVALID, "Role %q does not exist", input.RoleID)
+		}
+		group.RoleID = &input.RoleID
+	}
+
+	if err := Tx(ctx).Omit("Role").Create(&group).Error; err != nil {
+		return Group{}, err
+	}
+	return FindGroupByID(ctx, tenantID, group.ID)
+}
+
+// UpdateGroup updates a group of a tenant
+func UpdateGroup(ctx echo.Context, tenantID, id string, input app.GroupUpdateInput) (Group, error) {
+	if err := input.Validate(); err != nil {
+		return Group{}, err
+	}
+	group, err := FindGroupByID(ctx, tenantID, id)
+	if err != nil {
+		return Group{}, err
+	}
+
+	if input.Name != nil {
+		if err = checkGroupName(ctx, tenantID, id, *input.Name); err != nil {
+			return Group{}, err
+		}
+		group.Name = *input.Name
+	}
+	if input.Description != nil {
+		group.Description = *input.Description
+	}
+	if input.ParentID != nil {
+		group.ParentID = nil
+		if *input.ParentID != "" {
+			if err = checkGroupParent(ctx, tenantID, id, *input.ParentID); err != nil {
+				return Group{}, err
+			}
+			group.ParentID = input.ParentID
+		}
+	}
+	if input.RoleID != nil {
+		group.RoleID = nil
+		if *input.RoleID != "" {
+			if _, err = FindRoleByID(ctx, *input.RoleID); err != nil {
+				return Group{}, app.Errorf(app.ERR_INVALID, "Role %q does not exist", *input.RoleID)
+			}
+			group.RoleID = input.RoleID
+		}
+	}
+	if input.Permissions != nil {
+		group.Permissions = *input.Permissions
+	}
+
+	group.Role = nil
+	if err = Tx(ctx).Omit("Role").Save(&group).Error; err != nil {
+		return Group{}, err
+	}
+	if err = invalidateUsers(ctx); err != nil {
+		return Group{}, err
+	}
+	return FindGroupByID(ctx, tenantID, id)
+}
+
+// DeleteGroup deletes a group of a tenant. Its subgroups move up to the top level.
+func DeleteGroup(ctx echo.Context, tenantID, id string) error {
+	result := Tx(ctx).Where("tenant_id = ? AND id = ?", tenantID, id).Delete(&Group{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return invalidateUsers(ctx)
+}
+
+// AddGroupMember adds a member of a tenant to one of its groups
+func AddGroupMember(ctx echo.Context, tenantID, groupID string, input app.GroupMemberAddInput) error {
+	if err := input.Validate(); err != nil {
+		return err
+	}
+	if _, err := FindGroupByID(ctx, tenantID, groupID); err != nil {
+		return err
+	}
+	if _, err := findTenantMembership(ctx, tenantID, input.UserID); err != nil {
+		return app.Errorf(app.ERR_INVALID, "User is not a member of this tenant")
+	}
+
+	var count int64
+	err := Tx(ctx).Model(&GroupMember{}).Where("group_id = ? AND user_id = ?", groupID, input.UserID).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return app.Errorf(app.ERR_INVALID, "User is already a member of this group")
+	}
+	if err = Tx(ctx).Create(&GroupMember{GroupID: groupID, UserID: input.UserID}).Error; err != nil {
+		return err
+	}
+	return invalidateUser(ctx, input.UserID)
+}
+
+// RemoveGroupMember removes a user from a group of a tenant
+func RemoveGroupMember(ctx echo.Context, tenantID, groupID, userID string) error {
+	if _, err := FindGroupByID(ctx, tenantID, groupID); err != nil {
+		return err
+	}
+	result := Tx(ctx).Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&GroupMember{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return invalidateUser(ctx, userID)
+}
+
+// removeTenantGroupMembers removes a user from all groups of a tenant
+func removeTenantGroupMembers(ctx echo.Context, tenantID, userID string) error {
+	return Tx(ctx).Where("user_id = ? AND group_id IN (?)", userID,
+		Tx(ctx).Model(&Group{}).Select("id").Where("tenant_id = ?", tenantID)).
+		Delete(&GroupMember{}).Error
+}
+
+// findGroupGrants returns the groups a user belongs to in a tenant, either directly or as a member of a subgroup,
+// along with the roles and permissions they grant
+func findGroupGrants(ctx echo.Context, tenantID, userID string) ([]groupGrant, error) {
+	var grants []groupGrant
+	result := Tx(ctx).Raw(`
+		WITH RECURSIVE member_groups AS (
+			SELECT g.id, g.parent_id, g.role_id, g.permissions FROM tenant_groups g
+				JOIN tenant_group_members m ON m.group_id = g.id
+				WHERE g.tenant_id = ? AND m.user_id = ?
+			UNION
+			SELECT p.id, p.parent_id, p.role_id, p.permissions FROM tenant_groups p
+				JOIN member_groups c ON p.id = c.parent_id
+		)
+		SELECT mg.id, mg.permissions, r.name AS role_name, r.permissions AS role_permissions FROM member_groups mg
+			LEFT JOIN roles r ON r.id = mg.role_id AND r.deleted IS NULL
+			ORDER BY mg.id`, tenantID, userID).Scan(&grants)
+	return grants, result.Error
+}
+
+// findGroupGrantsOfUsers returns the groups the given users belong to in any tenant, like findGroupGrants, by
+// tenant and user
+func findGroupGrantsOfUsers(ctx echo.Context, userIDs []string) (map[memberKey][]groupGrant, error) {
+	var grants []groupGrant
+	result := Tx(ctx).Raw(`
+		WITH RECURSIVE member_groups AS (
+			SELECT m.user_id, g.tenant_id, g.id, g.parent_id, g.role_id, g.permissions FROM tenant_groups g
+				JOIN tenant_group_members m ON m.group_id = g.id
+				WHERE m.user_id IN ?
+			UNION
+			SELECT c.user_id, p.tenant_id, p.id, p.parent_id, p.role_id, p.permissions FROM tenant_groups p
+				JOIN member_groups c ON p.id = c.parent_id
+		)
+		SELECT mg.user_id, mg.tenant_id, mg.id, mg.permissions, r.name AS role_name,
+				r.permissions AS role_permissions FROM member_groups mg
+			LEFT JOIN roles r ON r.id = mg.role_id AND r.deleted IS NULL
+			ORDER BY mg.id`, userIDs).Scan(&grants)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	byMember := map[memberKey][]groupGrant{}
+	for _, g := range grants {
+		key := memberKey{TenantID: g.TenantID, UserID: g.UserID}
+		byMember[key] = append(byMember[key], g)
+	}
+	return byMember, nil
+}
+
+// FindGroupPermissions returns the permissions a group grants to its members, including those granted by its
+// ancestor groups
+func FindGroupPermissions(ctx echo.Context, tenantID, id string) ([]string, error) {
+	var grants []groupGrant
+	result := Tx(ctx).Raw(`
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id, role_id, permissions FROM tenant_groups WHERE tenant_id = ? AND id = ?
+			UNION
+			SELECT p.id, p.parent_id, p.role_id, p.permissions FROM tenant_groups p
+				JOIN ancestors a ON p.id = a.parent_id
+		)
+		SELECT a.id, a.permissions, r.permissions AS role_permissions FROM ancestors a
+			LEFT JOIN roles r ON r.id = a.role_id AND r.deleted IS NULL`, tenantID, id).Scan(&grants)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	permissions := []string{}
+	for _, g := range grants {
+		addPermissions(&permissions, g.RolePermissions)
+		addPermissions(&permissions, g.Permissions)
+	}
+	return permissions, nil
+}
+
+// findGroupMemberIDsOfGroups returns the IDs of the direct members of the given groups, by group
+func findGroupMemberIDsOfGroups(ctx echo.Context, groupIDs []string) (map[string][]string, error) {
+	var members []GroupMember
+	result := Tx(ctx).Where("group_id IN ?", groupIDs).Order("created_at, user_id").Find(&members)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	byGroup := map[string][]string{}
+	for _, m := range members {
+		byGroup[m.GroupID] = append(byGroup[m.GroupID], m.UserID)
+	}
+	return byGroup, nil
+}
+
+// checkGroupName returns an error if another group in the tenant has the given name
+func checkGroupName(ctx echo.Context, tenantID, id, name string) error {
+	var count int64
+	err := Tx(ctx).Model(&Group{}).Where("tenant_id = ? AND name = ? AND id <> ?", tenantID, name, id).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return app.Errorf(app.ERR_INVALID, "Group %q already exists", name)
+	}
+	return nil
+}
+
+// checkGroupParent returns an error if the parent does not exist in the tenant, or if making it the parent of the
+// group would create a cycle
+func checkGroupParent(ctx echo.Context, tenantID, id, parentID string) error {
+	if _, err := FindGroupByID(ctx, tenantID, parentID); err != nil {
+		return app.Errorf(app.ERR_INVALID, "Parent group %q does not exist", parentID)
+	}
+
+	var ancestorIDs []string
+	err := Tx(ctx).Raw(`
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM tenant_groups WHERE id = ?
+			UNION
+			SELECT p.id, p.parent_id FROM tenant_groups p JOIN ancestors a ON p.id = a.parent_id
+		)
+		SELECT id FROM ancestors`, parentID).Scan(&ancestorIDs).Error
+	if err != nil {
+		return err
+	}
+	for _, a := range ancestorIDs {
+		if a == id {
+			return app.Errorf(app.ERR_INVALID, "A group cannot be nested within itself")
+		}
+	}
+	return nil
+}
+
+func ConvertGroup(ctx echo.Context, g Group) (app.Group, error) {
+	groups, err := ConvertGroups(ctx, []Group{g})
+	if err != nil {
+		return app.Group{}, err
+	}
+	return groups[0], nil
+}
+
+// ConvertGroups converts a list of groups, finding the members of all of them at once rather than one group at a
+// time. Their roles are expected to be preloaded, as by FindGroups.
+func ConvertGroups(ctx echo.Context, groups []Group) ([]app.Group, error) {
+	out := make([]app.Group, len(groups))
+	if len(groups) == 0 {
+		return out, nil
+	}
+
+	groupIDs := make([]string, len(groups))
+	for i, g := range groups {
+		groupIDs[i] = g.ID
+	}
+	memberIDs, err := findGroupMemberIDsOfGroups(ctx, groupIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, g := range groups {
+		group := app.Group{
+			ID:          g.ID,
+			TenantID:    g.TenantID,
+			Name:        g.Name,
+			Description: g.Description,
+			Permissions: g.Permissions,
+			MemberIDs:   memberIDs[g.ID],
+			CreatedAt:   g.CreatedAt,
+			UpdatedAt:   g.UpdatedAt,
+		}
+		if g.ParentID != nil {
+			group.ParentID = *g.ParentID
+		}
+		if g.RoleID != nil {
+			group.RoleID = *g.RoleID
+		}
+		if g.Role != nil {
+			group.Role = g.Role.Name
+		}
+		if group.Permissions == nil {
+			group.Permissions = []string{}
+		}
+		if group.MemberIDs == nil {
+			group.MemberIDs = []string{}
+		}
+		out[i] = group
+	}
+	return out, nil
+}
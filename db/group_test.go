@@ -0,0 +1,126 @@
+package db_test
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+)
+
+func (ts *TestSuite) Test_Groups() {
+	tenant, err := db.CreateTenant(ts.ctx, app.TenantCreateInput{Name: "tenant"})
+	ts.NoError(err)
+	user := ts.CreateUser(app.UserCreateInput{Email: "engineer@example.com", TenantID: tenant.ID})
+
+	role, err := db.CreateRole(ts.ctx, app.RoleCreateInput{
+		Name:        "Member Manager",
+		Permissions: []string{app.PermissionOwnTenantUsersList},
+	})
+	ts.NoError(err)
+
+	engineering, err := db.CreateGroup(ts.ctx, tenant.ID, app.GroupCreateInput{
+		Name:        "Engineering",
+		Permissions: []string{app.PermissionOwnTenantRead},
+	})
+	ts.NoError(err)
+	backend, err := db.CreateGroup(ts.ctx, tenant.ID, app.GroupCreateInput{
+		Name:     "Backend",
+		ParentID: engineering.ID,
+		RoleID:   role.ID,
+	})
+	ts.NoError(err)
+	ts.Equal(role.Name, backend.Role.Name)
+
+	// Expect errors for a duplicate name, a global permission, and an unknown parent
+	_, err = db.CreateGroup(ts.ctx, tenant.ID, app.GroupCreateInput{Name: "Backend"})
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err))
+	_, err = db.CreateGroup(ts.ctx, tenant.ID, app.GroupCreateInput{
+		Name:        "Operators",
+		Permissions: []string{app.PermissionTenantsCreate},
+	})
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err))
+	_, err = db.CreateGroup(ts.ctx, tenant.ID, app.GroupCreateInput{Name: "Operators", ParentID: "nope"})
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err))
+
+	// Expect an error for a cycle
+	_, err = db.UpdateGroup(ts.ctx, tenant.ID, engineering.ID, app.GroupUpdateInput{ParentID: &backend.ID})
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err))
+
+	ts.NoError(db.AddGroupMember(ts.ctx, tenant.ID, backend.ID, app.GroupMemberAddInput{UserID: user.ID}))
+	ts.Error(db.AddGroupMember(ts.ctx, tenant.ID, backend.ID, app.GroupMemberAddInput{UserID: user.ID}))
+
+	// Permissions resolve through the group, its role, and its parent group
+	converted, err := db.ConvertUser(ts.ctx, user)
+	ts.NoError(err)
+	ts.ElementsMatch([]string{engineering.ID, backend.ID}, converted.Memberships[0].GroupIDs)
+	ts.True(converted.HasTenantPermission(tenant.ID, app.PermissionTenantsUsersList))
+	ts.True(converted.HasTenantPermission(tenant.ID, app.PermissionTenantsRead))
+	ts.False(converted.HasTenantPermission(tenant.ID, app.PermissionTenantsUpdate))
+
+	permissions, err := db.FindGroupPermissions(ts.ctx, tenant.ID, backend.ID)
+	ts.NoError(err)
+	ts.ElementsMatch([]string{app.PermissionOwnTenantUsersList, app.PermissionOwnTenantRead}, permissions)
+
+	g, err := db.ConvertGroup(ts.ctx, backend)
+	ts.NoError(err)
+	ts.Equal([]string{user.ID}, g.MemberIDs)
+	ts.Equal(engineering.ID, g.ParentID)
+
+	// Deleting the parent moves the subgroup to the top level
+	ts.NoError(db.DeleteGroup(ts.ctx, tenant.ID, engineering.ID))
+	backend, err = db.FindGroupByID(ts.ctx, tenant.ID, backend.ID)
+	ts.NoError(err)
+	ts.Nil(backend.ParentID)
+
+	converted, err = db.ConvertUser(ts.ctx, user)
+	ts.NoError(err)
+	ts.False(converted.HasTenantPermission(tenant.ID, app.PermissionTenantsRead))
+
+	// Leaving the tenant leaves its groups
+	ts.NoError(db.DeleteTenantMembership(ts.ctx, tenant.ID, user.ID))
+	g, err = db.ConvertGroup(ts.ctx, backend)
+	ts.NoError(err)
+	ts.Empty(g.MemberIDs)
+}
+
+func (ts *TestSuite) Test_ConvertGroups() {
+	tenant, err := db.CreateTenant(ts.ctx, app.TenantCreateInput{Name: "tenant"})
+	ts.NoError(err)
+	user := ts.CreateUser(app.UserCreateInput{Email: "groups@example.com", TenantID: tenant.ID})
+
+	for _, name := range []string{"Engineering", "Finance", "Marketing", "Sales"} {
+		group, err := db.CreateGroup(ts.ctx, tenant.ID, app.GroupCreateInput{Name: name})
+		ts.NoError(err)
+		ts.NoError(db.AddGroupMember(ts.ctx, tenant.ID, group.ID, app.GroupMemberAddInput{UserID: user.ID}))
+	}
+	groups, err := db.FindGroups(ts.ctx, tenant.ID)
+	ts.NoError(err)
+
+	converted, err := db.ConvertGroups(ts.ctx, groups)
+	ts.NoError(err)
+	ts.Len(converted, len(groups))
+	for i, g := range groups {
+		one, err := db.ConvertGroup(ts.ctx, g)
+		ts.NoError(err)
+		ts.Equal(one, converted[i], "a group converted in a list is the same as on its own")
+		ts.Equal([]string{user.ID}, converted[i].MemberIDs)
+	}
+
+	// the number of queries does not grow with the number of groups
+	conn := db.OpenDB()
+	sqlDB, err := conn.DB()
+	ts.NoError(err)
+	defer sqlDB.Close()
+	var queries int
+	ts.NoError(conn.Callback().Query().Before("gorm:query").Register("test:count", func(*gorm.DB) { queries++ }))
+	ts.NoError(conn.Callback().Raw().Before("gorm:raw").Register("test:count", func(*gorm.DB) { queries++ }))
+	ctx := testContext(conn)
+
+	_, err = db.ConvertGroups(ctx, groups[:2])
+	ts.NoError(err)
+	two := queries
+	queries = 0
+	_, err = db.ConvertGroups(ctx, groups)
+	ts.NoError(err)
+	ts.Equal(two, queries)
+}
@@ -0,0 +1,271 @@
+package db
+
+import (
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"github.com/briskt/keygo/app"
+)
+
+type TenantInvitation struct {
+	ID        string `gorm:"primaryKey;type:string"`
+	TenantID  string
+	Tenant    Tenant
+	Email     string `validate:"email"`
+	RoleID    string
+	Role      Role
+	InviterID *string
+
+	TokenHash string
+	Token     string `gorm:"-"` // only set when the invitation is created or resent
+
+	SentAt       time.Time
+	ExpiresAt    time.Time
+	AcceptedAt   *time.Time
+	AcceptedByID *string
+	RevokedAt    *time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (i *TenantInvitation) BeforeCreate(_ *gorm.DB) error {
+	i.ID = newID()
+	return nil
+}
+
+// status returns the state of the invitation at the given time
+func (i TenantInvitation) status(now time.Time) string {
+	switch {
+	case i.AcceptedAt != nil:
+		return app.InvitationStatusAccepted
+	case i.RevokedAt != nil:
+		return app.InvitationStatusRevoked
+	case !now.Before(i.ExpiresAt):
+		return app.InvitationStatusExpired
+	}
+	return app.InvitationStatusPending
+}
+
+// FindTenantInvitations retrieves a list of invitations by filter, newest first
+func FindTenantInvitations(ctx echo.Context, filter app.InvitationFilter) ([]TenantInvitation, error) {
+	var invitations []TenantInvitation
+	q := Tx(ctx).Preload("Tenant").Preload("Role").Order("created_at DESC, id")
+	if filter.TenantID != nil {
+		q = q.Where("tenant_id = ?", filter.TenantID)
+	}
+	if filter.Email != nil {
+		q = q.Where("email = ?", normalizeEmail(*filter.Email))
+	}
+	result := q.Find(&invitations)
+	return invitations, result.Error
+}
+
+// FindTenantInvitationByID retrieves an invitation to a tenant by ID
+func FindTenantInvitationByID(ctx echo.Context, tenantID, id string) (TenantInvitation, error) {
+	var invitation TenantInvitation
+	result := Tx(ctx).Preload("Tenant").Preload("Role").
+		First(&invitation, "tenant_id = ? AND id = ?", tenantID, id)
+	return invitation, result.Error
+}
+
+// CreateTenantInvitation creates a pending invitation to a tenant, with a new single-use token
+func CreateTenantInvitation(ctx echo.Context, tenantID, inviterID string,
+	input app.InvitationCreateInput,
+) (TenantInvitation, error) {
+	if err := input.Validate(); err != nil {
+		return TenantInvitation{}, err
+	}
+	email := normalizeEmail(input.Email)
+
+	role, err := findInvitationRole(ctx, input.RoleID)
+	if err != nil {
+		return TenantInvitation{}, err
+	}
+
+	var count int64
+	err = Tx(ctx).Model(&TenantMembership{}).Where("tenant_id = ? AND user_id IN (?)", tenantID,
+		Tx(ctx).Model(&User{}).Select("id").Where("lower(email) = ?", email)).Count(&count).Error
+	if err != nil {
+		return TenantInvitation{}, err
+	}
+	if count > 0 {
+		return TenantInvitation{}, app.Errorf(app.ERR_INVALID, "User is already a member of this tenant")
+	}
+
+	err = Tx(ctx).Model(&TenantInvitation{}).
+		Where("tenant_id = ? AND email = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?",
+			tenantID, email, time.Now()).
+		Count(&count).Error
+	if err != nil {
+		return TenantInvitation{}, err
+	}
+	if count > 0 {
+		return TenantInvitation{}, app.Errorf(app.ERR_INVALID, "%s already has a pending invitation", email)
+	}
+
+	invitation := TenantInvitation{
+		TenantID: tenantID,
+		Email:    email,
+		RoleID:   role.ID,
+	}
+	if inviterID != "" {
+		invitation.InviterID = &inviterID
+	}
+	invitation.setToken()
+	if err = create(Tx(ctx).Omit("Tenant", "Role"), &invitation); err != nil {
+		return TenantInvitation{}, err
+	}
+	return reloadInvitation(ctx, invitation)
+}
+
+// ResendTenantInvitation replaces the token of a pending or expired invitation, and restarts its lifetime. Like
+// creating an invitation, this grants its role, so the caller must check that the actor may grant the role.
+func ResendTenantInvitation(ctx echo.Context, tenantID, id string) (TenantInvitation, error) {
+	invitation, err := FindTenantInvitationByID(ctx, tenantID, id)
+	if err != nil {
+		return TenantInvitation{}, err
+	}
+	if s := invitation.status(time.Now()); s != app.InvitationStatusPending && s != app.InvitationStatusExpired {
+		return TenantInvitation{}, app.Errorf(app.ERR_INVALID, "Invitation is %s", s)
+	}
+
+	invitation.setToken()
+	err = Tx(ctx).Model(&TenantInvitation{}).Where("id = ?", id).Updates(map[string]any{
+		"token_hash": invitation.TokenHash,
+		"sent_at":    invitation.SentAt,
+		"expires_at": invitation.ExpiresAt,
+		"updated_at": time.Now(),
+	}).Error
+	if err != nil {
+		return TenantInvitation{}, err
+	}
+	return reloadInvitation(ctx, invitation)
+}
+
+// RevokeTenantInvitation cancels a pending invitation
+func RevokeTenantInvitation(ctx echo.Context, tenantID, id string) (TenantInvitation, error) {
+	invitation, err := FindTenantInvitationByID(ctx, tenantID, id)
+	if err != nil {
+		return TenantInvitation{}, err
+	}
+	if s := invitation.status(time.Now()); s == app.InvitationStatusAccepted || s == app.InvitationStatusRevoked {
+		return TenantInvitation{}, app.Errorf(app.ERR_INVALID, "Invitation is %s", s)
+	}
+
+	now := time.Now()
+	err = Tx(ctx).Model(&TenantInvitation{}).Where("id = ?", id).
+		Updates(map[string]any{"revoked_at": now, "updated_at": now}).Error
+	if err != nil {
+		return TenantInvitation{}, err
+	}
+	return FindTenantInvitationByID(ctx, tenantID, id)
+}
+
+// AcceptTenantInvitation adds a user to the tenant of the invitation identified by the token. The user's email
+// address must match the invitation, and the token can be used only once.
+func AcceptTenantInvitation(ctx echo.Context, userID string,
+	input app.InvitationAcceptInput,
+) (TenantMembership, error) {
+	if err := input.Validate(); err != nil {
+		return TenantMembership{}, err
+	}
+
+	var invitation TenantInvitation
+	err := Tx(ctx).Preload("Role").First(&invitation, "token_hash = ?", hashToken(input.Token)).Error
+	if err == gorm.ErrRecordNotFound {
+		return TenantMembership{}, app.Errorf(app.ERR_NOTFOUND, "Invitation not found")
+	}
+	if err != nil {
+		return TenantMembership{}, err
+	}
+	if s := invitation.status(time.Now()); s != app.InvitationStatusPending {
+		return TenantMembership{}, app.Errorf(app.ERR_INVALID, "Invitation is %s", s)
+	}
+
+	user, err := findUserByID(ctx, userID)
+	if err != nil {
+		return TenantMembership{}, err
+	}
+	if normalizeEmail(user.Email) != invitation.Email {
+		return TenantMembership{}, app.Errorf(app.ERR_NOTFOUND, "Invitation not found")
+	}
+
+	membership, err := CreateTenantMembership(ctx, app.TenantMembershipCreateInput{
+		TenantID: invitation.TenantID,
+		UserID:   userID,
+		Role:     invitation.Role.Name,
+	})
+	if err != nil {
+		return TenantMembership{}, err
+	}
+
+	now := time.Now()
+	err = Tx(ctx).Model(&TenantInvitation{}).Where("id = ?", invitation.ID).
+		Updates(map[string]any{"accepted_at": now, "accepted_by_id": userID, "updated_at": now}).Error
+	if err != nil {
+		return TenantMembership{}, err
+	}
+	return membership, nil
+}
+
+// setToken generates a new token for the invitation, and restarts its lifetime
+func (i *TenantInvitation) setToken() {
+	i.Token = randomString()
+	i.TokenHash = hashToken(i.Token)
+	i.SentAt = time.Now()
+	i.ExpiresAt = i.SentAt.Add(app.InvitationLifetime)
+}
+
+// reloadInvitation fetches the invitation with its associations, keeping the plain text token
+func reloadInvitation(ctx echo.Context, invitation TenantInvitation) (TenantInvitation, error) {
+	reloaded, err := FindTenantInvitationByID(ctx, invitation.TenantID, invitation.ID)
+	if err != nil {
+		return TenantInvitation{}, err
+	}
+	reloaded.Token = invitation.Token
+	return reloaded, nil
+}
+
+// findInvitationRole returns the role with the given ID, or the Basic role if the ID is empty
+func findInvitationRole(ctx echo.Context, roleID string) (Role, error) {
+	if roleID == "" {
+		return findRoleByName(ctx, app.UserRoleBasic)
+	}
+	role, err := FindRoleByID(ctx, roleID)
+	if err != nil {
+		return Role{}, app.Errorf(app.ERR_INVALID, "Role %q does not exist", roleID)
+	}
+	return role, nil
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func ConvertTenantInvitation(_ echo.Context, i TenantInvitation) (app.Invitation, error) {
+	invitation := app.Invitation{
+		ID:         i.ID,
+		TenantID:   i.TenantID,
+		TenantName: i.Tenant.Name,
+		Email:      i.Email,
+		RoleID:     i.RoleID,
+		Role:       i.Role.Name,
+		Status:     i.status(time.Now()),
+		SentAt:     i.SentAt,
+		ExpiresAt:  i.ExpiresAt,
+		AcceptedAt: i.AcceptedAt,
+		RevokedAt:  i.RevokedAt,
+		CreatedAt:  i.CreatedAt,
+		UpdatedAt:  i.UpdatedAt,
+	}
+	if i.InviterID != nil {
+		invitation.InviterID = *i.InviterID
+	}
+	if i.AcceptedByID != nil {
+		invitation.AcceptedByID = *i.AcceptedByID
+	}
+	return invitation, nil
+}
@@ -0,0 +1,47 @@
+package db_test
+
+import (
+	"time"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+)
+
+func (ts *TestSuite) Test_TenantInvitations() {
+	tenant, err := db.CreateTenant(ts.ctx, app.TenantCreateInput{Name: "tenant"})
+	ts.NoError(err)
+	user := ts.CreateUser(app.UserCreateInput{Email: "invitee@example.com"})
+
+	_, err = db.CreateTenantInvitation(ts.ctx, tenant.ID, "", app.InvitationCreateInput{Email: "not an address"})
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err))
+
+	invitation, err := db.CreateTenantInvitation(ts.ctx, tenant.ID, "",
+		app.InvitationCreateInput{Email: "Invitee@example.com"})
+	ts.NoError(err)
+	ts.NotEmpty(invitation.Token)
+	ts.NotEqual(invitation.Token, invitation.TokenHash, "the token must be stored hashed")
+	ts.WithinDuration(time.Now().Add(app.InvitationLifetime), invitation.ExpiresAt, time.Minute)
+
+	// Resending replaces the token
+	resent, err := db.ResendTenantInvitation(ts.ctx, tenant.ID, invitation.ID)
+	ts.NoError(err)
+	ts.NotEqual(invitation.Token, resent.Token)
+	_, err = db.AcceptTenantInvitation(ts.ctx, user.ID, app.InvitationAcceptInput{Token: invitation.Token})
+	ts.Equal(app.ERR_NOTFOUND, app.ErrorCode(err), "the old token should no longer work")
+
+	membership, err := db.AcceptTenantInvitation(ts.ctx, user.ID, app.InvitationAcceptInput{Token: resent.Token})
+	ts.NoError(err)
+	ts.Equal(tenant.ID, membership.TenantID)
+	ts.Equal(app.UserRoleBasic, membership.Role.Name)
+
+	invitations, err := db.FindTenantInvitations(ts.ctx, app.InvitationFilter{TenantID: &tenant.ID})
+	ts.NoError(err)
+	ts.Len(invitations, 1)
+	converted, err := db.ConvertTenantInvitation(ts.ctx, invitations[0])
+	ts.NoError(err)
+	ts.Equal(app.InvitationStatusAccepted, converted.Status)
+	ts.Equal(user.ID, converted.AcceptedByID)
+
+	_, err = db.RevokeTenantInvitation(ts.ctx, tenant.ID, invitation.ID)
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "an accepted invitation cannot be revoked")
+}
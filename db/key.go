@@ -0,0 +1,256 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/keys"
+)
+
+type KeyRing struct {
+	ID            string `gorm:"primaryKey;type:string"`
+	TenantID      string
+	Name          string
+	Type          string
+	LatestVersion int
+	Versions      []KeyVersion
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (KeyRing) TableName() string {
+	return "key_rings"
+}
+
+func (k *KeyRing) BeforeCreate(_ *gorm.DB) error {
+	k.ID = newID()
+	return nil
+}
+
+// KeyVersion is the key material of one version of a key ring, wrapped by the master key. For a signing key, the
+// key material is the private key, and the public key is stored in the clear.
+type KeyVersion struct {
+	ID         string `gorm:"primaryKey;type:string"`
+	KeyRingID  string
+	Version    int
+	WrappedKey []byte
+	PublicKey  []byte
+	CreatedAt  time.Time
+}
+
+func (KeyVersion) TableName() string {
+	return "key_versions"
+}
+
+func (k *KeyVersion) BeforeCreate(_ *gorm.DB) error {
+	k.ID = newID()
+	return nil
+}
+
+// FindKeyRings retrieves the key rings of a tenant, ordered by name, excluding reserved key rings
+func FindKeyRings(ctx echo.Context, tenantID string) ([]KeyRing, error) {
+	var rings []KeyRing
+	result := Tx(ctx).Preload("Versions", orderKeyVersions).
+		Where("tenant_id = ? AND name NOT LIKE ?", tenantID, escapeLike(reservedKeyRingPrefix)+"%").Order("name").
+		Find(&rings)
+	return rings, result.Error
+}
+
+// FindKeyRingByName retrieves a key ring of a tenant by name. Reserved key rings are not found.
+func FindKeyRingByName(ctx echo.Context, tenantID, name string) (KeyRing, error) {
+	if isReservedKeyRing(name) {
+		return KeyRing{}, gorm.ErrRecordNotFound
+	}
+	var ring KeyRing
+	result := Tx(ctx).Preload("Versions", orderKeyVersions).
+		First(&ring, "tenant_id = ? AND name = ?", tenantID, name)
+	return ring, result.Error
+}
+
+// CreateKeyRing creates a new key ring in a tenant, with new key material as its first version
+func CreateKeyRing(ctx echo.Context, tenantID string, wrapper app.KeyWrapper,
+	input app.KeyRingCreateInput,
+) (KeyRing, error) {
+	if err := input.Validate(); err != nil {
+		return KeyRing{}, err
+	}
+
+	var count int64
+	err := Tx(ctx).Model(&KeyRing{}).Where("tenant_id = ? AND name = ?", tenantID, input.Name).Count(&count).Error
+	if err != nil {
+		return KeyRing{}, err
+	}
+	if count > 0 {
+		return KeyRing{}, app.Errorf(app.ERR_INVALID, "A key named %q already exists", input.Name)
+	}
+
+	ring := KeyRing{TenantID: tenantID, Name: input.Name, Type: input.Type, LatestVersion: 1}
+	if err = Tx(ctx).Omit("Versions").Create(&ring).Error; err != nil {
+		return KeyRing{}, err
+	}
+	if err = createKeyVersion(ctx, ring, wrapper); err != nil {
+		return KeyRing{}, err
+	}
+	return FindKeyRingByName(ctx, tenantID, input.Name)
+}
+
+// RotateKeyRing adds a new version of key material to a key ring, which is used for all subsequent encryption.
+// Reserved key rings are not found.
+func RotateKeyRing(ctx echo.Context, tenantID, name string, wrapper app.KeyWrapper) (KeyRing, error) {
+	if isReservedKeyRing(name) {
+		return KeyRing{}, gorm.ErrRecordNotFound
+	}
+	var ring KeyRing
+	err := Tx(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&ring, "tenant_id = ? AND name = ?", tenantID, name).Error
+	if err != nil {
+		return KeyRing{}, err
+	}
+
+	ring.LatestVersion++
+	err = Tx(ctx).Model(&ring).Updates(map[string]any{"latest_version": ring.LatestVersion, "updated_at": time.Now()}).
+		Error
+	if err != nil {
+		return KeyRing{}, err
+	}
+	if err = createKeyVersion(ctx, ring, wrapper); err != nil {
+		return KeyRing{}, err
+	}
+	return FindKeyRingByName(ctx, tenantID, name)
+}
+
+// FindKey returns the unwrapped key material of a version of an encryption key ring, and the version. Version 0
+// selects the latest version.
+func FindKey(ctx echo.Context, tenantID, name string, version int, wrapper app.KeyWrapper) ([]byte, int, error) {
+	ring, kv, err := findKeyVersion(ctx, tenantID, name, version)
+	if err != nil {
+		return nil, 0, err
+	}
+	if app.IsSigningKeyType(ring.Type) {
+		return nil, 0, app.Errorf(app.ERR_INVALID, "Key %q is a signing key, not an encryption key", name)
+	}
+	return unwrapKeyVersion(ring, kv, wrapper)
+}
+
+// FindSigningKey returns the unwrapped private key of a version of a signing key ring, and the version. Version 0
+// selects the latest version.
+func FindSigningKey(ctx echo.Context, tenantID, name string, version int,
+	wrapper app.KeyWrapper,
+) ([]byte, int, error) {
+	ring, kv, err := findKeyVersion(ctx, tenantID, name, version)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !app.IsSigningKeyType(ring.Type) {
+		return nil, 0, app.Errorf(app.ERR_INVALID, "Key %q is not a signing key", name)
+	}
+	return unwrapKeyVersion(ring, kv, wrapper)
+}
+
+// FindPublicKey returns the public key of a version of a signing key ring, and the version. Version 0 selects the
+// latest version.
+func FindPublicKey(ctx echo.Context, tenantID, name string, version int) ([]byte, int, error) {
+	ring, kv, err := findKeyVersion(ctx, tenantID, name, version)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !app.IsSigningKeyType(ring.Type) {
+		return nil, 0, app.Errorf(app.ERR_INVALID, "Key %q is not a signing key", name)
+	}
+	return kv.PublicKey, kv.Version, nil
+}
+
+func ConvertKeyRing(_ echo.Context, k KeyRing) (app.KeyRing, error) {
+	ring := app.KeyRing{
+		ID:            k.ID,
+		TenantID:      k.TenantID,
+		Name:          k.Name,
+		Type:          k.Type,
+		LatestVersion: k.LatestVersion,
+		Versions:      make([]app.KeyVersion, len(k.Versions)),
+		CreatedAt:     k.CreatedAt,
+		UpdatedAt:     k.UpdatedAt,
+	}
+	for i, v := range k.Versions {
+		ring.Versions[i] = app.KeyVersion{Version: v.Version, CreatedAt: v.CreatedAt}
+	}
+	return ring, nil
+}
+
+// createKeyVersion generates and stores the key material of the latest version of a key ring
+func createKeyVersion(ctx echo.Context, ring KeyRing, wrapper app.KeyWrapper) error {
+	var key, public []byte
+	var err error
+	if app.IsSigningKeyType(ring.Type) {
+		key, public, err = keys.NewSigningKey(ring.Type)
+	} else {
+		key, err = keys.NewKey()
+	}
+	if err != nil {
+		return err
+	}
+	wrapped, err := wrapper.WrapKey(key, keyWrapContext(ring, ring.LatestVersion))
+	if err != nil {
+		return fmt.Errorf("wrap key: %w", err)
+	}
+	kv := KeyVersion{KeyRingID: ring.ID, Version: ring.LatestVersion, WrappedKey: wrapped, PublicKey: public}
+	return Tx(ctx).Create(&kv).Error
+}
+
+// findKeyVersion retrieves a key ring of a tenant by name, and one of its versions, for API callers. Version 0
+// selects the latest version. Reserved key rings are not found.
+func findKeyVersion(ctx echo.Context, tenantID, name string, version int) (KeyRing, KeyVersion, error) {
+	if isReservedKeyRing(name) {
+		return KeyRing{}, KeyVersion{}, gorm.ErrRecordNotFound
+	}
+	return findRingVersion(ctx, tenantID, name, version)
+}
+
+// findRingVersion is like findKeyVersion, but also finds reserved key rings
+func findRingVersion(ctx echo.Context, tenantID, name string, version int) (KeyRing, KeyVersion, error) {
+	var ring KeyRing
+	if err := Tx(ctx).First(&ring, "tenant_id = ? AND name = ?", tenantID, name).Error; err != nil {
+		return KeyRing{}, KeyVersion{}, err
+	}
+	if version == 0 {
+		version = ring.LatestVersion
+	}
+
+	var kv KeyVersion
+	err := Tx(ctx).First(&kv, "key_ring_id = ? AND version = ?", ring.ID, version).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return KeyRing{}, KeyVersion{}, app.Errorf(app.ERR_NOTFOUND, "Key %q has no version %d", name, version)
+	}
+	return ring, kv, err
+}
+
+// isReservedKeyRing returns true if a key ring is used internally, e.g. to encrypt secrets, and not by API callers
+func isReservedKeyRing(name string) bool {
+	return strings.HasPrefix(name, reservedKeyRingPrefix)
+}
+
+// unwrapKeyVersion returns the unwrapped key material of a key version, and the version
+func unwrapKeyVersion(ring KeyRing, kv KeyVersion, wrapper app.KeyWrapper) ([]byte, int, error) {
+	key, err := wrapper.UnwrapKey(kv.WrappedKey, keyWrapContext(ring, kv.Version))
+	if err != nil {
+		return nil, 0, fmt.Errorf("unwrap key %s version %d: %w", ring.ID, kv.Version, err)
+	}
+	return key, kv.Version, nil
+}
+
+// keyWrapContext binds wrapped key material to its key ring and version, so that it cannot be substituted for
+// another key's
+func keyWrapContext(ring KeyRing, version int) []byte {
+	return []byte(fmt.Sprintf("%s/%s/%d", ring.TenantID, ring.ID, version))
+}
+
+func orderKeyVersions(db *gorm.DB) *gorm.DB {
+	return db.Order("version")
+}
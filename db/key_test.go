@@ -0,0 +1,105 @@
+package db_test
+
+import (
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+	"github.com/briskt/keygo/keys"
+)
+
+func (ts *TestSuite) Test_KeyRings() {
+	material, err := keys.NewKey()
+	ts.NoError(err)
+	master, err := keys.NewMasterKey(material)
+	ts.NoError(err)
+
+	tenant, err := db.CreateTenant(ts.ctx, app.TenantCreateInput{Name: "tenant"})
+	ts.NoError(err)
+
+	_, err = db.CreateKeyRing(ts.ctx, tenant.ID, master, app.KeyRingCreateInput{Name: "no spaces"})
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err))
+
+	ring, err := db.CreateKeyRing(ts.ctx, tenant.ID, master, app.KeyRingCreateInput{Name: "payments"})
+	ts.NoError(err)
+	ts.Equal(1, ring.LatestVersion)
+	ts.Len(ring.Versions, 1)
+	ts.NotEqual(keys.KeySize, len(ring.Versions[0].WrappedKey), "the key must be stored wrapped")
+
+	_, err = db.CreateKeyRing(ts.ctx, tenant.ID, master, app.KeyRingCreateInput{Name: "payments"})
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "names are unique within a tenant")
+
+	v1, version, err := db.FindKey(ts.ctx, tenant.ID, "payments", 0, master)
+	ts.NoError(err)
+	ts.Equal(1, version)
+	ts.Len(v1, keys.KeySize)
+
+	ring, err = db.RotateKeyRing(ts.ctx, tenant.ID, "payments", master)
+	ts.NoError(err)
+	ts.Equal(2, ring.LatestVersion)
+	ts.Len(ring.Versions, 2)
+
+	v2, version, err := db.FindKey(ts.ctx, tenant.ID, "payments", 0, master)
+	ts.NoError(err)
+	ts.Equal(2, version)
+	ts.NotEqual(v1, v2)
+
+	old, _, err := db.FindKey(ts.ctx, tenant.ID, "payments", 1, master)
+	ts.NoError(err)
+	ts.Equal(v1, old, "old versions are kept")
+
+	_, _, err = db.FindKey(ts.ctx, tenant.ID, "payments", 3, master)
+	ts.Equal(app.ERR_NOTFOUND, app.ErrorCode(err))
+
+	otherMaterial, err := keys.NewKey()
+	ts.NoError(err)
+	otherMaster, err := keys.NewMasterKey(otherMaterial)
+	ts.NoError(err)
+	_, _, err = db.FindKey(ts.ctx, tenant.ID, "payments", 0, otherMaster)
+	ts.Error(err, "keys only unwrap with the master key that wrapped them")
+}
+
+func (ts *TestSuite) Test_SigningKeys() {
+	material, err := keys.NewKey()
+	ts.NoError(err)
+	master, err := keys.NewMasterKey(material)
+	ts.NoError(err)
+
+	tenant, err := db.CreateTenant(ts.ctx, app.TenantCreateInput{Name: "tenant"})
+	ts.NoError(err)
+
+	_, err = db.CreateKeyRing(ts.ctx, tenant.ID, master, app.KeyRingCreateInput{Name: "webhooks", Type: "dsa"})
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err))
+
+	ring, err := db.CreateKeyRing(ts.ctx, tenant.ID, master,
+		app.KeyRingCreateInput{Name: "webhooks", Type: app.KeyTypeEd25519})
+	ts.NoError(err)
+	ts.Equal(app.KeyTypeEd25519, ring.Type)
+	ts.NotEmpty(ring.Versions[0].PublicKey)
+
+	private, version, err := db.FindSigningKey(ts.ctx, tenant.ID, "webhooks", 0, master)
+	ts.NoError(err)
+	ts.Equal(1, version)
+	signature, err := keys.Sign(private, []byte("payload"))
+	ts.NoError(err)
+
+	_, err = db.RotateKeyRing(ts.ctx, tenant.ID, "webhooks", master)
+	ts.NoError(err)
+
+	public, version, err := db.FindPublicKey(ts.ctx, tenant.ID, "webhooks", 0)
+	ts.NoError(err)
+	ts.Equal(2, version)
+	ts.ErrorIs(keys.Verify(public, []byte("payload"), signature), keys.ErrVerify, "version 2 did not sign")
+
+	public, _, err = db.FindPublicKey(ts.ctx, tenant.ID, "webhooks", 1)
+	ts.NoError(err)
+	ts.NoError(keys.Verify(public, []byte("payload"), signature), "old versions still verify")
+
+	_, _, err = db.FindKey(ts.ctx, tenant.ID, "webhooks", 0, master)
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "signing keys do not encrypt")
+
+	_, err = db.CreateKeyRing(ts.ctx, tenant.ID, master, app.KeyRingCreateInput{Name: "payments"})
+	ts.NoError(err)
+	_, _, err = db.FindSigningKey(ts.ctx, tenant.ID, "payments", 0, master)
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "encryption keys do not sign")
+	_, _, err = db.FindPublicKey(ts.ctx, tenant.ID, "payments", 0)
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err))
+}
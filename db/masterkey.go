@@ -0,0 +1,84 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/briskt/keygo/app"
+)
+
+// masterKeyCheckValue is wrapped by the master key to recognize it later
+var masterKeyCheckValue = []byte("keygo master key check")
+
+// masterKeyCheckContext is the wrapping context of the check value
+var masterKeyCheckContext = []byte("master-key-check")
+
+// MasterKeyCheck is a known value wrapped by the master key, and how the master key is split into shares, if at
+// all. There is a single row.
+type MasterKeyCheck struct {
+	ID         int `gorm:"primaryKey"`
+	Wrapped    []byte
+	ShareCount int
+	Threshold  int
+
+	// WrappedMasterKey is the master key wrapped by the unseal key that the shares reconstruct. It is nil if the
+	// shares were split from the master key itself, before unseal keys were introduced.
+	WrappedMasterKey []byte
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (MasterKeyCheck) TableName() string {
+	return "master_key_check"
+}
+
+// VerifyMasterKey returns an error if the given master key is not the one tenant keys are wrapped with. The first
+// master key verified becomes the master key.
+func VerifyMasterKey(conn *gorm.DB, master app.KeyWrapper) error {
+	wrapped, err := master.WrapKey(masterKeyCheckValue, masterKeyCheckContext)
+	if err != nil {
+		return err
+	}
+	check := MasterKeyCheck{ID: 1, Wrapped: wrapped}
+	if err = conn.Clauses(clause.OnConflict{DoNothing: true}).Create(&check).Error; err != nil {
+		return err
+	}
+
+	if err = conn.First(&check, 1).Error; err != nil {
+		return err
+	}
+	value, err := master.UnwrapKey(check.Wrapped, masterKeyCheckContext)
+	if err != nil || !bytes.Equal(value, masterKeyCheckValue) {
+		return app.Errorf(app.ERR_INVALID, "Incorrect master key")
+	}
+	return nil
+}
+
+// FindMasterKeyCheck returns the master key check, and false if no master key has been verified yet
+func FindMasterKeyCheck(conn *gorm.DB) (MasterKeyCheck, bool, error) {
+	var check MasterKeyCheck
+	err := conn.First(&check, 1).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return MasterKeyCheck{}, false, nil
+	}
+	return check, err == nil, err
+}
+
+// SetMasterKeyShares verifies the master key, and records the share set of a new unseal key, under which the master
+// key is wrapped. Shares of the previous unseal key no longer unwrap the master key.
+func SetMasterKeyShares(conn *gorm.DB, master app.KeyWrapper, wrappedMasterKey []byte, shareCount, threshold int) error {
+	if err := VerifyMasterKey(conn, master); err != nil {
+		return err
+	}
+	return conn.Model(&MasterKeyCheck{ID: 1}).Updates(map[string]any{
+		"share_count":        shareCount,
+		"threshold":          threshold,
+		"wrapped_master_key": wrappedMasterKey,
+		"updated_at":         time.Now(),
+	}).Error
+}
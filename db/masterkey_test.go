@@ -0,0 +1,67 @@
+package db_test
+
+import (
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+	"github.com/briskt/keygo/keys"
+)
+
+func (ts *TestSuite) Test_VerifyMasterKey() {
+	// the check belongs to whichever master key is verified first, so start without one
+	deleteCheck := func() {
+		ts.NoError(ts.DB.Exec("DELETE FROM master_key_check").Error)
+	}
+	deleteCheck()
+	defer deleteCheck()
+
+	material, err := keys.NewKey()
+	ts.NoError(err)
+	master, err := keys.NewMasterKey(material)
+	ts.NoError(err)
+
+	ts.NoError(db.VerifyMasterKey(ts.DB, master), "the first master key is accepted")
+	ts.NoError(db.VerifyMasterKey(ts.DB, master), "and accepted again")
+
+	otherMaterial, err := keys.NewKey()
+	ts.NoError(err)
+	other, err := keys.NewMasterKey(otherMaterial)
+	ts.NoError(err)
+	err = db.VerifyMasterKey(ts.DB, other)
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "another key is rejected")
+}
+
+func (ts *TestSuite) Test_SetMasterKeyShares() {
+	deleteCheck := func() {
+		ts.NoError(ts.DB.Exec("DELETE FROM master_key_check").Error)
+	}
+	deleteCheck()
+	defer deleteCheck()
+
+	_, initialized, err := db.FindMasterKeyCheck(ts.DB)
+	ts.NoError(err)
+	ts.False(initialized)
+
+	material, err := keys.NewKey()
+	ts.NoError(err)
+	master, err := keys.NewMasterKey(material)
+	ts.NoError(err)
+	unsealKey, err := keys.NewKey()
+	ts.NoError(err)
+	wrappedMasterKey, err := keys.WrapMasterKey(unsealKey, material)
+	ts.NoError(err)
+	ts.NoError(db.SetMasterKeyShares(ts.DB, master, wrappedMasterKey, 5, 3))
+
+	check, initialized, err := db.FindMasterKeyCheck(ts.DB)
+	ts.NoError(err)
+	ts.True(initialized)
+	ts.Equal(5, check.ShareCount)
+	ts.Equal(3, check.Threshold)
+	ts.Equal(wrappedMasterKey, check.WrappedMasterKey)
+
+	otherMaterial, err := keys.NewKey()
+	ts.NoError(err)
+	other, err := keys.NewMasterKey(otherMaterial)
+	ts.NoError(err)
+	err = db.SetMasterKeyShares(ts.DB, other, wrappedMasterKey, 2, 2)
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "another key is rejected")
+}
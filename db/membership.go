@@ -0,0 +1,213 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"github.com/briskt/keygo/app"
+)
+
+type TenantMembership struct {
+	ID        string `gorm:"primaryKey;type:string"`
+	TenantID  string
+	Tenant    Tenant
+	UserID    string
+	User      User
+	RoleID    string
+	Role      Role
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (m *TenantMembership) BeforeCreate(_ *gorm.DB) error {
+	m.ID = newID()
+	return nil
+}
+
+// FindTenantMemberships retrieves a list of memberships by filter, oldest first
+func FindTenantMemberships(ctx echo.Context, filter app.TenantMembershipFilter) ([]TenantMembership, error) {
+	var memberships []TenantMembership
+	q := Tx(ctx).Preload("Tenant").Preload("User").Preload("Role").Order("created_at, id")
+	if filter.TenantID != nil {
+		q = q.Where("tenant_id = ?", filter.TenantID)
+	}
+	if filter.UserID != nil {
+		q = q.Where("user_id = ?", filter.UserID)
+	}
+	result := q.Find(&memberships)
+	return memberships, result.Error
+}
+
+// findTenantMembershipsOfUsers retrieves the memberships of the given users, by user ID
+func findTenantMembershipsOfUsers(ctx echo.Context, userIDs []string) (map[string][]TenantMembership, error) {
+	var memberships []TenantMembership
+	result := Tx(ctx).Preload("Tenant").Preload("User").Preload("Role").Order("created_at, id").
+		Find(&memberships, "user_id IN ?", userIDs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	byUser := map[string][]TenantMembership{}
+	for _, m := range memberships {
+		byUser[m.UserID] = append(byUser[m.UserID], m)
+	}
+	return byUser, nil
+}
+
+// CreateTenantMembership adds a user to a tenant
+func CreateTenantMembership(ctx echo.Context, input app.TenantMembershipCreateInput) (TenantMembership, error) {
+	if err := input.Validate(); err != nil {
+		return TenantMembership{}, err
+	}
+
+	roleName := input.Role
+	if roleName == "" {
+		roleName = app.UserRoleBasic
+	}
+	role, err := findRoleByName(ctx, roleName)
+	if err != nil {
+		return TenantMembership{}, app.Errorf(app.ERR_INVALID, "Role %q does not exist", roleName)
+	}
+
+	if _, err = findTenantMembership(ctx, input.TenantID, input.UserID); err == nil {
+		return TenantMembership{}, app.Errorf(app.ERR_INVALID, "User is already a member of this tenant")
+	}
+
+	membership := TenantMembership{
+		TenantID: input.TenantID,
+		UserID:   input.UserID,
+		RoleID:   role.ID,
+	}
+	if err = Tx(ctx).Omit("Tenant", "User", "Role").Create(&membership).Error; err != nil {
+		return TenantMembership{}, err
+	}
+	if err = invalidateUser(ctx, input.UserID); err != nil {
+		return TenantMembership{}, err
+	}
+	return findTenantMembership(ctx, input.TenantID, input.UserID)
+}
+
+// AssignMembershipRole changes the role of a user within a tenant
+func AssignMembershipRole(ctx echo.Context, tenantID, userID string,
+	input app.UserRoleAssignInput,
+) (TenantMembership, error) {
+	if err := input.Validate(); err != nil {
+		return TenantMembership{}, err
+	}
+
+	if _, err := FindRoleByID(ctx, input.RoleID); err != nil {
+		return TenantMembership{}, app.Errorf(app.ERR_INVALID, "Role %q does not exist", input.RoleID)
+	}
+
+	membership, err := findTenantMembership(ctx, tenantID, userID)
+	if err != nil {
+		return TenantMembership{}, err
+	}
+
+	err = Tx(ctx).Model(&TenantMembership{}).Where("id = ?", membership.ID).
+		Updates(map[string]any{"role_id": input.RoleID, "updated_at": time.Now()}).Error
+	if err != nil {
+		return TenantMembership{}, err
+	}
+	if err = invalidateUser(ctx, userID); err != nil {
+		return TenantMembership{}, err
+	}
+	return findTenantMembership(ctx, tenantID, userID)
+}
+
+// DeleteTenantMembership removes a user from a tenant
+func DeleteTenantMembership(ctx echo.Context, tenantID, userID string) error {
+	if err := removeTenantGroupMembers(ctx, tenantID, userID); err != nil {
+		return err
+	}
+	result := Tx(ctx).Where("tenant_id = ? AND user_id = ?", tenantID, userID).Delete(&TenantMembership{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return invalidateUser(ctx, userID)
+}
+
+// findTenantMembership is a helper function to fetch the membership of a user in a tenant
+func findTenantMembership(ctx echo.Context, tenantID, userID string) (TenantMembership, error) {
+	var membership TenantMembership
+	result := Tx(ctx).Preload("Tenant").Preload("User").Preload("Role").
+		First(&membership, "tenant_id = ? AND user_id = ?", tenantID, userID)
+	return membership, result.Error
+}
+
+// ConvertTenantMembership converts a membership, resolving the effective permissions granted by the membership role
+// and the groups of the user
+func ConvertTenantMembership(ctx echo.Context, m TenantMembership) (app.TenantMembership, error) {
+	grants, err := findGroupGrants(ctx, m.TenantID, m.UserID)
+	if err != nil {
+		return app.TenantMembership{}, fmt.Errorf("find groups of user %s: %w", m.UserID, err)
+	}
+	return convertTenantMembership(m, grants), nil
+}
+
+// convertTenantMemberships converts a list of memberships, like ConvertTenantMembership, finding the groups of all
+// their users at once
+func convertTenantMemberships(ctx echo.Context, memberships []TenantMembership) ([]app.TenantMembership, error) {
+	out := make([]app.TenantMembership, len(memberships))
+	if len(memberships) == 0 {
+		return out, nil
+	}
+
+	userIDs := make([]string, len(memberships))
+	for i, m := range memberships {
+		userIDs[i] = m.UserID
+	}
+	grants, err := findGroupGrantsOfUsers(ctx, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("find groups of users: %w", err)
+	}
+	for i, m := range memberships {
+		out[i] = convertTenantMembership(m, grants[memberKey{TenantID: m.TenantID, UserID: m.UserID}])
+	}
+	return out, nil
+}
+
+// convertTenantMembership converts a membership, given the groups of its user in its tenant
+func convertTenantMembership(m TenantMembership, grants []groupGrant) app.TenantMembership {
+	membership := app.TenantMembership{
+		ID:          m.ID,
+		TenantID:    m.TenantID,
+		TenantName:  m.Tenant.Name,
+		UserID:      m.UserID,
+		UserEmail:   m.User.Email,
+		RoleID:      m.RoleID,
+		Role:        m.Role.Name,
+		Permissions: []string{},
+		GroupIDs:    []string{},
+		CreatedAt:   m.CreatedAt,
+		UpdatedAt:   m.UpdatedAt,
+	}
+	addPermissions(&membership.Permissions, m.Role.Permissions)
+
+	for _, g := range grants {
+		membership.GroupIDs = append(membership.GroupIDs, g.ID)
+		addPermissions(&membership.Permissions, g.RolePermissions)
+		addPermissions(&membership.Permissions, g.Permissions)
+	}
+	return membership
+}
+
+// addPermissions appends the permissions not already in the list
+func addPermissions(list *[]string, permissions []string) {
+	seen := make(map[string]bool, len(*list))
+	for _, p := range *list {
+		seen[p] = true
+	}
+	for _, p := range permissions {
+		if !seen[p] {
+			*list = append(*list, p)
+			seen[p] = true
+		}
+	}
+}
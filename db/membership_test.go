@@ -0,0 +1,57 @@
+package db_test
+
+import (
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+)
+
+func (ts *TestSuite) Test_TenantMemberships() {
+	tenant1, err := db.CreateTenant(ts.ctx, app.TenantCreateInput{Name: "tenant one"})
+	ts.NoError(err)
+	tenant2, err := db.CreateTenant(ts.ctx, app.TenantCreateInput{Name: "tenant two"})
+	ts.NoError(err)
+
+	user := ts.CreateUser(app.UserCreateInput{Email: "consultant@example.com", TenantID: tenant1.ID})
+
+	m, err := db.CreateTenantMembership(ts.ctx, app.TenantMembershipCreateInput{
+		TenantID: tenant2.ID,
+		UserID:   user.ID,
+		Role:     app.UserRoleTenantAdmin,
+	})
+	ts.NoError(err)
+	ts.Equal(app.UserRoleTenantAdmin, m.Role.Name)
+
+	// Expect an error for a duplicate membership
+	_, err = db.CreateTenantMembership(ts.ctx, app.TenantMembershipCreateInput{TenantID: tenant2.ID, UserID: user.ID})
+	ts.Error(err)
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err))
+
+	// One user is listed in both tenants
+	for _, tenantID := range []string{tenant1.ID, tenant2.ID} {
+		users, err := db.FindUsers(ts.ctx, app.UserFilter{TenantID: &tenantID})
+		ts.NoError(err)
+		ts.Len(users, 1)
+		ts.Equal(user.ID, users[0].ID)
+	}
+
+	converted, err := db.ConvertUser(ts.ctx, user)
+	ts.NoError(err)
+	ts.Len(converted.Memberships, 2)
+	ts.Equal(tenant1.ID, converted.TenantID, "the first tenant should be the default active tenant")
+	ts.False(converted.HasTenantPermission(tenant1.ID, app.PermissionTenantsUsersCreate))
+	ts.True(converted.HasTenantPermission(tenant2.ID, app.PermissionTenantsUsersCreate))
+	ts.False(converted.HasPermission(app.PermissionTenantsUsersCreate), "membership roles are not global")
+
+	tenant, err := db.ConvertTenant(ts.ctx, tenant2)
+	ts.NoError(err)
+	ts.Equal([]string{user.ID}, tenant.UserIDs)
+	ts.Equal(app.UserRoleTenantAdmin, tenant.Members[0].Role)
+	ts.Equal(user.Email, tenant.Members[0].UserEmail)
+
+	ts.NoError(db.DeleteTenantMembership(ts.ctx, tenant2.ID, user.ID))
+	ts.Error(db.DeleteTenantMembership(ts.ctx, tenant2.ID, user.ID))
+
+	users, err := db.FindUsers(ts.ctx, app.UserFilter{TenantID: &tenant2.ID})
+	ts.NoError(err)
+	ts.Len(users, 0)
+}
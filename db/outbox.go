@@ -0,0 +1,204 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/briskt/keygo/app"
+)
+
+const (
+	// outboxBatchSize is the most emails delivered per transaction
+	outboxBatchSize = 20
+
+	// outboxClaimTimeout is how long a batch is reserved for the instance delivering it. It must exceed the time to
+	// send a batch, which is bounded by the timeout of the sender.
+	outboxClaimTimeout = 15 * time.Minute
+
+	// maxEmailAttempts is the number of failed deliveries after which an email is abandoned
+	maxEmailAttempts = 5
+
+	// emailRetention is how long a sent or abandoned email is kept, without its bodies, before it is purged
+	emailRetention = 7 * 24 * time.Hour
+)
+
+// OutboxEmail is an email queued for delivery once the transaction queuing it commits
+type OutboxEmail struct {
+	ID            string `gorm:"primaryKey;type:string"`
+	ToAddress     string
+	Subject       string
+	TextBody      string
+	HTMLBody      string
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+	SentAt        *time.Time
+	FailedAt      *time.Time
+	CreatedAt     time.Time
+}
+
+func (OutboxEmail) TableName() string {
+	return "email_outbox"
+}
+
+func (e *OutboxEmail) BeforeCreate(_ *gorm.DB) error {
+	e.ID = newID()
+	return nil
+}
+
+// QueueEmail adds an email to the outbox in the request transaction, so that it is sent only if the transaction
+// commits
+func QueueEmail(ctx echo.Context, email app.Email) error {
+	now := time.Now()
+	e := OutboxEmail{
+		ToAddress:     email.To,
+		Subject:       email.Subject,
+		TextBody:      email.Text,
+		HTMLBody:      email.HTML,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+	if err := Tx(ctx).Create(&e).Error; err != nil {
+		return err
+	}
+	ctx.Set(app.ContextKeyEmailQueued, true)
+	return nil
+}
+
+// EmailQueued returns true if QueueEmail was called in the request
+func EmailQueued(ctx echo.Context) bool {
+	queued, _ := ctx.Get(app.ContextKeyEmailQueued).(bool)
+	return queued
+}
+
+// Outbox delivers queued email. It uses its own transactions rather than the request transaction, and claims the
+// emails it delivers, so that several server instances can share the outbox.
+type Outbox struct {
+	db     *gorm.DB
+	sender app.EmailSender
+	wake   chan struct{}
+}
+
+// NewOutbox returns an Outbox delivering email with the given sender
+func NewOutbox(conn *gorm.DB, sender app.EmailSender) *Outbox {
+	return &Outbox{db: conn, sender: sender, wake: make(chan struct{}, 1)}
+}
+
+// Notify asks a started outbox to deliver email now, rather than at its next interval
+func (o *Outbox) Notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Deliver sends a batch of queued emails, and returns the number sent. A failed email is retried with increasing
+// delays, until it is abandoned after maxEmailAttempts. The bodies of sent and abandoned emails are cleared, since
+// they can contain secrets such as invitation links.
+//
+// The batch is claimed in a short transaction, by postponing its next attempt by outboxClaimTimeout, and sent
+// without holding a transaction or locks. Delivery is at least once: if recording it fails, or the instance stops
+// while sending, the email is sent again once the claim expires.
+func (o *Outbox) Deliver(ctx context.Context) (int, error) {
+	emails, err := o.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, e := range emails {
+		sendErr := o.sender.SendEmail(app.Email{
+			To:      e.ToAddress,
+			Subject: e.Subject,
+			Text:    e.TextBody,
+			HTML:    e.HTMLBody,
+		})
+
+		now := time.Now()
+		updates := map[string]any{"attempts": e.Attempts + 1}
+		switch {
+		case sendErr == nil:
+			updates["sent_at"] = now
+			updates["text_body"] = ""
+			updates["html_body"] = ""
+			sent++
+		case e.Attempts+1 >= maxEmailAttempts:
+			updates["last_error"] = sendErr.Error()
+			updates["failed_at"] = now
+			updates["text_body"] = ""
+			updates["html_body"] = ""
+		default:
+			updates["last_error"] = sendErr.Error()
+			updates["next_attempt_at"] = now.Add(time.Minute << e.Attempts)
+		}
+		err = o.db.WithContext(ctx).Model(&OutboxEmail{}).Where("id = ?", e.ID).Updates(updates).Error
+		if err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+// claim returns a batch of emails due for delivery, and postpones their next attempt by outboxClaimTimeout so that
+// other instances skip them while they are sent
+func (o *Outbox) claim(ctx context.Context) ([]OutboxEmail, error) {
+	var emails []OutboxEmail
+	err := o.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("sent_at IS NULL AND failed_at IS NULL AND next_attempt_at <= ?", now).
+			Order("created_at").Limit(outboxBatchSize).Find(&emails).Error
+		if err != nil || len(emails) == 0 {
+			return err
+		}
+
+		ids := make([]string, len(emails))
+		for i, e := range emails {
+			ids[i] = e.ID
+		}
+		return tx.Model(&OutboxEmail{}).Where("id IN ?", ids).
+			Update("next_attempt_at", now.Add(outboxClaimTimeout)).Error
+	})
+	return emails, err
+}
+
+// Purge deletes the emails sent or abandoned before the given time, and returns the number deleted
+func (o *Outbox) Purge(ctx context.Context, before time.Time) (int64, error) {
+	result := o.db.WithContext(ctx).Where("sent_at < ? OR failed_at < ?", before, before).Delete(&OutboxEmail{})
+	return result.RowsAffected, result.Error
+}
+
+// Start delivers queued email when notified, and at the given interval to retry failures and to purge email older
+// than emailRetention, until the returned function is called. Delivery and purge errors are reported to onError.
+func (o *Outbox) Start(interval time.Duration, onError func(error)) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := o.Purge(context.Background(), time.Now().Add(-emailRetention)); err != nil {
+					onError(err)
+				}
+			case <-o.wake:
+			case <-done:
+				return
+			}
+			for {
+				n, err := o.Deliver(context.Background())
+				if err != nil {
+					onError(err)
+				}
+				if err != nil || n < outboxBatchSize {
+					break
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,75 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+)
+
+// testSender records sent email, and fails if err is set
+type testSender struct {
+	sent []app.Email
+	err  error
+}
+
+func (s *testSender) SendEmail(email app.Email) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.sent = append(s.sent, email)
+	return nil
+}
+
+func (ts *TestSuite) Test_Outbox() {
+	ts.NoError(ts.DB.Exec("DELETE FROM email_outbox").Error)
+
+	ctx := testContext(ts.DB)
+	ts.False(db.EmailQueued(ctx))
+	ts.NoError(db.QueueEmail(ctx, app.Email{To: "jane@example.com", Subject: "hello", Text: "hi"}))
+	ts.True(db.EmailQueued(ctx))
+
+	sender := &testSender{err: errors.New("connection refused")}
+	outbox := db.NewOutbox(ts.DB, sender)
+
+	n, err := outbox.Deliver(context.Background())
+	ts.NoError(err)
+	ts.Equal(0, n)
+
+	var e db.OutboxEmail
+	ts.NoError(ts.DB.First(&e).Error)
+	ts.Equal(1, e.Attempts)
+	ts.Equal("connection refused", e.LastError)
+	ts.Nil(e.SentAt)
+
+	// A failed email waits before it is retried
+	sender.err = nil
+	n, err = outbox.Deliver(context.Background())
+	ts.NoError(err)
+	ts.Equal(0, n)
+
+	ts.NoError(ts.DB.Model(&e).Update("next_attempt_at", e.CreatedAt).Error)
+	n, err = outbox.Deliver(context.Background())
+	ts.NoError(err)
+	ts.Equal(1, n)
+	ts.Len(sender.sent, 1)
+	ts.Equal("jane@example.com", sender.sent[0].To)
+
+	// A sent email is not sent again, and its body is cleared
+	n, err = outbox.Deliver(context.Background())
+	ts.NoError(err)
+	ts.Equal(0, n)
+	ts.NoError(ts.DB.First(&e, "id = ?", e.ID).Error)
+	ts.NotNil(e.SentAt)
+	ts.Empty(e.TextBody)
+
+	// Sent email is purged once older than the given time
+	purged, err := outbox.Purge(context.Background(), e.SentAt.Add(-time.Second))
+	ts.NoError(err)
+	ts.Equal(int64(0), purged)
+	purged, err = outbox.Purge(context.Background(), e.SentAt.Add(time.Second))
+	ts.NoError(err)
+	ts.Equal(int64(1), purged)
+}
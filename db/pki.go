@@ -0,0 +1,543 @@
+package db
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/pki"
+)
+
+// CertificateAuthority is the CA of a tenant. Its private key is wrapped by the master key. CRL is its latest signed
+// revocation list, DER encoded.
+type CertificateAuthority struct {
+	ID            string `gorm:"primaryKey;type:string"`
+	TenantID      string
+	CommonName    string
+	Certificate   []byte
+	WrappedKey    []byte
+	IsRoot        bool
+	NotBefore     time.Time
+	NotAfter      time.Time
+	CRLNumber     int64      `gorm:"column:crl_number"`
+	CRL           []byte     `gorm:"column:crl"`
+	CRLNextUpdate *time.Time `gorm:"column:crl_next_update"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (CertificateAuthority) TableName() string {
+	return "pki_cas"
+}
+
+func (c *CertificateAuthority) BeforeCreate(_ *gorm.DB) error {
+	c.ID = newID()
+	return nil
+}
+
+// CertificateTemplate is a policy for issuing certificates
+type CertificateTemplate struct {
+	ID             string `gorm:"primaryKey;type:string"`
+	TenantID       string
+	Name           string
+	AllowedDomains pq.StringArray `gorm:"type:text[];default:'{}'"`
+	AllowIPSANs    bool           `gorm:"column:allow_ip_sans"`
+	MaxTTL         string         `gorm:"column:max_ttl"`
+	KeyUsages      pq.StringArray `gorm:"type:text[];default:'{}'"`
+	ExtKeyUsages   pq.StringArray `gorm:"type:text[];default:'{}'"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (CertificateTemplate) TableName() string {
+	return "pki_templates"
+}
+
+func (t *CertificateTemplate) BeforeCreate(_ *gorm.DB) error {
+	t.ID = newID()
+	return nil
+}
+
+// Certificate is a certificate issued by a tenant CA
+type Certificate struct {
+	ID           string `gorm:"primaryKey;type:string"`
+	TenantID     string
+	CAID         string `gorm:"column:ca_id"`
+	TemplateName string
+	SerialNumber string
+	CommonName   string
+	DNSNames     pq.StringArray `gorm:"column:dns_names;type:text[];default:'{}'"`
+	IPAddresses  pq.StringArray `gorm:"column:ip_addresses;type:text[];default:'{}'"`
+	Certificate  []byte
+	NotBefore    time.Time
+	NotAfter     time.Time
+	RevokedAt    *time.Time
+	IssuedByID   *string
+	CreatedAt    time.Time
+}
+
+func (Certificate) TableName() string {
+	return "pki_certificates"
+}
+
+func (c *Certificate) BeforeCreate(_ *gorm.DB) error {
+	c.ID = newID()
+	return nil
+}
+
+// FindCA retrieves the CA of a tenant
+func FindCA(ctx echo.Context, tenantID string) (CertificateAuthority, error) {
+	var ca CertificateAuthority
+	result := Tx(ctx).First(&ca, "tenant_id = ?", tenantID)
+	return ca, result.Error
+}
+
+// GenerateCA creates a new self-signed root CA for a tenant, which must not already have one
+func GenerateCA(ctx echo.Context, tenantID string, wrapper app.KeyWrapper,
+	input app.CAGenerateInput,
+) (CertificateAuthority, error) {
+	if err := input.Validate(); err != nil {
+		return CertificateAuthority{}, err
+	}
+	ttl, _ := input.Duration()
+	cert, key, err := pki.GenerateCA(input.CommonName, ttl)
+	if err != nil {
+		return CertificateAuthority{}, err
+	}
+	return createCA(ctx, tenantID, wrapper, cert, key, true)
+}
+
+// ImportCA stores an existing root or intermediate CA, and its private key, as the CA of a tenant, which must not
+// already have one
+func ImportCA(ctx echo.Context, tenantID string, wrapper app.KeyWrapper,
+	input app.CAImportInput,
+) (CertificateAuthority, error) {
+	if err := input.Validate(); err != nil {
+		return CertificateAuthority{}, err
+	}
+	cert, key, isRoot, err := pki.ParseCA(input.Certificate, input.PrivateKey)
+	if err != nil {
+		return CertificateAuthority{}, err
+	}
+	return createCA(ctx, tenantID, wrapper, cert, key, isRoot)
+}
+
+// FindCertificateTemplates retrieves the certificate templates of a tenant, ordered by name
+func FindCertificateTemplates(ctx echo.Context, tenantID string) ([]CertificateTemplate, error) {
+	var templates []CertificateTemplate
+	result := Tx(ctx).Where("tenant_id = ?", tenantID).Order("name").Find(&templates)
+	return templates, result.Error
+}
+
+// FindCertificateTemplateByName retrieves a certificate template of a tenant by name
+func FindCertificateTemplateByName(ctx echo.Context, tenantID, name string) (CertificateTemplate, error) {
+	var template CertificateTemplate
+	result := Tx(ctx).First(&template, "tenant_id = ? AND name = ?", tenantID, name)
+	return template, result.Error
+}
+
+// CreateCertificateTemplate creates a certificate template in a tenant
+func CreateCertificateTemplate(ctx echo.Context, tenantID string,
+	input app.CertificateTemplateInput,
+) (CertificateTemplate, error) {
+	if err := input.Validate(); err != nil {
+		return CertificateTemplate{}, err
+	}
+
+	var count int64
+	err := Tx(ctx).Model(&CertificateTemplate{}).Where("tenant_id = ? AND name = ?", tenantID, input.Name).
+		Count(&count).Error
+	if err != nil {
+		return CertificateTemplate{}, err
+	}
+	if count > 0 {
+		return CertificateTemplate{}, app.Errorf(app.ERR_INVALID, "A template named %q already exists", input.Name)
+	}
+
+	template := CertificateTemplate{
+		TenantID:       tenantID,
+		Name:           input.Name,
+		AllowedDomains: input.AllowedDomains,
+		AllowIPSANs:    input.AllowIPSANs,
+		MaxTTL:         input.MaxTTL,
+		KeyUsages:      input.KeyUsages,
+		ExtKeyUsages:   input.ExtKeyUsages,
+	}
+	if err = Tx(ctx).Create(&template).Error; err != nil {
+		return CertificateTemplate{}, err
+	}
+	return template, nil
+}
+
+// UpdateCertificateTemplate replaces the policy of a certificate template. Certificates already issued are
+// unaffected.
+func UpdateCertificateTemplate(ctx echo.Context, tenantID, name string,
+	input app.CertificateTemplateInput,
+) (CertificateTemplate, error) {
+	input.Name = name
+	if err := input.Validate(); err != nil {
+		return CertificateTemplate{}, err
+	}
+	template, err := FindCertificateTemplateByName(ctx, tenantID, name)
+	if err != nil {
+		return CertificateTemplate{}, err
+	}
+
+	err = Tx(ctx).Model(&template).Updates(map[string]any{
+		"allowed_domains": pq.StringArray(input.AllowedDomains),
+		"allow_ip_sans":   input.AllowIPSANs,
+		"max_ttl":         input.MaxTTL,
+		"key_usages":      pq.StringArray(input.KeyUsages),
+		"ext_key_usages":  pq.StringArray(input.ExtKeyUsages),
+		"updated_at":      time.Now(),
+	}).Error
+	if err != nil {
+		return CertificateTemplate{}, err
+	}
+	return FindCertificateTemplateByName(ctx, tenantID, name)
+}
+
+// DeleteCertificateTemplate deletes a certificate template. Certificates already issued are unaffected.
+func DeleteCertificateTemplate(ctx echo.Context, tenantID, name string) error {
+	result := Tx(ctx).Where("tenant_id = ? AND name = ?", tenantID, name).Delete(&CertificateTemplate{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// IssueCertificate issues a certificate from a signing request with the tenant's CA, if the template allows it. The
+// certificate names crlURL, if given, as the distribution point of the CA's revocation list.
+func IssueCertificate(ctx echo.Context, tenantID, issuerID string, wrapper app.KeyWrapper, crlURL string,
+	input app.CertificateIssueInput,
+) (Certificate, error) {
+	if err := input.Validate(); err != nil {
+		return Certificate{}, err
+	}
+	var ttl time.Duration
+	if input.TTL != "" {
+		ttl, _ = app.ParseTTL(input.TTL)
+	}
+
+	template, err := FindCertificateTemplateByName(ctx, tenantID, input.Template)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Certificate{}, app.Errorf(app.ERR_INVALID, "Template %q does not exist", input.Template)
+	}
+	if err != nil {
+		return Certificate{}, err
+	}
+	csr, err := pki.ParseCSR(input.CSR)
+	if err != nil {
+		return Certificate{}, err
+	}
+	ca, caKey, err := findCAKey(ctx, tenantID, wrapper)
+	if err != nil {
+		return Certificate{}, err
+	}
+
+	t, err := ConvertCertificateTemplate(ctx, template)
+	if err != nil {
+		return Certificate{}, err
+	}
+	der, err := pki.Issue(ca.Certificate, caKey, csr, t, ttl, crlURL)
+	if err != nil {
+		return Certificate{}, err
+	}
+	issued, err := x509.ParseCertificate(der)
+	if err != nil {
+		return Certificate{}, err
+	}
+
+	cert := Certificate{
+		TenantID:     tenantID,
+		CAID:         ca.ID,
+		TemplateName: template.Name,
+		SerialNumber: issued.SerialNumber.Text(16),
+		CommonName:   issued.Subject.CommonName,
+		DNSNames:     append(pq.StringArray{}, issued.DNSNames...),
+		IPAddresses:  make(pq.StringArray, len(issued.IPAddresses)),
+		Certificate:  der,
+		NotBefore:    issued.NotBefore,
+		NotAfter:     issued.NotAfter,
+		IssuedByID:   &issuerID,
+	}
+	for i, ip := range issued.IPAddresses {
+		cert.IPAddresses[i] = ip.String()
+	}
+	if err = Tx(ctx).Create(&cert).Error; err != nil {
+		return Certificate{}, err
+	}
+	return cert, nil
+}
+
+// FindCertificates retrieves the certificates issued in a tenant by filter, soonest expiring first
+func FindCertificates(ctx echo.Context, tenantID string, filter app.CertificateFilter) ([]Certificate, error) {
+	var certs []Certificate
+	q := Tx(ctx).Where("tenant_id = ?", tenantID).Order("not_after, serial_number")
+	if filter.SerialNumber != nil {
+		q = q.Where("serial_number = ?", app.NormalizeSerialNumber(*filter.SerialNumber))
+	}
+	if filter.ExpiresBefore != nil {
+		q = q.Where("not_after < ?", filter.ExpiresBefore)
+	}
+	if filter.ExpiresAfter != nil {
+		q = q.Where("not_after > ?", filter.ExpiresAfter)
+	}
+	if filter.Revoked != nil && *filter.Revoked {
+		q = q.Where("revoked_at IS NOT NULL")
+	} else if filter.Revoked != nil {
+		q = q.Where("revoked_at IS NULL")
+	}
+	result := q.Find(&certs)
+	return certs, result.Error
+}
+
+// FindCertificateBySerial retrieves a certificate issued in a tenant by its hexadecimal serial number
+func FindCertificateBySerial(ctx echo.Context, tenantID, serial string) (Certificate, error) {
+	var cert Certificate
+	result := Tx(ctx).First(&cert, "tenant_id = ? AND serial_number = ?", tenantID, app.NormalizeSerialNumber(serial))
+	return cert, result.Error
+}
+
+// RevokeCertificate revokes a certificate, which is listed in the tenant's CRL until it expires. The CRL is signed
+// again right away.
+func RevokeCertificate(ctx echo.Context, tenantID, serial string, wrapper app.KeyWrapper) (Certificate, error) {
+	cert, err := FindCertificateBySerial(ctx, tenantID, serial)
+	if err != nil {
+		return Certificate{}, err
+	}
+	if cert.RevokedAt != nil {
+		return Certificate{}, app.Errorf(app.ERR_INVALID, "Certificate is already revoked")
+	}
+
+	now := time.Now()
+	if err = Tx(ctx).Model(&cert).Update("revoked_at", now).Error; err != nil {
+		return Certificate{}, err
+	}
+	cert.RevokedAt = &now
+
+	ca, err := lockCA(Tx(ctx), tenantID)
+	if err != nil {
+		return Certificate{}, err
+	}
+	if err = updateCRL(Tx(ctx), &ca, wrapper); err != nil {
+		return Certificate{}, err
+	}
+	return cert, nil
+}
+
+// FindCRL returns the latest DER-encoded revocation list of the tenant's CA. It does not need the CA's private key.
+func FindCRL(ctx echo.Context, tenantID string) ([]byte, error) {
+	var ca CertificateAuthority
+	err := Tx(ctx).Select("crl").First(&ca, "tenant_id = ? AND crl IS NOT NULL", tenantID).Error
+	return ca.CRL, err
+}
+
+// RefreshCRLs signs again the revocation lists due for their next update before the given time, each in its own
+// transaction on conn, which must not be subject to row-level security. It returns the number of lists signed.
+func RefreshCRLs(conn *gorm.DB, wrapper app.KeyWrapper, before time.Time) (int, error) {
+	var tenantIDs []string
+	err := conn.Model(&CertificateAuthority{}).Where("crl_next_update IS NULL OR crl_next_update < ?", before).
+		Pluck("tenant_id", &tenantIDs).Error
+	if err != nil {
+		return 0, err
+	}
+
+	refreshed := 0
+	for _, tenantID := range tenantIDs {
+		err = conn.Transaction(func(tx *gorm.DB) error {
+			ca, err := lockCA(tx, tenantID)
+			if err != nil {
+				return err
+			}
+			// another instance may have refreshed it in the meantime
+			if ca.CRLNextUpdate != nil && !ca.CRLNextUpdate.Before(before) {
+				return nil
+			}
+			if err = updateCRL(tx, &ca, wrapper); err != nil {
+				return err
+			}
+			refreshed++
+			return nil
+		})
+		if err != nil {
+			return refreshed, fmt.Errorf("refresh CRL of tenant %s: %w", tenantID, err)
+		}
+	}
+	return refreshed, nil
+}
+
+func ConvertCA(_ echo.Context, c CertificateAuthority) (app.CertificateAuthority, error) {
+	return app.CertificateAuthority{
+		ID:          c.ID,
+		TenantID:    c.TenantID,
+		CommonName:  c.CommonName,
+		Certificate: pki.EncodePEM("CERTIFICATE", c.Certificate),
+		IsRoot:      c.IsRoot,
+		NotBefore:   c.NotBefore,
+		NotAfter:    c.NotAfter,
+		CreatedAt:   c.CreatedAt,
+		UpdatedAt:   c.UpdatedAt,
+	}, nil
+}
+
+func ConvertCertificateTemplate(_ echo.Context, t CertificateTemplate) (app.CertificateTemplate, error) {
+	return app.CertificateTemplate{
+		ID:             t.ID,
+		TenantID:       t.TenantID,
+		Name:           t.Name,
+		AllowedDomains: t.AllowedDomains,
+		AllowIPSANs:    t.AllowIPSANs,
+		MaxTTL:         t.MaxTTL,
+		KeyUsages:      t.KeyUsages,
+		ExtKeyUsages:   t.ExtKeyUsages,
+		CreatedAt:      t.CreatedAt,
+		UpdatedAt:      t.UpdatedAt,
+	}, nil
+}
+
+func ConvertCertificate(_ echo.Context, c Certificate) (app.Certificate, error) {
+	cert := app.Certificate{
+		ID:           c.ID,
+		TenantID:     c.TenantID,
+		TemplateName: c.TemplateName,
+		SerialNumber: c.SerialNumber,
+		CommonName:   c.CommonName,
+		DNSNames:     c.DNSNames,
+		IPAddresses:  c.IPAddresses,
+		Certificate:  pki.EncodePEM("CERTIFICATE", c.Certificate),
+		NotBefore:    c.NotBefore,
+		NotAfter:     c.NotAfter,
+		RevokedAt:    c.RevokedAt,
+		CreatedAt:    c.CreatedAt,
+	}
+	if c.IssuedByID != nil {
+		cert.IssuedByID = *c.IssuedByID
+	}
+	return cert, nil
+}
+
+// createCA stores a DER-encoded CA certificate and its PKCS #8 private key as the CA of a tenant
+func createCA(ctx echo.Context, tenantID string, wrapper app.KeyWrapper, cert, key []byte,
+	isRoot bool,
+) (CertificateAuthority, error) {
+	var count int64
+	if err := Tx(ctx).Model(&CertificateAuthority{}).Where("tenant_id = ?", tenantID).Count(&count).Error; err != nil {
+		return CertificateAuthority{}, err
+	}
+	if count > 0 {
+		return CertificateAuthority{}, app.Errorf(app.ERR_INVALID, "The tenant already has a CA")
+	}
+
+	c, err := x509.ParseCertificate(cert)
+	if err != nil {
+		return CertificateAuthority{}, err
+	}
+	wrapped, err := wrapper.WrapKey(key, caWrapContext(tenantID))
+	if err != nil {
+		return CertificateAuthority{}, fmt.Errorf("wrap CA key: %w", err)
+	}
+
+	ca := CertificateAuthority{
+		TenantID:    tenantID,
+		CommonName:  c.Subject.CommonName,
+		Certificate: cert,
+		WrappedKey:  wrapped,
+		IsRoot:      isRoot,
+		NotBefore:   c.NotBefore,
+		NotAfter:    c.NotAfter,
+	}
+	if err = Tx(ctx).Create(&ca).Error; err != nil {
+		return CertificateAuthority{}, err
+	}
+	if err = updateCRL(Tx(ctx), &ca, wrapper); err != nil {
+		return CertificateAuthority{}, err
+	}
+	return ca, nil
+}
+
+// lockCA retrieves the CA of a tenant, locked until the end of the transaction
+func lockCA(tx *gorm.DB, tenantID string) (CertificateAuthority, error) {
+	var ca CertificateAuthority
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&ca, "tenant_id = ?", tenantID).Error
+	return ca, err
+}
+
+// updateCRL signs and stores a new revocation list of the unexpired revoked certificates of a CA, with a higher CRL
+// number than the last. The CA must be locked, or created, in the transaction.
+func updateCRL(tx *gorm.DB, ca *CertificateAuthority, wrapper app.KeyWrapper) error {
+	var certs []Certificate
+	err := tx.Where("ca_id = ? AND revoked_at IS NOT NULL AND not_after > ?", ca.ID, time.Now()).
+		Order("revoked_at").Find(&certs).Error
+	if err != nil {
+		return err
+	}
+	revoked := make([]pkix.RevokedCertificate, len(certs))
+	for i, c := range certs {
+		serial, ok := new(big.Int).SetString(c.SerialNumber, 16)
+		if !ok {
+			return fmt.Errorf("invalid serial number %q of certificate %s", c.SerialNumber, c.ID)
+		}
+		revoked[i] = pkix.RevokedCertificate{SerialNumber: serial, RevocationTime: *c.RevokedAt}
+	}
+
+	key, err := unwrapCAKey(*ca, wrapper)
+	if err != nil {
+		return err
+	}
+	der, err := pki.CreateCRL(ca.Certificate, key, revoked, ca.CRLNumber+1)
+	if err != nil {
+		return err
+	}
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		return err
+	}
+
+	ca.CRLNumber++
+	ca.CRL = der
+	ca.CRLNextUpdate = &crl.NextUpdate
+	return tx.Model(ca).Updates(map[string]any{
+		"crl_number":      ca.CRLNumber,
+		"crl":             ca.CRL,
+		"crl_next_update": ca.CRLNextUpdate,
+	}).Error
+}
+
+// findCAKey retrieves the CA of a tenant and its unwrapped private key
+func findCAKey(ctx echo.Context, tenantID string, wrapper app.KeyWrapper) (CertificateAuthority, []byte, error) {
+	ca, err := FindCA(ctx, tenantID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return CertificateAuthority{}, nil, app.Errorf(app.ERR_INVALID, "The tenant has no CA")
+	}
+	if err != nil {
+		return CertificateAuthority{}, nil, err
+	}
+	key, err := unwrapCAKey(ca, wrapper)
+	return ca, key, err
+}
+
+func unwrapCAKey(ca CertificateAuthority, wrapper app.KeyWrapper) ([]byte, error) {
+	key, err := wrapper.UnwrapKey(ca.WrappedKey, caWrapContext(ca.TenantID))
+	if err != nil {
+		return nil, fmt.Errorf("unwrap CA key %s: %w", ca.ID, err)
+	}
+	return key, nil
+}
+
+// caWrapContext binds the wrapped private key of a CA to its tenant, which has at most one CA
+func caWrapContext(tenantID string) []byte {
+	return []byte("pki-ca/" + tenantID)
+}
@@ -0,0 +1,116 @@
+package db_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+	"github.com/briskt/keygo/keys"
+	"github.com/briskt/keygo/pki"
+)
+
+func (ts *TestSuite) newCSR(commonName string) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ts.NoError(err)
+	der, err := x509.CreateCertificateRequest(rand.Reader,
+		&x509.CertificateRequest{Subject: pkix.Name{CommonName: commonName}}, key)
+	ts.NoError(err)
+	return pki.EncodePEM("CERTIFICATE REQUEST", der)
+}
+
+func (ts *TestSuite) Test_PKI() {
+	material, err := keys.NewKey()
+	ts.NoError(err)
+	master, err := keys.NewMasterKey(material)
+	ts.NoError(err)
+
+	tenant, err := db.CreateTenant(ts.ctx, app.TenantCreateInput{Name: "tenant"})
+	ts.NoError(err)
+	user := ts.CreateUser(app.UserCreateInput{Email: "pki@example.com"})
+
+	_, err = db.CreateCertificateTemplate(ts.ctx, tenant.ID, app.CertificateTemplateInput{
+		Name:           "services",
+		AllowedDomains: []string{"*.svc.internal"},
+		MaxTTL:         "24h",
+	})
+	ts.NoError(err)
+	issueInput := app.CertificateIssueInput{Template: "services", CSR: ts.newCSR("api.svc.internal")}
+
+	_, err = db.IssueCertificate(ts.ctx, tenant.ID, user.ID, master, "", issueInput)
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "the tenant has no CA yet")
+
+	_, err = db.FindCRL(ts.ctx, tenant.ID)
+	ts.ErrorIs(err, gorm.ErrRecordNotFound, "the tenant has no CRL yet")
+
+	ca, err := db.GenerateCA(ts.ctx, tenant.ID, master, app.CAGenerateInput{CommonName: "Tenant Root"})
+	ts.NoError(err)
+	ts.True(ca.IsRoot)
+	der, err := db.FindCRL(ts.ctx, tenant.ID)
+	ts.NoError(err)
+	crl, err := x509.ParseRevocationList(der)
+	ts.NoError(err)
+	ts.Equal(int64(1), crl.Number.Int64(), "a new CA has a CRL")
+	ts.Empty(crl.RevokedCertificates)
+	_, err = db.GenerateCA(ts.ctx, tenant.ID, master, app.CAGenerateInput{CommonName: "Second Root"})
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "a tenant has one CA")
+
+	cert, err := db.IssueCertificate(ts.ctx, tenant.ID, user.ID, master, "", issueInput)
+	ts.NoError(err)
+	ts.Equal("api.svc.internal", cert.CommonName)
+	ts.WithinDuration(time.Now().Add(24*time.Hour), cert.NotAfter, time.Minute)
+
+	short, err := db.IssueCertificate(ts.ctx, tenant.ID, user.ID, master, "", app.CertificateIssueInput{
+		Template: "services", CSR: ts.newCSR("db.svc.internal"), TTL: "1h",
+	})
+	ts.NoError(err)
+
+	_, err = db.IssueCertificate(ts.ctx, tenant.ID, user.ID, master, "",
+		app.CertificateIssueInput{Template: "services", CSR: ts.newCSR("evil.example.com")})
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "the template does not allow the name")
+
+	soon := time.Now().Add(2 * time.Hour)
+	certs, err := db.FindCertificates(ts.ctx, tenant.ID, app.CertificateFilter{ExpiresBefore: &soon})
+	ts.NoError(err)
+	ts.Len(certs, 1)
+	ts.Equal(short.ID, certs[0].ID)
+
+	serial := cert.SerialNumber
+	certs, err = db.FindCertificates(ts.ctx, tenant.ID, app.CertificateFilter{SerialNumber: &serial})
+	ts.NoError(err)
+	ts.Len(certs, 1)
+	ts.Equal(cert.ID, certs[0].ID)
+
+	_, err = db.RevokeCertificate(ts.ctx, tenant.ID, serial, master)
+	ts.NoError(err)
+	_, err = db.RevokeCertificate(ts.ctx, tenant.ID, serial, master)
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "already revoked")
+
+	der, err = db.FindCRL(ts.ctx, tenant.ID)
+	ts.NoError(err)
+	crl, err = x509.ParseRevocationList(der)
+	ts.NoError(err)
+	ts.Equal(int64(2), crl.Number.Int64(), "a revocation signs a new CRL")
+	ts.Len(crl.RevokedCertificates, 1)
+	ts.Equal(serial, crl.RevokedCertificates[0].SerialNumber.Text(16))
+
+	n, err := db.RefreshCRLs(ts.DB, master, time.Now())
+	ts.NoError(err)
+	ts.Equal(0, n, "the CRL is not due")
+	n, err = db.RefreshCRLs(ts.DB, master, crl.NextUpdate.Add(time.Minute))
+	ts.NoError(err)
+	ts.Equal(1, n)
+
+	der, err = db.FindCRL(ts.ctx, tenant.ID)
+	ts.NoError(err)
+	crl, err = x509.ParseRevocationList(der)
+	ts.NoError(err)
+	ts.Equal(int64(3), crl.Number.Int64(), "CRL numbers increase")
+	ts.Len(crl.RevokedCertificates, 1)
+}
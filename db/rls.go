@@ -0,0 +1,115 @@
+package db
+
+import (
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"github.com/briskt/keygo/app"
+)
+
+// Database roles used by request transactions. Row-level security policies apply to RLSRole, which does not own
+// the tables. RLSBypassRole has the BYPASSRLS attribute, for operations that span tenants.
+const (
+	RLSRole       = "keygo_app"
+	RLSBypassRole = "keygo_rls_bypass"
+)
+
+// Transaction-local settings referenced by row-level security policies
+const (
+	rlsSettingTenantID  = "app.tenant_id"
+	rlsSettingUserID    = "app.user_id"
+	rlsSettingTokenHash = "app.token_hash"
+)
+
+// RLSBypass is an audit record of a request whose transaction was switched to RLSBypassRole, with the reasons
+// given and the response status
+type RLSBypass struct {
+	ID        string `gorm:"primaryKey;type:string"`
+	UserID    string
+	Reason    string
+	Method    string
+	Path      string
+	IP        string
+	Status    int
+	CreatedAt time.Time
+
+	reasons []string
+}
+
+func (RLSBypass) TableName() string {
+	return "rls_bypasses"
+}
+
+func (b *RLSBypass) BeforeCreate(_ *gorm.DB) error {
+	b.ID = newID()
+	return nil
+}
+
+// BeginRLS switches a new transaction to RLSRole, so that row-level security policies restrict its queries. Until
+// SetRLSActor is called, only rows matched by a token lookup are visible.
+func BeginRLS(tx *gorm.DB) error {
+	return tx.Exec("SET LOCAL ROLE " + RLSRole).Error
+}
+
+// SetRLSActor restricts the transaction to rows belonging to the given user or tenant
+func SetRLSActor(ctx echo.Context, tenantID, userID string) error {
+	return Tx(ctx).Exec("SELECT set_config(?, ?, true), set_config(?, ?, true)",
+		rlsSettingTenantID, tenantID, rlsSettingUserID, userID).Error
+}
+
+// BypassRLS switches the transaction to RLSBypassRole, lifting row-level security for the rest of the transaction.
+// Who did so and why is held in the request until RecordRLSBypass writes it, outside the transaction, so that the
+// record survives a rollback. A request that bypasses RLS more than once is recorded once, with all its reasons.
+func BypassRLS(ctx echo.Context, userID, reason string) error {
+	if err := Tx(ctx).Exec("SET LOCAL ROLE " + RLSBypassRole).Error; err != nil {
+		return err
+	}
+
+	bypass, _ := ctx.Get(app.ContextKeyRLSBypass).(*RLSBypass)
+	if bypass == nil {
+		req := ctx.Request()
+		bypass = &RLSBypass{
+			UserID: userID,
+			Method: req.Method,
+			Path:   req.URL.Path,
+			IP:     ctx.RealIP(),
+		}
+		ctx.Set(app.ContextKeyRLSBypass, bypass)
+	}
+	if bypass.UserID == "" {
+		bypass.UserID = userID
+	}
+	for _, r := range bypass.reasons {
+		if r == reason {
+			return nil
+		}
+	}
+	bypass.reasons = append(bypass.reasons, reason)
+	return nil
+}
+
+// RecordRLSBypass writes the record of the request's RLS bypass, if any, with the response status. It must be
+// called with a connection other than the request transaction, once that transaction has ended.
+func RecordRLSBypass(conn *gorm.DB, ctx echo.Context, status int) error {
+	bypass, _ := ctx.Get(app.ContextKeyRLSBypass).(*RLSBypass)
+	if bypass == nil {
+		return nil
+	}
+	ctx.Set(app.ContextKeyRLSBypass, nil)
+
+	bypass.Reason = strings.Join(bypass.reasons, "; ")
+	bypass.Status = status
+	return conn.Create(bypass).Error
+}
+
+// EndRLSBypass switches the transaction back to RLSRole after BypassRLS
+func EndRLSBypass(ctx echo.Context) error {
+	return BeginRLS(Tx(ctx))
+}
+
+func setRLSSetting(ctx echo.Context, name, value string) error {
+	return Tx(ctx).Exec("SELECT set_config(?, ?, true)", name, value).Error
+}
@@ -0,0 +1,101 @@
+package db_test
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+)
+
+var errRollback = errors.New("rollback")
+
+// inRLSTx runs fn in a transaction restricted by row-level security, and rolls it back
+func (ts *TestSuite) inRLSTx(fn func()) {
+	err := ts.DB.Transaction(func(tx *gorm.DB) error {
+		ts.NoError(db.BeginRLS(tx))
+		ts.ctx.Set(app.ContextKeyTx, tx)
+		fn()
+		return errRollback
+	})
+	ts.ctx.Set(app.ContextKeyTx, ts.DB)
+	ts.ErrorIs(err, errRollback)
+}
+
+func (ts *TestSuite) Test_RLS() {
+	tenant1, err := db.CreateTenant(ts.ctx, app.TenantCreateInput{Name: "tenant one"})
+	ts.NoError(err)
+	tenant2, err := db.CreateTenant(ts.ctx, app.TenantCreateInput{Name: "tenant two"})
+	ts.NoError(err)
+	user1 := ts.CreateUser(app.UserCreateInput{Email: "one@example.com", TenantID: tenant1.ID})
+	colleague := ts.CreateUser(app.UserCreateInput{Email: "colleague@example.com", TenantID: tenant1.ID})
+	user2 := ts.CreateUser(app.UserCreateInput{Email: "two@example.com", TenantID: tenant2.ID})
+
+	userIDs := func() []string {
+		users, err := db.FindUsers(ts.ctx, app.UserFilter{})
+		ts.NoError(err)
+		ids := make([]string, len(users))
+		for i, u := range users {
+			ids[i] = u.ID
+		}
+		return ids
+	}
+
+	ts.inRLSTx(func() {
+		ts.Empty(userIDs(), "nothing is visible before the actor is set")
+	})
+
+	ts.inRLSTx(func() {
+		ts.NoError(db.SetRLSActor(ts.ctx, tenant1.ID, user1.ID))
+		ts.ElementsMatch([]string{user1.ID, colleague.ID}, userIDs())
+
+		_, err := db.FindUserByID(ts.ctx, user2.ID)
+		ts.ErrorIs(err, gorm.ErrRecordNotFound, "users of other tenants are invisible")
+	})
+
+	ts.inRLSTx(func() {
+		ts.NoError(db.SetRLSActor(ts.ctx, "", user2.ID))
+		ts.Equal([]string{user2.ID}, userIDs(), "without a tenant only the user is visible")
+	})
+
+	ts.inRLSTx(func() {
+		ts.NoError(db.BypassRLS(ts.ctx, user1.ID, "test"))
+		ts.ElementsMatch([]string{user1.ID, colleague.ID, user2.ID}, userIDs())
+	})
+}
+
+func (ts *TestSuite) Test_RecordRLSBypass() {
+	user := ts.CreateUser(app.UserCreateInput{Email: "bypass@example.com"})
+	ts.ctx.Set(app.ContextKeyRLSBypass, nil)
+
+	ts.inRLSTx(func() {
+		ts.NoError(db.BypassRLS(ts.ctx, user.ID, "first"))
+		ts.NoError(db.EndRLSBypass(ts.ctx))
+		ts.NoError(db.BypassRLS(ts.ctx, user.ID, "second"))
+		ts.NoError(db.BypassRLS(ts.ctx, user.ID, "first"))
+	})
+	ts.NoError(db.RecordRLSBypass(ts.DB, ts.ctx, 403))
+	ts.NoError(db.RecordRLSBypass(ts.DB, ts.ctx, 403), "a bypass is recorded once")
+
+	var bypasses []db.RLSBypass
+	ts.NoError(ts.DB.Where("user_id = ?", user.ID).Find(&bypasses).Error)
+	ts.Len(bypasses, 1, "the record survives the rolled back transaction")
+	ts.Equal("first; second", bypasses[0].Reason)
+	ts.Equal(403, bypasses[0].Status)
+}
+
+func (ts *TestSuite) Test_RLS_token() {
+	user := ts.CreateUser(app.UserCreateInput{Email: "token@example.com"})
+	token, err := db.CreateToken(ts.ctx, app.TokenCreateInput{UserID: user.ID, AuthID: "sub"})
+	ts.NoError(err)
+
+	ts.inRLSTx(func() {
+		found, err := db.FindToken(ts.ctx, token.PlainText)
+		ts.NoError(err, "a token can be found by its plain text")
+		ts.Equal(token.ID, found.ID)
+
+		_, err = db.FindUserByID(ts.ctx, user.ID)
+		ts.NoError(err, "finding a token makes its user visible")
+	})
+}
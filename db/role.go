@@ -0,0 +1,117 @@
+package db
+
+import (
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+
+	"github.com/briskt/keygo/app"
+)
+
+type Role struct {
+	ID          string `gorm:"primaryKey;type:string"`
+	Name        string
+	Description string
+	Permissions pq.StringArray `gorm:"type:text[];default:'{}'"`
+	Builtin     bool
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Deleted     gorm.DeletedAt
+}
+
+func (r *Role) BeforeCreate(_ *gorm.DB) error {
+	r.ID = newID()
+	return nil
+}
+
+// FindRoles retrieves a list of roles by filter
+func FindRoles(ctx echo.Context, filter app.RoleFilter) ([]Role, error) {
+	var roles []Role
+	q := Tx(ctx).Order("name")
+	if filter.Name != nil {
+		q = q.Where("name = ?", filter.Name)
+	}
+	if filter.Limit > 0 {
+		q = q.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		q = q.Offset(filter.Offset)
+	}
+	result := q.Find(&roles)
+	return roles, result.Error
+}
+
+// FindRoleByID retrieves a role by ID
+func FindRoleByID(ctx echo.Context, id string) (Role, error) {
+	var role Role
+	result := Tx(ctx).First(&role, "id = ?", id)
+	return role, result.Error
+}
+
+// CreateRole creates a new custom role
+func CreateRole(ctx echo.Context, input app.RoleCreateInput) (Role, error) {
+	if err := input.Validate(); err != nil {
+		return Role{}, err
+	}
+
+	if _, err := findRoleByName(ctx, input.Name); err == nil {
+		return Role{}, app.Errorf(app.ERR_INVALID, "Role %q already exists", input.Name)
+	}
+
+	role := Role{
+		Name:        input.Name,
+		Description: input.Description,
+		Permissions: input.Permissions,
+	}
+	if err := create(Tx(ctx), &role); err != nil {
+		return Role{}, err
+	}
+	return role, nil
+}
+
+// AssignUserRole changes the role of a user
+func AssignUserRole(ctx echo.Context, userID string, input app.UserRoleAssignInput) (User, error) {
+	if err := input.Validate(); err != nil {
+		return User{}, err
+	}
+
+	if _, err := FindRoleByID(ctx, input.RoleID); err != nil {
+		return User{}, app.Errorf(app.ERR_INVALID, "Role %q does not exist", input.RoleID)
+	}
+
+	user, err := findUserByID(ctx, userID)
+	if err != nil {
+		return User{}, err
+	}
+
+	user.RoleID = input.RoleID
+	if err = Tx(ctx).Save(&user).Error; err != nil {
+		return User{}, err
+	}
+	return user, invalidateUser(ctx, userID)
+}
+
+// findRoleByName is a helper function to fetch a role by name
+func findRoleByName(ctx echo.Context, name string) (Role, error) {
+	var role Role
+	result := Tx(ctx).First(&role, "name = ?", name)
+	return role, result.Error
+}
+
+func ConvertRole(_ echo.Context, r Role) (app.Role, error) {
+	role := app.Role{
+		ID:          r.ID,
+		Name:        r.Name,
+		Description: r.Description,
+		Permissions: r.Permissions,
+		Builtin:     r.Builtin,
+		CreatedAt:   r.CreatedAt,
+		UpdatedAt:   r.UpdatedAt,
+	}
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+	return role, nil
+}
@@ -0,0 +1,80 @@
+package db_test
+
+import (
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+)
+
+func (ts *TestSuite) Test_CreateRole() {
+	input := app.RoleCreateInput{
+		Name:        "Auditor",
+		Description: "read-only access",
+		Permissions: []string{app.PermissionTenantsList, app.PermissionTenantsRead},
+	}
+
+	role, err := db.CreateRole(ts.ctx, input)
+	ts.NoError(err)
+	ts.False(role.ID == "", "ID is not set")
+	ts.False(role.Builtin, "custom role should not be builtin")
+
+	fromDB, err := db.FindRoleByID(ts.ctx, role.ID)
+	ts.NoError(err)
+	ts.Equal(input.Name, fromDB.Name)
+	ts.ElementsMatch(input.Permissions, fromDB.Permissions)
+
+	// Expect an error for a duplicate name
+	_, err = db.CreateRole(ts.ctx, input)
+	ts.Error(err)
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err))
+
+	// Expect an error for an unknown permission
+	_, err = db.CreateRole(ts.ctx, app.RoleCreateInput{Name: "Bad", Permissions: []string{"bogus"}})
+	ts.Error(err)
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err))
+
+	// The wildcard is reserved for the builtin Admin role
+	_, err = db.CreateRole(ts.ctx, app.RoleCreateInput{Name: "Super", Permissions: []string{app.PermissionAll}})
+	ts.Error(err)
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err))
+}
+
+func (ts *TestSuite) Test_FindRoles() {
+	roles, err := db.FindRoles(ts.ctx, app.RoleFilter{})
+	ts.NoError(err)
+
+	names := make([]string, len(roles))
+	for i, r := range roles {
+		names[i] = r.Name
+	}
+	ts.Contains(names, app.UserRoleBasic)
+	ts.Contains(names, app.UserRoleAdmin)
+}
+
+func (ts *TestSuite) Test_AssignUserRole() {
+	user := ts.CreateUser(app.UserCreateInput{Email: "role@example.com"})
+
+	converted, err := db.ConvertUser(ts.ctx, user)
+	ts.NoError(err)
+	ts.Equal(app.UserRoleBasic, converted.Role, "new users should get the Basic role")
+	ts.False(converted.HasPermission(app.PermissionTenantsList))
+
+	role, err := db.CreateRole(ts.ctx, app.RoleCreateInput{
+		Name:        "Tenant Viewer",
+		Permissions: []string{app.PermissionTenantsList},
+	})
+	ts.NoError(err)
+
+	updated, err := db.AssignUserRole(ts.ctx, user.ID, app.UserRoleAssignInput{RoleID: role.ID})
+	ts.NoError(err)
+	ts.Equal(role.ID, updated.RoleID)
+
+	converted, err = db.ConvertUser(ts.ctx, updated)
+	ts.NoError(err)
+	ts.Equal(role.Name, converted.Role)
+	ts.True(converted.HasPermission(app.PermissionTenantsList))
+	ts.False(converted.HasPermission(app.PermissionTenantsCreate))
+
+	_, err = db.AssignUserRole(ts.ctx, user.ID, app.UserRoleAssignInput{RoleID: "nope"})
+	ts.Error(err)
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err))
+}
@@ -0,0 +1,303 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/keys"
+)
+
+// reservedKeyRingPrefix starts the names of key rings used internally. Key ring names given by users cannot contain
+// '.', so they do not collide, and API callers cannot find reserved key rings.
+const reservedKeyRingPrefix = "."
+
+// secretsKeyRing is the reserved key ring encrypting the secrets of a tenant
+const secretsKeyRing = reservedKeyRingPrefix + "secrets"
+
+type Secret struct {
+	ID             string `gorm:"primaryKey;type:string"`
+	TenantID       string
+	Path           string
+	CurrentVersion int
+	Versions       []SecretVersion
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (Secret) TableName() string {
+	return "secrets"
+}
+
+func (s *Secret) BeforeCreate(_ *gorm.DB) error {
+	s.ID = newID()
+	return nil
+}
+
+// SecretVersion is the encrypted data of one version of a secret. Versions are never modified.
+type SecretVersion struct {
+	ID             string `gorm:"primaryKey;type:string"`
+	SecretID       string
+	Version        int
+	Ciphertext     string
+	CreatedByID    *string
+	RolledBackFrom *int
+	CreatedAt      time.Time
+}
+
+func (SecretVersion) TableName() string {
+	return "secret_versions"
+}
+
+func (s *SecretVersion) BeforeCreate(_ *gorm.DB) error {
+	s.ID = newID()
+	return nil
+}
+
+// FindSecrets retrieves the secrets of a tenant whose path starts with the given prefix, ordered by path
+func FindSecrets(ctx echo.Context, tenantID, prefix string) ([]Secret, error) {
+	var secrets []Secret
+	q := Tx(ctx).Preload("Versions", orderSecretVersions).Where("tenant_id = ?", tenantID).Order("path")
+	if prefix != "" {
+		q = q.Where("path LIKE ?", escapeLike(prefix)+"%")
+	}
+	result := q.Find(&secrets)
+	return secrets, result.Error
+}
+
+// FindSecretByPath retrieves a secret of a tenant, with the metadata of its versions
+func FindSecretByPath(ctx echo.Context, tenantID, path string) (Secret, error) {
+	var secret Secret
+	result := Tx(ctx).Preload("Versions", orderSecretVersions).
+		First(&secret, "tenant_id = ? AND path = ?", tenantID, path)
+	return secret, result.Error
+}
+
+// ReadSecret decrypts a version of a secret. Version 0 selects the current version.
+func ReadSecret(ctx echo.Context, tenantID, path string, version int,
+	wrapper app.KeyWrapper,
+) (app.SecretData, error) {
+	secret, err := FindSecretByPath(ctx, tenantID, path)
+	if err != nil {
+		return app.SecretData{}, err
+	}
+	if version == 0 {
+		version = secret.CurrentVersion
+	}
+	data, err := readSecretVersion(ctx, secret, version, wrapper)
+	if err != nil {
+		return app.SecretData{}, err
+	}
+	return app.SecretData{Path: path, Version: version, Data: data}, nil
+}
+
+// WriteSecret stores data as a new version of a secret, creating the secret if it does not exist
+func WriteSecret(ctx echo.Context, tenantID, path, userID string, wrapper app.KeyWrapper,
+	input app.SecretWriteInput,
+) (Secret, error) {
+	if err := app.ValidateSecretPath(path); err != nil {
+		return Secret{}, err
+	}
+	if err := input.Validate(); err != nil {
+		return Secret{}, err
+	}
+
+	secret, err := lockSecret(ctx, tenantID, path)
+	if err != nil {
+		return Secret{}, err
+	}
+	if err = addSecretVersion(ctx, &secret, userID, input.Data, nil, wrapper); err != nil {
+		return Secret{}, err
+	}
+	return FindSecretByPath(ctx, tenantID, path)
+}
+
+// RollbackSecret restores the data of an earlier version of a secret as a new version
+func RollbackSecret(ctx echo.Context, tenantID, path, userID string, wrapper app.KeyWrapper,
+	input app.SecretRollbackInput,
+) (Secret, error) {
+	if err := input.Validate(); err != nil {
+		return Secret{}, err
+	}
+
+	var secret Secret
+	err := Tx(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&secret, "tenant_id = ? AND path = ?", tenantID, path).Error
+	if err != nil {
+		return Secret{}, err
+	}
+	data, err := readSecretVersion(ctx, secret, input.Version, wrapper)
+	if err != nil {
+		return Secret{}, err
+	}
+	if err = addSecretVersion(ctx, &secret, userID, data, &input.Version, wrapper); err != nil {
+		return Secret{}, err
+	}
+	return FindSecretByPath(ctx, tenantID, path)
+}
+
+func ConvertSecret(_ echo.Context, s Secret) (app.Secret, error) {
+	secret := app.Secret{
+		ID:             s.ID,
+		TenantID:       s.TenantID,
+		Path:           s.Path,
+		CurrentVersion: s.CurrentVersion,
+		Versions:       make([]app.SecretVersion, len(s.Versions)),
+		CreatedAt:      s.CreatedAt,
+		UpdatedAt:      s.UpdatedAt,
+	}
+	for i, v := range s.Versions {
+		secret.Versions[i] = app.SecretVersion{Version: v.Version, CreatedAt: v.CreatedAt}
+		if v.CreatedByID != nil {
+			secret.Versions[i].CreatedByID = *v.CreatedByID
+		}
+		if v.RolledBackFrom != nil {
+			secret.Versions[i].RolledBackFrom = *v.RolledBackFrom
+		}
+	}
+	return secret, nil
+}
+
+// lockSecret returns the secret at a path, locked for the rest of the transaction so that concurrent writes are
+// given consecutive versions. The secret is created if it does not exist.
+func lockSecret(ctx echo.Context, tenantID, path string) (Secret, error) {
+	secret := Secret{TenantID: tenantID, Path: path}
+	err := Tx(ctx).Omit("Versions").Clauses(clause.OnConflict{DoNothing: true}).Create(&secret).Error
+	if err != nil {
+		return Secret{}, err
+	}
+	err = Tx(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&secret, "tenant_id = ? AND path = ?", tenantID, path).Error
+	return secret, err
+}
+
+// addSecretVersion encrypts data as the next version of a locked secret
+func addSecretVersion(ctx echo.Context, secret *Secret, userID string, data map[string]string, rolledBackFrom *int,
+	wrapper app.KeyWrapper,
+) error {
+	plaintext, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	version := SecretVersion{
+		SecretID:       secret.ID,
+		Version:        secret.CurrentVersion + 1,
+		RolledBackFrom: rolledBackFrom,
+	}
+	if userID != "" {
+		version.CreatedByID = &userID
+	}
+	version.Ciphertext, err = encryptForTenant(ctx, secret.TenantID, wrapper, plaintext,
+		secretVersionContext(*secret, version.Version))
+	if err != nil {
+		return err
+	}
+	if err = Tx(ctx).Create(&version).Error; err != nil {
+		return err
+	}
+
+	secret.CurrentVersion = version.Version
+	return Tx(ctx).Model(secret).
+		Updates(map[string]any{"current_version": secret.CurrentVersion, "updated_at": time.Now()}).Error
+}
+
+func readSecretVersion(ctx echo.Context, secret Secret, version int,
+	wrapper app.KeyWrapper,
+) (map[string]string, error) {
+	var v SecretVersion
+	err := Tx(ctx).First(&v, "secret_id = ? AND version = ?", secret.ID, version).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, app.Errorf(app.ERR_NOTFOUND, "Secret %q has no version %d", secret.Path, version)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := decryptForTenant(ctx, secret.TenantID, wrapper, v.Ciphertext,
+		secretVersionContext(secret, version))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt secret %s version %d: %w", secret.ID, version, err)
+	}
+	var data map[string]string
+	err = json.Unmarshal(plaintext, &data)
+	return data, err
+}
+
+// encryptForTenant encrypts data with the latest version of the tenant's secrets key ring, creating the key ring if
+// the tenant has none. Of concurrent first writes, one creates the key ring; the others wait for it to commit, then
+// use it.
+func encryptForTenant(ctx echo.Context, tenantID string, wrapper app.KeyWrapper,
+	plaintext, additionalData []byte,
+) (string, error) {
+	key, version, err := findSecretsKey(ctx, tenantID, 0, wrapper)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ring := KeyRing{TenantID: tenantID, Name: secretsKeyRing, Type: app.KeyTypeAES256GCM, LatestVersion: 1}
+		result := Tx(ctx).Omit("Versions").Clauses(clause.OnConflict{DoNothing: true}).Create(&ring)
+		if result.Error != nil {
+			return "", result.Error
+		}
+		if result.RowsAffected > 0 {
+			if err = createKeyVersion(ctx, ring, wrapper); err != nil {
+				return "", err
+			}
+		}
+		key, version, err = findSecretsKey(ctx, tenantID, 0, wrapper)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := keys.Seal(key, plaintext, additionalData)
+	if err != nil {
+		return "", err
+	}
+	return keys.FormatCiphertext(version, sealed), nil
+}
+
+// decryptForTenant decrypts data encrypted by encryptForTenant
+func decryptForTenant(ctx echo.Context, tenantID string, wrapper app.KeyWrapper,
+	ciphertext string, additionalData []byte,
+) ([]byte, error) {
+	version, sealed, err := keys.ParseCiphertext(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	key, _, err := findSecretsKey(ctx, tenantID, version, wrapper)
+	if err != nil {
+		return nil, err
+	}
+	return keys.Open(key, sealed, additionalData)
+}
+
+// findSecretsKey returns the unwrapped key material of a version of the tenant's secrets key ring, and the version.
+// Version 0 selects the latest version.
+func findSecretsKey(ctx echo.Context, tenantID string, version int, wrapper app.KeyWrapper) ([]byte, int, error) {
+	ring, kv, err := findRingVersion(ctx, tenantID, secretsKeyRing, version)
+	if err != nil {
+		return nil, 0, err
+	}
+	return unwrapKeyVersion(ring, kv, wrapper)
+}
+
+// secretVersionContext binds the ciphertext of a secret version to the secret and version, so that it cannot be
+// substituted for another
+func secretVersionContext(secret Secret, version int) []byte {
+	return []byte(fmt.Sprintf("secret/%s/%d", secret.ID, version))
+}
+
+func orderSecretVersions(db *gorm.DB) *gorm.DB {
+	return db.Order("version")
+}
+
+// escapeLike escapes the wildcard characters of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,125 @@
+package db_test
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+	"github.com/briskt/keygo/keys"
+)
+
+func (ts *TestSuite) Test_Secrets() {
+	material, err := keys.NewKey()
+	ts.NoError(err)
+	master, err := keys.NewMasterKey(material)
+	ts.NoError(err)
+
+	tenant, err := db.CreateTenant(ts.ctx, app.TenantCreateInput{Name: "tenant"})
+	ts.NoError(err)
+	user := ts.CreateUser(app.UserCreateInput{Email: "secrets@example.com"})
+
+	for _, path := range []string{"", "/billing", "billing/", "billing//stripe", "billing/../other", "a b"} {
+		_, err = db.WriteSecret(ts.ctx, tenant.ID, path, user.ID, master,
+			app.SecretWriteInput{Data: map[string]string{"k": "v"}})
+		ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "path %q", path)
+	}
+
+	secret, err := db.WriteSecret(ts.ctx, tenant.ID, "billing/stripe", user.ID, master,
+		app.SecretWriteInput{Data: map[string]string{"api_key": "sk_1"}})
+	ts.NoError(err)
+	ts.Equal(1, secret.CurrentVersion)
+
+	var version db.SecretVersion
+	ts.NoError(ts.DB.First(&version, "secret_id = ?", secret.ID).Error)
+	ts.NotContains(version.Ciphertext, "sk_1", "data must be encrypted at rest")
+
+	secret, err = db.WriteSecret(ts.ctx, tenant.ID, "billing/stripe", user.ID, master,
+		app.SecretWriteInput{Data: map[string]string{"api_key": "sk_2"}})
+	ts.NoError(err)
+	ts.Equal(2, secret.CurrentVersion)
+	ts.Len(secret.Versions, 2)
+
+	data, err := db.ReadSecret(ts.ctx, tenant.ID, "billing/stripe", 0, master)
+	ts.NoError(err)
+	ts.Equal(2, data.Version)
+	ts.Equal("sk_2", data.Data["api_key"])
+
+	data, err = db.ReadSecret(ts.ctx, tenant.ID, "billing/stripe", 1, master)
+	ts.NoError(err)
+	ts.Equal("sk_1", data.Data["api_key"])
+
+	_, err = db.ReadSecret(ts.ctx, tenant.ID, "billing/stripe", 3, master)
+	ts.Equal(app.ERR_NOTFOUND, app.ErrorCode(err))
+
+	// Rotating the tenant key does not affect existing versions
+	_, err = db.RotateKeyRing(ts.ctx, tenant.ID, ".secrets", master)
+	ts.NoError(err)
+
+	secret, err = db.RollbackSecret(ts.ctx, tenant.ID, "billing/stripe", user.ID, master,
+		app.SecretRollbackInput{Version: 1})
+	ts.NoError(err)
+	ts.Equal(3, secret.CurrentVersion)
+	converted, err := db.ConvertSecret(ts.ctx, secret)
+	ts.NoError(err)
+	ts.Equal(1, converted.Versions[2].RolledBackFrom)
+	ts.Equal(user.ID, converted.Versions[2].CreatedByID)
+
+	data, err = db.ReadSecret(ts.ctx, tenant.ID, "billing/stripe", 0, master)
+	ts.NoError(err)
+	ts.Equal("sk_1", data.Data["api_key"])
+
+	_, err = db.WriteSecret(ts.ctx, tenant.ID, "billing_other", user.ID, master,
+		app.SecretWriteInput{Data: map[string]string{"k": "v"}})
+	ts.NoError(err)
+	secrets, err := db.FindSecrets(ts.ctx, tenant.ID, "billing/")
+	ts.NoError(err)
+	ts.Len(secrets, 1)
+	secrets, err = db.FindSecrets(ts.ctx, tenant.ID, "billing_")
+	ts.NoError(err)
+	ts.Len(secrets, 1, "the prefix is not a LIKE pattern")
+
+	rings, err := db.FindKeyRings(ts.ctx, tenant.ID)
+	ts.NoError(err)
+	ts.Empty(rings, "the secrets key ring is reserved")
+	_, err = db.FindKeyRingByName(ts.ctx, tenant.ID, ".secrets")
+	ts.ErrorIs(err, gorm.ErrRecordNotFound)
+	_, _, err = db.FindKey(ts.ctx, tenant.ID, ".secrets", 0, master)
+	ts.ErrorIs(err, gorm.ErrRecordNotFound)
+	_, err = db.RotateKeyRing(ts.ctx, tenant.ID, ".secrets", master)
+	ts.ErrorIs(err, gorm.ErrRecordNotFound)
+}
+
+func (ts *TestSuite) Test_WriteSecret_concurrentFirstWrites() {
+	material, err := keys.NewKey()
+	ts.NoError(err)
+	master, err := keys.NewMasterKey(material)
+	ts.NoError(err)
+
+	tenant, err := db.CreateTenant(ts.ctx, app.TenantCreateInput{Name: "tenant"})
+	ts.NoError(err)
+	user := ts.CreateUser(app.UserCreateInput{Email: "concurrent-secrets@example.com"})
+	input := app.SecretWriteInput{Data: map[string]string{"k": "v"}}
+
+	// the first write creates the tenant's key ring, and a second write waits for it rather than failing
+	tx1, tx2 := ts.DB.Begin(), ts.DB.Begin()
+	_, err = db.WriteSecret(testContext(tx1), tenant.ID, "first", user.ID, master, input)
+	ts.NoError(err)
+
+	done := make(chan error)
+	go func() {
+		_, err := db.WriteSecret(testContext(tx2), tenant.ID, "second", user.ID, master, input)
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	ts.NoError(tx1.Commit().Error)
+	ts.NoError(<-done)
+	ts.NoError(tx2.Commit().Error)
+
+	for _, path := range []string{"first", "second"} {
+		data, err := db.ReadSecret(ts.ctx, tenant.ID, path, 0, master)
+		ts.NoError(err)
+		ts.Equal("v", data.Data["k"])
+	}
+}
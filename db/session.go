@@ -0,0 +1,198 @@
+package db
+
+import (
+	"encoding/base32"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultSessionMaxAge is used for sessions that don't specify their own MaxAge
+const defaultSessionMaxAge = 86400 * 30
+
+// Session is a server-side session record. The session cookie holds only the signed ID.
+type Session struct {
+	ID        string `gorm:"primaryKey"`
+	Data      string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// SessionStore is a gorilla sessions.Store that persists session values in the sessions table
+type SessionStore struct {
+	Codecs  []securecookie.Codec
+	Options *sessions.Options // default configuration
+	db      *gorm.DB
+}
+
+// NewSessionStore returns a new SessionStore using the given database connection. See sessions.NewCookieStore()
+// for a description of keyPairs.
+func NewSessionStore(conn *gorm.DB, keyPairs ...[]byte) *SessionStore {
+	s := &SessionStore{
+		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{
+			Path:   "/",
+			MaxAge: defaultSessionMaxAge,
+		},
+		db: conn,
+	}
+
+	s.MaxAge(s.Options.MaxAge)
+	return s
+}
+
+// Get returns a session for the given name after adding it to the registry.
+//
+// See sessions.CookieStore.Get().
+func (s *SessionStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns a session for the given name without adding it to the registry. If the cookie references a
+// session that has expired or no longer exists, a new session is returned.
+//
+// See sessions.CookieStore.New().
+func (s *SessionStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+
+	c, errCookie := r.Cookie(name)
+	if errCookie != nil {
+		return session, nil
+	}
+
+	if err := securecookie.DecodeMulti(name, c.Value, &session.ID, s.Codecs...); err != nil {
+		return session, err
+	}
+
+	found, err := s.load(session)
+	if err != nil {
+		return session, err
+	}
+	if !found {
+		session.ID = ""
+		return session, nil
+	}
+
+	session.IsNew = false
+	return session, nil
+}
+
+// Save writes the session values to the database and sets the session ID cookie. If Options.MaxAge is <= 0,
+// the session is deleted.
+func (s *SessionStore) Save(_ *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge <= 0 {
+		if err := s.erase(session); err != nil {
+			return err
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+	}
+	if err := s.save(session); err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// MaxAge sets the maximum age for the store and the underlying cookie implementation. Individual sessions can be
+// deleted by setting Options.MaxAge = -1 for that session.
+func (s *SessionStore) MaxAge(age int) {
+	s.Options.MaxAge = age
+
+	for _, codec := range s.Codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(age)
+		}
+	}
+}
+
+// DeleteExpired removes all expired sessions from the database
+func (s *SessionStore) DeleteExpired() (int64, error) {
+	result := s.db.Where("expires_at <= ?", time.Now()).Delete(&Session{})
+	return result.RowsAffected, result.Error
+}
+
+// StartCleanup removes expired sessions at the given interval until the returned stop function is called.
+// Errors are passed to onError, which may be nil.
+func (s *SessionStore) StartCleanup(interval time.Duration, onError func(error)) (stop func()) {
+	quit := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := s.DeleteExpired(); err != nil && onError != nil {
+					onError(err)
+				}
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	return func() { close(quit) }
+}
+
+// save encodes the session values and upserts the session record
+func (s *SessionStore) save(session *sessions.Session) error {
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.Values, s.Codecs...)
+	if err != nil {
+		return err
+	}
+
+	record := Session{
+		ID:        session.ID,
+		Data:      encoded,
+		ExpiresAt: time.Now().Add(time.Duration(session.Options.MaxAge) * time.Second),
+	}
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"data", "expires_at", "updated_at"}),
+	}).Create(&record).Error
+}
+
+// load fetches an unexpired session record and decodes its values into the session. Returns false if no such
+// session exists.
+func (s *SessionStore) load(session *sessions.Session) (bool, error) {
+	var record Session
+	err := s.db.Where("id = ? AND expires_at > ?", session.ID, time.Now()).First(&record).Error
+	if err == gorm.ErrRecordNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err = securecookie.DecodeMulti(session.Name(), record.Data, &session.Values, s.Codecs...); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// erase deletes the session record
+func (s *SessionStore) erase(session *sessions.Session) error {
+	if session.ID == "" {
+		return nil
+	}
+	return s.db.Where("id = ?", session.ID).Delete(&Session{}).Error
+}
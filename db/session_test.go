@@ -0,0 +1,58 @@
+package db_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/briskt/keygo/db"
+)
+
+func (ts *TestSuite) Test_SessionStore() {
+	store := db.NewSessionStore(ts.DB, []byte("0123456789abcdef0123456789abcdef"))
+
+	// Save a new session and check that the cookie holds only the ID
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	sess, err := store.New(req, "session")
+	ts.NoError(err)
+	ts.True(sess.IsNew)
+	sess.Values["key"] = "value"
+
+	rec := httptest.NewRecorder()
+	ts.NoError(store.Save(req, rec, sess))
+	ts.NotEmpty(sess.ID)
+	cookies := rec.Result().Cookies()
+	ts.Len(cookies, 1)
+	ts.NotContains(cookies[0].Value, "value")
+
+	// Load the session back using the cookie
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookies[0])
+	loaded, err := store.New(req, "session")
+	ts.NoError(err)
+	ts.False(loaded.IsNew)
+	ts.Equal(sess.ID, loaded.ID)
+	ts.Equal("value", loaded.Values["key"])
+
+	// Expired sessions are not loaded and are removed by DeleteExpired
+	ts.NoError(ts.DB.Model(&db.Session{}).Where("id = ?", sess.ID).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error)
+	expired, err := store.New(req, "session")
+	ts.NoError(err)
+	ts.True(expired.IsNew)
+	ts.Empty(expired.Values)
+
+	n, err := store.DeleteExpired()
+	ts.NoError(err)
+	ts.GreaterOrEqual(n, int64(1))
+
+	// A session with MaxAge <= 0 is erased
+	sess, err = store.New(httptest.NewRequest(http.MethodGet, "/", nil), "session")
+	ts.NoError(err)
+	ts.NoError(store.Save(req, httptest.NewRecorder(), sess))
+	sess.Options.MaxAge = -1
+	ts.NoError(store.Save(req, httptest.NewRecorder(), sess))
+	var count int64
+	ts.NoError(ts.DB.Model(&db.Session{}).Where("id = ?", sess.ID).Count(&count).Error)
+	ts.Zero(count)
+}
@@ -0,0 +1,217 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/pki"
+)
+
+// SSHCertificateAuthority is the SSH CA of a tenant. Its private key is wrapped by the master key.
+type SSHCertificateAuthority struct {
+	ID                 string `gorm:"primaryKey;type:string"`
+	TenantID           string
+	PublicKey          string
+	WrappedKey         []byte
+	AllowedHostDomains pq.StringArray `gorm:"type:text[];default:'{}'"`
+	AllowHostIPs       bool           `gorm:"column:allow_host_ips"`
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+}
+
+func (SSHCertificateAuthority) TableName() string {
+	return "ssh_cas"
+}
+
+func (c *SSHCertificateAuthority) BeforeCreate(_ *gorm.DB) error {
+	c.ID = newID()
+	return nil
+}
+
+// FindSSHCA retrieves the SSH CA of a tenant
+func FindSSHCA(ctx echo.Context, tenantID string) (SSHCertificateAuthority, error) {
+	var ca SSHCertificateAuthority
+	result := Tx(ctx).First(&ca, "tenant_id = ?", tenantID)
+	return ca, result.Error
+}
+
+// GenerateSSHCA creates a new SSH CA for a tenant, which must not already have one
+func GenerateSSHCA(ctx echo.Context, tenantID string, wrapper app.KeyWrapper,
+	input app.SSHCAInput,
+) (SSHCertificateAuthority, error) {
+	if err := input.Validate(); err != nil {
+		return SSHCertificateAuthority{}, err
+	}
+
+	var count int64
+	err := Tx(ctx).Model(&SSHCertificateAuthority{}).Where("tenant_id = ?", tenantID).Count(&count).Error
+	if err != nil {
+		return SSHCertificateAuthority{}, err
+	}
+	if count > 0 {
+		return SSHCertificateAuthority{}, app.Errorf(app.ERR_INVALID, "The tenant already has an SSH CA")
+	}
+
+	key, publicKey, err := pki.GenerateSSHCA()
+	if err != nil {
+		return SSHCertificateAuthority{}, err
+	}
+	wrapped, err := wrapper.WrapKey(key, sshCAWrapContext(tenantID))
+	if err != nil {
+		return SSHCertificateAuthority{}, fmt.Errorf("wrap SSH CA key: %w", err)
+	}
+
+	ca := SSHCertificateAuthority{
+		TenantID:           tenantID,
+		PublicKey:          publicKey,
+		WrappedKey:         wrapped,
+		AllowedHostDomains: input.AllowedHostDomains,
+		AllowHostIPs:       input.AllowHostIPs,
+	}
+	if err = Tx(ctx).Create(&ca).Error; err != nil {
+		return SSHCertificateAuthority{}, err
+	}
+	return ca, nil
+}
+
+// UpdateSSHCA replaces the host certificate policy of the SSH CA of a tenant. Certificates already issued are
+// unaffected.
+func UpdateSSHCA(ctx echo.Context, tenantID string, input app.SSHCAInput) (SSHCertificateAuthority, error) {
+	if err := input.Validate(); err != nil {
+		return SSHCertificateAuthority{}, err
+	}
+	ca, err := FindSSHCA(ctx, tenantID)
+	if err != nil {
+		return SSHCertificateAuthority{}, err
+	}
+
+	err = Tx(ctx).Model(&ca).Updates(map[string]any{
+		"allowed_host_domains": pq.StringArray(input.AllowedHostDomains),
+		"allow_host_ips":       input.AllowHostIPs,
+		"updated_at":           time.Now(),
+	}).Error
+	if err != nil {
+		return SSHCertificateAuthority{}, err
+	}
+	return FindSSHCA(ctx, tenantID)
+}
+
+// SignSSHUserKey signs a user certificate for a member of a tenant with the tenant's SSH CA. The key ID is the
+// user's email address, and the principals are derived from the user's role in the tenant and the roles of the
+// user's groups.
+func SignSSHUserKey(ctx echo.Context, tenantID, userID string, wrapper app.KeyWrapper,
+	input app.SSHUserCertificateInput,
+) (*ssh.Certificate, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	ttl, _ := input.Duration()
+
+	membership, err := findTenantMembership(ctx, tenantID, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, app.Errorf(app.ERR_INVALID, "Only members of the tenant may obtain an SSH user certificate")
+	}
+	if err != nil {
+		return nil, err
+	}
+	grants, err := findGroupGrants(ctx, tenantID, userID)
+	if err != nil {
+		return nil, err
+	}
+	_, key, err := findSSHCAKey(ctx, tenantID, wrapper)
+	if err != nil {
+		return nil, err
+	}
+
+	principals := []string{app.SSHPrincipal(membership.Role.Name)}
+	seen := map[string]bool{principals[0]: true}
+	for _, g := range grants {
+		if g.RoleName == nil {
+			continue
+		}
+		if p := app.SSHPrincipal(*g.RoleName); !seen[p] {
+			principals = append(principals, p)
+			seen[p] = true
+		}
+	}
+	return pki.SignSSHUserKey(key, input.PublicKey, membership.User.Email, principals, ttl)
+}
+
+// SignSSHHostKey signs a host certificate for the given host names with the tenant's SSH CA, which must allow each
+// of them
+func SignSSHHostKey(ctx echo.Context, tenantID string, wrapper app.KeyWrapper,
+	input app.SSHHostCertificateInput,
+) (*ssh.Certificate, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	ttl, _ := input.Duration()
+
+	ca, key, err := findSSHCAKey(ctx, tenantID, wrapper)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := ConvertSSHCA(ctx, ca)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range input.Hostnames {
+		if !policy.AllowsHost(h) {
+			return nil, app.Errorf(app.ERR_INVALID, "The SSH CA does not allow host %q", h)
+		}
+	}
+	return pki.SignSSHHostKey(key, input.PublicKey, input.Hostnames, ttl)
+}
+
+func ConvertSSHCA(_ echo.Context, c SSHCertificateAuthority) (app.SSHCertificateAuthority, error) {
+	return app.SSHCertificateAuthority{
+		ID:                 c.ID,
+		TenantID:           c.TenantID,
+		PublicKey:          c.PublicKey,
+		AllowedHostDomains: c.AllowedHostDomains,
+		AllowHostIPs:       c.AllowHostIPs,
+		CreatedAt:          c.CreatedAt,
+		UpdatedAt:          c.UpdatedAt,
+	}, nil
+}
+
+func ConvertSSHCertificate(_ echo.Context, c *ssh.Certificate) (app.SSHCertificate, error) {
+	return app.SSHCertificate{
+		Certificate: pki.MarshalSSHPublicKey(c),
+		Serial:      c.Serial,
+		KeyID:       c.KeyId,
+		Principals:  c.ValidPrincipals,
+		ValidAfter:  time.Unix(int64(c.ValidAfter), 0),
+		ValidBefore: time.Unix(int64(c.ValidBefore), 0),
+	}, nil
+}
+
+// findSSHCAKey retrieves the SSH CA of a tenant and its unwrapped private key
+func findSSHCAKey(ctx echo.Context, tenantID string,
+	wrapper app.KeyWrapper,
+) (SSHCertificateAuthority, []byte, error) {
+	ca, err := FindSSHCA(ctx, tenantID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return SSHCertificateAuthority{}, nil, app.Errorf(app.ERR_INVALID, "The tenant has no SSH CA")
+	}
+	if err != nil {
+		return SSHCertificateAuthority{}, nil, err
+	}
+	key, err := wrapper.UnwrapKey(ca.WrappedKey, sshCAWrapContext(ca.TenantID))
+	if err != nil {
+		return SSHCertificateAuthority{}, nil, fmt.Errorf("unwrap SSH CA key %s: %w", ca.ID, err)
+	}
+	return ca, key, nil
+}
+
+// sshCAWrapContext binds the wrapped private key of an SSH CA to its tenant, which has at most one SSH CA
+func sshCAWrapContext(tenantID string) []byte {
+	return []byte("ssh-ca/" + tenantID)
+}
@@ -0,0 +1,87 @@
+package db_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+	"github.com/briskt/keygo/keys"
+	"github.com/briskt/keygo/pki"
+)
+
+func (ts *TestSuite) Test_SSHCA() {
+	material, err := keys.NewKey()
+	ts.NoError(err)
+	master, err := keys.NewMasterKey(material)
+	ts.NoError(err)
+
+	tenant, err := db.CreateTenant(ts.ctx, app.TenantCreateInput{Name: "tenant"})
+	ts.NoError(err)
+	member := ts.CreateUser(app.UserCreateInput{Email: "ssh-member@example.com"})
+	_, err = db.CreateTenantMembership(ts.ctx, app.TenantMembershipCreateInput{
+		TenantID: tenant.ID, UserID: member.ID, Role: app.UserRoleTenantAdmin,
+	})
+	ts.NoError(err)
+	outsider := ts.CreateUser(app.UserCreateInput{Email: "ssh-outsider@example.com"})
+
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	ts.NoError(err)
+	sshPublic, err := ssh.NewPublicKey(public)
+	ts.NoError(err)
+	userInput := app.SSHUserCertificateInput{PublicKey: pki.MarshalSSHPublicKey(sshPublic)}
+
+	_, err = db.SignSSHUserKey(ts.ctx, tenant.ID, member.ID, master, userInput)
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "the tenant has no SSH CA yet")
+
+	ca, err := db.GenerateSSHCA(ts.ctx, tenant.ID, master, app.SSHCAInput{})
+	ts.NoError(err)
+	ts.Contains(ca.PublicKey, "ssh-ed25519 ")
+	_, err = db.GenerateSSHCA(ts.ctx, tenant.ID, master, app.SSHCAInput{})
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "a tenant has one SSH CA")
+
+	cert, err := db.SignSSHUserKey(ts.ctx, tenant.ID, member.ID, master, userInput)
+	ts.NoError(err)
+	ts.Equal("ssh-member@example.com", cert.KeyId)
+	ts.Equal([]string{"tenant-admin"}, cert.ValidPrincipals)
+	ts.Equal(ca.PublicKey, pki.MarshalSSHPublicKey(cert.SignatureKey))
+
+	role, err := db.CreateRole(ts.ctx, app.RoleCreateInput{
+		Name:        "Database Operator",
+		Permissions: []string{app.PermissionOwnTenantRead},
+	})
+	ts.NoError(err)
+	operators, err := db.CreateGroup(ts.ctx, tenant.ID, app.GroupCreateInput{Name: "Operators", RoleID: role.ID})
+	ts.NoError(err)
+	ts.NoError(db.AddGroupMember(ts.ctx, tenant.ID, operators.ID, app.GroupMemberAddInput{UserID: member.ID}))
+	cert, err = db.SignSSHUserKey(ts.ctx, tenant.ID, member.ID, master, userInput)
+	ts.NoError(err)
+	ts.Equal([]string{"tenant-admin", "database-operator"}, cert.ValidPrincipals, "group roles are principals")
+
+	_, err = db.SignSSHUserKey(ts.ctx, tenant.ID, outsider.ID, master, userInput)
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "only members get a user certificate")
+
+	userInput.TTL = "48h"
+	_, err = db.SignSSHUserKey(ts.ctx, tenant.ID, member.ID, master, userInput)
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "user certificates are short-lived")
+
+	hostInput := app.SSHHostCertificateInput{PublicKey: userInput.PublicKey, Hostnames: []string{"web1.example.com"}}
+	_, err = db.SignSSHHostKey(ts.ctx, tenant.ID, master, hostInput)
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "no hosts are allowed by default")
+
+	_, err = db.UpdateSSHCA(ts.ctx, tenant.ID, app.SSHCAInput{AllowedHostDomains: []string{"*.example.com"}})
+	ts.NoError(err)
+	host, err := db.SignSSHHostKey(ts.ctx, tenant.ID, master, hostInput)
+	ts.NoError(err)
+	ts.Equal(uint32(ssh.HostCert), host.CertType)
+	ts.Equal([]string{"web1.example.com"}, host.ValidPrincipals)
+
+	hostInput.Hostnames = []string{"web1.example.org"}
+	_, err = db.SignSSHHostKey(ts.ctx, tenant.ID, master, hostInput)
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "a host outside the allowed domains is refused")
+	hostInput.Hostnames = []string{"10.0.0.1"}
+	_, err = db.SignSSHHostKey(ts.ctx, tenant.ID, master, hostInput)
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "IP addresses are not allowed by default")
+}
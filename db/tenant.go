@@ -4,17 +4,20 @@ import (
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
 	"gorm.io/gorm"
 
 	"github.com/briskt/keygo/app"
 )
 
 type Tenant struct {
-	ID        string `gorm:"primaryKey;type:string"`
-	Name      string
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Deleted   gorm.DeletedAt
+	ID             string `gorm:"primaryKey;type:string"`
+	Name           string
+	AllowedOrigins pq.StringArray `gorm:"type:text[];default:'{}'"`
+	AllowedCIDRs   pq.StringArray `gorm:"type:text[];default:'{}'"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Deleted        gorm.DeletedAt
 }
 
 func (u *Tenant) BeforeCreate(_ *gorm.DB) error {
@@ -65,12 +68,22 @@ func UpdateTenant(ctx echo.Context, id string, input app.TenantUpdateInput) (Ten
 	if input.Name != nil {
 		tenant.Name = *input.Name
 	}
+	if input.AllowedOrigins != nil {
+		tenant.AllowedOrigins = *input.AllowedOrigins
+	}
+	if input.AllowedCIDRs != nil {
+		tenant.AllowedCIDRs = *input.AllowedCIDRs
+	}
 
 	result := Tx(ctx).Save(&tenant)
-	if err != nil {
+	if result.Error != nil {
 		return Tenant{}, result.Error
 	}
 
+	// the tenant name is part of its members' memberships
+	if input.Name != nil {
+		return tenant, invalidateUsers(ctx)
+	}
 	return tenant, nil
 }
 
@@ -80,16 +93,18 @@ func DeleteTenant(ctx echo.Context, id string) error {
 	if err := result.Error; err != nil {
 		return err
 	}
-	return nil
+	if err := invalidateUsers(ctx); err != nil {
+		return err
+	}
+	// the tenant's API keys are deleted with it, but cached verifications would still find them valid
+	return invalidateAPIKeys(ctx)
 }
 
-// CreateTenantUser creates a new user for a tenant
-func CreateTenantUser(ctx echo.Context, tenantID string, input app.TenantUserCreateInput) (User, error) {
-	user, err := CreateUser(ctx, app.UserCreateInput{Email: input.Email, TenantID: tenantID})
-	if err != nil {
-		return User{}, err
-	}
-	return user, nil
+// TenantOriginAllowed returns true if the tenant allows the given web origin
+func TenantOriginAllowed(ctx echo.Context, tenantID, origin string) (bool, error) {
+	var count int64
+	result := Tx(ctx).Model(&Tenant{}).Where("id = ? AND ? = ANY(allowed_origins)", tenantID, origin).Count(&count)
+	return count > 0, result.Error
 }
 
 // FindTenantByID is a function to fetch a tenant by ID.
@@ -101,18 +116,29 @@ func FindTenantByID(ctx echo.Context, id string) (Tenant, error) {
 
 func ConvertTenant(c echo.Context, t Tenant) (app.Tenant, error) {
 	tenant := app.Tenant{
-		ID:        t.ID,
-		Name:      t.Name,
-		CreatedAt: t.CreatedAt,
-		UpdatedAt: t.UpdatedAt,
+		ID:             t.ID,
+		Name:           t.Name,
+		AllowedOrigins: t.AllowedOrigins,
+		AllowedCIDRs:   t.AllowedCIDRs,
+		CreatedAt:      t.CreatedAt,
+		UpdatedAt:      t.UpdatedAt,
+	}
+	if tenant.AllowedOrigins == nil {
+		tenant.AllowedOrigins = []string{}
 	}
-	users, err := FindUsers(c, app.UserFilter{TenantID: &t.ID})
+	if tenant.AllowedCIDRs == nil {
+		tenant.AllowedCIDRs = []string{}
+	}
+	memberships, err := FindTenantMemberships(c, app.TenantMembershipFilter{TenantID: &t.ID})
 	if err != nil {
 		return app.Tenant{}, err
 	}
-	tenant.UserIDs = make([]string, len(users))
-	for i, user := range users {
-		tenant.UserIDs[i] = user.ID
+	tenant.UserIDs = make([]string, len(memberships))
+	for i, m := range memberships {
+		tenant.UserIDs[i] = m.UserID
+	}
+	if tenant.Members, err = convertTenantMemberships(c, memberships); err != nil {
+		return app.Tenant{}, err
 	}
 	return tenant, nil
 }
@@ -9,21 +9,27 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/briskt/keygo/app"
 )
 
 const tokenBytes = 32
 
+// tokenTouchInterval is how often TouchToken records the use of a token
+const tokenTouchInterval = time.Minute
+
 type Token struct {
 	ID string `gorm:"primaryKey"`
 
 	User   User
 	UserID string
 
-	AuthID    string // OAuth sub (subject)
-	Hash      string
-	PlainText string `gorm:"-"`
+	AuthID         string  // OAuth sub (subject)
+	AuthSessionID  string  // OAuth sid (IdP session ID), may be empty
+	ActiveTenantID *string // tenant selected for this session, if any
+	Hash           string
+	PlainText      string `gorm:"-"`
 
 	LastUsedAt *time.Time
 	ExpiresAt  time.Time
@@ -66,13 +72,35 @@ func hashToken(accessToken string) string {
 
 // findToken is a helper function to return a token object by unhashed token string
 // Returns ERR_NOTFOUND if record doesn't exist
+// The token hash is published to row-level security policies so that the lookup can see the token, and on success
+// the token's user becomes the transaction's RLS actor. If the auth cache is enabled, a cached lookup skips the query.
 func findToken(ctx echo.Context, raw string) (Token, error) {
-	var token Token
-	err := Tx(ctx).Where("hash = ?", hashToken(raw)).First(&token).Error
-	if err == gorm.ErrRecordNotFound {
+	hash := hashToken(raw)
+	a := authCache.Load()
+	token, found, cached := a.getToken(hash)
+	if !cached {
+		var err error
+		if token, found, err = lookupToken(ctx, hash); err != nil {
+			return Token{}, err
+		}
+		a.addToken(hash, token, found)
+	}
+	if !found {
 		return Token{}, &app.Error{Code: app.ERR_NOTFOUND, Message: "Token not found"}
 	}
-	return token, err
+	return token, setRLSSetting(ctx, rlsSettingUserID, token.UserID)
+}
+
+// lookupToken queries a token by hash. found is false if it doesn't exist.
+func lookupToken(ctx echo.Context, hash string) (token Token, found bool, err error) {
+	if err = setRLSSetting(ctx, rlsSettingTokenHash, hash); err != nil {
+		return Token{}, false, err
+	}
+	err = Tx(ctx).Where("hash = ?", hash).First(&token).Error
+	if err == gorm.ErrRecordNotFound {
+		return Token{}, false, nil
+	}
+	return token, err == nil, err
 }
 
 // findToken is a helper function to return a token object by its ID
@@ -95,6 +123,9 @@ func updateToken(ctx echo.Context, token Token, input app.TokenUpdateInput) (Tok
 	if input.LastUsedAt != nil {
 		token.LastUsedAt = input.LastUsedAt
 	}
+	if input.ActiveTenantID != nil {
+		token.ActiveTenantID = input.ActiveTenantID
+	}
 
 	result := Tx(ctx).Omit("User").Save(&token)
 	return token, result.Error
@@ -109,8 +140,38 @@ func deleteToken(ctx echo.Context, id string) error {
 	//	return keygo.Errorf(keygo.ERR_UNAUTHORIZED, "You are not allowed to delete this token")
 	//}
 
-	result := Tx(ctx).Where("id = ?", id).Delete(&Token{})
-	return result.Error
+	var hashes []string
+	if err := Tx(ctx).Model(&Token{}).Where("id = ?", id).Pluck("hash", &hashes).Error; err != nil {
+		return err
+	}
+	if err := Tx(ctx).Where("id = ?", id).Delete(&Token{}).Error; err != nil {
+		return err
+	}
+	return invalidateTokens(ctx, hashes...)
+}
+
+// deleteTokensByAuth removes all tokens belonging to an IdP subject or session. If authSessionID is given, only
+// tokens of that IdP session are removed.
+func deleteTokensByAuth(ctx echo.Context, authID, authSessionID string) (int64, error) {
+	byAuth := func(q *gorm.DB) *gorm.DB {
+		if authSessionID != "" {
+			q = q.Where("auth_session_id = ?", authSessionID)
+		}
+		if authID != "" {
+			q = q.Where("auth_id = ?", authID)
+		}
+		return q
+	}
+
+	var hashes []string
+	if err := Tx(ctx).Model(&Token{}).Scopes(byAuth).Pluck("hash", &hashes).Error; err != nil {
+		return 0, err
+	}
+	result := Tx(ctx).Scopes(byAuth).Delete(&Token{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, invalidateTokens(ctx, hashes...)
 }
 
 // loadUser is a helper function to fetch & attach the associated User
@@ -137,9 +198,10 @@ func CreateToken(ctx echo.Context, input app.TokenCreateInput) (Token, error) {
 	}
 
 	token := Token{
-		UserID:    input.UserID,
-		AuthID:    input.AuthID,
-		ExpiresAt: input.ExpiresAt,
+		UserID:        input.UserID,
+		AuthID:        input.AuthID,
+		AuthSessionID: input.AuthSessionID,
+		ExpiresAt:     input.ExpiresAt,
 	}
 
 	err := token.create(ctx)
@@ -154,6 +216,42 @@ func DeleteToken(ctx echo.Context, id string) error {
 	return deleteToken(ctx, id)
 }
 
+// DeleteTokensByAuth revokes all tokens matching an IdP subject (sub) and/or session (sid), as identified by a
+// back-channel logout token. Returns the number of tokens revoked.
+func DeleteTokensByAuth(ctx echo.Context, authID, authSessionID string) (int64, error) {
+	if authID == "" && authSessionID == "" {
+		return 0, app.Errorf(app.ERR_INVALID, "AuthID or AuthSessionID is required")
+	}
+	return deleteTokensByAuth(ctx, authID, authSessionID)
+}
+
+// LogoutToken is the ID (jti) of an accepted back-channel logout token, kept until the token expires so that
+// replays of it are refused
+type LogoutToken struct {
+	ID        string `gorm:"primaryKey;type:string"`
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// RecordLogoutToken records the ID of a back-channel logout token, and returns an ERR_INVALID error if it was
+// already recorded. IDs of expired logout tokens are dropped, since the tokens themselves are refused.
+func RecordLogoutToken(ctx echo.Context, id string, expiresAt time.Time) error {
+	now := time.Now()
+	if err := Tx(ctx).Where("expires_at < ?", now).Delete(&LogoutToken{}).Error; err != nil {
+		return err
+	}
+
+	result := Tx(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&LogoutToken{ID: id, ExpiresAt: expiresAt, CreatedAt: now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return app.Errorf(app.ERR_INVALID, "Logout token %q was already used", id)
+	}
+	return nil
+}
+
 func UpdateToken(ctx echo.Context, id string, input app.TokenUpdateInput) error {
 	if err := input.Validate(); err != nil {
 		return err
@@ -163,29 +261,72 @@ func UpdateToken(ctx echo.Context, id string, input app.TokenUpdateInput) error
 	if err != nil {
 		return err
 	}
-	_, err = updateToken(ctx, token, input)
-	return err
+	if _, err = updateToken(ctx, token, input); err != nil {
+		return err
+	}
+
+	// a cached token may keep its previous expiry, which is only ever extended, but not its previous tenant
+	if input.ActiveTenantID != nil {
+		return invalidateTokens(ctx, token.Hash)
+	}
+	return nil
 }
 
-func ConvertToken(ctx echo.Context, token Token) (app.Token, error) {
-	if err := token.loadUser(ctx); err != nil {
-		return app.Token{}, err
+// TouchToken records the use of a token, and extends its expiry to app.AuthTokenLifetime from now. To spare a write
+// on every request, nothing is written if the token was last used within tokenTouchInterval, so a token may expire
+// up to that much sooner than AuthTokenLifetime after its last use.
+func TouchToken(ctx echo.Context, token Token) error {
+	now := time.Now()
+	if token.LastUsedAt != nil && now.Sub(*token.LastUsedAt) < tokenTouchInterval {
+		return nil
 	}
 
-	user, err := ConvertUser(ctx, token.User)
+	token.LastUsedAt = &now
+	token.ExpiresAt = now.Add(app.AuthTokenLifetime)
+	err := Tx(ctx).Model(&Token{}).Where("id = ?", token.ID).
+		Updates(map[string]any{"last_used_at": now, "expires_at": token.ExpiresAt}).Error
 	if err != nil {
-		return app.Token{}, err
+		return err
+	}
+
+	// a cached lookup would otherwise see the previous use, and write again
+	authCache.Load().addToken(token.Hash, token, true)
+	return nil
+}
+
+// ConvertToken converts a token, with its user. If the auth cache is enabled, a cached user skips the queries.
+func ConvertToken(ctx echo.Context, token Token) (app.Token, error) {
+	a := authCache.Load()
+	user, cached := a.getUser(token.UserID)
+	if !cached {
+		if err := token.loadUser(ctx); err != nil {
+			return app.Token{}, err
+		}
+
+		var err error
+		if user, err = ConvertUser(ctx, token.User); err != nil {
+			return app.Token{}, err
+		}
+		a.addUser(user)
+	}
+
+	// the active tenant is only honored while the user remains a member of it, or may access any tenant
+	if token.ActiveTenantID != nil {
+		if _, ok := user.Membership(*token.ActiveTenantID); ok || user.HasPermission(app.PermissionTenantsRead) {
+			user.TenantID = *token.ActiveTenantID
+		}
 	}
 
 	return app.Token{
-		ID:         token.ID,
-		User:       user,
-		UserID:     token.UserID,
-		AuthID:     token.AuthID,
-		PlainText:  token.PlainText,
-		LastUsedAt: token.LastUsedAt,
-		ExpiresAt:  token.ExpiresAt,
-		CreatedAt:  token.CreatedAt,
-		UpdatedAt:  token.UpdatedAt,
+		ID:            token.ID,
+		User:          user,
+		UserID:        token.UserID,
+		AuthID:        token.AuthID,
+		AuthSessionID: token.AuthSessionID,
+		PlainText:     token.PlainText,
+		LastUsedAt:    token.LastUsedAt,
+		ExpiresAt:     token.ExpiresAt,
+		CreatedAt:     token.CreatedAt,
+		UpdatedAt:     token.UpdatedAt,
 	}, nil
 }
@@ -34,3 +34,55 @@ func (ts *TestSuite) Test_CreateToken() {
 	ts.Error(err, "expected validation error")
 	ts.Equal(app.ERR_INVALID, app.ErrorCode(err))
 }
+
+func (ts *TestSuite) Test_DeleteTokensByAuth() {
+	user, err := db.CreateUser(ts.ctx, app.UserCreateInput{Email: "a@b.com"})
+	ts.NoError(err)
+
+	exp := time.Now().Add(time.Hour)
+	tokenA1, err := db.CreateToken(ts.ctx, app.TokenCreateInput{AuthID: "a", AuthSessionID: "s1", UserID: user.ID, ExpiresAt: exp})
+	ts.NoError(err)
+	tokenA2, err := db.CreateToken(ts.ctx, app.TokenCreateInput{AuthID: "a", AuthSessionID: "s2", UserID: user.ID, ExpiresAt: exp})
+	ts.NoError(err)
+	tokenB, err := db.CreateToken(ts.ctx, app.TokenCreateInput{AuthID: "b", UserID: user.ID, ExpiresAt: exp})
+	ts.NoError(err)
+
+	// Expect validation error
+	_, err = db.DeleteTokensByAuth(ts.ctx, "", "")
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err))
+
+	// sid only revokes the one IdP session
+	n, err := db.DeleteTokensByAuth(ts.ctx, "a", "s1")
+	ts.NoError(err)
+	ts.Equal(int64(1), n)
+	_, err = db.FindToken(ts.ctx, tokenA1.PlainText)
+	ts.Equal(app.ERR_NOTFOUND, app.ErrorCode(err))
+	_, err = db.FindToken(ts.ctx, tokenA2.PlainText)
+	ts.NoError(err)
+
+	// sub revokes all sessions of the subject
+	n, err = db.DeleteTokensByAuth(ts.ctx, "a", "")
+	ts.NoError(err)
+	ts.Equal(int64(1), n)
+	_, err = db.FindToken(ts.ctx, tokenA2.PlainText)
+	ts.Equal(app.ERR_NOTFOUND, app.ErrorCode(err))
+	_, err = db.FindToken(ts.ctx, tokenB.PlainText)
+	ts.NoError(err)
+}
+
+func (ts *TestSuite) Test_RecordLogoutToken() {
+	ts.NoError(ts.DB.Exec("DELETE FROM logout_tokens").Error)
+
+	ts.NoError(db.RecordLogoutToken(ts.ctx, "jti-1", time.Now().Add(time.Minute)))
+	ts.NoError(db.RecordLogoutToken(ts.ctx, "jti-2", time.Now().Add(time.Minute)))
+
+	err := db.RecordLogoutToken(ts.ctx, "jti-1", time.Now().Add(time.Minute))
+	ts.Equal(app.ERR_INVALID, app.ErrorCode(err), "a replayed logout token should be rejected")
+
+	// expired logout tokens are dropped
+	ts.NoError(db.RecordLogoutToken(ts.ctx, "jti-3", time.Now().Add(-time.Minute)))
+	ts.NoError(db.RecordLogoutToken(ts.ctx, "jti-4", time.Now().Add(time.Minute)))
+	var count int64
+	ts.NoError(ts.DB.Model(&db.LogoutToken{}).Where("id = ?", "jti-3").Count(&count).Error)
+	ts.Equal(int64(0), count)
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -15,8 +16,7 @@ type User struct {
 	LastName    string
 	Email       string `validate:"email"`
 	AvatarURL   string
-	Role        string
-	TenantID    *string
+	RoleID      string
 	LastLoginAt *time.Time
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
@@ -46,7 +46,8 @@ func FindUsers(ctx echo.Context, filter app.UserFilter) ([]User, error) {
 		q = q.Where("email = ?", filter.Email)
 	}
 	if filter.TenantID != nil {
-		q = q.Where("tenant_id = ?", filter.TenantID)
+		q = q.Where("id IN (?)",
+			Tx(ctx).Model(&TenantMembership{}).Select("user_id").Where("tenant_id = ?", filter.TenantID))
 	}
 	result := q.Find(&users)
 	return users, result.Error
@@ -58,20 +59,36 @@ func CreateUser(ctx echo.Context, userCreate app.UserCreateInput) (User, error)
 		return User{}, err
 	}
 
+	roleName := userCreate.Role
+	if roleName == "" {
+		roleName = app.UserRoleBasic
+	}
+	role, err := findRoleByName(ctx, roleName)
+	if err != nil {
+		return User{}, app.Errorf(app.ERR_INVALID, "Role %q does not exist", roleName)
+	}
+
 	user := User{
 		FirstName: userCreate.FirstName,
 		LastName:  userCreate.LastName,
 		Email:     userCreate.Email,
 		AvatarURL: userCreate.AvatarURL,
-		Role:      userCreate.Role,
+		RoleID:    role.ID,
 	}
 
-	if userCreate.TenantID != "" {
-		user.TenantID = &userCreate.TenantID
+	if err = create(Tx(ctx), &user); err != nil {
+		return User{}, err
 	}
 
-	if err := create(Tx(ctx), &user); err != nil {
-		return User{}, err
+	if userCreate.TenantID != "" {
+		_, err = CreateTenantMembership(ctx, app.TenantMembershipCreateInput{
+			TenantID: userCreate.TenantID,
+			UserID:   user.ID,
+			Role:     userCreate.TenantRole,
+		})
+		if err != nil {
+			return User{}, err
+		}
 	}
 	return user, nil
 }
@@ -100,19 +117,25 @@ func UpdateUser(ctx echo.Context, id string, input app.UserUpdateInput) (User, e
 	if result.Error != nil {
 		return User{}, result.Error
 	}
-	return user, nil
+	return user, invalidateUser(ctx, id)
 }
 
 // DeleteUser permanently deletes a user and all child objects
 func DeleteUser(ctx echo.Context, id string) error {
 	result := Tx(ctx).Where("id = ?", id).Delete(&User{})
-	return result.Error
+	if result.Error != nil {
+		return result.Error
+	}
+	return invalidateUser(ctx, id)
 }
 
 // TouchLastLoginAt sets the LastLoginAt field to the current time
 func TouchLastLoginAt(ctx echo.Context, id string) error {
 	result := Tx(ctx).Model(&User{}).Where("id = ?", id).Update("last_login_at", time.Now())
-	return result.Error
+	if result.Error != nil {
+		return result.Error
+	}
+	return invalidateUser(ctx, id)
 }
 
 // findUserByID is a helper function to fetch a user by ID.
@@ -122,20 +145,86 @@ func findUserByID(ctx echo.Context, id string) (User, error) {
 	return user, result.Error
 }
 
-func ConvertUser(_ echo.Context, u User) (app.User, error) {
-	user := app.User{
-		ID:          u.ID,
-		FirstName:   u.FirstName,
-		LastName:    u.LastName,
-		Email:       u.Email,
-		AvatarURL:   u.AvatarURL,
-		Role:        u.Role,
-		LastLoginAt: u.LastLoginAt,
-		CreatedAt:   u.CreatedAt,
-		UpdatedAt:   u.UpdatedAt,
-	}
-	if u.TenantID != nil {
-		user.TenantID = *u.TenantID
+func ConvertUser(ctx echo.Context, u User) (app.User, error) {
+	users, err := ConvertUsers(ctx, []User{u})
+	if err != nil {
+		return app.User{}, err
 	}
-	return user, nil
+	return users[0], nil
+}
+
+// ConvertUsers converts a list of users, finding the roles, active elevations, and tenant memberships of all of
+// them at once rather than one user at a time
+func ConvertUsers(ctx echo.Context, users []User) ([]app.User, error) {
+	out := make([]app.User, len(users))
+	if len(users) == 0 {
+		return out, nil
+	}
+
+	userIDs := make([]string, len(users))
+	roleIDs := make([]string, len(users))
+	for i, u := range users {
+		userIDs[i] = u.ID
+		roleIDs[i] = u.RoleID
+	}
+	var roles []Role
+	if err := Tx(ctx).Find(&roles, "id IN ?", roleIDs).Error; err != nil {
+		return nil, fmt.Errorf("find roles of users: %w", err)
+	}
+	rolesByID := make(map[string]Role, len(roles))
+	for _, r := range roles {
+		rolesByID[r.ID] = r
+	}
+	elevations, err := findActiveElevationsOfUsers(ctx, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("find elevations of users: %w", err)
+	}
+	memberships, err := findTenantMembershipsOfUsers(ctx, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("find memberships of users: %w", err)
+	}
+	var userMemberships []TenantMembership
+	for _, u := range users {
+		userMemberships = append(userMemberships, memberships[u.ID]...)
+	}
+	convertedMemberships, err := convertTenantMemberships(ctx, userMemberships)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, u := range users {
+		role, ok := rolesByID[u.RoleID]
+		if !ok {
+			return nil, fmt.Errorf("find role of user %s: %w", u.ID, gorm.ErrRecordNotFound)
+		}
+
+		user := app.User{
+			ID:          u.ID,
+			FirstName:   u.FirstName,
+			LastName:    u.LastName,
+			Email:       u.Email,
+			AvatarURL:   u.AvatarURL,
+			Role:        role.Name,
+			RoleID:      role.ID,
+			Permissions: append([]string{}, role.Permissions...),
+			LastLoginAt: u.LastLoginAt,
+			CreatedAt:   u.CreatedAt,
+			UpdatedAt:   u.UpdatedAt,
+		}
+		user.Elevations = make([]app.Elevation, len(elevations[u.ID]))
+		for j, e := range elevations[u.ID] {
+			if user.Elevations[j], err = ConvertElevation(ctx, e); err != nil {
+				return nil, err
+			}
+			addPermissions(&user.Permissions, e.Role.Permissions)
+		}
+
+		n := len(memberships[u.ID])
+		user.Memberships, convertedMemberships = convertedMemberships[:n:n], convertedMemberships[n:]
+		if len(user.Memberships) > 0 {
+			user.TenantID = user.Memberships[0].TenantID
+		}
+		out[i] = user
+	}
+	return out, nil
 }
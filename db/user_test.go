@@ -4,6 +4,8 @@ import (
 	"testing"
 	"time"
 
+	"gorm.io/gorm"
+
 	"github.com/briskt/keygo/app"
 	"github.com/briskt/keygo/db"
 )
@@ -131,3 +133,53 @@ func (ts *TestSuite) Test_TouchLastLoginAt() {
 
 	ts.WithinDuration(now, *found.LastLoginAt, time.Second)
 }
+
+func (ts *TestSuite) Test_ConvertUsers() {
+	tenant, err := db.CreateTenant(ts.ctx, app.TenantCreateInput{Name: "tenant"})
+	ts.NoError(err)
+	other, err := db.CreateTenant(ts.ctx, app.TenantCreateInput{Name: "other"})
+	ts.NoError(err)
+	group, err := db.CreateGroup(ts.ctx, tenant.ID, app.GroupCreateInput{
+		Name:        "Engineering",
+		Permissions: []string{app.PermissionOwnTenantRead},
+	})
+	ts.NoError(err)
+
+	var users []db.User
+	for _, email := range []string{"joe@example.com", "sally@example.com", "bob@example.com", "ann@example.com"} {
+		u := ts.CreateUser(app.UserCreateInput{Email: email, TenantID: tenant.ID})
+		_, err = db.CreateTenantMembership(ts.ctx, app.TenantMembershipCreateInput{TenantID: other.ID, UserID: u.ID})
+		ts.NoError(err)
+		ts.NoError(db.AddGroupMember(ts.ctx, tenant.ID, group.ID, app.GroupMemberAddInput{UserID: u.ID}))
+		users = append(users, u)
+	}
+
+	converted, err := db.ConvertUsers(ts.ctx, users)
+	ts.NoError(err)
+	ts.Len(converted, len(users))
+	for i, u := range users {
+		one, err := db.ConvertUser(ts.ctx, u)
+		ts.NoError(err)
+		ts.Equal(one, converted[i], "a user converted in a list is the same as on its own")
+		ts.Len(converted[i].Memberships, 2)
+		ts.Contains(converted[i].Memberships[0].GroupIDs, group.ID)
+	}
+
+	// the number of queries does not grow with the number of users
+	conn := db.OpenDB()
+	sqlDB, err := conn.DB()
+	ts.NoError(err)
+	defer sqlDB.Close()
+	var queries int
+	ts.NoError(conn.Callback().Query().Before("gorm:query").Register("test:count", func(*gorm.DB) { queries++ }))
+	ts.NoError(conn.Callback().Raw().Before("gorm:raw").Register("test:count", func(*gorm.DB) { queries++ }))
+	ctx := testContext(conn)
+
+	_, err = db.ConvertUsers(ctx, users[:2])
+	ts.NoError(err)
+	two := queries
+	queries = 0
+	_, err = db.ConvertUsers(ctx, users)
+	ts.NoError(err)
+	ts.Equal(two, queries)
+}
@@ -0,0 +1,70 @@
+package keys
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrSealed is returned by a sealed Barrier
+var ErrSealed = errors.New("keygo is sealed")
+
+// Barrier guards the master key. While sealed, it holds no key, and wrapping or unwrapping tenant keys fails with
+// ErrSealed. Unsealing gives it the master key, in memory only.
+type Barrier struct {
+	mu     sync.RWMutex
+	master *MasterKey
+}
+
+// Unseal starts using the given master key
+func (b *Barrier) Unseal(key []byte) error {
+	master, err := NewMasterKey(key)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.master = master
+	return nil
+}
+
+// Seal discards the master key
+func (b *Barrier) Seal() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.master = nil
+}
+
+// Sealed returns true until the barrier is unsealed
+func (b *Barrier) Sealed() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.master == nil
+}
+
+func (b *Barrier) WrapKey(key, context []byte) ([]byte, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.master == nil {
+		return nil, ErrSealed
+	}
+	return b.master.WrapKey(key, context)
+}
+
+func (b *Barrier) UnwrapKey(wrapped, context []byte) ([]byte, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.master == nil {
+		return nil, ErrSealed
+	}
+	return b.master.UnwrapKey(wrapped, context)
+}
+
+// WrapMaster encrypts the master key under an unseal key with WrapMasterKey, without revealing it otherwise
+func (b *Barrier) WrapMaster(unsealKey []byte) ([]byte, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.master == nil {
+		return nil, ErrSealed
+	}
+	return WrapMasterKey(unsealKey, b.master.key)
+}
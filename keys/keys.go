@@ -0,0 +1,113 @@
+// Package keys implements the encryption and signing of tenant data: AES-256-GCM data keys and signing key pairs,
+// wrapped by a master key, and the versioned ciphertext and signature format returned to clients
+package keys
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// KeySize is the size in bytes of data keys and the master key, for AES-256
+const KeySize = 32
+
+// versionedPrefix starts every ciphertext and signature, followed by the key version, e.g. "keygo:v2:<base64>"
+const versionedPrefix = "keygo:v"
+
+// ErrDecrypt is returned for ciphertext that is malformed, was encrypted with a different key or context, or was
+// tampered with. The cause is deliberately not distinguished.
+var ErrDecrypt = errors.New("unable to decrypt")
+
+// NewKey returns new random key material
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate key: %w", err)
+	}
+	return key, nil
+}
+
+// Seal encrypts and authenticates plaintext, and authenticates the additional data, with AES-256-GCM. The random
+// nonce is prepended to the result.
+func Seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// Open decrypts the result of Seal, given the same key and additional data
+func Open(key, sealed, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrDecrypt
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// FormatCiphertext encodes sealed data with the version of the key that sealed it
+func FormatCiphertext(version int, sealed []byte) string {
+	return formatVersioned(version, sealed)
+}
+
+// ParseCiphertext returns the key version and sealed data of a ciphertext made by FormatCiphertext
+func ParseCiphertext(ciphertext string) (int, []byte, error) {
+	version, sealed, ok := parseVersioned(ciphertext)
+	if !ok {
+		return 0, nil, ErrDecrypt
+	}
+	return version, sealed, nil
+}
+
+func formatVersioned(version int, data []byte) string {
+	return versionedPrefix + strconv.Itoa(version) + ":" + base64.StdEncoding.EncodeToString(data)
+}
+
+func parseVersioned(s string) (int, []byte, bool) {
+	rest, ok := strings.CutPrefix(s, versionedPrefix)
+	if !ok {
+		return 0, nil, false
+	}
+	v, encoded, ok := strings.Cut(rest, ":")
+	if !ok {
+		return 0, nil, false
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil || version < 1 {
+		return 0, nil, false
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return 0, nil, false
+	}
+	return version, data, true
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes, not %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
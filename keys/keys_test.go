@@ -0,0 +1,92 @@
+package keys
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealOpen(t *testing.T) {
+	key, err := NewKey()
+	require.NoError(t, err)
+	other, err := NewKey()
+	require.NoError(t, err)
+
+	sealed, err := Seal(key, []byte("secret"), []byte("context"))
+	require.NoError(t, err)
+	require.False(t, bytes.Contains(sealed, []byte("secret")))
+
+	plaintext, err := Open(key, sealed, []byte("context"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("secret"), plaintext)
+
+	_, err = Open(key, sealed, []byte("other context"))
+	require.ErrorIs(t, err, ErrDecrypt)
+	_, err = Open(other, sealed, []byte("context"))
+	require.ErrorIs(t, err, ErrDecrypt)
+	_, err = Open(key, sealed[:10], []byte("context"))
+	require.ErrorIs(t, err, ErrDecrypt)
+
+	sealed[len(sealed)-1] ^= 1
+	_, err = Open(key, sealed, []byte("context"))
+	require.ErrorIs(t, err, ErrDecrypt, "tampering should be detected")
+
+	_, err = Seal(key[:16], []byte("secret"), nil)
+	require.Error(t, err, "only 256-bit keys are allowed")
+}
+
+func TestCiphertext(t *testing.T) {
+	ciphertext := FormatCiphertext(3, []byte{1, 2, 3})
+	require.Equal(t, "keygo:v3:AQID", ciphertext)
+
+	version, sealed, err := ParseCiphertext(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, 3, version)
+	require.Equal(t, []byte{1, 2, 3}, sealed)
+
+	for _, bad := range []string{"", "AQID", "vault:v1:AQID", "keygo:v0:AQID", "keygo:vx:AQID", "keygo:v1", "keygo:v1:!"} {
+		_, _, err = ParseCiphertext(bad)
+		require.ErrorIs(t, err, ErrDecrypt, bad)
+	}
+}
+
+func TestMasterKey(t *testing.T) {
+	_, err := NewMasterKey(make([]byte, 16))
+	require.Error(t, err)
+
+	material, err := NewKey()
+	require.NoError(t, err)
+	master, err := NewMasterKey(material)
+	require.NoError(t, err)
+
+	key, err := NewKey()
+	require.NoError(t, err)
+	wrapped, err := master.WrapKey(key, []byte("tenant/ring/1"))
+	require.NoError(t, err)
+
+	unwrapped, err := master.UnwrapKey(wrapped, []byte("tenant/ring/1"))
+	require.NoError(t, err)
+	require.Equal(t, key, unwrapped)
+
+	_, err = master.UnwrapKey(wrapped, []byte("tenant/ring/2"))
+	require.Error(t, err, "a wrapped key is bound to its ring and version")
+}
+
+func TestWrapMasterKey(t *testing.T) {
+	master, err := NewKey()
+	require.NoError(t, err)
+	unsealKey, err := NewKey()
+	require.NoError(t, err)
+
+	wrapped, err := WrapMasterKey(unsealKey, master)
+	require.NoError(t, err)
+	unwrapped, err := UnwrapMasterKey(unsealKey, wrapped)
+	require.NoError(t, err)
+	require.Equal(t, master, unwrapped)
+
+	otherUnsealKey, err := NewKey()
+	require.NoError(t, err)
+	_, err = UnwrapMasterKey(otherUnsealKey, wrapped)
+	require.ErrorIs(t, err, ErrDecrypt, "a replaced unseal key no longer unwraps the master key")
+}
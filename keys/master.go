@@ -0,0 +1,43 @@
+package keys
+
+import (
+	"fmt"
+)
+
+// MasterKey wraps tenant data keys with AES-256-GCM
+type MasterKey struct {
+	key []byte
+}
+
+// NewMasterKey returns a MasterKey using the given key material, which must be KeySize bytes
+func NewMasterKey(key []byte) (*MasterKey, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("master key must be %d bytes, not %d", KeySize, len(key))
+	}
+	return &MasterKey{key: append([]byte{}, key...)}, nil
+}
+
+// WrapKey encrypts a data key, bound to the given context
+func (m *MasterKey) WrapKey(key, context []byte) ([]byte, error) {
+	return Seal(m.key, key, context)
+}
+
+// UnwrapKey decrypts a data key wrapped with the same context
+func (m *MasterKey) UnwrapKey(wrapped, context []byte) ([]byte, error) {
+	return Open(m.key, wrapped, context)
+}
+
+// unsealKeyContext is the wrapping context of the master key under an unseal key
+var unsealKeyContext = []byte("unseal-key")
+
+// WrapMasterKey encrypts a master key under an unseal key. When the master key is split into shares, the shares
+// reconstruct the unseal key, so that replacing the unseal key revokes the old shares without re-wrapping any
+// tenant keys.
+func WrapMasterKey(unsealKey, master []byte) ([]byte, error) {
+	return Seal(unsealKey, master, unsealKeyContext)
+}
+
+// UnwrapMasterKey decrypts a master key wrapped by WrapMasterKey, and fails with ErrDecrypt for any other unseal key
+func UnwrapMasterKey(unsealKey, wrapped []byte) ([]byte, error) {
+	return Open(unsealKey, wrapped, unsealKeyContext)
+}
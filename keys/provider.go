@@ -0,0 +1,81 @@
+package keys
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2id parameters for deriving the master key from a passphrase. Changing them changes the derived key.
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+
+	// MinSaltSize is the smallest salt accepted for passphrase derivation
+	MinSaltSize = 16
+)
+
+// Provider supplies the master key, the key-encryption key that wraps all tenant keys
+type Provider interface {
+	MasterKey() ([]byte, error)
+}
+
+// EnvProvider reads the master key from an environment variable, base64 encoded
+type EnvProvider struct {
+	Name string
+}
+
+func (p EnvProvider) MasterKey() ([]byte, error) {
+	v := os.Getenv(p.Name)
+	if v == "" {
+		return nil, fmt.Errorf("%s is not set", p.Name)
+	}
+	return DecodeKey(v)
+}
+
+// FileProvider reads the master key from a file, base64 encoded. The file would typically be mounted from a secret
+// store, rather than kept on the same disk as the database.
+type FileProvider struct {
+	Path string
+}
+
+func (p FileProvider) MasterKey() ([]byte, error) {
+	b, err := os.ReadFile(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("read master key file: %w", err)
+	}
+	return DecodeKey(string(bytes.TrimSpace(b)))
+}
+
+// PassphraseProvider derives the master key from a passphrase with Argon2id. The salt is not secret, but must stay
+// the same for the life of the master key.
+type PassphraseProvider struct {
+	Passphrase string
+	Salt       []byte
+}
+
+func (p PassphraseProvider) MasterKey() ([]byte, error) {
+	if p.Passphrase == "" {
+		return nil, fmt.Errorf("passphrase is empty")
+	}
+	if len(p.Salt) < MinSaltSize {
+		return nil, fmt.Errorf("salt must be at least %d bytes", MinSaltSize)
+	}
+	return argon2.IDKey([]byte(p.Passphrase), p.Salt, argon2Time, argon2Memory, argon2Threads, KeySize), nil
+}
+
+// DecodeKey decodes base64-encoded key material, and checks its size
+func DecodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("key must be base64 encoded")
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes, not %d", KeySize, len(key))
+	}
+	return key, nil
+}
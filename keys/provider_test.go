@@ -0,0 +1,86 @@
+package keys
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviders(t *testing.T) {
+	key, err := NewKey()
+	require.NoError(t, err)
+	encoded := base64.StdEncoding.EncodeToString(key)
+
+	t.Setenv("TEST_MASTER_KEY", encoded)
+	got, err := EnvProvider{Name: "TEST_MASTER_KEY"}.MasterKey()
+	require.NoError(t, err)
+	require.Equal(t, key, got)
+
+	_, err = EnvProvider{Name: "TEST_MASTER_KEY_UNSET"}.MasterKey()
+	require.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "master.key")
+	require.NoError(t, os.WriteFile(path, []byte(encoded+"\n"), 0o600))
+	got, err = FileProvider{Path: path}.MasterKey()
+	require.NoError(t, err)
+	require.Equal(t, key, got)
+
+	require.NoError(t, os.WriteFile(path, []byte("dG9vIHNob3J0"), 0o600))
+	_, err = FileProvider{Path: path}.MasterKey()
+	require.Error(t, err, "the key must be 32 bytes")
+}
+
+func TestPassphraseProvider(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	key, err := PassphraseProvider{Passphrase: "correct horse", Salt: salt}.MasterKey()
+	require.NoError(t, err)
+	require.Len(t, key, KeySize)
+
+	again, err := PassphraseProvider{Passphrase: "correct horse", Salt: salt}.MasterKey()
+	require.NoError(t, err)
+	require.Equal(t, key, again, "derivation must be deterministic")
+
+	other, err := PassphraseProvider{Passphrase: "battery staple", Salt: salt}.MasterKey()
+	require.NoError(t, err)
+	require.NotEqual(t, key, other)
+
+	_, err = PassphraseProvider{Passphrase: "correct horse", Salt: []byte("short")}.MasterKey()
+	require.Error(t, err)
+	_, err = PassphraseProvider{Salt: salt}.MasterKey()
+	require.Error(t, err)
+}
+
+func TestBarrier(t *testing.T) {
+	var b Barrier
+	require.True(t, b.Sealed())
+	_, err := b.WrapKey([]byte("key"), nil)
+	require.ErrorIs(t, err, ErrSealed)
+
+	master, err := NewKey()
+	require.NoError(t, err)
+	require.NoError(t, b.Unseal(master))
+	require.False(t, b.Sealed())
+
+	wrapped, err := b.WrapKey([]byte("key"), []byte("context"))
+	require.NoError(t, err)
+	unwrapped, err := b.UnwrapKey(wrapped, []byte("context"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("key"), unwrapped)
+
+	unsealKey, err := NewKey()
+	require.NoError(t, err)
+	wrappedMaster, err := b.WrapMaster(unsealKey)
+	require.NoError(t, err)
+	unwrappedMaster, err := UnwrapMasterKey(unsealKey, wrappedMaster)
+	require.NoError(t, err)
+	require.Equal(t, master, unwrappedMaster)
+
+	b.Seal()
+	_, err = b.UnwrapKey(wrapped, []byte("context"))
+	require.ErrorIs(t, err, ErrSealed)
+	_, err = b.WrapMaster(unsealKey)
+	require.ErrorIs(t, err, ErrSealed)
+}
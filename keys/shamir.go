@@ -0,0 +1,166 @@
+package keys
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// MaxShares is the most shares a secret can be split into, one per non-zero element of GF(2^8)
+const MaxShares = 255
+
+// Arithmetic in GF(2^8) with the AES polynomial x^8 + x^4 + x^3 + x + 1, using logarithms to the generator 3
+var gfExp, gfLog = func() (exp [510]byte, log [256]byte) {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		exp[i], exp[i+255] = x, x
+		log[x] = byte(i)
+		// multiply by 3: x*2 xor x, reducing x*2 by the polynomial
+		x2 := x << 1
+		if x&0x80 != 0 {
+			x2 ^= 0x1b
+		}
+		x ^= x2
+	}
+	return exp, log
+}()
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// SplitSecret splits a secret into n shares with Shamir's secret sharing, such that any threshold of them
+// reconstruct it, and fewer reveal nothing about it. Each share is the secret's length plus one byte.
+func SplitSecret(secret []byte, n, threshold int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("secret is empty")
+	}
+	if threshold < 2 || threshold > n || n > MaxShares {
+		return nil, fmt.Errorf("need 2 <= threshold <= shares <= %d, not threshold %d of %d shares", MaxShares,
+			threshold, n)
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		// the share's x coordinate is its last byte
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+
+	// each byte of the secret is the constant term of a random polynomial of degree threshold-1
+	coefficients := make([]byte, threshold)
+	for b, s := range secret {
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, fmt.Errorf("generate coefficients: %w", err)
+		}
+		coefficients[0] = s
+		for _, share := range shares {
+			share[b] = evaluate(coefficients, share[len(secret)])
+		}
+	}
+	return shares, nil
+}
+
+// CombineShares reconstructs a secret from a threshold of its shares. With fewer shares, or shares of different
+// secrets, the result is not the secret, but no error is returned; the result must be verified by the caller.
+func CombineShares(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, errors.New("at least two shares are required")
+	}
+	size := len(shares[0])
+	if size < 2 {
+		return nil, errors.New("invalid share")
+	}
+	xs := make([]byte, len(shares))
+	for i, share := range shares {
+		if len(share) != size {
+			return nil, errors.New("shares must be the same length")
+		}
+		xs[i] = share[size-1]
+		if xs[i] == 0 || bytes.IndexByte(xs[:i], xs[i]) >= 0 {
+			return nil, errors.New("invalid or duplicate share")
+		}
+	}
+
+	// Lagrange interpolation of each byte at x = 0
+	secret := make([]byte, size-1)
+	for b := range secret {
+		var value byte
+		for i, xi := range xs {
+			basis := byte(1)
+			for j, xj := range xs {
+				if i != j {
+					// (0 - xj) / (xi - xj), where subtraction is xor
+					basis = gfMul(basis, gfDiv(xj, xi^xj))
+				}
+			}
+			value ^= gfMul(shares[i][b], basis)
+		}
+		secret[b] = value
+	}
+	return secret, nil
+}
+
+// evaluate returns the value of the polynomial with the given coefficients, lowest degree first, at x
+func evaluate(coefficients []byte, x byte) byte {
+	var y byte
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ coefficients[i]
+	}
+	return y
+}
+
+// ShareCollector accumulates shares submitted one at a time, until it holds enough to reconstruct the secret
+type ShareCollector struct {
+	mu     sync.Mutex
+	shares [][]byte
+}
+
+// Add adds a share, and once the threshold is reached, returns the combined secret and forgets the shares.
+// Otherwise, it returns nil and the number of shares held.
+func (c *ShareCollector) Add(share []byte, threshold int) ([]byte, int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range c.shares {
+		if bytes.Equal(s, share) {
+			return nil, len(c.shares), errors.New("share was already given")
+		}
+	}
+	if len(c.shares) > 0 && len(share) != len(c.shares[0]) {
+		return nil, len(c.shares), errors.New("share is not the same length as the others")
+	}
+
+	c.shares = append(c.shares, append([]byte{}, share...))
+	if len(c.shares) < threshold {
+		return nil, len(c.shares), nil
+	}
+	secret, err := CombineShares(c.shares)
+	c.shares = nil
+	return secret, 0, err
+}
+
+// Progress returns the number of shares held
+func (c *ShareCollector) Progress() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.shares)
+}
+
+// Reset forgets the shares held
+func (c *ShareCollector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.shares = nil
+}
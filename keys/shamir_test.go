@@ -0,0 +1,72 @@
+package keys
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGF(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			require.Equal(t, byte(a), gfDiv(gfMul(byte(a), byte(b)), byte(b)))
+		}
+	}
+	require.Equal(t, byte(0xc1), gfMul(0x57, 0x83), "the example from FIPS-197")
+}
+
+func TestSplitCombine(t *testing.T) {
+	secret, err := NewKey()
+	require.NoError(t, err)
+
+	shares, err := SplitSecret(secret, 5, 3)
+	require.NoError(t, err)
+	require.Len(t, shares, 5)
+
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		var given [][]byte
+		for _, i := range subset {
+			given = append(given, shares[i])
+		}
+		combined, err := CombineShares(given)
+		require.NoError(t, err)
+		require.Equal(t, secret, combined, "shares %v", subset)
+	}
+
+	combined, err := CombineShares(shares[:2])
+	require.NoError(t, err)
+	require.NotEqual(t, secret, combined, "fewer than the threshold do not reconstruct the secret")
+
+	_, err = CombineShares([][]byte{shares[0], shares[0]})
+	require.Error(t, err)
+	_, err = CombineShares([][]byte{shares[0], shares[1][:5]})
+	require.Error(t, err)
+
+	for _, bad := range [][2]int{{1, 1}, {3, 4}, {256, 3}, {3, 1}} {
+		_, err = SplitSecret(secret, bad[0], bad[1])
+		require.Error(t, err, "%d shares, threshold %d", bad[0], bad[1])
+	}
+}
+
+func TestShareCollector(t *testing.T) {
+	secret, err := NewKey()
+	require.NoError(t, err)
+	shares, err := SplitSecret(secret, 3, 2)
+	require.NoError(t, err)
+
+	var c ShareCollector
+	got, progress, err := c.Add(shares[2], 2)
+	require.NoError(t, err)
+	require.Nil(t, got)
+	require.Equal(t, 1, progress)
+
+	_, _, err = c.Add(shares[2], 2)
+	require.Error(t, err, "the same share cannot be given twice")
+	require.Equal(t, 1, c.Progress())
+
+	got, progress, err = c.Add(shares[0], 2)
+	require.NoError(t, err)
+	require.Equal(t, secret, got)
+	require.Equal(t, 0, progress)
+	require.Equal(t, 0, c.Progress(), "shares are forgotten once combined")
+}
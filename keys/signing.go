@@ -0,0 +1,174 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Signing key types. ECDSA and RSA-PSS sign the SHA-256 digest of the message; Ed25519 signs the message itself.
+// ECDSA signatures are ASN.1 DER encoded, as OpenSSL expects, rather than in the fixed-size form of JWS.
+const (
+	Ed25519   = "ed25519"
+	ECDSAP256 = "ecdsa-p256"
+	RSAPSS    = "rsa-pss"
+)
+
+// RSAKeyBits is the size of generated RSA keys
+const RSAKeyBits = 3072
+
+// pssOptions are the RSA-PSS parameters of PS256
+var pssOptions = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+
+// ErrVerify is returned for a signature that is malformed, or was not made by the key over the message
+var ErrVerify = errors.New("invalid signature")
+
+// NewSigningKey generates a key pair of the given type, and returns the private key in PKCS #8 and the public key in
+// PKIX form, both DER encoded
+func NewSigningKey(keyType string) (private, public []byte, err error) {
+	var key crypto.Signer
+	switch keyType {
+	case Ed25519:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case ECDSAP256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case RSAPSS:
+		key, err = rsa.GenerateKey(rand.Reader, RSAKeyBits)
+	default:
+		return nil, nil, fmt.Errorf("unsupported signing key type %q", keyType)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate %s key: %w", keyType, err)
+	}
+
+	if private, err = x509.MarshalPKCS8PrivateKey(key); err != nil {
+		return nil, nil, err
+	}
+	if public, err = x509.MarshalPKIXPublicKey(key.Public()); err != nil {
+		return nil, nil, err
+	}
+	return private, public, nil
+}
+
+// Sign signs a message with a private key made by NewSigningKey
+func Sign(private, message []byte) ([]byte, error) {
+	key, err := x509.ParsePKCS8PrivateKey(private)
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		return ed25519.Sign(k, message), nil
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(message)
+		return ecdsa.SignASN1(rand.Reader, k, digest[:])
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256(message)
+		return rsa.SignPSS(rand.Reader, k, crypto.SHA256, digest[:], pssOptions)
+	}
+	return nil, fmt.Errorf("unsupported private key type %T", key)
+}
+
+// Verify returns ErrVerify unless the signature was made over the message by the private key of the public key
+func Verify(public, message, signature []byte) error {
+	key, err := x509.ParsePKIXPublicKey(public)
+	if err != nil {
+		return fmt.Errorf("parse public key: %w", err)
+	}
+	valid := false
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(k, message, signature)
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(message)
+		valid = ecdsa.VerifyASN1(k, digest[:], signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(message)
+		valid = rsa.VerifyPSS(k, crypto.SHA256, digest[:], signature, pssOptions) == nil
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+	if !valid {
+		return ErrVerify
+	}
+	return nil
+}
+
+// FormatSignature encodes a signature with the version of the key that made it
+func FormatSignature(version int, signature []byte) string {
+	return formatVersioned(version, signature)
+}
+
+// ParseSignature returns the key version and signature of a signature made by FormatSignature
+func ParseSignature(signature string) (int, []byte, error) {
+	version, sig, ok := parseVersioned(signature)
+	if !ok {
+		return 0, nil, ErrVerify
+	}
+	return version, sig, nil
+}
+
+// PublicKeyPEM returns a DER-encoded PKIX public key in PEM form
+func PublicKeyPEM(public []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}))
+}
+
+// JWK is a public key in JSON Web Key form (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// JWKSet is a set of JSON Web Keys
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKeyJWK returns a DER-encoded PKIX public key as a JSON Web Key for verifying signatures, with the given key
+// ID
+func PublicKeyJWK(public []byte, keyID string) (JWK, error) {
+	key, err := x509.ParsePKIXPublicKey(public)
+	if err != nil {
+		return JWK{}, fmt.Errorf("parse public key: %w", err)
+	}
+	jwk := JWK{KeyID: keyID, Use: "sig"}
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		jwk.KeyType, jwk.Algorithm, jwk.Curve = "OKP", "EdDSA", "Ed25519"
+		jwk.X = encodeJWKBytes(k)
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		// no "alg", since the signatures are not in the ES256 form
+		jwk.KeyType, jwk.Curve = "EC", k.Curve.Params().Name
+		jwk.X = encodeJWKBytes(k.X.FillBytes(make([]byte, size)))
+		jwk.Y = encodeJWKBytes(k.Y.FillBytes(make([]byte, size)))
+	case *rsa.PublicKey:
+		jwk.KeyType, jwk.Algorithm = "RSA", "PS256"
+		jwk.N = encodeJWKBytes(k.N.Bytes())
+		jwk.E = encodeJWKBytes(big.NewInt(int64(k.E)).Bytes())
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", key)
+	}
+	return jwk, nil
+}
+
+func encodeJWKBytes(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,86 @@
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignVerify(t *testing.T) {
+	for _, keyType := range []string{Ed25519, ECDSAP256, RSAPSS} {
+		t.Run(keyType, func(t *testing.T) {
+			private, public, err := NewSigningKey(keyType)
+			require.NoError(t, err)
+			_, otherPublic, err := NewSigningKey(keyType)
+			require.NoError(t, err)
+
+			signature, err := Sign(private, []byte("artifact"))
+			require.NoError(t, err)
+
+			require.NoError(t, Verify(public, []byte("artifact"), signature))
+			require.ErrorIs(t, Verify(public, []byte("other artifact"), signature), ErrVerify)
+			require.ErrorIs(t, Verify(otherPublic, []byte("artifact"), signature), ErrVerify)
+
+			signature[len(signature)-1] ^= 1
+			require.ErrorIs(t, Verify(public, []byte("artifact"), signature), ErrVerify,
+				"tampering should be detected")
+		})
+	}
+
+	_, _, err := NewSigningKey("dsa")
+	require.Error(t, err)
+}
+
+func TestSignature(t *testing.T) {
+	signature := FormatSignature(2, []byte{1, 2, 3})
+	require.Equal(t, "keygo:v2:AQID", signature)
+
+	version, sig, err := ParseSignature(signature)
+	require.NoError(t, err)
+	require.Equal(t, 2, version)
+	require.Equal(t, []byte{1, 2, 3}, sig)
+
+	_, _, err = ParseSignature("keygo:v0:AQID")
+	require.ErrorIs(t, err, ErrVerify)
+}
+
+func TestPublicKeyExport(t *testing.T) {
+	_, public, err := NewSigningKey(ECDSAP256)
+	require.NoError(t, err)
+
+	block, _ := pem.Decode([]byte(PublicKeyPEM(public)))
+	require.NotNil(t, block)
+	require.Equal(t, "PUBLIC KEY", block.Type)
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	require.NoError(t, err)
+	require.IsType(t, &ecdsa.PublicKey{}, key)
+
+	jwk, err := PublicKeyJWK(public, "ring:1")
+	require.NoError(t, err)
+	require.Equal(t, "EC", jwk.KeyType)
+	require.Equal(t, "P-256", jwk.Curve)
+	require.Equal(t, "ring:1", jwk.KeyID)
+	require.Len(t, jwk.X, 43, "coordinates are 32 bytes, unpadded base64url")
+	require.Len(t, jwk.Y, 43)
+
+	_, public, err = NewSigningKey(Ed25519)
+	require.NoError(t, err)
+	jwk, err = PublicKeyJWK(public, "")
+	require.NoError(t, err)
+	require.Equal(t, "OKP", jwk.KeyType)
+	require.Equal(t, "Ed25519", jwk.Curve)
+	require.Len(t, jwk.X, 43, "%d-byte key", ed25519.PublicKeySize)
+
+	_, public, err = NewSigningKey(RSAPSS)
+	require.NoError(t, err)
+	jwk, err = PublicKeyJWK(public, "")
+	require.NoError(t, err)
+	require.Equal(t, "RSA", jwk.KeyType)
+	require.Equal(t, "PS256", jwk.Algorithm)
+	require.Equal(t, "AQAB", jwk.E)
+	require.Len(t, jwk.N, (RSAKeyBits/8*4+2)/3)
+}
@@ -0,0 +1,35 @@
+package mailer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/briskt/keygo/app"
+)
+
+// FileSender writes each email to a .eml file in a directory, for development and testing
+type FileSender struct {
+	From *mail.Address
+	Dir  string
+}
+
+// SendEmail implements app.EmailSender
+func (f FileSender) SendEmail(email app.Email) error {
+	now := time.Now()
+	msg, err := buildMessage(f.From, email, now)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(f.Dir, 0o700); err != nil {
+		return err
+	}
+
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	name := now.UTC().Format("20060102T150405.000000000Z") + "-" + hex.EncodeToString(b) + ".eml"
+	return os.WriteFile(filepath.Join(f.Dir, name), msg, 0o600)
+}
@@ -0,0 +1,52 @@
+// Package mailer renders email from templates, and delivers it by SMTP or to files
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/briskt/keygo/app"
+)
+
+//go:embed templates
+var templates embed.FS
+
+// layoutTemplate wraps the HTML body of every email
+const layoutTemplate = "layout.html.tmpl"
+
+// Render returns an email, without a recipient, from the named templates in the templates directory:
+//
+//   - <name>.txt.tmpl is the plain text body, and defines a "subject" template
+//   - <name>.html.tmpl defines the "content" template, which is the HTML body within the layout
+func Render(name string, data any) (app.Email, error) {
+	textName := name + ".txt.tmpl"
+	t, err := texttemplate.ParseFS(templates, "templates/"+textName)
+	if err != nil {
+		return app.Email{}, err
+	}
+	var subject, text bytes.Buffer
+	if err = t.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return app.Email{}, err
+	}
+	if err = t.ExecuteTemplate(&text, textName, data); err != nil {
+		return app.Email{}, err
+	}
+
+	h, err := htmltemplate.ParseFS(templates, "templates/"+layoutTemplate, "templates/"+name+".html.tmpl")
+	if err != nil {
+		return app.Email{}, err
+	}
+	var html bytes.Buffer
+	if err = h.ExecuteTemplate(&html, layoutTemplate, data); err != nil {
+		return app.Email{}, err
+	}
+
+	return app.Email{
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    html.String(),
+	}, nil
+}
@@ -0,0 +1,115 @@
+package mailer
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/briskt/keygo/app"
+)
+
+var testFrom = &mail.Address{Name: "Keygo", Address: "support@example.com"}
+
+func TestRender(t *testing.T) {
+	data := map[string]any{
+		"TenantName":   "Acme <Corp>",
+		"Role":         "Basic",
+		"InviterEmail": "admin@example.com",
+		"URL":          "https://keygo.example.com/invitations/accept?token=abc",
+		"ExpiresAt":    time.Date(2023, 9, 17, 12, 0, 0, 0, time.UTC),
+	}
+	email, err := Render("invitation", data)
+	require.NoError(t, err)
+	require.Equal(t, "You are invited to join Acme <Corp>", email.Subject)
+	require.Contains(t, email.Text, "admin@example.com has invited you to join Acme <Corp> as Basic.")
+	require.Contains(t, email.Text, data["URL"])
+	require.Contains(t, email.Text, "September 17, 2023")
+	require.Contains(t, email.HTML, "<strong>Acme &lt;Corp&gt;</strong>", "HTML must be escaped")
+	require.Contains(t, email.HTML, `href="https://keygo.example.com/invitations/accept?token=abc"`)
+
+	_, err = Render("no-such-template", data)
+	require.Error(t, err)
+}
+
+func TestBuildMessage(t *testing.T) {
+	email := app.Email{
+		To:      "Jane Doe <jane@example.com>",
+		Subject: "Héllo\r\nBcc: victim@example.com",
+		Text:    "plain body",
+		HTML:    "<p>html body</p>",
+	}
+	b, err := buildMessage(testFrom, email, time.Now())
+	require.NoError(t, err)
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(b)))
+	require.NoError(t, err)
+	require.Equal(t, `"Jane Doe" <jane@example.com>`, msg.Header.Get("To"))
+	require.Empty(t, msg.Header.Get("Bcc"), "a subject must not inject headers")
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	require.Equal(t, "Héllo Bcc: victim@example.com", subject)
+	require.True(t, strings.HasSuffix(msg.Header.Get("Message-ID"), "@example.com>"))
+
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	var bodies []string
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		body, err := io.ReadAll(part)
+		require.NoError(t, err)
+		bodies = append(bodies, string(body))
+	}
+	require.Equal(t, []string{"plain body", "<p>html body</p>"}, bodies)
+
+	_, err = buildMessage(testFrom, app.Email{To: "jane@example.com\r\nBcc: victim@example.com"}, time.Now())
+	require.Error(t, err, "an invalid recipient must be rejected")
+}
+
+func TestFileSender(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	sender := FileSender{From: testFrom, Dir: dir}
+	require.NoError(t, sender.SendEmail(app.Email{To: "jane@example.com", Subject: "one", Text: "1"}))
+	require.NoError(t, sender.SendEmail(app.Email{To: "jane@example.com", Subject: "two", Text: "2"}))
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	require.Equal(t, ".eml", filepath.Ext(files[0].Name()))
+}
+
+func TestSMTPSender_timeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		// accept a connection, but never greet
+		conn, err := l.Accept()
+		if err == nil {
+			<-done
+			conn.Close()
+		}
+	}()
+
+	addr := l.Addr().(*net.TCPAddr)
+	sender := SMTPSender{From: testFrom, Host: "127.0.0.1", Port: addr.Port, Timeout: 100 * time.Millisecond}
+	start := time.Now()
+	err = sender.SendEmail(app.Email{To: "jane@example.com", Subject: "hello", Text: "hi"})
+	require.Error(t, err)
+	require.Less(t, time.Since(start), time.Second, "an unresponsive server must time out")
+}
@@ -0,0 +1,75 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/briskt/keygo/app"
+)
+
+// buildMessage returns the email as a MIME message, with the text and HTML bodies as alternatives
+func buildMessage(from *mail.Address, email app.Email, now time.Time) ([]byte, error) {
+	to, err := mail.ParseAddress(email.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient %q: %w", email.To, err)
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	header := []string{
+		"From: " + from.String(),
+		"To: " + to.String(),
+		"Subject: " + mime.QEncoding.Encode("utf-8", strings.Join(strings.Fields(email.Subject), " ")),
+		"Date: " + now.Format(time.RFC1123Z),
+		"Message-ID: " + messageID(from, now),
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + w.Boundary(),
+	}
+	buf.WriteString(strings.Join(header, "\r\n") + "\r\n\r\n")
+
+	if err = writePart(w, "text/plain", email.Text); err != nil {
+		return nil, err
+	}
+	if email.HTML != "" {
+		if err = writePart(w, "text/html", email.HTML); err != nil {
+			return nil, err
+		}
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writePart(w *multipart.Writer, contentType, body string) error {
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(part)
+	if _, err = qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// messageID returns a unique Message-ID in the domain of the sender
+func messageID(from *mail.Address, now time.Time) string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	_, domain, _ := strings.Cut(from.Address, "@")
+	return fmt.Sprintf("<%d.%s@%s>", now.UnixNano(), hex.EncodeToString(b), domain)
+}
@@ -0,0 +1,88 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/briskt/keygo/app"
+)
+
+// DefaultSMTPTimeout is the longest an SMTPSender takes to deliver an email, unless its Timeout is set
+const DefaultSMTPTimeout = 30 * time.Second
+
+// SMTPSender delivers email to an SMTP server, using STARTTLS if the server supports it
+type SMTPSender struct {
+	From     *mail.Address
+	Host     string
+	Port     int
+	Username string
+	Password string
+
+	// Timeout limits connecting to the server and delivering an email, so that an unresponsive server cannot stall
+	// the outbox. Defaults to DefaultSMTPTimeout.
+	Timeout time.Duration
+}
+
+// SendEmail implements app.EmailSender
+func (s SMTPSender) SendEmail(email app.Email) error {
+	msg, err := buildMessage(s.From, email, time.Now())
+	if err != nil {
+		return err
+	}
+	to, _ := mail.ParseAddress(email.To)
+
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = DefaultSMTPTimeout
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(s.Host, strconv.Itoa(s.Port)), timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return s.send(c, to.Address, msg)
+}
+
+// send delivers a message over an SMTP connection, like smtp.SendMail
+func (s SMTPSender) send(c *smtp.Client, to string, msg []byte) error {
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: s.Host}); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.From.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "tokens" ADD "auth_session_id" text NOT NULL DEFAULT '';
+CREATE INDEX "tokens_auth_id_idx" ON "tokens" (auth_id);
+CREATE INDEX "tokens_auth_session_id_idx" ON "tokens" (auth_session_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX "tokens_auth_session_id_idx";
+DROP INDEX "tokens_auth_id_idx";
+ALTER TABLE "tokens" DROP "auth_session_id";
+-- +goose StatementEnd
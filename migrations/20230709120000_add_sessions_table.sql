@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "sessions" (
+    id text NOT NULL,
+    data text NOT NULL,
+    expires_at timestamp NOT NULL,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    PRIMARY KEY(id)
+);
+CREATE INDEX "sessions_expires_at_idx" ON "sessions" (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE "sessions";
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "rate_limits" (
+    key text NOT NULL,
+    tokens double precision NOT NULL,
+    updated_at timestamp NOT NULL,
+    PRIMARY KEY(key)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE "rate_limits";
+-- +goose StatementEnd
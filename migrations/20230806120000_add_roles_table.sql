@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "roles" (
+    id text NOT NULL,
+    name text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    permissions text[] NOT NULL DEFAULT '{}',
+    builtin boolean NOT NULL DEFAULT false,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    deleted timestamp,
+    PRIMARY KEY(id)
+);
+CREATE UNIQUE INDEX "roles_name_unique"
+    ON roles(name)
+    WHERE deleted IS NULL;
+
+INSERT INTO "roles" (id, name, description, permissions, builtin, created_at, updated_at) VALUES
+    ('role_basic', 'Basic', 'Access to own user record only', '{}', true, now(), now()),
+    ('role_admin', 'Admin', 'Full access to all tenants and users', '{*}', true, now(), now());
+
+ALTER TABLE "users" ADD "role_id" text NULL;
+UPDATE "users" SET role_id = CASE WHEN role = 'Admin' THEN 'role_admin' ELSE 'role_basic' END;
+ALTER TABLE "users" ALTER "role_id" SET NOT NULL;
+ALTER TABLE "users" ADD FOREIGN KEY ("role_id") REFERENCES "roles" ("id");
+ALTER TABLE "users" DROP "role";
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "users" ADD "role" text NOT NULL DEFAULT 'Basic';
+UPDATE "users" SET role = 'Admin' WHERE role_id = 'role_admin';
+ALTER TABLE "users" ALTER "role" DROP DEFAULT;
+ALTER TABLE "users" DROP CONSTRAINT "users_role_id_fkey";
+ALTER TABLE "users" DROP "role_id";
+DROP TABLE "roles";
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+UPDATE "roles" SET permissions = array_replace(permissions, 'tenant.users.create', 'tenants.users.create');
+
+INSERT INTO "roles" (id, name, description, permissions, builtin, created_at, updated_at) VALUES
+    ('role_tenant_admin', 'Tenant Admin', 'Manage members and settings of own tenant',
+     '{own_tenant.read,own_tenant.update,own_tenant.users.list,own_tenant.users.create,own_tenant.users.assign_role}',
+     true, now(), now());
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE "users" SET role_id = 'role_basic' WHERE role_id = 'role_tenant_admin';
+DELETE FROM "roles" WHERE id = 'role_tenant_admin';
+UPDATE "roles" SET permissions = array_replace(permissions, 'tenants.users.create', 'tenant.users.create');
+-- +goose StatementEnd
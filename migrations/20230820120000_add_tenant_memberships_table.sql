@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "tenant_memberships" (
+    id text NOT NULL,
+    tenant_id text NOT NULL REFERENCES "tenants" ("id") ON DELETE CASCADE,
+    user_id text NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+    role_id text NOT NULL REFERENCES "roles" ("id"),
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    PRIMARY KEY(id),
+    UNIQUE (tenant_id, user_id)
+);
+CREATE INDEX "tenant_memberships_user_id" ON tenant_memberships(user_id);
+
+-- tenant admins become admins of their tenant only
+INSERT INTO "tenant_memberships" (id, tenant_id, user_id, role_id, created_at, updated_at)
+    SELECT 'tm_' || id, tenant_id, id,
+           CASE WHEN role_id = 'role_tenant_admin' THEN 'role_tenant_admin' ELSE 'role_basic' END,
+           now(), now()
+    FROM "users" WHERE tenant_id IS NOT NULL;
+UPDATE "users" SET role_id = 'role_basic' WHERE role_id = 'role_tenant_admin';
+
+UPDATE "roles" SET permissions = array_append(permissions, 'own_tenant.users.remove')
+    WHERE id = 'role_tenant_admin';
+
+ALTER TABLE "tokens" ADD "active_tenant_id" text NULL;
+ALTER TABLE "tokens" ADD FOREIGN KEY ("active_tenant_id") REFERENCES "tenants" ("id") ON DELETE SET NULL;
+
+ALTER TABLE "users" DROP CONSTRAINT "users_tenant_id_fkey";
+ALTER TABLE "users" DROP "tenant_id";
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "users" ADD "tenant_id" text NULL;
+ALTER TABLE "users" ADD FOREIGN KEY ("tenant_id") REFERENCES "tenants" ("id") ON DELETE SET NULL ON UPDATE SET NULL;
+UPDATE "users" SET tenant_id = m.tenant_id
+    FROM (SELECT DISTINCT ON (user_id) user_id, tenant_id FROM "tenant_memberships" ORDER BY user_id, created_at) m
+    WHERE users.id = m.user_id;
+
+ALTER TABLE "tokens" DROP CONSTRAINT "tokens_active_tenant_id_fkey";
+ALTER TABLE "tokens" DROP "active_tenant_id";
+
+UPDATE "roles" SET permissions = array_remove(permissions, 'own_tenant.users.remove')
+    WHERE id = 'role_tenant_admin';
+
+DROP TABLE "tenant_memberships";
+-- +goose StatementEnd
@@ -0,0 +1,70 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Request transactions run as keygo_app, which does not own the tables and is therefore subject to row-level
+-- security. Operations spanning tenants switch to keygo_rls_bypass. The database user must be a member of both.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'keygo_app') THEN
+        CREATE ROLE keygo_app NOLOGIN;
+    END IF;
+    IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'keygo_rls_bypass') THEN
+        CREATE ROLE keygo_rls_bypass NOLOGIN BYPASSRLS;
+    END IF;
+END
+$$;
+GRANT keygo_app, keygo_rls_bypass TO CURRENT_USER;
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO keygo_app, keygo_rls_bypass;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public
+    GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO keygo_app, keygo_rls_bypass;
+
+CREATE TABLE "rls_bypasses" (
+    id text NOT NULL,
+    user_id text NOT NULL,
+    reason text NOT NULL,
+    method text NOT NULL,
+    path text NOT NULL,
+    ip text NOT NULL,
+    created_at timestamp NOT NULL,
+    PRIMARY KEY(id)
+);
+CREATE INDEX "rls_bypasses_created_at" ON rls_bypasses(created_at);
+
+-- Policies compare against transaction-local settings made by the application: app.user_id and app.tenant_id
+-- identify the authenticated user and their active tenant, and app.token_hash allows a token to be looked up
+-- before the user is known. An unset setting matches nothing.
+--
+-- Tables of tenant data should enable row-level security with a policy on tenant_id, like tenant_memberships.
+
+ALTER TABLE "tenant_memberships" ENABLE ROW LEVEL SECURITY;
+CREATE POLICY "tenant_memberships_isolation" ON "tenant_memberships"
+    USING (tenant_id = current_setting('app.tenant_id', true)
+        OR user_id = current_setting('app.user_id', true));
+
+ALTER TABLE "users" ENABLE ROW LEVEL SECURITY;
+CREATE POLICY "users_isolation" ON "users"
+    USING (id = current_setting('app.user_id', true)
+        OR id IN (SELECT user_id FROM tenant_memberships WHERE tenant_id = current_setting('app.tenant_id', true)));
+
+ALTER TABLE "tokens" ENABLE ROW LEVEL SECURITY;
+CREATE POLICY "tokens_isolation" ON "tokens"
+    USING (user_id = current_setting('app.user_id', true)
+        OR hash = current_setting('app.token_hash', true));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP POLICY "tokens_isolation" ON "tokens";
+ALTER TABLE "tokens" DISABLE ROW LEVEL SECURITY;
+DROP POLICY "users_isolation" ON "users";
+ALTER TABLE "users" DISABLE ROW LEVEL SECURITY;
+DROP POLICY "tenant_memberships_isolation" ON "tenant_memberships";
+ALTER TABLE "tenant_memberships" DISABLE ROW LEVEL SECURITY;
+
+DROP TABLE "rls_bypasses";
+
+ALTER DEFAULT PRIVILEGES IN SCHEMA public
+    REVOKE SELECT, INSERT, UPDATE, DELETE ON TABLES FROM keygo_app, keygo_rls_bypass;
+REVOKE ALL ON ALL TABLES IN SCHEMA public FROM keygo_app, keygo_rls_bypass;
+-- the roles are left in place, since they belong to the database cluster rather than this database
+-- +goose StatementEnd
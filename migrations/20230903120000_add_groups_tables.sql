@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "tenant_groups" (
+    id text NOT NULL,
+    tenant_id text NOT NULL REFERENCES "tenants" ("id") ON DELETE CASCADE,
+    parent_id text NULL REFERENCES "tenant_groups" ("id") ON DELETE SET NULL,
+    name text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    role_id text NULL REFERENCES "roles" ("id"),
+    permissions text[] NOT NULL DEFAULT '{}',
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    PRIMARY KEY(id),
+    UNIQUE (tenant_id, name)
+);
+CREATE INDEX "tenant_groups_parent_id" ON tenant_groups(parent_id);
+
+CREATE TABLE "tenant_group_members" (
+    group_id text NOT NULL REFERENCES "tenant_groups" ("id") ON DELETE CASCADE,
+    user_id text NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+    created_at timestamp NOT NULL,
+    PRIMARY KEY(group_id, user_id)
+);
+CREATE INDEX "tenant_group_members_user_id" ON tenant_group_members(user_id);
+
+-- groups are visible within the active tenant, and within the other tenants of the user, so that the user's
+-- effective permissions can be resolved in all of their tenants
+ALTER TABLE "tenant_groups" ENABLE ROW LEVEL SECURITY;
+CREATE POLICY "tenant_groups_isolation" ON "tenant_groups"
+    USING (tenant_id = current_setting('app.tenant_id', true)
+        OR tenant_id IN (SELECT tenant_id FROM tenant_memberships
+                         WHERE user_id = current_setting('app.user_id', true)));
+
+ALTER TABLE "tenant_group_members" ENABLE ROW LEVEL SECURITY;
+CREATE POLICY "tenant_group_members_isolation" ON "tenant_group_members"
+    USING (group_id IN (SELECT id FROM tenant_groups));
+
+UPDATE "roles" SET permissions = permissions || '{own_tenant.groups.read,own_tenant.groups.manage}'
+    WHERE id = 'role_tenant_admin';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE "roles" SET permissions = array_remove(array_remove(permissions, 'own_tenant.groups.read'),
+    'own_tenant.groups.manage');
+DROP TABLE "tenant_group_members";
+DROP TABLE "tenant_groups";
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "tenant_invitations" (
+    id text NOT NULL,
+    tenant_id text NOT NULL REFERENCES "tenants" ("id") ON DELETE CASCADE,
+    email text NOT NULL,
+    role_id text NOT NULL REFERENCES "roles" ("id"),
+    inviter_id text NULL REFERENCES "users" ("id") ON DELETE SET NULL,
+    token_hash text NOT NULL,
+    sent_at timestamp NOT NULL,
+    expires_at timestamp NOT NULL,
+    accepted_at timestamp NULL,
+    accepted_by_id text NULL REFERENCES "users" ("id") ON DELETE SET NULL,
+    revoked_at timestamp NULL,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    PRIMARY KEY(id),
+    UNIQUE (token_hash)
+);
+CREATE INDEX "tenant_invitations_tenant_id_email" ON tenant_invitations(tenant_id, email);
+
+-- invitations are accepted by users outside the tenant, which bypasses row-level security
+ALTER TABLE "tenant_invitations" ENABLE ROW LEVEL SECURITY;
+CREATE POLICY "tenant_invitations_isolation" ON "tenant_invitations"
+    USING (tenant_id = current_setting('app.tenant_id', true));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE "tenant_invitations";
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "email_outbox" (
+    id text NOT NULL,
+    to_address text NOT NULL,
+    subject text NOT NULL,
+    text_body text NOT NULL,
+    html_body text NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    last_error text NOT NULL DEFAULT '',
+    next_attempt_at timestamp NOT NULL,
+    sent_at timestamp NULL,
+    failed_at timestamp NULL,
+    created_at timestamp NOT NULL,
+    PRIMARY KEY(id)
+);
+CREATE INDEX "email_outbox_unsent" ON email_outbox(next_attempt_at) WHERE sent_at IS NULL AND failed_at IS NULL;
+
+-- requests may queue email, but not read it, since it can contain secrets such as invitation links. The outbox is
+-- delivered by the table owner.
+ALTER TABLE "email_outbox" ENABLE ROW LEVEL SECURITY;
+CREATE POLICY "email_outbox_queue" ON "email_outbox" FOR INSERT WITH CHECK (true);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE "email_outbox";
+-- +goose StatementEnd
@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "role_elevations" (
+    id text NOT NULL,
+    user_id text NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+    role_id text NOT NULL REFERENCES "roles" ("id"),
+    hours integer NOT NULL,
+    justification text NOT NULL,
+    approver_id text NULL REFERENCES "users" ("id") ON DELETE SET NULL,
+    decision_note text NOT NULL DEFAULT '',
+    approved_at timestamp NULL,
+    denied_at timestamp NULL,
+    expires_at timestamp NULL,
+    revoked_at timestamp NULL,
+    revoker_id text NULL REFERENCES "users" ("id") ON DELETE SET NULL,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    PRIMARY KEY(id)
+);
+CREATE INDEX "role_elevations_user_id_expires_at" ON role_elevations(user_id, expires_at);
+CREATE INDEX "role_elevations_created_at" ON role_elevations(created_at);
+
+-- users see their own elevations; approvers see all of them, which bypasses row-level security
+ALTER TABLE "role_elevations" ENABLE ROW LEVEL SECURITY;
+CREATE POLICY "role_elevations_isolation" ON "role_elevations"
+    USING (user_id = current_setting('app.user_id', true));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE "role_elevations";
+-- +goose StatementEnd
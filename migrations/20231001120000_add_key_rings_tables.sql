@@ -0,0 +1,43 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "key_rings" (
+    id text NOT NULL,
+    tenant_id text NOT NULL REFERENCES "tenants" ("id") ON DELETE CASCADE,
+    name text NOT NULL,
+    latest_version integer NOT NULL,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    PRIMARY KEY(id),
+    UNIQUE (tenant_id, name)
+);
+
+-- key material is stored wrapped (encrypted) by the master key, which is never stored in the database
+CREATE TABLE "key_versions" (
+    id text NOT NULL,
+    key_ring_id text NOT NULL REFERENCES "key_rings" ("id") ON DELETE CASCADE,
+    version integer NOT NULL,
+    wrapped_key bytea NOT NULL,
+    created_at timestamp NOT NULL,
+    PRIMARY KEY(id),
+    UNIQUE (key_ring_id, version)
+);
+
+ALTER TABLE "key_rings" ENABLE ROW LEVEL SECURITY;
+CREATE POLICY "key_rings_isolation" ON "key_rings"
+    USING (tenant_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE "key_versions" ENABLE ROW LEVEL SECURITY;
+CREATE POLICY "key_versions_isolation" ON "key_versions"
+    USING (key_ring_id IN (SELECT id FROM key_rings));
+
+UPDATE "roles" SET permissions = permissions || '{own_tenant.keys.read,own_tenant.keys.manage,own_tenant.keys.use}'
+    WHERE id = 'role_tenant_admin';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE "roles" SET permissions = array_remove(array_remove(array_remove(permissions, 'own_tenant.keys.read'),
+    'own_tenant.keys.manage'), 'own_tenant.keys.use');
+DROP TABLE "key_versions";
+DROP TABLE "key_rings";
+-- +goose StatementEnd
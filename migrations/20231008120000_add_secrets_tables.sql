@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "secrets" (
+    id text NOT NULL,
+    tenant_id text NOT NULL REFERENCES "tenants" ("id") ON DELETE CASCADE,
+    path text NOT NULL,
+    current_version integer NOT NULL DEFAULT 0,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    PRIMARY KEY(id),
+    UNIQUE (tenant_id, path)
+);
+
+-- data is encrypted with the tenant's ".secrets" key ring
+CREATE TABLE "secret_versions" (
+    id text NOT NULL,
+    secret_id text NOT NULL REFERENCES "secrets" ("id") ON DELETE CASCADE,
+    version integer NOT NULL,
+    ciphertext text NOT NULL,
+    created_by_id text NULL REFERENCES "users" ("id") ON DELETE SET NULL,
+    rolled_back_from integer NULL,
+    created_at timestamp NOT NULL,
+    PRIMARY KEY(id),
+    UNIQUE (secret_id, version)
+);
+
+ALTER TABLE "secrets" ENABLE ROW LEVEL SECURITY;
+CREATE POLICY "secrets_isolation" ON "secrets"
+    USING (tenant_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE "secret_versions" ENABLE ROW LEVEL SECURITY;
+CREATE POLICY "secret_versions_isolation" ON "secret_versions"
+    USING (secret_id IN (SELECT id FROM secrets));
+
+-- versions are immutable
+REVOKE UPDATE, DELETE ON "secret_versions" FROM keygo_app, keygo_rls_bypass;
+
+UPDATE "roles" SET permissions = permissions || '{own_tenant.secrets.read,own_tenant.secrets.write}'
+    WHERE id = 'role_tenant_admin';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE "roles" SET permissions = array_remove(array_remove(permissions, 'own_tenant.secrets.read'),
+    'own_tenant.secrets.write');
+DROP TABLE "secret_versions";
+DROP TABLE "secrets";
+-- +goose StatementEnd
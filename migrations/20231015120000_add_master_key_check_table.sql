@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- a value wrapped by the master key, to verify the key given to unseal keygo
+CREATE TABLE "master_key_check" (
+    id integer NOT NULL CHECK (id = 1),
+    wrapped bytea NOT NULL,
+    created_at timestamp NOT NULL,
+    PRIMARY KEY(id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE "master_key_check";
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the number of shares the master key is split into, and the number needed to unseal, or 0 if it is not split
+ALTER TABLE "master_key_check" ADD "share_count" integer NOT NULL DEFAULT 0;
+ALTER TABLE "master_key_check" ADD "threshold" integer NOT NULL DEFAULT 0;
+ALTER TABLE "master_key_check" ADD "updated_at" timestamp NULL;
+UPDATE "master_key_check" SET updated_at = created_at;
+ALTER TABLE "master_key_check" ALTER "updated_at" SET NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "master_key_check" DROP "updated_at";
+ALTER TABLE "master_key_check" DROP "threshold";
+ALTER TABLE "master_key_check" DROP "share_count";
+-- +goose StatementEnd
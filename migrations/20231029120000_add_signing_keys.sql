@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "key_rings" ADD COLUMN type text NOT NULL DEFAULT 'aes256-gcm';
+
+-- the public key of a signing key version, which needs no protection
+ALTER TABLE "key_versions" ADD COLUMN public_key bytea;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "key_versions" DROP COLUMN public_key;
+ALTER TABLE "key_rings" DROP COLUMN type;
+-- +goose StatementEnd
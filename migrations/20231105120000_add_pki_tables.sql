@@ -0,0 +1,78 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the private key is stored wrapped (encrypted) by the master key
+CREATE TABLE "pki_cas" (
+    id text NOT NULL,
+    tenant_id text NOT NULL REFERENCES "tenants" ("id") ON DELETE CASCADE,
+    common_name text NOT NULL,
+    certificate bytea NOT NULL,
+    wrapped_key bytea NOT NULL,
+    is_root boolean NOT NULL,
+    not_before timestamp NOT NULL,
+    not_after timestamp NOT NULL,
+    crl_number bigint NOT NULL DEFAULT 0,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    PRIMARY KEY(id),
+    UNIQUE (tenant_id)
+);
+
+CREATE TABLE "pki_templates" (
+    id text NOT NULL,
+    tenant_id text NOT NULL REFERENCES "tenants" ("id") ON DELETE CASCADE,
+    name text NOT NULL,
+    allowed_domains text[] NOT NULL DEFAULT '{}',
+    allow_ip_sans boolean NOT NULL DEFAULT false,
+    max_ttl text NOT NULL,
+    key_usages text[] NOT NULL DEFAULT '{}',
+    ext_key_usages text[] NOT NULL DEFAULT '{}',
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    PRIMARY KEY(id),
+    UNIQUE (tenant_id, name)
+);
+
+CREATE TABLE "pki_certificates" (
+    id text NOT NULL,
+    tenant_id text NOT NULL REFERENCES "tenants" ("id") ON DELETE CASCADE,
+    ca_id text NOT NULL REFERENCES "pki_cas" ("id") ON DELETE CASCADE,
+    template_name text NOT NULL,
+    serial_number text NOT NULL,
+    common_name text NOT NULL,
+    dns_names text[] NOT NULL DEFAULT '{}',
+    ip_addresses text[] NOT NULL DEFAULT '{}',
+    certificate bytea NOT NULL,
+    not_before timestamp NOT NULL,
+    not_after timestamp NOT NULL,
+    revoked_at timestamp NULL,
+    issued_by_id text NULL REFERENCES "users" ("id") ON DELETE SET NULL,
+    created_at timestamp NOT NULL,
+    PRIMARY KEY(id),
+    UNIQUE (tenant_id, serial_number)
+);
+CREATE INDEX "pki_certificates_not_after" ON "pki_certificates" (tenant_id, not_after);
+
+ALTER TABLE "pki_cas" ENABLE ROW LEVEL SECURITY;
+CREATE POLICY "pki_cas_isolation" ON "pki_cas"
+    USING (tenant_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE "pki_templates" ENABLE ROW LEVEL SECURITY;
+CREATE POLICY "pki_templates_isolation" ON "pki_templates"
+    USING (tenant_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE "pki_certificates" ENABLE ROW LEVEL SECURITY;
+CREATE POLICY "pki_certificates_isolation" ON "pki_certificates"
+    USING (tenant_id = current_setting('app.tenant_id', true));
+
+UPDATE "roles" SET permissions = permissions || '{own_tenant.pki.read,own_tenant.pki.manage,own_tenant.pki.issue}'
+    WHERE id = 'role_tenant_admin';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE "roles" SET permissions = array_remove(array_remove(array_remove(permissions, 'own_tenant.pki.read'),
+    'own_tenant.pki.manage'), 'own_tenant.pki.issue');
+DROP TABLE "pki_certificates";
+DROP TABLE "pki_templates";
+DROP TABLE "pki_cas";
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the private key is stored wrapped (encrypted) by the master key
+CREATE TABLE "ssh_cas" (
+    id text NOT NULL,
+    tenant_id text NOT NULL REFERENCES "tenants" ("id") ON DELETE CASCADE,
+    public_key text NOT NULL,
+    wrapped_key bytea NOT NULL,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    PRIMARY KEY(id),
+    UNIQUE (tenant_id)
+);
+
+ALTER TABLE "ssh_cas" ENABLE ROW LEVEL SECURITY;
+CREATE POLICY "ssh_cas_isolation" ON "ssh_cas"
+    USING (tenant_id = current_setting('app.tenant_id', true));
+
+UPDATE "roles" SET permissions = permissions || '{own_tenant.ssh.manage,own_tenant.ssh.issue}'
+    WHERE id = 'role_tenant_admin';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE "roles" SET permissions = array_remove(array_remove(permissions, 'own_tenant.ssh.manage'),
+    'own_tenant.ssh.issue');
+DROP TABLE "ssh_cas";
+-- +goose StatementEnd
@@ -0,0 +1,53 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "api_key_types" (
+    id text NOT NULL,
+    tenant_id text NOT NULL REFERENCES "tenants" ("id") ON DELETE CASCADE,
+    name text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    metadata jsonb NOT NULL DEFAULT '{}',
+    ttl text NOT NULL DEFAULT '',
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    PRIMARY KEY(id),
+    UNIQUE (tenant_id, name)
+);
+
+-- like "tokens", only the hash of a key is stored
+CREATE TABLE "api_keys" (
+    id text NOT NULL,
+    tenant_id text NOT NULL REFERENCES "tenants" ("id") ON DELETE CASCADE,
+    type_id text NOT NULL REFERENCES "api_key_types" ("id") ON DELETE RESTRICT,
+    name text NOT NULL,
+    prefix text NOT NULL,
+    hash text NOT NULL,
+    metadata jsonb NOT NULL DEFAULT '{}',
+    expires_at timestamp NULL,
+    revoked_at timestamp NULL,
+    issued_by_id text NULL REFERENCES "users" ("id") ON DELETE SET NULL,
+    created_at timestamp NOT NULL,
+    PRIMARY KEY(id),
+    UNIQUE (hash)
+);
+CREATE INDEX "api_keys_tenant_created_at" ON "api_keys" (tenant_id, created_at);
+
+ALTER TABLE "api_key_types" ENABLE ROW LEVEL SECURITY;
+CREATE POLICY "api_key_types_isolation" ON "api_key_types"
+    USING (tenant_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE "api_keys" ENABLE ROW LEVEL SECURITY;
+CREATE POLICY "api_keys_isolation" ON "api_keys"
+    USING (tenant_id = current_setting('app.tenant_id', true));
+
+UPDATE "roles" SET permissions = permissions ||
+    '{own_tenant.apikeys.read,own_tenant.apikeys.manage,own_tenant.apikeys.verify}'
+    WHERE id = 'role_tenant_admin';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE "roles" SET permissions = array_remove(array_remove(array_remove(permissions, 'own_tenant.apikeys.read'),
+    'own_tenant.apikeys.manage'), 'own_tenant.apikeys.verify');
+DROP TABLE "api_keys";
+DROP TABLE "api_key_types";
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the master key wrapped by the unseal key that the shares reconstruct, so that a rekey can revoke old shares. NULL
+-- if the shares reconstruct the master key itself.
+ALTER TABLE "master_key_check" ADD "wrapped_master_key" bytea NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "master_key_check" DROP "wrapped_master_key";
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the response status of the request that bypassed RLS, now that bypasses are recorded after the request
+-- transaction, including those of failed and denied requests. 0 for bypasses recorded before.
+ALTER TABLE "rls_bypasses" ADD "status" integer NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "rls_bypasses" DROP "status";
+-- +goose StatementEnd
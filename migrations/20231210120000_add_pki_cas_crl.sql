@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the latest signed CRL of the CA, DER encoded, which is served without authentication at the CRL distribution point
+-- of issued certificates. It is signed again when a certificate is revoked, and before it reaches its next update.
+ALTER TABLE "pki_cas" ADD "crl" bytea NULL;
+ALTER TABLE "pki_cas" ADD "crl_next_update" timestamp NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "pki_cas" DROP "crl_next_update";
+ALTER TABLE "pki_cas" DROP "crl";
+-- +goose StatementEnd
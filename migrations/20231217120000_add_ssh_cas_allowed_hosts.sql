@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the host names an SSH CA may issue host certificates for. Existing CAs allow none until their policy is set.
+ALTER TABLE "ssh_cas" ADD "allowed_host_domains" text[] NOT NULL DEFAULT '{}';
+ALTER TABLE "ssh_cas" ADD "allow_host_ips" boolean NOT NULL DEFAULT false;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "ssh_cas" DROP "allow_host_ips";
+ALTER TABLE "ssh_cas" DROP "allowed_host_domains";
+-- +goose StatementEnd
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the bodies of sent and abandoned email are cleared by the outbox, since they can contain secrets such as
+-- invitation links. Clear those delivered before it did.
+UPDATE "email_outbox" SET text_body = '', html_body = '' WHERE sent_at IS NOT NULL OR failed_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- cleared bodies cannot be restored
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the IDs (jti) of accepted back-channel logout tokens, kept until the tokens expire so that replays are refused
+CREATE TABLE "logout_tokens" (
+    id text NOT NULL,
+    expires_at timestamp NOT NULL,
+    created_at timestamp NOT NULL,
+    PRIMARY KEY(id)
+);
+CREATE INDEX "logout_tokens_expires_at_idx" ON logout_tokens(expires_at);
+
+-- only back-channel logout, which bypasses row-level security, uses the table
+ALTER TABLE "logout_tokens" ENABLE ROW LEVEL SECURITY;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE "logout_tokens";
+-- +goose StatementEnd
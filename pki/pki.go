@@ -0,0 +1,282 @@
+// Package pki implements the certificate authorities of a tenant. The X.509 CA is generated or imported, issues
+// certificates from signing requests according to a template, and signs revocation lists. The SSH CA signs user and
+// host certificates for OpenSSH.
+package pki
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/briskt/keygo/app"
+)
+
+// CRLValidity is the time until the next update of a revocation list
+const CRLValidity = 24 * time.Hour
+
+// backdate is subtracted from the start of validity of a certificate, to allow for clock skew
+const backdate = time.Minute
+
+// serialNumberLimit bounds random serial numbers to 128 bits
+var serialNumberLimit = new(big.Int).Lsh(big.NewInt(1), 128)
+
+var keyUsages = map[string]x509.KeyUsage{
+	app.KeyUsageDigitalSignature: x509.KeyUsageDigitalSignature,
+	app.KeyUsageKeyEncipherment:  x509.KeyUsageKeyEncipherment,
+	app.KeyUsageKeyAgreement:     x509.KeyUsageKeyAgreement,
+}
+
+var extKeyUsages = map[string]x509.ExtKeyUsage{
+	app.ExtKeyUsageServerAuth: x509.ExtKeyUsageServerAuth,
+	app.ExtKeyUsageClientAuth: x509.ExtKeyUsageClientAuth,
+}
+
+// GenerateCA returns a new self-signed root CA certificate with an ECDSA P-256 key, and its private key in PKCS #8
+// form, both DER encoded
+func GenerateCA(commonName string, ttl time.Duration) (cert, key []byte, err error) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate CA key: %w", err)
+	}
+	serial, err := NewSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-backdate),
+		NotAfter:              now.Add(ttl),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if cert, err = x509.CreateCertificate(rand.Reader, &template, &template, private.Public(), private); err != nil {
+		return nil, nil, fmt.Errorf("create CA certificate: %w", err)
+	}
+	if key, err = x509.MarshalPKCS8PrivateKey(private); err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// ParseCA checks an imported CA certificate and its private key, both PEM encoded, and returns them DER encoded,
+// with the key in PKCS #8 form. isRoot is true if the certificate is self-signed.
+func ParseCA(certPEM, keyPEM string) (cert, key []byte, isRoot bool, err error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, nil, false, app.Errorf(app.ERR_INVALID, "Certificate must be a PEM encoded certificate")
+	}
+	c, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, false, app.Errorf(app.ERR_INVALID, "Invalid certificate: %s", err)
+	}
+	if !c.IsCA || (c.KeyUsage != 0 && c.KeyUsage&x509.KeyUsageCertSign == 0) {
+		return nil, nil, false, app.Errorf(app.ERR_INVALID, "Certificate is not a CA certificate")
+	}
+	if time.Now().After(c.NotAfter) {
+		return nil, nil, false, app.Errorf(app.ERR_INVALID, "Certificate has expired")
+	}
+
+	private, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	public, ok := private.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !public.Equal(c.PublicKey) {
+		return nil, nil, false, app.Errorf(app.ERR_INVALID, "PrivateKey does not match the certificate")
+	}
+	if key, err = x509.MarshalPKCS8PrivateKey(private); err != nil {
+		return nil, nil, false, err
+	}
+
+	isRoot = bytes.Equal(c.RawSubject, c.RawIssuer) && c.CheckSignatureFrom(c) == nil
+	return c.Raw, key, isRoot, nil
+}
+
+// ParseCSR parses a PEM-encoded certificate signing request, and checks its signature
+func ParseCSR(csrPEM string) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode([]byte(csrPEM))
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, app.Errorf(app.ERR_INVALID, "CSR must be a PEM encoded certificate request")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, app.Errorf(app.ERR_INVALID, "Invalid CSR: %s", err)
+	}
+	if err = csr.CheckSignature(); err != nil {
+		return nil, app.Errorf(app.ERR_INVALID, "Invalid CSR signature: %s", err)
+	}
+	return csr, nil
+}
+
+// Issue signs a certificate for the subject and public key of a signing request, if the template allows its names
+// and validity. The certificate expires no later than the CA certificate, and names crlURL, if given, as the
+// distribution point of the CA's revocation list. The DER-encoded certificate is returned.
+func Issue(caCert, caKey []byte, csr *x509.CertificateRequest, template app.CertificateTemplate,
+	ttl time.Duration, crlURL string,
+) ([]byte, error) {
+	if err := checkNames(csr, template); err != nil {
+		return nil, err
+	}
+	maxTTL, err := app.ParseTTL(template.MaxTTL)
+	if err != nil {
+		return nil, err
+	}
+	if ttl == 0 {
+		ttl = maxTTL
+	}
+	if ttl > maxTTL {
+		return nil, app.Errorf(app.ERR_INVALID, "TTL is longer than the template's MaxTTL of %s", template.MaxTTL)
+	}
+
+	ca, signer, err := parseCA(caCert, caKey)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := NewSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	cert := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: csr.Subject.CommonName},
+		DNSNames:              csr.DNSNames,
+		IPAddresses:           csr.IPAddresses,
+		NotBefore:             now.Add(-backdate),
+		NotAfter:              now.Add(ttl),
+		BasicConstraintsValid: true,
+	}
+	if cert.NotAfter.After(ca.NotAfter) {
+		cert.NotAfter = ca.NotAfter
+	}
+	for _, u := range template.KeyUsages {
+		cert.KeyUsage |= keyUsages[u]
+	}
+	for _, u := range template.ExtKeyUsages {
+		cert.ExtKeyUsage = append(cert.ExtKeyUsage, extKeyUsages[u])
+	}
+	if crlURL != "" {
+		cert.CRLDistributionPoints = []string{crlURL}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &cert, ca, csr.PublicKey, signer)
+	if err != nil {
+		return nil, fmt.Errorf("create certificate: %w", err)
+	}
+	return der, nil
+}
+
+// CreateCRL returns a DER-encoded revocation list of the given certificates, signed by the CA
+func CreateCRL(caCert, caKey []byte, revoked []pkix.RevokedCertificate, number int64) ([]byte, error) {
+	ca, signer, err := parseCA(caCert, caKey)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	list := x509.RevocationList{
+		RevokedCertificates: revoked,
+		Number:              big.NewInt(number),
+		ThisUpdate:          now,
+		NextUpdate:          now.Add(CRLValidity),
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, &list, ca, signer)
+	if err != nil {
+		return nil, fmt.Errorf("create CRL: %w", err)
+	}
+	return crl, nil
+}
+
+// NewSerialNumber returns a random, positive 128-bit certificate serial number
+func NewSerialNumber() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, serialNumberLimit)
+	if err != nil {
+		return nil, fmt.Errorf("generate serial number: %w", err)
+	}
+	return serial.Add(serial, big.NewInt(1)), nil
+}
+
+// EncodePEM returns DER-encoded data in PEM form, with the given block type, e.g. "CERTIFICATE"
+func EncodePEM(blockType string, der []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}))
+}
+
+// checkNames returns an error unless the template allows every name in the signing request
+func checkNames(csr *x509.CertificateRequest, template app.CertificateTemplate) error {
+	if len(csr.EmailAddresses) > 0 || len(csr.URIs) > 0 {
+		return app.Errorf(app.ERR_INVALID, "Email and URI alternative names are not allowed")
+	}
+	if len(csr.IPAddresses) > 0 && !template.AllowIPSANs {
+		return app.Errorf(app.ERR_INVALID, "IP alternative names are not allowed by template %q", template.Name)
+	}
+	if csr.Subject.CommonName == "" && len(csr.DNSNames) == 0 && len(csr.IPAddresses) == 0 {
+		return app.Errorf(app.ERR_INVALID, "CSR has no common name or alternative names")
+	}
+
+	names := csr.DNSNames
+	if cn := csr.Subject.CommonName; cn != "" {
+		names = append([]string{cn}, names...)
+	}
+	for _, name := range names {
+		if !template.AllowsDomain(name) {
+			return app.Errorf(app.ERR_INVALID, "%q is not allowed by template %q", name, template.Name)
+		}
+	}
+	return nil
+}
+
+// parseCA parses a DER-encoded CA certificate and PKCS #8 private key
+func parseCA(caCert, caKey []byte) (*x509.Certificate, crypto.Signer, error) {
+	ca, err := x509.ParseCertificate(caCert)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse CA certificate: %w", err)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(caKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse CA key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.New("CA key cannot sign")
+	}
+	return ca, signer, nil
+}
+
+// parsePrivateKey parses a PEM-encoded private key in PKCS #8, PKCS #1 (RSA) or SEC 1 (EC) form
+func parsePrivateKey(keyPEM string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, app.Errorf(app.ERR_INVALID, "PrivateKey must be PEM encoded")
+	}
+	var key any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, app.Errorf(app.ERR_INVALID, "Unsupported private key type %q", block.Type)
+	}
+	if err != nil {
+		return nil, app.Errorf(app.ERR_INVALID, "Invalid private key: %s", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, app.Errorf(app.ERR_INVALID, "Unsupported private key")
+	}
+	return signer, nil
+}
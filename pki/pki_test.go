@@ -0,0 +1,157 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/briskt/keygo/app"
+)
+
+func newCSR(t *testing.T, commonName string, dnsNames []string, ips []net.IP) *x509.CertificateRequest {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: commonName},
+		DNSNames:    dnsNames,
+		IPAddresses: ips,
+	}, key)
+	require.NoError(t, err)
+	csr, err := ParseCSR(EncodePEM("CERTIFICATE REQUEST", der))
+	require.NoError(t, err)
+	return csr
+}
+
+func TestIssue(t *testing.T) {
+	caCert, caKey, err := GenerateCA("Test Root", 48*time.Hour)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caCert)
+	require.NoError(t, err)
+	require.True(t, ca.IsCA)
+
+	template := app.CertificateTemplate{
+		Name:           "services",
+		AllowedDomains: []string{"*.svc.internal", "db.internal"},
+		MaxTTL:         "24h",
+		KeyUsages:      []string{app.KeyUsageDigitalSignature},
+		ExtKeyUsages:   []string{app.ExtKeyUsageClientAuth, app.ExtKeyUsageServerAuth},
+	}
+
+	csr := newCSR(t, "api.svc.internal", []string{"db.internal", "a.b.svc.internal"}, nil)
+	der, err := Issue(caCert, caKey, csr, template, time.Hour, "")
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	require.NoError(t, cert.CheckSignatureFrom(ca))
+	require.Equal(t, "api.svc.internal", cert.Subject.CommonName)
+	require.Equal(t, x509.KeyUsageDigitalSignature, cert.KeyUsage)
+	require.Len(t, cert.ExtKeyUsage, 2)
+	require.WithinDuration(t, time.Now().Add(time.Hour), cert.NotAfter, time.Minute)
+	require.Empty(t, cert.CRLDistributionPoints)
+
+	der, err = Issue(caCert, caKey, csr, template, 0, "")
+	require.NoError(t, err)
+	cert, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(24*time.Hour), cert.NotAfter, time.Minute, "TTL defaults to MaxTTL")
+
+	der, err = Issue(caCert, caKey, csr, template, 0, "https://keygo.example.com/api/pki/t1/crl")
+	require.NoError(t, err)
+	cert, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+	require.Equal(t, []string{"https://keygo.example.com/api/pki/t1/crl"}, cert.CRLDistributionPoints)
+
+	_, err = Issue(caCert, caKey, csr, template, 25*time.Hour, "")
+	require.Equal(t, app.ERR_INVALID, app.ErrorCode(err), "TTL is limited by the template")
+
+	for _, names := range [][]string{{"svc.internal"}, {"evil.internal"}, {"x.svc.internal.evil.com"}} {
+		_, err = Issue(caCert, caKey, newCSR(t, "", names, nil), template, 0, "")
+		require.Equal(t, app.ERR_INVALID, app.ErrorCode(err), names)
+	}
+
+	ipCSR := newCSR(t, "api.svc.internal", nil, []net.IP{net.ParseIP("10.0.0.1")})
+	_, err = Issue(caCert, caKey, ipCSR, template, 0, "")
+	require.Equal(t, app.ERR_INVALID, app.ErrorCode(err), "IP SANs are not allowed")
+	template.AllowIPSANs = true
+	_, err = Issue(caCert, caKey, ipCSR, template, 0, "")
+	require.NoError(t, err)
+}
+
+func TestParseCA(t *testing.T) {
+	caCert, caKey, err := GenerateCA("Test Root", time.Hour)
+	require.NoError(t, err)
+	_, otherKey, err := GenerateCA("Other Root", time.Hour)
+	require.NoError(t, err)
+
+	cert, key, isRoot, err := ParseCA(EncodePEM("CERTIFICATE", caCert), EncodePEM("PRIVATE KEY", caKey))
+	require.NoError(t, err)
+	require.True(t, isRoot)
+	require.Equal(t, caCert, cert)
+	require.Equal(t, caKey, key)
+
+	_, _, _, err = ParseCA(EncodePEM("CERTIFICATE", caCert), EncodePEM("PRIVATE KEY", otherKey))
+	require.Equal(t, app.ERR_INVALID, app.ErrorCode(err), "the key must match the certificate")
+
+	// an intermediate, signed by the root
+	root, signer, err := parseCA(caCert, caKey)
+	require.NoError(t, err)
+	intermediateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := NewSerialNumber()
+	require.NoError(t, err)
+	intermediate, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "Test Intermediate"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, root, intermediateKey.Public(), signer)
+	require.NoError(t, err)
+	ecKey, err := x509.MarshalECPrivateKey(intermediateKey)
+	require.NoError(t, err)
+
+	_, _, isRoot, err = ParseCA(EncodePEM("CERTIFICATE", intermediate), EncodePEM("EC PRIVATE KEY", ecKey))
+	require.NoError(t, err)
+	require.False(t, isRoot)
+
+	csr := newCSR(t, "leaf.internal", nil, nil)
+	leaf, err := Issue(caCert, caKey, csr, app.CertificateTemplate{AllowedDomains: []string{"leaf.internal"},
+		MaxTTL: "1h"}, 0, "")
+	require.NoError(t, err)
+	_, _, _, err = ParseCA(EncodePEM("CERTIFICATE", leaf), EncodePEM("PRIVATE KEY", caKey))
+	require.Equal(t, app.ERR_INVALID, app.ErrorCode(err), "only CA certificates can be imported")
+}
+
+func TestCreateCRL(t *testing.T) {
+	caCert, caKey, err := GenerateCA("Test Root", time.Hour)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caCert)
+	require.NoError(t, err)
+
+	serial, err := NewSerialNumber()
+	require.NoError(t, err)
+	der, err := CreateCRL(caCert, caKey, []pkix.RevokedCertificate{
+		{SerialNumber: serial, RevocationTime: time.Now()},
+	}, 7)
+	require.NoError(t, err)
+
+	crl, err := x509.ParseRevocationList(der)
+	require.NoError(t, err)
+	require.NoError(t, crl.CheckSignatureFrom(ca))
+	require.Equal(t, int64(7), crl.Number.Int64())
+	require.Len(t, crl.RevokedCertificates, 1)
+	require.Equal(t, serial, crl.RevokedCertificates[0].SerialNumber)
+
+	block, _ := pem.Decode([]byte(EncodePEM("X509 CRL", der)))
+	require.Equal(t, der, block.Bytes)
+}
@@ -0,0 +1,114 @@
+package pki
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/briskt/keygo/app"
+)
+
+// sshUserExtensions are the permissions of an SSH user certificate, the same as ssh-keygen grants by default
+var sshUserExtensions = map[string]string{
+	"permit-X11-forwarding":   "",
+	"permit-agent-forwarding": "",
+	"permit-port-forwarding":  "",
+	"permit-pty":              "",
+	"permit-user-rc":          "",
+}
+
+// GenerateSSHCA returns a new Ed25519 SSH CA key, with the private key in PKCS #8 form, DER encoded, and the public
+// key in authorized_keys format
+func GenerateSSHCA() (key []byte, publicKey string, err error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, "", fmt.Errorf("generate SSH CA key: %w", err)
+	}
+	sshPublic, err := ssh.NewPublicKey(public)
+	if err != nil {
+		return nil, "", err
+	}
+	if key, err = x509.MarshalPKCS8PrivateKey(private); err != nil {
+		return nil, "", err
+	}
+	return key, MarshalSSHPublicKey(sshPublic), nil
+}
+
+// SignSSHUserKey returns an SSH user certificate for a public key in authorized_keys format, allowing login as the
+// given principals
+func SignSSHUserKey(caKey []byte, publicKey, keyID string, principals []string,
+	ttl time.Duration,
+) (*ssh.Certificate, error) {
+	cert, err := newSSHCertificate(publicKey, ssh.UserCert, keyID, principals, ttl)
+	if err != nil {
+		return nil, err
+	}
+	cert.Permissions.Extensions = sshUserExtensions
+	return signSSHCertificate(caKey, cert)
+}
+
+// SignSSHHostKey returns an SSH host certificate for a public key in authorized_keys format, valid for the given host
+// names
+func SignSSHHostKey(caKey []byte, publicKey string, hostnames []string, ttl time.Duration) (*ssh.Certificate, error) {
+	cert, err := newSSHCertificate(publicKey, ssh.HostCert, hostnames[0], hostnames, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return signSSHCertificate(caKey, cert)
+}
+
+// MarshalSSHPublicKey returns a public key or certificate in authorized_keys format, without a trailing newline
+func MarshalSSHPublicKey(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+// newSSHCertificate returns an unsigned certificate for a public key in authorized_keys format, with a random serial
+// number
+func newSSHCertificate(publicKey string, certType uint32, keyID string, principals []string,
+	ttl time.Duration,
+) (*ssh.Certificate, error) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+	if err != nil {
+		return nil, app.Errorf(app.ERR_INVALID, "PublicKey must be an SSH public key in authorized_keys format")
+	}
+	if _, ok := key.(*ssh.Certificate); ok {
+		return nil, app.Errorf(app.ERR_INVALID, "PublicKey must be a public key, not a certificate")
+	}
+
+	var serial [8]byte
+	if _, err = rand.Read(serial[:]); err != nil {
+		return nil, fmt.Errorf("generate serial number: %w", err)
+	}
+	now := time.Now()
+	return &ssh.Certificate{
+		Key:             key,
+		Serial:          binary.BigEndian.Uint64(serial[:]),
+		CertType:        certType,
+		KeyId:           keyID,
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(now.Add(-backdate).Unix()),
+		ValidBefore:     uint64(now.Add(ttl).Unix()),
+	}, nil
+}
+
+// signSSHCertificate signs a certificate with a PKCS #8 CA private key
+func signSSHCertificate(caKey []byte, cert *ssh.Certificate) (*ssh.Certificate, error) {
+	key, err := x509.ParsePKCS8PrivateKey(caKey)
+	if err != nil {
+		return nil, fmt.Errorf("parse SSH CA key: %w", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("SSH CA key cannot sign: %w", err)
+	}
+	if err = cert.SignCert(rand.Reader, signer); err != nil {
+		return nil, fmt.Errorf("sign SSH certificate: %w", err)
+	}
+	return cert, nil
+}
@@ -0,0 +1,71 @@
+package pki
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/briskt/keygo/app"
+)
+
+func newSSHPublicKey(t *testing.T) string {
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := ssh.NewPublicKey(public)
+	require.NoError(t, err)
+	return MarshalSSHPublicKey(key)
+}
+
+func TestSignSSHUserKey(t *testing.T) {
+	caKey, caPublic, err := GenerateSSHCA()
+	require.NoError(t, err)
+	ca, _, _, _, err := ssh.ParseAuthorizedKey([]byte(caPublic))
+	require.NoError(t, err)
+
+	cert, err := SignSSHUserKey(caKey, newSSHPublicKey(t), "user@example.com", []string{"tenant-admin"}, time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, uint32(ssh.UserCert), cert.CertType)
+	require.Equal(t, "user@example.com", cert.KeyId)
+	require.Contains(t, cert.Permissions.Extensions, "permit-pty")
+	require.WithinDuration(t, time.Now().Add(time.Hour), time.Unix(int64(cert.ValidBefore), 0), time.Minute)
+
+	checker := ssh.CertChecker{IsUserAuthority: func(auth ssh.PublicKey) bool {
+		return string(auth.Marshal()) == string(ca.Marshal())
+	}}
+	require.NoError(t, checker.CheckCert("tenant-admin", cert))
+	require.Error(t, checker.CheckCert("root", cert))
+
+	parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(MarshalSSHPublicKey(cert)))
+	require.NoError(t, err)
+	require.IsType(t, &ssh.Certificate{}, parsed)
+
+	_, err = SignSSHUserKey(caKey, "not a key", "user@example.com", []string{"basic"}, time.Hour)
+	require.Equal(t, app.ERR_INVALID, app.ErrorCode(err))
+
+	_, err = SignSSHUserKey(caKey, MarshalSSHPublicKey(cert), "user@example.com", []string{"basic"}, time.Hour)
+	require.Equal(t, app.ERR_INVALID, app.ErrorCode(err))
+}
+
+func TestSignSSHHostKey(t *testing.T) {
+	caKey, caPublic, err := GenerateSSHCA()
+	require.NoError(t, err)
+	ca, _, _, _, err := ssh.ParseAuthorizedKey([]byte(caPublic))
+	require.NoError(t, err)
+
+	cert, err := SignSSHHostKey(caKey, newSSHPublicKey(t), []string{"web1.example.com", "10.0.0.1"}, 24*time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, uint32(ssh.HostCert), cert.CertType)
+	require.Equal(t, "web1.example.com", cert.KeyId)
+
+	checker := ssh.CertChecker{IsHostAuthority: func(auth ssh.PublicKey, _ string) bool {
+		return string(auth.Marshal()) == string(ca.Marshal())
+	}}
+	addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 22}
+	require.NoError(t, checker.CheckHostKey("web1.example.com:22", addr, cert))
+	require.Error(t, checker.CheckHostKey("web2.example.com:22", addr, cert))
+}
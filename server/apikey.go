@@ -0,0 +1,204 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+)
+
+func (s *Server) tenantsAPIKeyTypesListHandler(c echo.Context) error {
+	types, err := db.FindAPIKeyTypes(c, c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	out := make([]app.APIKeyType, len(types))
+	for i, t := range types {
+		if out[i], err = db.ConvertAPIKeyType(c, t); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, out)
+}
+
+func (s *Server) tenantsAPIKeyTypesCreateHandler(c echo.Context) error {
+	var input app.APIKeyTypeInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	tenantID := c.Param("id")
+	keyType, err := db.CreateAPIKeyType(c, tenantID, input)
+	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s created API key type %q in tenant %s", app.CurrentUser(c).ID, keyType.Name, tenantID)
+
+	return s.respondAPIKeyType(c, keyType)
+}
+
+func (s *Server) tenantsAPIKeyTypesUpdateHandler(c echo.Context) error {
+	var input app.APIKeyTypeInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	tenantID := c.Param("id")
+	keyType, err := db.UpdateAPIKeyType(c, tenantID, c.Param("name"), input)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	case app.ErrorCode(err) == app.ERR_INVALID:
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+	case err != nil:
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s updated API key type %q in tenant %s", app.CurrentUser(c).ID, keyType.Name, tenantID)
+
+	return s.respondAPIKeyType(c, keyType)
+}
+
+func (s *Server) tenantsAPIKeyTypesDeleteHandler(c echo.Context) error {
+	tenantID, name := c.Param("id"), c.Param("name")
+	err := db.DeleteAPIKeyType(c, tenantID, name)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	case app.ErrorCode(err) == app.ERR_INVALID:
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+	case err != nil:
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s deleted API key type %q in tenant %s", app.CurrentUser(c).ID, name, tenantID)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// tenantsAPIKeysListHandler lists the API keys of a tenant, filtered by the "type" and "revoked" parameters
+func (s *Server) tenantsAPIKeysListHandler(c echo.Context) error {
+	var filter app.APIKeyFilter
+	if keyType := c.QueryParam("type"); keyType != "" {
+		filter.Type = &keyType
+	}
+	if v := c.QueryParam("revoked"); v != "" {
+		revoked, err := strconv.ParseBool(v)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: "revoked must be true or false"})
+		}
+		filter.Revoked = &revoked
+	}
+
+	keys, err := db.FindAPIKeys(c, c.Param("id"), filter)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	out := make([]app.APIKey, len(keys))
+	for i, k := range keys {
+		if out[i], err = db.ConvertAPIKey(c, k); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, out)
+}
+
+func (s *Server) tenantsAPIKeysGetHandler(c echo.Context) error {
+	key, err := db.FindAPIKeyByID(c, c.Param("id"), c.Param("keyID"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+	return s.respondAPIKey(c, key)
+}
+
+// tenantsAPIKeysIssueHandler issues an API key. The response is the only time the plaintext key is available.
+func (s *Server) tenantsAPIKeysIssueHandler(c echo.Context) error {
+	var input app.APIKeyIssueInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	actor := app.CurrentUser(c)
+	tenantID := c.Param("id")
+	key, err := db.IssueAPIKey(c, tenantID, actor.ID, input)
+	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s issued %s API key %s (%q) in tenant %s", actor.ID, key.Type.Name, key.ID, key.Name,
+		tenantID)
+
+	return s.respondAPIKey(c, key)
+}
+
+func (s *Server) tenantsAPIKeysRevokeHandler(c echo.Context) error {
+	tenantID := c.Param("id")
+	key, err := db.RevokeAPIKey(c, tenantID, c.Param("keyID"))
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	case app.ErrorCode(err) == app.ERR_INVALID:
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+	case err != nil:
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s revoked API key %s in tenant %s", app.CurrentUser(c).ID, key.ID, tenantID)
+
+	return s.respondAPIKey(c, key)
+}
+
+// tenantsAPIKeysVerifyHandler checks an API key presented to a tenant's own API. An unknown, revoked or expired key
+// is not an error, but is reported as not valid.
+func (s *Server) tenantsAPIKeysVerifyHandler(c echo.Context) error {
+	var input app.APIKeyVerifyInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	out, err := db.VerifyAPIKey(c, c.Param("id"), input)
+	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, out)
+}
+
+func (s *Server) respondAPIKeyType(c echo.Context, keyType db.APIKeyType) error {
+	out, err := db.ConvertAPIKeyType(c, keyType)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, out)
+}
+
+func (s *Server) respondAPIKey(c echo.Context, key db.APIKey) error {
+	out, err := db.ConvertAPIKey(c, key)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, out)
+}
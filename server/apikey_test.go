@@ -0,0 +1,136 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+	"github.com/briskt/keygo/server"
+)
+
+func (ts *TestSuite) Test_tenantsAPIKeys() {
+	tenant := ts.createTenantFixture()
+	tenantAdmin := ts.createTenantUserFixture(tenant.ID, app.UserRoleTenantAdmin)
+	member := ts.createTenantUserFixture(tenant.ID, app.UserRoleBasic)
+	otherTenant := ts.createTenantFixture()
+	otherAdmin := ts.createTenantUserFixture(otherTenant.ID, app.UserRoleTenantAdmin)
+
+	typesPath := fmt.Sprintf("/api/tenants/%s/api-key-types", tenant.ID)
+	keysPath := fmt.Sprintf("/api/tenants/%s/api-keys", tenant.ID)
+
+	typeInput := app.APIKeyTypeInput{Name: "free", Metadata: map[string]string{"plan": "free"}, TTL: "24h"}
+	_, status := ts.request(http.MethodPost, typesPath, member.Email, typeInput)
+	ts.Equal(http.StatusNotFound, status, "a member cannot define key types")
+
+	body, status := ts.request(http.MethodPost, typesPath, tenantAdmin.Email, typeInput)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+
+	body, status = ts.request(http.MethodPost, keysPath, tenantAdmin.Email,
+		app.APIKeyIssueInput{Type: "free", Name: "customer 1"})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var key app.APIKey
+	ts.NoError(json.Unmarshal(body, &key))
+	ts.NotEmpty(key.Key)
+
+	body, status = ts.request(http.MethodGet, keysPath+"/"+key.ID, tenantAdmin.Email, nil)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var found app.APIKey
+	ts.NoError(json.Unmarshal(body, &found))
+	ts.Empty(found.Key, "the plaintext key is only returned when issued")
+	ts.Equal(key.Prefix, found.Prefix)
+
+	body, status = ts.request(http.MethodPost, keysPath+"/verify", tenantAdmin.Email,
+		app.APIKeyVerifyInput{Key: key.Key})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var out app.APIKeyVerifyOutput
+	ts.NoError(json.Unmarshal(body, &out))
+	ts.True(out.Valid)
+	ts.Equal(map[string]string{"plan": "free"}, out.Metadata)
+
+	_, status = ts.request(http.MethodPost, fmt.Sprintf("/api/tenants/%s/api-keys/verify", tenant.ID),
+		otherAdmin.Email, app.APIKeyVerifyInput{Key: key.Key})
+	ts.Equal(http.StatusNotFound, status, "another tenant cannot verify the key")
+
+	_, status = ts.request(http.MethodPost, keysPath+"/"+key.ID+"/revoke", tenantAdmin.Email, nil)
+	ts.Equal(http.StatusOK, status)
+
+	body, status = ts.request(http.MethodPost, keysPath+"/verify", tenantAdmin.Email,
+		app.APIKeyVerifyInput{Key: key.Key})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	out = app.APIKeyVerifyOutput{}
+	ts.NoError(json.Unmarshal(body, &out))
+	ts.False(out.Valid)
+}
+
+// BenchmarkAPIKeyVerify measures verifying an API key with a bearer token, once the token, its user, and the key are
+// cached. It reports the statements sent per request, including those that set up the request transaction but not
+// its BEGIN and COMMIT.
+func BenchmarkAPIKeyVerify(b *testing.B) {
+	b.Setenv("RATE_LIMIT_ENABLED", "false")
+
+	conn := db.OpenDB()
+	var statements atomic.Int64
+	count := func(*gorm.DB) { statements.Add(1) }
+	callbacks := conn.Callback()
+	require.NoError(b, callbacks.Create().Before("gorm:create").Register("bench:count", count))
+	require.NoError(b, callbacks.Query().Before("gorm:query").Register("bench:count", count))
+	require.NoError(b, callbacks.Update().Before("gorm:update").Register("bench:count", count))
+	require.NoError(b, callbacks.Delete().Before("gorm:delete").Register("bench:count", count))
+	require.NoError(b, callbacks.Row().Before("gorm:row").Register("bench:count", count))
+	require.NoError(b, callbacks.Raw().Before("gorm:raw").Register("bench:count", count))
+
+	svr := server.New(server.WithDataBase(conn))
+	ctx := testContext()
+	ctx.Set(app.ContextKeyTx, conn)
+
+	tenant, err := db.CreateTenant(ctx, app.TenantCreateInput{Name: "bench"})
+	require.NoError(b, err)
+	user, err := db.CreateUser(ctx, app.UserCreateInput{
+		Email:      fmt.Sprintf("bench%s@example.com", RandStr(6)),
+		TenantID:   tenant.ID,
+		TenantRole: app.UserRoleTenantAdmin,
+	})
+	require.NoError(b, err)
+	token, err := db.CreateToken(ctx, app.TokenCreateInput{
+		AuthID: "bench", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(b, err)
+	_, err = db.CreateAPIKeyType(ctx, tenant.ID, app.APIKeyTypeInput{Name: "free"})
+	require.NoError(b, err)
+	key, err := db.IssueAPIKey(ctx, tenant.ID, user.ID, app.APIKeyIssueInput{Type: "free", Name: "bench"})
+	require.NoError(b, err)
+
+	body, err := json.Marshal(app.APIKeyVerifyInput{Key: key.PlainText})
+	require.NoError(b, err)
+	verify := func() {
+		req := httptest.NewRequest(http.MethodPost, "/api/tenants/"+tenant.ID+"/api-keys/verify", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token.PlainText)
+		res := httptest.NewRecorder()
+		svr.ServeHTTP(res, req)
+		if res.Code != http.StatusOK {
+			b.Fatalf("status %d, body: %s", res.Code, res.Body)
+		}
+	}
+
+	// fill the caches, and record the token's use
+	verify()
+
+	statements.Store(0)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		verify()
+	}
+	b.ReportMetric(float64(statements.Load())/float64(b.N), "statements/op")
+}
@@ -19,19 +19,24 @@ import (
 	"github.com/briskt/keygo/server/oauth"
 )
 
-const AuthCallbackPath = "/api/auth/callback"
+const (
+	AuthCallbackPath          = "/api/auth/callback"
+	AuthBackChannelLogoutPath = "/api/auth/backchannel-logout"
+)
 
 const (
 	SessionKeyAuthID   = "AuthID"
+	SessionKeyIDToken  = "IDToken"
 	SessionKeyToken    = "Token"
 	SessionKeyReturnTo = "ReturnTo"
 	SessionKeyState    = "State"
 )
 
 const (
-	ParamReturnTo = "returnTo"
-	ParamCode     = "code"
-	DefaultUIPath = "/"
+	ParamReturnTo    = "returnTo"
+	ParamCode        = "code"
+	ParamLogoutToken = "logout_token"
+	DefaultUIPath    = "/"
 )
 
 type AuthError struct {
@@ -41,11 +46,12 @@ type AuthError struct {
 func init() {
 	const required = true
 	config := oauth.Config{
-		Issuer:       env("OAUTH_ISSUER_URL", required),
-		ClientID:     env("OAUTH_CLIENT_ID", required),
-		ClientSecret: env("OAUTH_CLIENT_SECRET", required),
-		RedirectURL:  env("HOST", required) + env("OAUTH_REDIRECT_PATH", required),
-		Scopes:       env("OAUTH_OPENID_SCOPES", required),
+		Issuer:                env("OAUTH_ISSUER_URL", required),
+		ClientID:              env("OAUTH_CLIENT_ID", required),
+		ClientSecret:          env("OAUTH_CLIENT_SECRET", required),
+		RedirectURL:           env("HOST", required) + env("OAUTH_REDIRECT_PATH", required),
+		PostLogoutRedirectURL: env("HOST", required) + DefaultUIPath,
+		Scopes:                env("OAUTH_OPENID_SCOPES", required),
 	}
 
 	if err := oauth.Init(config); err != nil {
@@ -71,6 +77,35 @@ func (s *Server) authStatus(c echo.Context) error {
 	return c.JSON(http.StatusOK, status)
 }
 
+// authTenantHandler switches the active tenant of the current session
+func (s *Server) authTenantHandler(c echo.Context) error {
+	var input app.ActiveTenantInput
+	if err := (&echo.DefaultBinder{}).BindBody(c, &input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+	if err := input.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+	}
+
+	user := app.CurrentUser(c)
+	if _, ok := user.Membership(input.TenantID); !ok && !user.HasPermission(app.PermissionTenantsRead) {
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+	if _, err := db.FindTenantByID(c, input.TenantID); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+
+	token := app.CurrentToken(c)
+	if err := db.UpdateToken(c, token.ID, app.TokenUpdateInput{ActiveTenantID: &input.TenantID}); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s switched active tenant to %s", user.ID, input.TenantID)
+
+	user.TenantID = input.TenantID
+	return c.JSON(http.StatusOK, user)
+}
+
 func (s *Server) authLogin(c echo.Context) error {
 	authenticator := oauth.Get()
 	if authenticator == nil {
@@ -132,9 +167,59 @@ func (s *Server) authLogout(c echo.Context) error {
 	if err := db.DeleteToken(c, token.ID); err != nil {
 		s.Logger.Errorf("failed to delete user token: %s", err)
 	}
+
+	// end the session at the IdP too, if it supports RP-initiated logout
+	idToken, _ := sessionGetValue(c, SessionKeyIDToken)
+	idTokenHint, _ := idToken.(string)
+	if url := oauth.EndSessionURL(idTokenHint); url != "" {
+		s.Logger.Infof("redirecting to auth provider for logout: %s", url)
+		return c.Redirect(http.StatusTemporaryRedirect, url)
+	}
 	return c.Redirect(http.StatusTemporaryRedirect, DefaultUIPath)
 }
 
+// verifyLogoutToken verifies a back-channel logout token, and may be replaced for tests
+var verifyLogoutToken = oauth.VerifyLogoutToken
+
+// authBackChannelLogout receives logout tokens sent directly by the IdP when a user's session ends there, and
+// revokes the matching tokens. Each logout token is accepted once. See OpenID Connect Back-Channel Logout 1.0.
+func (s *Server) authBackChannelLogout(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "no-store")
+
+	authenticator := oauth.Get()
+	if authenticator == nil {
+		err := fmt.Errorf("authenticator is not initialized")
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	claims, err := verifyLogoutToken(c.Request().Context(), c.FormValue(ParamLogoutToken))
+	if err != nil {
+		s.Logger.Warnf("invalid back-channel logout request: %s", err)
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: "invalid_request"})
+	}
+
+	if err = bypassRLS(c, "back-channel logout"); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	if err = db.RecordLogoutToken(c, claims.ID, claims.ExpiresAt); err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			s.Logger.Warnf("replayed back-channel logout token, jti=%q", claims.ID)
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: "invalid_request"})
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	n, err := db.DeleteTokensByAuth(c, claims.Subject, claims.SessionID)
+	if err != nil {
+		err = fmt.Errorf("revoking tokens: %w", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("back-channel logout revoked %d token(s), sub=%q sid=%q", n, claims.Subject, claims.SessionID)
+	return c.NoContent(http.StatusOK)
+}
+
 func (s *Server) authCallback(c echo.Context) error {
 	if authError := c.QueryParam("error"); authError != "" {
 		errDescription := c.QueryParam("error_description")
@@ -161,17 +246,28 @@ func (s *Server) authCallback(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
 	}
 
+	if err := sessionSetValue(c, SessionKeyIDToken, profile.IDToken); err != nil {
+		err = fmt.Errorf("setting ID token: %w", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
 	s.Logger.Infof("user authenticated, profile=%+v", profile)
 
+	// the user is found by email address, before anything restricts the transaction to a user or tenant
+	if err = bypassRLS(c, "login"); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
 	user, err := s.FindOrCreateUser(c, profile.Email)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
 	}
 
 	token, err := db.CreateToken(c, app.TokenCreateInput{
-		AuthID:    profile.ID,
-		UserID:    user.ID,
-		ExpiresAt: time.Now().Add(app.AuthTokenLifetime),
+		AuthID:        profile.ID,
+		AuthSessionID: profile.SessionID,
+		UserID:        user.ID,
+		ExpiresAt:     time.Now().Add(app.AuthTokenLifetime),
 	})
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
@@ -202,40 +298,48 @@ func (s *Server) AuthnMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 			return next(c)
 		}
 
-		token, err := s.getTokenFromSession(c)
-		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("getTokenFromSession: %s", err))
-		}
-
 		status := http.StatusUnauthorized
 		authError := AuthError{"not authorized"}
 
-		if token.ID == "" {
-			t, err := db.FindToken(c, getBearerToken(c))
-			if err != nil {
+		// A bearer token takes precedence over the session cookie, so that requests exempted from CSRF checks
+		// are never authenticated by the cookie.
+		var t db.Token
+		if bearer := getBearerToken(c); bearer != "" {
+			var err error
+			if t, err = db.FindToken(c, bearer); err != nil {
+				s.recordAuthFailure(c)
 				return echo.NewHTTPError(status, authError) // TODO: should this be a different error?
 			}
-			token, err = db.ConvertToken(c, t)
-			if err != nil {
-				return echo.NewHTTPError(status, authError) // TODO: should this be a different error?
+		} else {
+			var err error
+			if t, err = s.findSessionToken(c); err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("getTokenFromSession: %s", err))
 			}
 		}
 
-		if token.ID == "" {
+		if t.ID == "" {
 			return echo.NewHTTPError(status, authError)
 		}
-		if token.ExpiresAt.Before(time.Now()) {
-			s.Logger.Infof("token expired at %s\n", token.ExpiresAt)
+		if t.ExpiresAt.Before(time.Now()) {
+			s.Logger.Infof("token expired at %s\n", t.ExpiresAt)
 			return echo.NewHTTPError(status, authError)
 		}
 
-		now := time.Now()
-		tokenExpiry := now.Add(app.AuthTokenLifetime)
-		if err := db.UpdateToken(c, token.ID, app.TokenUpdateInput{
-			ExpiresAt:  &tokenExpiry,
-			LastUsedAt: &now,
-		}); err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, echo.NewHTTPError(http.StatusInternalServerError), AuthError{Error: err.Error()})
+		token, err := db.ConvertToken(c, t)
+		if err != nil {
+			return echo.NewHTTPError(status, authError) // TODO: should this be a different error?
+		}
+
+		if err = s.checkTenantNetwork(c, token.User, token.User.TenantID); err != nil {
+			return err
+		}
+
+		if err = db.SetRLSActor(c, token.User.TenantID, token.User.ID); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+		}
+
+		if err = db.TouchToken(c, t); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
 		}
 
 		c.Set(app.ContextKeyToken, token)
@@ -258,7 +362,9 @@ func getBearerToken(c echo.Context) (token string) {
 }
 
 func AuthnSkipper(c echo.Context) bool {
-	skipURLs := []string{"/api/auth", "/api/auth/login", "/api/auth/callback", "/api/auth/logout"}
+	skipURLs := []string{
+		"/api/auth", "/api/auth/login", AuthCallbackPath, "/api/auth/logout", AuthBackChannelLogoutPath, PKICRLPath,
+	}
 	for _, u := range skipURLs {
 		if c.Path() == u {
 			return true
@@ -272,23 +378,31 @@ func AuthnSkipper(c echo.Context) bool {
 }
 
 func (s *Server) getTokenFromSession(c echo.Context) (app.Token, error) {
+	token, err := s.findSessionToken(c)
+	if err != nil || token.ID == "" {
+		return app.Token{}, err
+	}
+	return db.ConvertToken(c, token)
+}
+
+// findSessionToken returns the token in the session cookie, or an empty token if there is none
+func (s *Server) findSessionToken(c echo.Context) (db.Token, error) {
 	tokenInterface, err := sessionGetValue(c, SessionKeyToken)
 	if err != nil {
 		s.Logger.Infof("no token in session: %s", err)
-		return app.Token{}, nil
+		return db.Token{}, nil
 	}
 
 	tokenPlainText, ok := tokenInterface.(string)
 	if !ok {
-		return app.Token{}, fmt.Errorf("token in session is not a string\n")
+		return db.Token{}, fmt.Errorf("token in session is not a string\n")
 	}
 
 	token, err := db.FindToken(c, tokenPlainText)
 	if err != nil {
-		return app.Token{}, fmt.Errorf("could not find token in DB: %w\n", err)
+		return db.Token{}, fmt.Errorf("could not find token in DB: %w\n", err)
 	}
-
-	return db.ConvertToken(c, token)
+	return token, nil
 }
 
 func env(key string, required bool) string {
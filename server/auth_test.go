@@ -1,9 +1,21 @@
 package server_test
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
 
 	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+	"github.com/briskt/keygo/server"
+	"github.com/briskt/keygo/server/oauth"
 )
 
 func (ts *TestSuite) TestServer_findOrCreateUser() {
@@ -33,3 +45,67 @@ func (ts *TestSuite) TestServer_findOrCreateUser() {
 		})
 	}
 }
+
+func (ts *TestSuite) TestServer_authBackChannelLogout() {
+	user := ts.createUserFixture(app.UserRoleBasic)
+
+	body, status := ts.request(http.MethodPost, server.AuthBackChannelLogoutPath, "", nil)
+	ts.Equal(http.StatusBadRequest, status, "incorrect http status, body: \n%s", body)
+
+	// the user's token is untouched by an invalid logout request
+	_, status = ts.request(http.MethodGet, "/api/users/"+user.ID, user.Email, nil)
+	ts.Equal(http.StatusOK, status)
+
+	ts.NoError(ts.tx.Exec("DELETE FROM logout_tokens").Error)
+	ts.NoError(ts.tx.Model(&db.Token{}).Where("user_id = ?", user.ID).Update("auth_id", "auth-1").Error)
+	restore := server.SetLogoutTokenVerifier(func(context.Context, string) (oauth.LogoutClaims, error) {
+		return oauth.LogoutClaims{ID: "logout-1", Subject: "auth-1", ExpiresAt: time.Now().Add(time.Minute)}, nil
+	})
+	defer restore()
+
+	logout := func() int {
+		form := url.Values{server.ParamLogoutToken: {"logout-token"}}
+		req := httptest.NewRequest(http.MethodPost, server.AuthBackChannelLogoutPath, strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		res := httptest.NewRecorder()
+		ts.server.ServeHTTP(res, req)
+		return res.Code
+	}
+
+	ts.Equal(http.StatusOK, logout())
+	_, status = ts.request(http.MethodGet, "/api/users/"+user.ID, user.Email, nil)
+	ts.Equal(http.StatusUnauthorized, status, "a valid logout token should revoke the user's tokens")
+
+	ts.Equal(http.StatusBadRequest, logout(), "a replayed logout token should be rejected")
+}
+
+func (ts *TestSuite) Test_authTenantHandler() {
+	tenant1 := ts.createTenantFixture()
+	tenant2 := ts.createTenantFixture()
+	otherTenant := ts.createTenantFixture()
+	user := ts.createTenantUserFixture(tenant1.ID, app.UserRoleBasic)
+	_, err := db.CreateTenantMembership(ts.ctx, app.TenantMembershipCreateInput{
+		TenantID: tenant2.ID,
+		UserID:   user.ID,
+		Role:     app.UserRoleTenantAdmin,
+	})
+	ts.NoError(err)
+
+	activeTenant := func() string {
+		body, status := ts.request(http.MethodGet, "/api/users/"+user.ID, user.Email, nil)
+		ts.Equal(http.StatusOK, status, "incorrect http status, body: \n%s", body)
+		var got app.User
+		ts.NoError(json.Unmarshal(body, &got))
+		return got.TenantID
+	}
+	ts.Equal(tenant1.ID, activeTenant(), "the first tenant should be active by default")
+
+	input := app.ActiveTenantInput{TenantID: otherTenant.ID}
+	_, status := ts.request(http.MethodPut, "/api/auth/tenant", user.Email, input)
+	ts.Equal(http.StatusNotFound, status, "cannot switch to a tenant the user is not a member of")
+
+	input = app.ActiveTenantInput{TenantID: tenant2.ID}
+	body, status := ts.request(http.MethodPut, "/api/auth/tenant", user.Email, input)
+	ts.Equal(http.StatusOK, status, "incorrect http status, body: \n%s", body)
+	ts.Equal(tenant2.ID, activeTenant())
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/briskt/keygo/db"
+)
+
+const (
+	defaultAuthCacheSize        = 10000
+	defaultAuthCacheTTL         = 30 * time.Second
+	defaultAuthCacheNegativeTTL = 5 * time.Second
+)
+
+// authCacheConfig holds the token, API key, and user cache settings read from the environment
+type authCacheConfig struct {
+	enabled bool
+	cache   db.AuthCacheConfig
+}
+
+// loadAuthCacheConfig reads the token, API key, and user cache settings from the environment. Durations are in the
+// form accepted by time.ParseDuration, e.g. "30s".
+//
+//   - AUTH_CACHE_SIZE: the number of tokens, of API keys, and of users, to cache (default 10000), or 0 to disable
+//     the cache
+//   - AUTH_CACHE_TTL: how long a found token, key, or user is cached (default 30s)
+//   - AUTH_CACHE_NEGATIVE_TTL: how long an unknown token or invalid key is cached (default 5s)
+func loadAuthCacheConfig() (authCacheConfig, error) {
+	config := authCacheConfig{
+		enabled: true,
+		cache: db.AuthCacheConfig{
+			Size:        defaultAuthCacheSize,
+			TTL:         defaultAuthCacheTTL,
+			NegativeTTL: defaultAuthCacheNegativeTTL,
+		},
+	}
+
+	if v := os.Getenv("AUTH_CACHE_SIZE"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < 0 {
+			return authCacheConfig{}, fmt.Errorf("invalid AUTH_CACHE_SIZE %q", v)
+		}
+		config.enabled = size > 0
+		config.cache.Size = size
+	}
+
+	durations := []struct {
+		key      string
+		duration *time.Duration
+	}{
+		{"AUTH_CACHE_TTL", &config.cache.TTL},
+		{"AUTH_CACHE_NEGATIVE_TTL", &config.cache.NegativeTTL},
+	}
+	for _, d := range durations {
+		v := os.Getenv(d.key)
+		if v == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(v)
+		if err != nil || duration < 0 {
+			return authCacheConfig{}, fmt.Errorf("invalid %s %q", d.key, v)
+		}
+		*d.duration = duration
+	}
+
+	return config, nil
+}
+
+// startAuthCache enables the token, API key, and user cache, and listens for revocations made by other instances
+func (s *Server) startAuthCache(config authCacheConfig) {
+	if !config.enabled || s.db == nil {
+		db.DisableAuthCache()
+		return
+	}
+	db.EnableAuthCache(config.cache).Listen(os.Getenv("DATABASE_URL"), func(err error) {
+		s.Logger.Errorf("auth cache listener error: %s", err)
+	})
+}
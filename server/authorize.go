@@ -0,0 +1,133 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+	"github.com/briskt/keygo/server/authz"
+)
+
+const defaultPolicyReloadInterval = 10 * time.Second
+
+// authzConfig holds the authorization settings read from the environment
+type authzConfig struct {
+	policyFile     string
+	reloadInterval time.Duration
+}
+
+// loadAuthzConfig reads the authorization settings from the environment:
+//
+//   - AUTHZ_POLICY_FILE: YAML policy file, defaults to the built-in policy
+//   - AUTHZ_POLICY_RELOAD_INTERVAL: how often to check the policy file for changes, e.g. "30s"
+func loadAuthzConfig() (authzConfig, error) {
+	config := authzConfig{
+		policyFile:     os.Getenv("AUTHZ_POLICY_FILE"),
+		reloadInterval: defaultPolicyReloadInterval,
+	}
+	if v := os.Getenv("AUTHZ_POLICY_RELOAD_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return authzConfig{}, fmt.Errorf("invalid AUTHZ_POLICY_RELOAD_INTERVAL %q", v)
+		}
+		config.reloadInterval = d
+	}
+	return config, nil
+}
+
+// newAuthorizer returns the policy authorizer, logging its decisions, and starts watching the policy file
+func (s *Server) newAuthorizer(config authzConfig) (authz.Authorizer, error) {
+	policy, err := authz.NewPolicyAuthorizer(config.policyFile)
+	if err != nil {
+		return nil, err
+	}
+	if config.policyFile != "" {
+		policy.StartReload(config.reloadInterval, func(err error) {
+			if err != nil {
+				s.Logger.Errorf("authorization policy not reloaded: %s", err)
+				return
+			}
+			s.Logger.Infof("authorization policy reloaded from %s", config.policyFile)
+		})
+	}
+	return authz.LoggingAuthorizer{Authorizer: policy, Logger: s.Logger}, nil
+}
+
+// decide asks the authorizer whether the current user may perform the action on the resource. If allowed, the
+// request transaction's row-level security is set to match the scope of the decision.
+func (s *Server) decide(c echo.Context, action string, resource authz.Resource) (authz.Decision, error) {
+	user := app.CurrentUser(c)
+	d := s.authorizer.Authorize(user, action, resource)
+	if !d.Allowed {
+		return d, nil
+	}
+
+	var err error
+	switch d.Scope {
+	case authz.ScopeGlobal:
+		err = bypassRLS(c, fmt.Sprintf("%s on %s (rule %q)", action, resource, d.Rule))
+	case authz.ScopeTenant:
+		err = db.SetRLSActor(c, resource.TenantID, user.ID)
+	}
+	return d, err
+}
+
+// authorize is like decide, but returns an HTTP error if the action is not allowed
+func (s *Server) authorize(c echo.Context, action string, resource authz.Resource) error {
+	d, err := s.decide(c, action, resource)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+	if !d.Allowed {
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+	return nil
+}
+
+// RequirePermission returns a middleware that responds "not found" unless the authorizer allows the current user
+// the given permission on the collection it belongs to, e.g. "tenants" for "tenants.create"
+func (s *Server) RequirePermission(permission string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if err := s.authorize(c, permission, authz.Resource{Type: resourceType(permission)}); err != nil {
+				return err
+			}
+			return next(c)
+		}
+	}
+}
+
+// RequireTenantPermission returns a middleware that responds "not found" unless the authorizer allows the current
+// user the given permission on the tenant identified by the "id" path parameter. Like the active tenant, that tenant
+// may restrict access to some networks.
+func (s *Server) RequireTenantPermission(permission string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			tenantID := c.Param("id")
+			resource := authz.Resource{Type: resourceType(permission), ID: tenantID, TenantID: tenantID}
+			if err := s.authorize(c, permission, resource); err != nil {
+				return err
+			}
+
+			// the active tenant's network was checked by AuthnMiddleware
+			if user := app.CurrentUser(c); tenantID != user.TenantID {
+				if err := s.checkTenantNetwork(c, user, tenantID); err != nil {
+					return err
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+// resourceType returns the resource type of a permission, which is its first component
+func resourceType(permission string) string {
+	t, _, _ := strings.Cut(permission, ".")
+	return t
+}
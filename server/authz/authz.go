@@ -0,0 +1,83 @@
+// Package authz decides whether an actor may perform an action on a resource
+package authz
+
+import (
+	"fmt"
+
+	"github.com/briskt/keygo/app"
+)
+
+// Scope is the extent of the data an allowed decision grants access to. Narrower scopes are smaller values.
+type Scope int
+
+const (
+	// ScopeSelf limits access to the actor's own records
+	ScopeSelf Scope = iota + 1
+
+	// ScopeTenant limits access to the resource's tenant
+	ScopeTenant
+
+	// ScopeGlobal grants access across all tenants
+	ScopeGlobal
+)
+
+func (s Scope) String() string {
+	switch s {
+	case ScopeSelf:
+		return "self"
+	case ScopeTenant:
+		return "tenant"
+	case ScopeGlobal:
+		return "global"
+	}
+	return "none"
+}
+
+// Resource identifies the object of an action
+type Resource struct {
+	// Type is the kind of resource, e.g. "users" or "tenants"
+	Type string
+
+	// ID identifies the resource. It is empty for actions on a collection, e.g. creating or listing.
+	ID string
+
+	// TenantID is the tenant the resource belongs to, if any. For a tenant it is the tenant's own ID.
+	TenantID string
+
+	// OwnerID is the user the resource belongs to, if any. For a user it is the user's own ID.
+	OwnerID string
+}
+
+func (r Resource) String() string {
+	if r.ID == "" {
+		return r.Type
+	}
+	return r.Type + "/" + r.ID
+}
+
+// Decision is the outcome of an authorization check
+type Decision struct {
+	Allowed bool
+
+	// Rule names the policy rule that matched, or DefaultRule if none did
+	Rule string
+
+	// Scope is the extent of access granted, if allowed
+	Scope Scope
+}
+
+// DefaultRule is the rule name reported when no policy rule matched, and the action is denied
+const DefaultRule = "default-deny"
+
+func (d Decision) String() string {
+	if !d.Allowed {
+		return fmt.Sprintf("deny (rule %q)", d.Rule)
+	}
+	return fmt.Sprintf("allow %s (rule %q)", d.Scope, d.Rule)
+}
+
+// Authorizer decides whether an actor may perform an action on a resource. Actions are named like permissions,
+// e.g. "users.read".
+type Authorizer interface {
+	Authorize(actor app.User, action string, resource Resource) Decision
+}
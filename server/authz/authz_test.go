@@ -0,0 +1,261 @@
+package authz
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/briskt/keygo/app"
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	admin := app.User{ID: "admin", Role: app.UserRoleAdmin, Permissions: []string{app.PermissionAll}}
+	basic := app.User{ID: "basic", Role: app.UserRoleBasic, Permissions: []string{}}
+	tenantAdmin := app.User{
+		ID:   "tenant-admin",
+		Role: app.UserRoleBasic,
+		Memberships: []app.TenantMembership{{
+			TenantID:    "t1",
+			Role:        app.UserRoleTenantAdmin,
+			Permissions: []string{app.PermissionOwnTenantRead},
+		}},
+	}
+
+	tests := []struct {
+		name      string
+		actor     app.User
+		action    string
+		resource  Resource
+		wantRule  string
+		wantScope Scope
+	}{
+		{
+			name:      "admin",
+			actor:     admin,
+			action:    app.PermissionTenantsCreate,
+			resource:  Resource{Type: "tenants"},
+			wantRule:  "role-permission",
+			wantScope: ScopeGlobal,
+		},
+		{
+			name:     "basic user",
+			actor:    basic,
+			action:   app.PermissionTenantsCreate,
+			resource: Resource{Type: "tenants"},
+			wantRule: DefaultRule,
+		},
+		{
+			name:      "own user record",
+			actor:     basic,
+			action:    app.PermissionUsersUpdate,
+			resource:  Resource{Type: "users", ID: "basic", OwnerID: "basic"},
+			wantRule:  "own-user-record",
+			wantScope: ScopeSelf,
+		},
+		{
+			name:     "other user record",
+			actor:    basic,
+			action:   app.PermissionUsersRead,
+			resource: Resource{Type: "users", ID: "admin", OwnerID: "admin"},
+			wantRule: DefaultRule,
+		},
+		{
+			name:      "tenant admin in own tenant",
+			actor:     tenantAdmin,
+			action:    app.PermissionTenantsRead,
+			resource:  Resource{Type: "tenants", ID: "t1", TenantID: "t1"},
+			wantRule:  "role-permission",
+			wantScope: ScopeTenant,
+		},
+		{
+			name:     "tenant admin in other tenant",
+			actor:    tenantAdmin,
+			action:   app.PermissionTenantsRead,
+			resource: Resource{Type: "tenants", ID: "t2", TenantID: "t2"},
+			wantRule: DefaultRule,
+		},
+		{
+			name:      "tenant member SSH login",
+			actor:     tenantAdmin,
+			action:    app.PermissionTenantsSSHLogin,
+			resource:  Resource{Type: "tenants", ID: "t1", TenantID: "t1"},
+			wantRule:  "tenant-members-ssh",
+			wantScope: ScopeTenant,
+		},
+		{
+			name:     "SSH login in other tenant",
+			actor:    tenantAdmin,
+			action:   app.PermissionTenantsSSHLogin,
+			resource: Resource{Type: "tenants", ID: "t2", TenantID: "t2"},
+			wantRule: DefaultRule,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := DefaultPolicy().Authorize(tt.actor, tt.action, tt.resource)
+			require.Equal(t, tt.wantRule, d.Rule)
+			require.Equal(t, tt.wantScope != 0, d.Allowed)
+			require.Equal(t, tt.wantScope, d.Scope)
+		})
+	}
+}
+
+func TestPolicy_Authorize(t *testing.T) {
+	policy, err := ParsePolicy([]byte(`
+rules:
+  - name: no-support-edits
+    effect: deny
+    actions: ["*.update", "*.create"]
+    when:
+      roles: [Support]
+  - name: support-read-only
+    effect: allow
+    actions: ["*.read", "*.list"]
+    when:
+      roles: [Support]
+  - name: tenant-members-read
+    effect: allow
+    actions: [users.read]
+    resources: [users]
+    when:
+      same_tenant: true
+`))
+	require.NoError(t, err)
+
+	support := app.User{ID: "support", Role: "Support"}
+	tenantSupport := app.User{ID: "ts", Memberships: []app.TenantMembership{{TenantID: "t1", Role: "Support"}}}
+	member := app.User{ID: "member", Memberships: []app.TenantMembership{{TenantID: "t1"}}}
+
+	tests := []struct {
+		name      string
+		actor     app.User
+		action    string
+		resource  Resource
+		wantRule  string
+		wantScope Scope
+	}{
+		{
+			name:      "support can read anything",
+			actor:     support,
+			action:    app.PermissionTenantsRead,
+			resource:  Resource{Type: "tenants", ID: "t9", TenantID: "t9"},
+			wantRule:  "support-read-only",
+			wantScope: ScopeGlobal,
+		},
+		{
+			name:     "support cannot edit",
+			actor:    support,
+			action:   app.PermissionTenantsUpdate,
+			resource: Resource{Type: "tenants", ID: "t9", TenantID: "t9"},
+			wantRule: "no-support-edits",
+		},
+		{
+			name:      "tenant support role is scoped to the tenant",
+			actor:     tenantSupport,
+			action:    app.PermissionTenantsRead,
+			resource:  Resource{Type: "tenants", ID: "t1", TenantID: "t1"},
+			wantRule:  "support-read-only",
+			wantScope: ScopeTenant,
+		},
+		{
+			name:     "tenant support role does not apply to other tenants",
+			actor:    tenantSupport,
+			action:   app.PermissionTenantsRead,
+			resource: Resource{Type: "tenants", ID: "t2", TenantID: "t2"},
+			wantRule: DefaultRule,
+		},
+		{
+			name:      "member can read members of own tenant",
+			actor:     member,
+			action:    app.PermissionUsersRead,
+			resource:  Resource{Type: "users", ID: "u2", OwnerID: "u2", TenantID: "t1"},
+			wantRule:  "tenant-members-read",
+			wantScope: ScopeTenant,
+		},
+		{
+			name:     "member cannot read users outside own tenant",
+			actor:    member,
+			action:   app.PermissionUsersRead,
+			resource: Resource{Type: "users", ID: "u3", OwnerID: "u3"},
+			wantRule: DefaultRule,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := policy.Authorize(tt.actor, tt.action, tt.resource)
+			require.Equal(t, tt.wantRule, d.Rule)
+			require.Equal(t, tt.wantScope != 0, d.Allowed)
+			require.Equal(t, tt.wantScope, d.Scope)
+		})
+	}
+}
+
+func TestParsePolicy_invalid(t *testing.T) {
+	for name, policy := range map[string]string{
+		"no name":        "rules: [{effect: allow}]",
+		"bad effect":     "rules: [{name: x, effect: maybe}]",
+		"bad pattern":    "rules: [{name: x, effect: allow, actions: ['[']}]",
+		"malformed yaml": "rules: [",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParsePolicy([]byte(policy))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestPolicyAuthorizer_Reload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	write := func(effect string, modTime time.Time) {
+		policy := fmt.Sprintf("rules: [{name: everything, effect: %s}]", effect)
+		require.NoError(t, os.WriteFile(file, []byte(policy), 0o600))
+		require.NoError(t, os.Chtimes(file, modTime, modTime))
+	}
+	now := time.Now()
+	write(EffectDeny, now)
+
+	a, err := NewPolicyAuthorizer(file)
+	require.NoError(t, err)
+	require.False(t, a.Authorize(app.User{}, "x.read", Resource{}).Allowed)
+
+	changed, err := a.Reload()
+	require.NoError(t, err)
+	require.False(t, changed, "an unmodified file should not be reloaded")
+
+	write(EffectAllow, now.Add(time.Second))
+	changed, err = a.Reload()
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.True(t, a.Authorize(app.User{}, "x.read", Resource{}).Allowed)
+
+	// an invalid policy leaves the current policy in effect
+	require.NoError(t, os.WriteFile(file, []byte("rules: ["), 0o600))
+	require.NoError(t, os.Chtimes(file, now.Add(2*time.Second), now.Add(2*time.Second)))
+	_, err = a.Reload()
+	require.Error(t, err)
+	require.True(t, a.Authorize(app.User{}, "x.read", Resource{}).Allowed)
+}
+
+type testLogger struct {
+	entries []string
+}
+
+func (l *testLogger) Infof(format string, args ...interface{}) {
+	l.entries = append(l.entries, fmt.Sprintf(format, args...))
+}
+
+func TestLoggingAuthorizer(t *testing.T) {
+	logger := &testLogger{}
+	a := LoggingAuthorizer{Authorizer: DefaultPolicy(), Logger: logger}
+
+	a.Authorize(app.User{ID: "u1"}, app.PermissionUsersRead, Resource{Type: "users", ID: "u1", OwnerID: "u1"})
+	a.Authorize(app.User{ID: "u1"}, app.PermissionTenantsList, Resource{Type: "tenants"})
+
+	require.Len(t, logger.entries, 2)
+	require.Contains(t, logger.entries[0], `allow self (rule "own-user-record")`)
+	require.Contains(t, logger.entries[1], `deny (rule "default-deny")`)
+}
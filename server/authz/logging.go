@@ -0,0 +1,24 @@
+package authz
+
+import (
+	"github.com/briskt/keygo/app"
+)
+
+// Logger receives decision log entries
+type Logger interface {
+	Infof(format string, args ...interface{})
+}
+
+// LoggingAuthorizer logs every decision of another Authorizer, along with the rule that made it
+type LoggingAuthorizer struct {
+	Authorizer Authorizer
+	Logger     Logger
+}
+
+// Authorize implements Authorizer
+func (l LoggingAuthorizer) Authorize(actor app.User, action string, resource Resource) Decision {
+	d := l.Authorizer.Authorize(actor, action, resource)
+	l.Logger.Infof("authz: %s: actor=%q action=%q resource=%q tenant=%q", d, actor.ID, action, resource,
+		resource.TenantID)
+	return d
+}
@@ -0,0 +1,270 @@
+package authz
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/briskt/keygo/app"
+)
+
+//go:embed default_policy.yaml
+var defaultPolicy []byte
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Policy is an ordered list of rules. The first rule matching a request decides it, and a request matching no rule
+// is denied.
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule allows or denies matching requests
+type Rule struct {
+	Name   string `yaml:"name"`
+	Effect string `yaml:"effect"`
+
+	// Actions are patterns (see path.Match) of actions the rule applies to, e.g. "users.*" or "*.read". Empty
+	// matches any action.
+	Actions []string `yaml:"actions"`
+
+	// Resources are the resource types the rule applies to. Empty matches any type.
+	Resources []string `yaml:"resources"`
+
+	When Conditions `yaml:"when"`
+}
+
+// Conditions on the actor and resource. All given conditions must hold for a rule to match.
+type Conditions struct {
+	// Self requires the resource to be owned by the actor
+	Self bool `yaml:"self"`
+
+	// SameTenant requires the actor to be a member of the resource's tenant
+	SameTenant bool `yaml:"same_tenant"`
+
+	// Roles requires the actor to have one of the roles, either globally, through an active elevation, or as a member
+	// of the resource's tenant
+	Roles []string `yaml:"roles"`
+
+	// HasPermission requires the actor to hold the permission named by the action, either globally or for the
+	// resource's tenant
+	HasPermission bool `yaml:"has_permission"`
+}
+
+// ParsePolicy parses and validates a YAML policy
+func ParsePolicy(b []byte) (Policy, error) {
+	var p Policy
+	if err := yaml.Unmarshal(b, &p); err != nil {
+		return Policy{}, err
+	}
+	for i, r := range p.Rules {
+		if r.Name == "" {
+			return Policy{}, fmt.Errorf("rule %d has no name", i)
+		}
+		if r.Effect != EffectAllow && r.Effect != EffectDeny {
+			return Policy{}, fmt.Errorf("rule %q has invalid effect %q, expected allow or deny", r.Name, r.Effect)
+		}
+		for _, a := range r.Actions {
+			if _, err := path.Match(a, ""); err != nil {
+				return Policy{}, fmt.Errorf("rule %q has invalid action pattern %q", r.Name, a)
+			}
+		}
+	}
+	return p, nil
+}
+
+// DefaultPolicy returns the built-in policy, which allows actions by permission, lets users manage their own user
+// record, and lets tenant members use the tenant's SSH CA
+func DefaultPolicy() Policy {
+	p, err := ParsePolicy(defaultPolicy)
+	if err != nil {
+		panic("invalid default authorization policy: " + err.Error())
+	}
+	return p
+}
+
+// Authorize evaluates the policy
+func (p Policy) Authorize(actor app.User, action string, resource Resource) Decision {
+	for _, r := range p.Rules {
+		scope, ok := r.match(actor, action, resource)
+		if !ok {
+			continue
+		}
+		if r.Effect == EffectDeny {
+			return Decision{Rule: r.Name}
+		}
+		return Decision{Allowed: true, Rule: r.Name, Scope: scope}
+	}
+	return Decision{Rule: DefaultRule}
+}
+
+// match returns true and the narrowest scope implied by the rule's conditions if the rule applies to the request
+func (r Rule) match(actor app.User, action string, resource Resource) (Scope, bool) {
+	if len(r.Actions) > 0 && !matchAny(r.Actions, action) {
+		return 0, false
+	}
+	if len(r.Resources) > 0 && !contains(r.Resources, resource.Type) {
+		return 0, false
+	}
+
+	scope := ScopeGlobal
+	narrow := func(s Scope) {
+		if s < scope {
+			scope = s
+		}
+	}
+
+	w := r.When
+	if w.Self {
+		if actor.ID == "" || resource.OwnerID != actor.ID {
+			return 0, false
+		}
+		narrow(ScopeSelf)
+	}
+	if w.SameTenant {
+		if _, ok := actor.Membership(resource.TenantID); resource.TenantID == "" || !ok {
+			return 0, false
+		}
+		narrow(ScopeTenant)
+	}
+	if len(w.Roles) > 0 {
+		m, _ := actor.Membership(resource.TenantID)
+		switch {
+		case hasAnyRole(actor, w.Roles):
+		case resource.TenantID != "" && contains(w.Roles, m.Role):
+			narrow(ScopeTenant)
+		default:
+			return 0, false
+		}
+	}
+	if w.HasPermission {
+		switch {
+		case actor.HasPermission(action):
+		case actor.HasTenantPermission(resource.TenantID, action):
+			narrow(ScopeTenant)
+		default:
+			return 0, false
+		}
+	}
+	return scope, true
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyRole(actor app.User, roles []string) bool {
+	for _, r := range roles {
+		if actor.HasRole(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyAuthorizer is an Authorizer evaluating a policy file, which can be reloaded while in use
+type PolicyAuthorizer struct {
+	file string
+
+	mu      sync.RWMutex
+	policy  Policy
+	modTime time.Time
+}
+
+// NewPolicyAuthorizer returns a PolicyAuthorizer for the given policy file, or for the default policy if file is
+// empty
+func NewPolicyAuthorizer(file string) (*PolicyAuthorizer, error) {
+	a := &PolicyAuthorizer{file: file, policy: DefaultPolicy()}
+	if file == "" {
+		return a, nil
+	}
+	if _, err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Authorize implements Authorizer
+func (a *PolicyAuthorizer) Authorize(actor app.User, action string, resource Resource) Decision {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.policy.Authorize(actor, action, resource)
+}
+
+// Reload reads the policy file if it changed since it was last read, and returns true if it did. An invalid file
+// is reported as an error, and the current policy stays in effect.
+func (a *PolicyAuthorizer) Reload() (bool, error) {
+	if a.file == "" {
+		return false, nil
+	}
+
+	info, err := os.Stat(a.file)
+	if err != nil {
+		return false, err
+	}
+
+	a.mu.RLock()
+	unchanged := info.ModTime().Equal(a.modTime)
+	a.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	b, err := os.ReadFile(a.file)
+	if err != nil {
+		return false, err
+	}
+	policy, err := ParsePolicy(b)
+	if err != nil {
+		return false, fmt.Errorf("policy file %s: %w", a.file, err)
+	}
+
+	a.mu.Lock()
+	a.policy = policy
+	a.modTime = info.ModTime()
+	a.mu.Unlock()
+	return true, nil
+}
+
+// StartReload checks the policy file for changes at the given interval until the returned function is called.
+// Each reload, successful or not, is reported to onReload.
+func (a *PolicyAuthorizer) StartReload(interval time.Duration, onReload func(error)) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if changed, err := a.Reload(); changed || err != nil {
+					onReload(err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
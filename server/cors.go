@@ -0,0 +1,130 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/keygo/db"
+)
+
+const corsMaxAge = 600
+
+var corsAllowMethods = strings.Join([]string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions,
+}, ",")
+
+// corsConfig holds the CORS policy read from the environment
+type corsConfig struct {
+	// allowedOrigins may call the API, but not with cookies
+	allowedOrigins map[string]bool
+
+	// trustedOrigins may call the API with cookies (credentials)
+	trustedOrigins map[string]bool
+}
+
+// loadCORSConfig reads the CORS policy from the environment:
+//
+//   - CORS_ALLOWED_ORIGINS: comma-separated origins allowed to call the API without credentials
+//   - CORS_TRUSTED_ORIGINS: comma-separated origins allowed to call the API with credentials
+//
+// Tenants can allow additional origins (without credentials) in their tenant settings. These may only call the API
+// routes of that tenant, i.e. /api/tenants/:id/...
+func loadCORSConfig() corsConfig {
+	config := corsConfig{
+		allowedOrigins: map[string]bool{},
+		trustedOrigins: map[string]bool{},
+	}
+	for _, o := range envList("CORS_ALLOWED_ORIGINS") {
+		config.allowedOrigins[o] = true
+	}
+	for _, o := range envList("CORS_TRUSTED_ORIGINS") {
+		config.trustedOrigins[o] = true
+	}
+	return config
+}
+
+// CORSMiddleware applies the CORS policy to API requests. Allowed preflight requests are answered here; others
+// fall through to the API routes, where AuthnSkipper lets OPTIONS requests through unauthenticated.
+func (s *Server) CORSMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		origin := req.Header.Get(echo.HeaderOrigin)
+		if origin == "" || !strings.HasPrefix(req.URL.Path, "/api/") {
+			return next(c)
+		}
+
+		res := c.Response()
+		res.Header().Add(echo.HeaderVary, echo.HeaderOrigin)
+
+		allowed, credentials := s.corsOriginAllowed(c, origin)
+		if !allowed {
+			return next(c)
+		}
+
+		res.Header().Set(echo.HeaderAccessControlAllowOrigin, origin)
+		if credentials {
+			res.Header().Set(echo.HeaderAccessControlAllowCredentials, "true")
+		}
+
+		if req.Method != http.MethodOptions || req.Header.Get(echo.HeaderAccessControlRequestMethod) == "" {
+			return next(c)
+		}
+
+		// preflight request
+		res.Header().Add(echo.HeaderVary, echo.HeaderAccessControlRequestMethod)
+		res.Header().Add(echo.HeaderVary, echo.HeaderAccessControlRequestHeaders)
+		res.Header().Set(echo.HeaderAccessControlAllowMethods, corsAllowMethods)
+		if h := req.Header.Get(echo.HeaderAccessControlRequestHeaders); h != "" {
+			res.Header().Set(echo.HeaderAccessControlAllowHeaders, h)
+		}
+		res.Header().Set(echo.HeaderAccessControlMaxAge, strconv.Itoa(corsMaxAge))
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// corsOriginAllowed reports whether the origin may call the API, and whether it may do so with credentials
+func (s *Server) corsOriginAllowed(c echo.Context, origin string) (allowed, credentials bool) {
+	if s.corsConfig.trustedOrigins[origin] {
+		return true, true
+	}
+	if s.corsConfig.allowedOrigins[origin] {
+		return true, false
+	}
+	tenantID := corsTenantID(c.Request().URL.Path)
+	if s.db == nil || tenantID == "" {
+		return false, false
+	}
+
+	allowed, err := db.TenantOriginAllowed(c, tenantID, origin)
+	if err != nil {
+		s.Logger.Errorf("error checking tenant CORS origins: %s", err)
+		return false, false
+	}
+	return allowed, false
+}
+
+// corsTenantID returns the ID of the tenant an API path is for, or "" if it is not a tenant's path. Tenant origins
+// are checked before authentication, and for preflight requests, which carry no token, so the path is all there is.
+func corsTenantID(path string) string {
+	rest, ok := strings.CutPrefix(path, "/api/tenants/")
+	if !ok {
+		return ""
+	}
+	id, _, _ := strings.Cut(rest, "/")
+	return id
+}
+
+// envList returns the comma-separated values of an environment variable, with whitespace and empty values removed
+func envList(key string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,71 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+)
+
+func (ts *TestSuite) Test_CORSMiddleware() {
+	tenant := ts.createTenantFixture()
+	const tenantOrigin = "https://app.tenant.example.com"
+	_, err := db.UpdateTenant(ts.ctx, tenant.ID, app.TenantUpdateInput{AllowedOrigins: &[]string{tenantOrigin}})
+	ts.NoError(err)
+
+	otherTenant := ts.createTenantFixture()
+
+	tests := []struct {
+		name            string
+		path            string
+		origin          string
+		wantStatus      int
+		wantAllowOrigin string
+	}{
+		{
+			name:            "tenant origin preflight",
+			path:            "/api/tenants/" + tenant.ID + "/groups",
+			origin:          tenantOrigin,
+			wantStatus:      http.StatusNoContent,
+			wantAllowOrigin: tenantOrigin,
+		},
+		{
+			name:       "tenant origin preflight for another tenant",
+			path:       "/api/tenants/" + otherTenant.ID + "/groups",
+			origin:     tenantOrigin,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "tenant origin preflight outside the tenant",
+			path:       "/api/tenants",
+			origin:     tenantOrigin,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "unknown origin preflight",
+			path:       "/api/tenants/" + tenant.ID + "/groups",
+			origin:     "https://evil.example.com",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		ts.Run(tt.name, func() {
+			req := httptest.NewRequest(http.MethodOptions, tt.path, nil)
+			req.Header.Set(echo.HeaderOrigin, tt.origin)
+			req.Header.Set(echo.HeaderAccessControlRequestMethod, http.MethodPost)
+			req.Header.Set(echo.HeaderAccessControlRequestHeaders, echo.HeaderAuthorization)
+
+			res := httptest.NewRecorder()
+			ts.server.ServeHTTP(res, req)
+
+			ts.Equal(tt.wantStatus, res.Code, "incorrect http status, body: \n%s", res.Body.String())
+			ts.Equal(tt.wantAllowOrigin, res.Header().Get(echo.HeaderAccessControlAllowOrigin))
+
+			// credentials are only allowed for trusted origins
+			ts.Empty(res.Header().Get(echo.HeaderAccessControlAllowCredentials))
+		})
+	}
+}
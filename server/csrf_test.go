@@ -0,0 +1,94 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+	"github.com/briskt/keygo/server"
+)
+
+func (ts *TestSuite) Test_CSRFMiddleware() {
+	admin := ts.createUserFixture(app.UserRoleAdmin)
+	sessionCookie := ts.createSessionCookieFixture(admin.Email)
+	const csrfToken = "0123456789abcdef0123456789abcdef"
+
+	tests := []struct {
+		name       string
+		bearer     string
+		session    bool
+		csrfCookie string
+		csrfHeader string
+		wantStatus int
+	}{
+		{
+			name:       "session without CSRF token",
+			session:    true,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "session with mismatched CSRF token",
+			session:    true,
+			csrfCookie: csrfToken,
+			csrfHeader: "wrong",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "session with CSRF token",
+			session:    true,
+			csrfCookie: csrfToken,
+			csrfHeader: csrfToken,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "bearer token is exempt",
+			bearer:     admin.Email,
+			session:    true,
+			wantStatus: http.StatusOK,
+		},
+	}
+	for i, tt := range tests {
+		ts.Run(tt.name, func() {
+			j, _ := json.Marshal(app.TenantCreateInput{Name: "csrf tenant " + string(rune('a'+i))})
+			req := httptest.NewRequest(http.MethodPost, "/api/tenants", bytes.NewReader(j))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			if tt.bearer != "" {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+tt.bearer)
+			}
+			if tt.session {
+				req.AddCookie(sessionCookie)
+			}
+			if tt.csrfCookie != "" {
+				req.AddCookie(&http.Cookie{Name: server.CSRFCookieName, Value: tt.csrfCookie})
+			}
+			if tt.csrfHeader != "" {
+				req.Header.Set(server.CSRFHeader, tt.csrfHeader)
+			}
+
+			res := httptest.NewRecorder()
+			ts.server.ServeHTTP(res, req)
+			ts.Equal(tt.wantStatus, res.Code, "incorrect http status, body: \n%s", res.Body.String())
+		})
+	}
+}
+
+// createSessionCookieFixture creates a server-side session holding the given token and returns its cookie
+func (ts *TestSuite) createSessionCookieFixture(token string) *http.Cookie {
+	store := db.NewSessionStore(ts.tx, []byte(os.Getenv("SESSION_SECRET")), nil)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	sess, err := store.New(req, "session")
+	ts.NoError(err)
+	sess.Values[server.SessionKeyToken] = token
+
+	res := httptest.NewRecorder()
+	ts.NoError(store.Save(req, res, sess))
+	cookies := res.Result().Cookies()
+	ts.Len(cookies, 1)
+	return cookies[0]
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+	"github.com/briskt/keygo/server/authz"
+)
+
+// elevationsListHandler lists all elevations to users allowed to list them, and otherwise only the user's own
+func (s *Server) elevationsListHandler(c echo.Context) error {
+	actor := app.CurrentUser(c)
+	var filter app.ElevationFilter
+	if status := c.QueryParam("status"); status != "" {
+		filter.Status = &status
+	}
+
+	d, err := s.decide(c, app.PermissionElevationsList, authz.Resource{Type: "elevations"})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+	if userID := c.QueryParam("user_id"); d.Allowed && userID != "" {
+		filter.UserID = &userID
+	} else if !d.Allowed {
+		filter.UserID = &actor.ID
+	}
+
+	elevations, err := db.FindElevations(c, filter)
+	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	out := make([]app.Elevation, len(elevations))
+	for i, e := range elevations {
+		if out[i], err = db.ConvertElevation(c, e); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, out)
+}
+
+func (s *Server) elevationsCreateHandler(c echo.Context) error {
+	var input app.ElevationCreateInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	actor := app.CurrentUser(c)
+	elevation, err := db.CreateElevation(c, actor.ID, input)
+	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s requested role %s for %d hours (elevation %s)", actor.ID, elevation.RoleID,
+		elevation.Hours, elevation.ID)
+
+	return s.respondElevation(c, elevation)
+}
+
+func (s *Server) elevationsApproveHandler(c echo.Context) error {
+	var input app.ElevationDecisionInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	actor := app.CurrentUser(c)
+	elevation, err := db.FindElevationByID(c, c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+	if elevation.UserID == actor.ID {
+		return echo.NewHTTPError(http.StatusForbidden, AuthError{Error: "cannot approve your own request"})
+	}
+	if !canGrant(actor, elevation.Role.Permissions) {
+		return echo.NewHTTPError(http.StatusForbidden, AuthError{Error: "cannot grant permissions you do not hold"})
+	}
+
+	elevation, err = db.ApproveElevation(c, elevation.ID, actor.ID, input)
+	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s approved elevation %s of user %s to role %s until %s", actor.ID, elevation.ID,
+		elevation.UserID, elevation.RoleID, elevation.ExpiresAt)
+
+	return s.respondElevation(c, elevation)
+}
+
+func (s *Server) elevationsDenyHandler(c echo.Context) error {
+	var input app.ElevationDecisionInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	actor := app.CurrentUser(c)
+	elevation, err := db.DenyElevation(c, c.Param("id"), actor.ID, input)
+	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+
+	s.Logger.Infof("user %s denied elevation %s of user %s", actor.ID, elevation.ID, elevation.UserID)
+
+	return s.respondElevation(c, elevation)
+}
+
+// elevationsRevokeHandler ends an elevation early. Users may revoke their own; others need to be allowed to approve
+// elevations.
+func (s *Server) elevationsRevokeHandler(c echo.Context) error {
+	actor := app.CurrentUser(c)
+	id := c.Param("id")
+
+	d, err := s.decide(c, app.PermissionElevationsApprove, authz.Resource{Type: "elevations", ID: id})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+	elevation, err := db.FindElevationByID(c, id)
+	if err != nil || (!d.Allowed && elevation.UserID != actor.ID) {
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+
+	elevation, err = db.RevokeElevation(c, id, actor.ID)
+	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s revoked elevation %s of user %s", actor.ID, elevation.ID, elevation.UserID)
+
+	return s.respondElevation(c, elevation)
+}
+
+func (s *Server) respondElevation(c echo.Context, elevation db.Elevation) error {
+	e, err := db.ConvertElevation(c, elevation)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, e)
+}
@@ -0,0 +1,110 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+)
+
+func (ts *TestSuite) Test_elevations() {
+	role, err := db.CreateRole(ts.ctx, app.RoleCreateInput{
+		Name:        "Tenant Viewer " + RandStr(6),
+		Permissions: []string{app.PermissionTenantsList},
+	})
+	ts.NoError(err)
+
+	user := ts.createUserFixture(app.UserRoleBasic)
+	other := ts.createUserFixture(app.UserRoleBasic)
+	admin := ts.createUserFixture(app.UserRoleAdmin)
+
+	_, status := ts.request(http.MethodGet, "/api/tenants", user.Email, nil)
+	ts.Equal(http.StatusNotFound, status)
+
+	body, status := ts.request(http.MethodPost, "/api/elevations", user.Email,
+		app.ElevationCreateInput{RoleID: role.ID, Hours: 1, Justification: "incident 42"})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var elevation app.Elevation
+	ts.NoError(json.Unmarshal(body, &elevation))
+	ts.Equal(app.ElevationStatusPending, elevation.Status)
+	ts.Equal(user.Email, elevation.UserEmail)
+
+	path := "/api/elevations/" + elevation.ID
+
+	_, status = ts.request(http.MethodPost, path+"/approve", user.Email, app.ElevationDecisionInput{})
+	ts.Equal(http.StatusNotFound, status, "a user cannot approve without permission")
+
+	_, status = ts.request(http.MethodPost, path+"/revoke", other.Email, nil)
+	ts.Equal(http.StatusNotFound, status, "another user cannot revoke the request")
+
+	body, status = ts.request(http.MethodGet, "/api/elevations", other.Email, nil)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var elevations []app.Elevation
+	ts.NoError(json.Unmarshal(body, &elevations))
+	ts.Empty(elevations, "users only see their own requests")
+
+	body, status = ts.request(http.MethodPost, path+"/approve", admin.Email, app.ElevationDecisionInput{Note: "ok"})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	ts.NoError(json.Unmarshal(body, &elevation))
+	ts.Equal(app.ElevationStatusActive, elevation.Status)
+	ts.Equal(admin.ID, elevation.ApproverID)
+
+	_, status = ts.request(http.MethodGet, "/api/tenants", user.Email, nil)
+	ts.Equal(http.StatusOK, status, "an active elevation grants the role's permissions")
+
+	body, status = ts.request(http.MethodGet, "/api/elevations?status=active&user_id="+user.ID, admin.Email, nil)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	ts.NoError(json.Unmarshal(body, &elevations))
+	ts.Len(elevations, 1)
+
+	body, status = ts.request(http.MethodPost, path+"/revoke", user.Email, nil)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	ts.NoError(json.Unmarshal(body, &elevation))
+	ts.Equal(app.ElevationStatusRevoked, elevation.Status)
+
+	_, status = ts.request(http.MethodGet, "/api/tenants", user.Email, nil)
+	ts.Equal(http.StatusNotFound, status, "a revoked elevation grants nothing")
+}
+
+func (ts *TestSuite) Test_elevationsApproveHandler_escalation() {
+	approverRole, err := db.CreateRole(ts.ctx, app.RoleCreateInput{
+		Name:        "Approver " + RandStr(6),
+		Permissions: []string{app.PermissionElevationsApprove},
+	})
+	ts.NoError(err)
+	approver := ts.createUserFixture(app.UserRoleBasic)
+	_, err = db.AssignUserRole(ts.ctx, approver.ID, app.UserRoleAssignInput{RoleID: approverRole.ID})
+	ts.NoError(err)
+
+	roles, err := db.FindRoles(ts.ctx, app.RoleFilter{})
+	ts.NoError(err)
+	var adminRoleID string
+	for _, r := range roles {
+		if r.Name == app.UserRoleAdmin {
+			adminRoleID = r.ID
+		}
+	}
+
+	body, status := ts.request(http.MethodPost, "/api/elevations", approver.Email,
+		app.ElevationCreateInput{RoleID: approverRole.ID + "x", Hours: 1, Justification: "x"})
+	ts.Equal(http.StatusBadRequest, status, "body: %s", body)
+
+	user := ts.createUserFixture(app.UserRoleBasic)
+	body, status = ts.request(http.MethodPost, "/api/elevations", user.Email,
+		app.ElevationCreateInput{RoleID: adminRoleID, Hours: 1, Justification: "x"})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var elevation app.Elevation
+	ts.NoError(json.Unmarshal(body, &elevation))
+
+	_, status = ts.request(http.MethodPost, "/api/elevations/"+elevation.ID+"/approve", approver.Email, nil)
+	ts.Equal(http.StatusForbidden, status, "an approver cannot grant permissions they do not hold")
+
+	body, status = ts.request(http.MethodPost, "/api/elevations", approver.Email,
+		app.ElevationCreateInput{RoleID: adminRoleID, Hours: 1, Justification: "x"})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	ts.NoError(json.Unmarshal(body, &elevation))
+
+	_, status = ts.request(http.MethodPost, "/api/elevations/"+elevation.ID+"/approve", approver.Email, nil)
+	ts.Equal(http.StatusForbidden, status, "an approver cannot approve their own request")
+}
@@ -0,0 +1,14 @@
+package server
+
+import (
+	"context"
+
+	"github.com/briskt/keygo/server/oauth"
+)
+
+// SetLogoutTokenVerifier replaces the back-channel logout token verifier until the returned function is called
+func SetLogoutTokenVerifier(f func(ctx context.Context, raw string) (oauth.LogoutClaims, error)) (restore func()) {
+	previous := verifyLogoutToken
+	verifyLogoutToken = f
+	return func() { verifyLogoutToken = previous }
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+)
+
+func (s *Server) tenantsGroupsListHandler(c echo.Context) error {
+	groups, err := db.FindGroups(c, c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	out, err := db.ConvertGroups(c, groups)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, out)
+}
+
+func (s *Server) tenantsGroupsGetHandler(c echo.Context) error {
+	group, err := db.FindGroupByID(c, c.Param("id"), c.Param("group_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+
+	g, err := db.ConvertGroup(c, group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, g)
+}
+
+func (s *Server) tenantsGroupsCreateHandler(c echo.Context) error {
+	var input app.GroupCreateInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	tenantID := c.Param("id")
+	group, err := db.CreateGroup(c, tenantID, input)
+	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	if err = checkGroupGrants(c, tenantID, group.ID); err != nil {
+		return err
+	}
+
+	g, err := db.ConvertGroup(c, group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	s.Logger.Infof("created group (name %q, id %q) in tenant %s", group.Name, group.ID, tenantID)
+
+	return c.JSON(http.StatusOK, g)
+}
+
+func (s *Server) tenantsGroupsUpdateHandler(c echo.Context) error {
+	var input app.GroupUpdateInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	tenantID := c.Param("id")
+	group, err := db.UpdateGroup(c, tenantID, c.Param("group_id"), input)
+	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+
+	if err = checkGroupGrants(c, tenantID, group.ID); err != nil {
+		return err
+	}
+
+	g, err := db.ConvertGroup(c, group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	s.Logger.Infof("updated group (name %q, id %q) in tenant %s", group.Name, group.ID, tenantID)
+
+	return c.JSON(http.StatusOK, g)
+}
+
+func (s *Server) tenantsGroupsDeleteHandler(c echo.Context) error {
+	tenantID := c.Param("id")
+	groupID := c.Param("group_id")
+	if err := db.DeleteGroup(c, tenantID, groupID); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+
+	s.Logger.Infof("user %s deleted group %s in tenant %s", app.CurrentUser(c).ID, groupID, tenantID)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (s *Server) tenantsGroupsMembersAddHandler(c echo.Context) error {
+	var input app.GroupMemberAddInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	tenantID := c.Param("id")
+	groupID := c.Param("group_id")
+	if err = db.AddGroupMember(c, tenantID, groupID, input); err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+
+	// adding a member grants them the permissions of the group
+	if err = checkGroupGrants(c, tenantID, groupID); err != nil {
+		return err
+	}
+
+	group, err := db.FindGroupByID(c, tenantID, groupID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	g, err := db.ConvertGroup(c, group)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	s.Logger.Infof("user %s added user %s to group %s in tenant %s", app.CurrentUser(c).ID, input.UserID, groupID,
+		tenantID)
+
+	return c.JSON(http.StatusOK, g)
+}
+
+func (s *Server) tenantsGroupsMembersDeleteHandler(c echo.Context) error {
+	tenantID := c.Param("id")
+	groupID := c.Param("group_id")
+	userID := c.Param("user_id")
+	if err := db.RemoveGroupMember(c, tenantID, groupID, userID); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+
+	s.Logger.Infof("user %s removed user %s from group %s in tenant %s", app.CurrentUser(c).ID, userID, groupID,
+		tenantID)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// checkGroupGrants returns an HTTP error unless the current user holds every permission the group grants, including
+// those inherited from its ancestors, preventing privilege escalation through group management
+func checkGroupGrants(c echo.Context, tenantID, groupID string) error {
+	permissions, err := db.FindGroupPermissions(c, tenantID, groupID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+	if !canGrantInTenant(app.CurrentUser(c), tenantID, permissions) {
+		return echo.NewHTTPError(http.StatusForbidden, AuthError{Error: "cannot grant permissions you do not hold"})
+	}
+	return nil
+}
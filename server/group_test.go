@@ -0,0 +1,74 @@
+package server_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+)
+
+func (ts *TestSuite) Test_tenantsGroups() {
+	tenant := ts.createTenantFixture()
+	otherTenant := ts.createTenantFixture()
+	tenantAdmin := ts.createTenantUserFixture(tenant.ID, app.UserRoleTenantAdmin)
+	member := ts.createTenantUserFixture(tenant.ID, app.UserRoleBasic)
+	outsider := ts.createTenantUserFixture(otherTenant.ID, app.UserRoleTenantAdmin)
+
+	groupsPath := fmt.Sprintf("/api/tenants/%s/groups", tenant.ID)
+
+	// Only tenant administrators of the tenant may manage its groups
+	_, status := ts.request(http.MethodGet, groupsPath, member.Email, nil)
+	ts.Equal(http.StatusNotFound, status)
+	_, status = ts.request(http.MethodGet, groupsPath, outsider.Email, nil)
+	ts.Equal(http.StatusNotFound, status)
+
+	// A tenant administrator cannot grant permissions they do not hold
+	input := app.GroupCreateInput{Name: "Auditors", Permissions: []string{app.PermissionOwnTenantRead}}
+	body, status := ts.request(http.MethodPost, groupsPath, tenantAdmin.Email, input)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var group app.Group
+	ts.NoError(json.Unmarshal(body, &group))
+	ts.Equal(tenant.ID, group.TenantID)
+
+	adminRole := app.UserRoleAdmin
+	roles, err := db.FindRoles(ts.ctx, app.RoleFilter{Name: &adminRole})
+	ts.NoError(err)
+	body, status = ts.request(http.MethodPost, groupsPath, tenantAdmin.Email,
+		app.GroupCreateInput{Name: "Admins", RoleID: roles[0].ID})
+	ts.Equal(http.StatusForbidden, status, "body: %s", body)
+
+	// Membership in a group grants its permissions
+	membersPath := fmt.Sprintf("%s/%s/members", groupsPath, group.ID)
+	body, status = ts.request(http.MethodPost, membersPath, tenantAdmin.Email,
+		app.GroupMemberAddInput{UserID: member.ID})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+
+	tenantPath := fmt.Sprintf("/api/tenants/%s", tenant.ID)
+	_, status = ts.request(http.MethodGet, tenantPath, member.Email, nil)
+	ts.Equal(http.StatusOK, status)
+
+	// A user outside the tenant cannot be added
+	_, status = ts.request(http.MethodPost, membersPath, tenantAdmin.Email,
+		app.GroupMemberAddInput{UserID: outsider.ID})
+	ts.Equal(http.StatusBadRequest, status)
+
+	newName := "Readers"
+	body, status = ts.request(http.MethodPut, groupsPath+"/"+group.ID, tenantAdmin.Email,
+		app.GroupUpdateInput{Name: &newName})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	ts.NoError(json.Unmarshal(body, &group))
+	ts.Equal(newName, group.Name)
+	ts.Equal([]string{member.ID}, group.MemberIDs)
+
+	_, status = ts.request(http.MethodDelete, membersPath+"/"+member.ID, tenantAdmin.Email, nil)
+	ts.Equal(http.StatusNoContent, status)
+	_, status = ts.request(http.MethodGet, tenantPath, member.Email, nil)
+	ts.Equal(http.StatusNotFound, status)
+
+	_, status = ts.request(http.MethodDelete, groupsPath+"/"+group.ID, tenantAdmin.Email, nil)
+	ts.Equal(http.StatusNoContent, status)
+	_, status = ts.request(http.MethodGet, groupsPath+"/"+group.ID, tenantAdmin.Email, nil)
+	ts.Equal(http.StatusNotFound, status)
+}
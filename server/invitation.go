@@ -0,0 +1,179 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+)
+
+// InvitationAcceptPath is the UI page linked from invitations, which accepts the invitation given in the "token"
+// query parameter
+const InvitationAcceptPath = "/invitations/accept"
+
+func (s *Server) tenantsInvitationsListHandler(c echo.Context) error {
+	tenantID := c.Param("id")
+	invitations, err := db.FindTenantInvitations(c, app.InvitationFilter{TenantID: &tenantID})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	out := make([]app.Invitation, len(invitations))
+	for i, inv := range invitations {
+		if out[i], err = db.ConvertTenantInvitation(c, inv); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, out)
+}
+
+func (s *Server) tenantsInvitationsCreateHandler(c echo.Context) error {
+	var input app.InvitationCreateInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	tenantID := c.Param("id")
+	actor := app.CurrentUser(c)
+	if input.RoleID != "" {
+		role, err := db.FindRoleByID(c, input.RoleID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: "role does not exist"})
+		}
+		if !canGrantInTenant(actor, tenantID, role.Permissions) {
+			return echo.NewHTTPError(http.StatusForbidden, AuthError{Error: "cannot grant permissions you do not hold"})
+		}
+	}
+
+	invitation, err := db.CreateTenantInvitation(c, tenantID, actor.ID, input)
+	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s invited %q to tenant %s (invitation %s)", actor.ID, invitation.Email, tenantID,
+		invitation.ID)
+
+	return s.sendInvitation(c, invitation)
+}
+
+func (s *Server) tenantsInvitationsResendHandler(c echo.Context) error {
+	tenantID := c.Param("id")
+	invitation, err := db.FindTenantInvitationByID(c, tenantID, c.Param("invitation_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+
+	// resending issues a new token, so it grants the role again, possibly on behalf of a more privileged inviter
+	if !canGrantInTenant(app.CurrentUser(c), tenantID, invitation.Role.Permissions) {
+		return echo.NewHTTPError(http.StatusForbidden, AuthError{Error: "cannot grant permissions you do not hold"})
+	}
+
+	invitation, err = db.ResendTenantInvitation(c, tenantID, invitation.ID)
+	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+
+	s.Logger.Infof("user %s resent invitation %s", app.CurrentUser(c).ID, invitation.ID)
+
+	return s.sendInvitation(c, invitation)
+}
+
+func (s *Server) tenantsInvitationsRevokeHandler(c echo.Context) error {
+	invitation, err := db.RevokeTenantInvitation(c, c.Param("id"), c.Param("invitation_id"))
+	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+
+	inv, err := db.ConvertTenantInvitation(c, invitation)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	s.Logger.Infof("user %s revoked invitation %s", app.CurrentUser(c).ID, invitation.ID)
+
+	return c.JSON(http.StatusOK, inv)
+}
+
+func (s *Server) invitationsAcceptHandler(c echo.Context) error {
+	var input app.InvitationAcceptInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	// the invitation belongs to a tenant the user is not yet a member of
+	if err = bypassRLS(c, "accept invitation"); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	user := app.CurrentUser(c)
+	membership, err := db.AcceptTenantInvitation(c, user.ID, input)
+	if err != nil {
+		switch app.ErrorCode(err) {
+		case app.ERR_INVALID:
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		case app.ERR_NOTFOUND:
+			return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	m, err := db.ConvertTenantMembership(c, membership)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	s.Logger.Infof("user %s accepted an invitation to tenant %s", user.ID, m.TenantID)
+
+	return c.JSON(http.StatusOK, m)
+}
+
+// sendInvitation queues an email with the invitation link to the invitee, and responds with the invitation
+func (s *Server) sendInvitation(c echo.Context, invitation db.TenantInvitation) error {
+	inv, err := db.ConvertTenantInvitation(c, invitation)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	data := invitationEmail{
+		TenantName:   inv.TenantName,
+		Role:         inv.Role,
+		InviterEmail: app.CurrentUser(c).Email,
+		URL:          invitationURL(invitation.Token),
+		ExpiresAt:    inv.ExpiresAt,
+	}
+	if err = queueEmail(c, inv.Email, "invitation", data); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, inv)
+}
+
+// invitationEmail is the data of the invitation email template
+type invitationEmail struct {
+	TenantName   string
+	Role         string
+	InviterEmail string
+	URL          string
+	ExpiresAt    time.Time
+}
+
+// invitationURL returns the link to accept an invitation
+func invitationURL(token string) string {
+	return env("HOST", false) + InvitationAcceptPath + "?token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,166 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+	"github.com/briskt/keygo/server"
+)
+
+func (ts *TestSuite) Test_tenantsInvitations() {
+	tenant := ts.createTenantFixture()
+	tenantAdmin := ts.createTenantUserFixture(tenant.ID, app.UserRoleTenantAdmin)
+	member := ts.createTenantUserFixture(tenant.ID, app.UserRoleBasic)
+
+	path := fmt.Sprintf("/api/tenants/%s/invitations", tenant.ID)
+
+	_, status := ts.request(http.MethodPost, path, member.Email, app.InvitationCreateInput{Email: "new@example.com"})
+	ts.Equal(http.StatusNotFound, status, "a member cannot invite")
+
+	body, status := ts.request(http.MethodPost, path, tenantAdmin.Email,
+		app.InvitationCreateInput{Email: "New@Example.com"})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var invitation app.Invitation
+	ts.NoError(json.Unmarshal(body, &invitation))
+	ts.Equal("new@example.com", invitation.Email)
+	ts.Equal(app.UserRoleBasic, invitation.Role)
+	ts.Equal(tenantAdmin.ID, invitation.InviterID)
+	ts.Equal(app.InvitationStatusPending, invitation.Status)
+
+	_, status = ts.request(http.MethodPost, path, tenantAdmin.Email, app.InvitationCreateInput{Email: "new@example.com"})
+	ts.Equal(http.StatusBadRequest, status, "an address cannot have two pending invitations")
+
+	_, status = ts.request(http.MethodPost, path, tenantAdmin.Email, app.InvitationCreateInput{Email: member.Email})
+	ts.Equal(http.StatusBadRequest, status, "a member cannot be invited")
+
+	roles, err := db.FindRoles(ts.ctx, app.RoleFilter{})
+	ts.NoError(err)
+	for _, r := range roles {
+		if r.Name == app.UserRoleAdmin {
+			_, status = ts.request(http.MethodPost, path, tenantAdmin.Email,
+				app.InvitationCreateInput{Email: "admin@example.com", RoleID: r.ID})
+			ts.Equal(http.StatusForbidden, status, "a tenant admin cannot invite a global admin")
+
+			adminInvitation, err := db.CreateTenantInvitation(ts.ctx, tenant.ID, "",
+				app.InvitationCreateInput{Email: "admin@example.com", RoleID: r.ID})
+			ts.NoError(err)
+			_, status = ts.request(http.MethodPost, path+"/"+adminInvitation.ID+"/resend", tenantAdmin.Email, nil)
+			ts.Equal(http.StatusForbidden, status, "a tenant admin cannot resend an invitation of a global admin")
+			ts.NoError(ts.tx.Delete(&adminInvitation).Error)
+		}
+	}
+
+	body, status = ts.request(http.MethodPost, path+"/"+invitation.ID+"/resend", tenantAdmin.Email, nil)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+
+	body, status = ts.request(http.MethodGet, path, tenantAdmin.Email, nil)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var invitations []app.Invitation
+	ts.NoError(json.Unmarshal(body, &invitations))
+	ts.Len(invitations, 1)
+
+	body, status = ts.request(http.MethodDelete, path+"/"+invitation.ID, tenantAdmin.Email, nil)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	ts.NoError(json.Unmarshal(body, &invitation))
+	ts.Equal(app.InvitationStatusRevoked, invitation.Status)
+
+	_, status = ts.request(http.MethodPost, path+"/"+invitation.ID+"/resend", tenantAdmin.Email, nil)
+	ts.Equal(http.StatusBadRequest, status, "a revoked invitation cannot be resent")
+}
+
+func (ts *TestSuite) Test_invitationsAcceptHandler() {
+	tenant := ts.createTenantFixture()
+	otherTenant := ts.createTenantFixture()
+	invitee := ts.createTenantUserFixture(otherTenant.ID, app.UserRoleBasic)
+	someoneElse := ts.createUserFixture(app.UserRoleBasic)
+
+	invitation, err := db.CreateTenantInvitation(ts.ctx, tenant.ID, "", app.InvitationCreateInput{Email: invitee.Email})
+	ts.NoError(err)
+	input := app.InvitationAcceptInput{Token: invitation.Token}
+
+	_, status := ts.request(http.MethodPost, "/api/invitations/accept", someoneElse.Email, input)
+	ts.Equal(http.StatusNotFound, status, "the invitation is bound to the invitee's email address")
+
+	_, status = ts.request(http.MethodPost, "/api/invitations/accept", invitee.Email,
+		app.InvitationAcceptInput{Token: "wrong"})
+	ts.Equal(http.StatusNotFound, status)
+
+	body, status := ts.request(http.MethodPost, "/api/invitations/accept", invitee.Email, input)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var membership app.TenantMembership
+	ts.NoError(json.Unmarshal(body, &membership))
+	ts.Equal(tenant.ID, membership.TenantID)
+	ts.Equal(invitee.ID, membership.UserID)
+
+	_, status = ts.request(http.MethodPost, "/api/invitations/accept", invitee.Email, input)
+	ts.Equal(http.StatusBadRequest, status, "the token can be used only once")
+
+	accepted, err := db.FindTenantInvitationByID(ts.ctx, tenant.ID, invitation.ID)
+	ts.NoError(err)
+	ts.NotNil(accepted.AcceptedAt)
+	ts.Equal(invitee.ID, *accepted.AcceptedByID)
+}
+
+func (ts *TestSuite) Test_tenantsInvitationsCreateHandler_email() {
+	tenant := ts.createTenantFixture()
+	tenantAdmin := ts.createTenantUserFixture(tenant.ID, app.UserRoleTenantAdmin)
+	member := ts.createTenantUserFixture(tenant.ID, app.UserRoleBasic)
+	ts.NoError(ts.tx.Exec("DELETE FROM email_outbox").Error)
+
+	// the invitation link holds the secret token, so it is only emailed, never logged
+	var logs bytes.Buffer
+	level := ts.server.Logger.Level()
+	ts.server.Logger.SetOutput(&logs)
+	ts.server.Logger.SetLevel(log.INFO)
+	defer func() {
+		ts.server.Logger.SetOutput(os.Stdout)
+		ts.server.Logger.SetLevel(level)
+	}()
+
+	path := fmt.Sprintf("/api/tenants/%s/invitations", tenant.ID)
+	_, status := ts.request(http.MethodPost, path, tenantAdmin.Email, app.InvitationCreateInput{Email: member.Email})
+	ts.Equal(http.StatusBadRequest, status)
+
+	_, status = ts.request(http.MethodPost, path, tenantAdmin.Email, app.InvitationCreateInput{Email: "new@example.com"})
+	ts.Equal(http.StatusOK, status)
+
+	var emails []db.OutboxEmail
+	ts.NoError(ts.tx.Find(&emails).Error)
+	ts.Len(emails, 1, "only the committed request should queue email")
+	ts.Equal("new@example.com", emails[0].ToAddress)
+	ts.Contains(emails[0].TextBody, "/invitations/accept?token=")
+	ts.Contains(emails[0].TextBody, tenantAdmin.Email)
+	ts.Contains(logs.String(), "invited \"new@example.com\"")
+	ts.NotContains(logs.String(), "token=")
+
+	// Email queued by a request that then fails is rolled back, whether the handler returns an error or writes an
+	// error response
+	e := echo.New()
+	e.Use(server.TxMiddleware(ts.tx, nil))
+	e.POST("/error", func(c echo.Context) error {
+		ts.NoError(db.QueueEmail(c, app.Email{To: "error@example.com", Subject: "invitation"}))
+		return echo.NewHTTPError(http.StatusConflict)
+	})
+	e.POST("/response", func(c echo.Context) error {
+		ts.NoError(db.QueueEmail(c, app.Email{To: "response@example.com", Subject: "invitation"}))
+		return c.JSON(http.StatusBadRequest, server.AuthError{Error: "invalid"})
+	})
+	for _, p := range []string{"/error", "/response"} {
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, httptest.NewRequest(http.MethodPost, p, nil))
+		ts.GreaterOrEqual(res.Code, http.StatusBadRequest, p)
+	}
+
+	var after []db.OutboxEmail
+	ts.NoError(ts.tx.Find(&after).Error)
+	ts.Len(after, 1, "email queued by a failed request should be rolled back")
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+)
+
+// ipExtractor returns the client IP extractor. If TRUSTED_PROXIES lists the networks (CIDRs) of the reverse
+// proxies in front of the server, the client IP is taken from the X-Forwarded-For header added by those proxies.
+// Otherwise, the address of the direct peer is used.
+func ipExtractor() (echo.IPExtractor, error) {
+	proxies := envList("TRUSTED_PROXIES")
+	if len(proxies) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+
+	// trust only the configured proxies, not the defaults of loopback, link-local, and private networks
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, p := range proxies {
+		_, ipNet, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q: %w", p, err)
+		}
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
+
+// checkTenantNetwork returns an error if a tenant restricts API access to networks that do not include the client
+// IP. It is checked for the user's active tenant on every request, and for the tenant of a tenant route. Global
+// admins are exempt. A tenant that is not found is left to the handler to respond to.
+func (s *Server) checkTenantNetwork(c echo.Context, user app.User, tenantID string) error {
+	if tenantID == "" {
+		return nil
+	}
+
+	tenant, err := db.FindTenantByID(c, tenantID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+	if len(tenant.AllowedCIDRs) == 0 {
+		return nil
+	}
+
+	ip := c.RealIP()
+	if ipAllowed(ip, tenant.AllowedCIDRs) {
+		return nil
+	}
+
+	if user.HasPermission(app.PermissionTenantsNetworkBypass) {
+		s.Logger.Infof("user %s bypassed tenant %s network restriction from %s", user.ID, tenant.ID, ip)
+		return nil
+	}
+
+	s.Logger.Warnf("user %s of tenant %s denied access from %s", user.ID, tenant.ID, ip)
+	return echo.NewHTTPError(http.StatusForbidden, AuthError{Error: "access from this network is not allowed"})
+}
+
+// ipAllowed returns true if ip is within any of the given CIDRs
+func ipAllowed(ip string, cidrs []string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package server_test
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+)
+
+func (ts *TestSuite) Test_tenantNetworkRestriction() {
+	admin := ts.createUserFixture(app.UserRoleAdmin)
+
+	// httptest requests come from 192.0.2.1
+	tests := []struct {
+		name       string
+		cidrs      []string
+		role       string
+		wantStatus int
+	}{
+		{
+			name:       "no restriction",
+			cidrs:      []string{},
+			role:       app.UserRoleBasic,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "allowed network",
+			cidrs:      []string{"203.0.113.0/24", "192.0.2.0/24"},
+			role:       app.UserRoleBasic,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "other network",
+			cidrs:      []string{"203.0.113.0/24"},
+			role:       app.UserRoleBasic,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "admin bypass",
+			cidrs:      []string{"203.0.113.0/24"},
+			role:       app.UserRoleAdmin,
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		ts.Run(tt.name, func() {
+			tenant := ts.createTenantFixture()
+			_, err := db.UpdateTenant(ts.ctx, tenant.ID, app.TenantUpdateInput{AllowedCIDRs: &tt.cidrs})
+			ts.NoError(err)
+
+			user, err := db.CreateUser(ts.ctx, app.UserCreateInput{
+				Email:    fmt.Sprintf("test%s@example.com", RandStr(6)),
+				Role:     tt.role,
+				TenantID: tenant.ID,
+			})
+			ts.NoError(err)
+			ts.createTokenFixture(user.Email, user.ID)
+
+			body, status := ts.request(http.MethodGet, "/api/users/"+user.ID, user.Email, nil)
+			ts.Equal(tt.wantStatus, status, "incorrect http status, body: \n%s", body)
+		})
+	}
+
+	// CIDRs are validated
+	_, status := ts.request(http.MethodPut, "/api/tenants/"+ts.createTenantFixture().ID, admin.Email,
+		app.TenantUpdateInput{AllowedCIDRs: &[]string{"192.0.2.1"}})
+	ts.Equal(http.StatusBadRequest, status)
+}
+
+func (ts *TestSuite) Test_tenantNetworkRestriction_otherTenant() {
+	open := ts.createTenantFixture()
+	restricted := ts.createTenantFixture()
+	cidrs := []string{"203.0.113.0/24"}
+	_, err := db.UpdateTenant(ts.ctx, restricted.ID, app.TenantUpdateInput{AllowedCIDRs: &cidrs})
+	ts.NoError(err)
+
+	// the unrestricted tenant is active, by being the first membership
+	user := ts.createTenantUserFixture(open.ID, app.UserRoleTenantAdmin)
+	_, err = db.CreateTenantMembership(ts.ctx, app.TenantMembershipCreateInput{
+		TenantID: restricted.ID,
+		UserID:   user.ID,
+		Role:     app.UserRoleTenantAdmin,
+	})
+	ts.NoError(err)
+
+	body, status := ts.request(http.MethodGet, "/api/tenants/"+open.ID, user.Email, nil)
+	ts.Equal(http.StatusOK, status, "incorrect http status, body: \n%s", body)
+
+	body, status = ts.request(http.MethodGet, "/api/tenants/"+restricted.ID, user.Email, nil)
+	ts.Equal(http.StatusForbidden, status, "the restricted tenant is checked even if not active, body: \n%s", body)
+
+	body, status = ts.request(http.MethodGet, "/api/tenants/"+restricted.ID+"/keys", user.Email, nil)
+	ts.Equal(http.StatusForbidden, status, "incorrect http status, body: \n%s", body)
+
+	admin := ts.createUserFixture(app.UserRoleAdmin)
+	body, status = ts.request(http.MethodGet, "/api/tenants/unknown", admin.Email, nil)
+	ts.Equal(http.StatusNotFound, status, "an unknown tenant is not found, body: \n%s", body)
+}
@@ -0,0 +1,274 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+	"github.com/briskt/keygo/keys"
+)
+
+func (s *Server) tenantsKeysListHandler(c echo.Context) error {
+	rings, err := db.FindKeyRings(c, c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	out := make([]app.KeyRing, len(rings))
+	for i, r := range rings {
+		if out[i], err = db.ConvertKeyRing(c, r); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, out)
+}
+
+func (s *Server) tenantsKeysGetHandler(c echo.Context) error {
+	ring, err := db.FindKeyRingByName(c, c.Param("id"), c.Param("name"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+	return s.respondKeyRing(c, ring)
+}
+
+func (s *Server) tenantsKeysCreateHandler(c echo.Context) error {
+	var input app.KeyRingCreateInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	tenantID := c.Param("id")
+	ring, err := db.CreateKeyRing(c, tenantID, s.barrier, input)
+	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s created %s key %q (id %s) in tenant %s", app.CurrentUser(c).ID, ring.Type, ring.Name,
+		ring.ID, tenantID)
+
+	return s.respondKeyRing(c, ring)
+}
+
+func (s *Server) tenantsKeysRotateHandler(c echo.Context) error {
+	ring, err := db.RotateKeyRing(c, c.Param("id"), c.Param("name"), s.barrier)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s rotated key %s to version %d", app.CurrentUser(c).ID, ring.ID, ring.LatestVersion)
+
+	return s.respondKeyRing(c, ring)
+}
+
+func (s *Server) tenantsKeysEncryptHandler(c echo.Context) error {
+	var input app.EncryptInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+	if err = input.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+	}
+	plaintext, _ := base64.StdEncoding.DecodeString(input.Plaintext)
+	additionalData, _ := base64.StdEncoding.DecodeString(input.Context)
+
+	key, version, err := db.FindKey(c, c.Param("id"), c.Param("name"), 0, s.barrier)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	case app.ErrorCode(err) == app.ERR_INVALID:
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+	case err != nil:
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	sealed, err := keys.Seal(key, plaintext, additionalData)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, app.EncryptOutput{
+		Ciphertext: keys.FormatCiphertext(version, sealed),
+		KeyVersion: version,
+	})
+}
+
+func (s *Server) tenantsKeysDecryptHandler(c echo.Context) error {
+	var input app.DecryptInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+	if err = input.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+	}
+	additionalData, _ := base64.StdEncoding.DecodeString(input.Context)
+
+	// the ciphertext names the key version it was encrypted with, so data encrypted before a rotation still decrypts
+	version, sealed, err := keys.ParseCiphertext(input.Ciphertext)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: err.Error()})
+	}
+
+	key, _, err := db.FindKey(c, c.Param("id"), c.Param("name"), version, s.barrier)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	case app.ErrorCode(err) == app.ERR_NOTFOUND:
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: keys.ErrDecrypt.Error()})
+	case app.ErrorCode(err) == app.ERR_INVALID:
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+	case err != nil:
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	plaintext, err := keys.Open(key, sealed, additionalData)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, app.DecryptOutput{Plaintext: base64.StdEncoding.EncodeToString(plaintext)})
+}
+
+func (s *Server) tenantsKeysSignHandler(c echo.Context) error {
+	var input app.SignInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+	if err = input.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+	}
+	message, _ := base64.StdEncoding.DecodeString(input.Input)
+
+	private, version, err := db.FindSigningKey(c, c.Param("id"), c.Param("name"), 0, s.barrier)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	case app.ErrorCode(err) == app.ERR_INVALID:
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+	case err != nil:
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	signature, err := keys.Sign(private, message)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, app.SignOutput{
+		Signature:  keys.FormatSignature(version, signature),
+		KeyVersion: version,
+	})
+}
+
+// tenantsKeysVerifyHandler verifies a signature with the public key of the version that made it. An invalid
+// signature is not an error, but a false result.
+func (s *Server) tenantsKeysVerifyHandler(c echo.Context) error {
+	var input app.VerifyInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+	if err = input.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+	}
+	message, _ := base64.StdEncoding.DecodeString(input.Input)
+
+	// the signature names the key version that made it, so signatures made before a rotation still verify
+	version, signature, err := keys.ParseSignature(input.Signature)
+	if err != nil {
+		return c.JSON(http.StatusOK, app.VerifyOutput{Valid: false})
+	}
+
+	public, _, err := db.FindPublicKey(c, c.Param("id"), c.Param("name"), version)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	case app.ErrorCode(err) == app.ERR_NOTFOUND:
+		return c.JSON(http.StatusOK, app.VerifyOutput{Valid: false})
+	case app.ErrorCode(err) == app.ERR_INVALID:
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+	case err != nil:
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	err = keys.Verify(public, message, signature)
+	if err != nil && !errors.Is(err, keys.ErrVerify) {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+	return c.JSON(http.StatusOK, app.VerifyOutput{Valid: err == nil})
+}
+
+// tenantsKeysPublicKeyHandler exports the public keys of all versions of a signing key, or of the one given by the
+// "version" parameter, as PEM, or as a JWK set if the "format" parameter is "jwk". The JWK key IDs are of the form
+// "<key ring ID>:<version>".
+func (s *Server) tenantsKeysPublicKeyHandler(c echo.Context) error {
+	format := c.QueryParam("format")
+	if format != "" && format != "pem" && format != "jwk" {
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: "format must be pem or jwk"})
+	}
+	version := 0
+	if v := c.QueryParam("version"); v != "" {
+		var err error
+		if version, err = strconv.Atoi(v); err != nil || version < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: "invalid version"})
+		}
+	}
+
+	ring, err := db.FindKeyRingByName(c, c.Param("id"), c.Param("name"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+	if !app.IsSigningKeyType(ring.Type) {
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: "not a signing key"})
+	}
+
+	pems := []app.PublicKey{}
+	jwks := keys.JWKSet{Keys: []keys.JWK{}}
+	for _, kv := range ring.Versions {
+		if version != 0 && kv.Version != version {
+			continue
+		}
+		if format != "jwk" {
+			pems = append(pems, app.PublicKey{Version: kv.Version, PEM: keys.PublicKeyPEM(kv.PublicKey)})
+			continue
+		}
+		jwk, err := keys.PublicKeyJWK(kv.PublicKey, fmt.Sprintf("%s:%d", ring.ID, kv.Version))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	if len(pems) == 0 && len(jwks.Keys) == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+
+	if format == "jwk" {
+		return c.JSON(http.StatusOK, jwks)
+	}
+	return c.JSON(http.StatusOK, pems)
+}
+
+func (s *Server) respondKeyRing(c echo.Context, ring db.KeyRing) error {
+	r, err := db.ConvertKeyRing(c, ring)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, r)
+}
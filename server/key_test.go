@@ -0,0 +1,184 @@
+package server_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/briskt/keygo/app"
+)
+
+func (ts *TestSuite) Test_tenantsKeys() {
+	tenant := ts.createTenantFixture()
+	tenantAdmin := ts.createTenantUserFixture(tenant.ID, app.UserRoleTenantAdmin)
+	member := ts.createTenantUserFixture(tenant.ID, app.UserRoleBasic)
+	otherTenant := ts.createTenantFixture()
+	otherAdmin := ts.createTenantUserFixture(otherTenant.ID, app.UserRoleTenantAdmin)
+
+	path := fmt.Sprintf("/api/tenants/%s/keys", tenant.ID)
+
+	_, status := ts.request(http.MethodPost, path, member.Email, app.KeyRingCreateInput{Name: "payments"})
+	ts.Equal(http.StatusNotFound, status, "a member cannot create keys")
+
+	body, status := ts.request(http.MethodPost, path, tenantAdmin.Email, app.KeyRingCreateInput{Name: "payments"})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var ring app.KeyRing
+	ts.NoError(json.Unmarshal(body, &ring))
+	ts.Equal(1, ring.LatestVersion)
+
+	_, status = ts.request(http.MethodPost, path+"/payments/encrypt", otherAdmin.Email,
+		app.EncryptInput{Plaintext: "AQID"})
+	ts.Equal(http.StatusNotFound, status, "another tenant cannot use the key")
+
+	plaintext := base64.StdEncoding.EncodeToString([]byte("card number"))
+	context := base64.StdEncoding.EncodeToString([]byte("order 42"))
+	body, status = ts.request(http.MethodPost, path+"/payments/encrypt", tenantAdmin.Email,
+		app.EncryptInput{Plaintext: plaintext, Context: context})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var encrypted app.EncryptOutput
+	ts.NoError(json.Unmarshal(body, &encrypted))
+	ts.Equal(1, encrypted.KeyVersion)
+
+	body, status = ts.request(http.MethodPost, path+"/payments/rotate", tenantAdmin.Email, nil)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	ts.NoError(json.Unmarshal(body, &ring))
+	ts.Equal(2, ring.LatestVersion)
+
+	body, status = ts.request(http.MethodPost, path+"/payments/decrypt", tenantAdmin.Email,
+		app.DecryptInput{Ciphertext: encrypted.Ciphertext, Context: context})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var decrypted app.DecryptOutput
+	ts.NoError(json.Unmarshal(body, &decrypted))
+	ts.Equal(plaintext, decrypted.Plaintext, "data encrypted before a rotation should decrypt")
+
+	_, status = ts.request(http.MethodPost, path+"/payments/decrypt", tenantAdmin.Email,
+		app.DecryptInput{Ciphertext: encrypted.Ciphertext})
+	ts.Equal(http.StatusBadRequest, status, "the context is required to decrypt")
+
+	body, status = ts.request(http.MethodPost, path+"/payments/encrypt", tenantAdmin.Email,
+		app.EncryptInput{Plaintext: plaintext})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	ts.NoError(json.Unmarshal(body, &encrypted))
+	ts.Equal(2, encrypted.KeyVersion, "the latest version encrypts")
+
+	_, status = ts.request(http.MethodPost, path+"/missing/encrypt", tenantAdmin.Email,
+		app.EncryptInput{Plaintext: plaintext})
+	ts.Equal(http.StatusNotFound, status)
+}
+
+func (ts *TestSuite) Test_tenantsKeysSign() {
+	tenant := ts.createTenantFixture()
+	tenantAdmin := ts.createTenantUserFixture(tenant.ID, app.UserRoleTenantAdmin)
+	otherTenant := ts.createTenantFixture()
+	otherAdmin := ts.createTenantUserFixture(otherTenant.ID, app.UserRoleTenantAdmin)
+
+	path := fmt.Sprintf("/api/tenants/%s/keys", tenant.ID)
+
+	_, status := ts.request(http.MethodPost, path, tenantAdmin.Email,
+		app.KeyRingCreateInput{Name: "releases", Type: "dsa"})
+	ts.Equal(http.StatusBadRequest, status, "unknown key types are rejected")
+
+	body, status := ts.request(http.MethodPost, path, tenantAdmin.Email,
+		app.KeyRingCreateInput{Name: "releases", Type: app.KeyTypeECDSAP256})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var ring app.KeyRing
+	ts.NoError(json.Unmarshal(body, &ring))
+	ts.Equal(app.KeyTypeECDSAP256, ring.Type)
+
+	input := base64.StdEncoding.EncodeToString([]byte("release v1.2.3"))
+	_, status = ts.request(http.MethodPost, path+"/releases/encrypt", tenantAdmin.Email,
+		app.EncryptInput{Plaintext: input})
+	ts.Equal(http.StatusBadRequest, status, "signing keys do not encrypt")
+
+	_, status = ts.request(http.MethodPost, path+"/releases/sign", otherAdmin.Email, app.SignInput{Input: input})
+	ts.Equal(http.StatusNotFound, status, "another tenant cannot use the key")
+
+	body, status = ts.request(http.MethodPost, path+"/releases/sign", tenantAdmin.Email, app.SignInput{Input: input})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var signed app.SignOutput
+	ts.NoError(json.Unmarshal(body, &signed))
+	ts.Equal(1, signed.KeyVersion)
+
+	_, status = ts.request(http.MethodPost, path+"/releases/rotate", tenantAdmin.Email, nil)
+	ts.Equal(http.StatusOK, status)
+
+	verify := func(input, signature string) bool {
+		body, status := ts.request(http.MethodPost, path+"/releases/verify", tenantAdmin.Email,
+			app.VerifyInput{Input: input, Signature: signature})
+		ts.Equal(http.StatusOK, status, "body: %s", body)
+		var verified app.VerifyOutput
+		ts.NoError(json.Unmarshal(body, &verified))
+		return verified.Valid
+	}
+	ts.True(verify(input, signed.Signature), "signatures made before a rotation should verify")
+	ts.False(verify(base64.StdEncoding.EncodeToString([]byte("release v6.6.6")), signed.Signature))
+	ts.False(verify(input, "keygo:v9:AQID"), "an unknown version does not verify")
+	ts.False(verify(input, "not a signature"))
+
+	body, status = ts.request(http.MethodGet, path+"/releases/public-key", tenantAdmin.Email, nil)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var pems []app.PublicKey
+	ts.NoError(json.Unmarshal(body, &pems))
+	ts.Len(pems, 2)
+	ts.Contains(pems[0].PEM, "-----BEGIN PUBLIC KEY-----")
+
+	body, status = ts.request(http.MethodGet, path+"/releases/public-key?format=jwk&version=2", tenantAdmin.Email, nil)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var jwks struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	ts.NoError(json.Unmarshal(body, &jwks))
+	ts.Len(jwks.Keys, 1)
+	ts.Equal("EC", jwks.Keys[0]["kty"])
+	ts.Equal(ring.ID+":2", jwks.Keys[0]["kid"])
+
+	_, status = ts.request(http.MethodPost, path, tenantAdmin.Email, app.KeyRingCreateInput{Name: "payments"})
+	ts.Equal(http.StatusOK, status)
+	_, status = ts.request(http.MethodPost, path+"/payments/sign", tenantAdmin.Email, app.SignInput{Input: input})
+	ts.Equal(http.StatusBadRequest, status, "encryption keys do not sign")
+	_, status = ts.request(http.MethodGet, path+"/payments/public-key", tenantAdmin.Email, nil)
+	ts.Equal(http.StatusBadRequest, status)
+}
+
+func (ts *TestSuite) Test_sysUnsealHandler() {
+	admin := ts.createUserFixture(app.UserRoleAdmin)
+	user := ts.createUserFixture(app.UserRoleBasic)
+	tenant := ts.createTenantFixture()
+	keysPath := fmt.Sprintf("/api/tenants/%s/keys", tenant.ID)
+
+	body, status := ts.request(http.MethodGet, "/api/sys/seal-status", user.Email, nil)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var sealStatus app.SealStatus
+	ts.NoError(json.Unmarshal(body, &sealStatus))
+	ts.False(sealStatus.Sealed, "the test server is unsealed by MASTER_KEY")
+
+	_, status = ts.request(http.MethodPost, "/api/sys/seal", user.Email, nil)
+	ts.Equal(http.StatusNotFound, status, "only operators may seal")
+
+	body, status = ts.request(http.MethodPost, "/api/sys/seal", admin.Email, nil)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	ts.NoError(json.Unmarshal(body, &sealStatus))
+	ts.True(sealStatus.Sealed)
+
+	_, status = ts.request(http.MethodGet, keysPath, admin.Email, nil)
+	ts.Equal(http.StatusServiceUnavailable, status, "key operations are refused while sealed")
+
+	wrongKey := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdeX"))
+	_, status = ts.request(http.MethodPost, "/api/sys/unseal", admin.Email, app.UnsealInput{Key: wrongKey})
+	ts.Equal(http.StatusBadRequest, status, "the wrong master key is rejected")
+
+	_, status = ts.request(http.MethodPost, "/api/sys/unseal", user.Email,
+		app.UnsealInput{Key: os.Getenv("MASTER_KEY")})
+	ts.Equal(http.StatusNotFound, status, "only operators may unseal")
+
+	body, status = ts.request(http.MethodPost, "/api/sys/unseal", admin.Email,
+		app.UnsealInput{Key: os.Getenv("MASTER_KEY")})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	ts.NoError(json.Unmarshal(body, &sealStatus))
+	ts.False(sealStatus.Sealed)
+
+	_, status = ts.request(http.MethodGet, keysPath, admin.Email, nil)
+	ts.Equal(http.StatusOK, status)
+}
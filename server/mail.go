@@ -0,0 +1,119 @@
+package server
+
+import (
+	"fmt"
+	"net/mail"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+	"github.com/briskt/keygo/mailer"
+)
+
+const (
+	defaultSMTPPort     = 587
+	defaultMailFileDir  = "mail"
+	outboxRetryInterval = time.Minute
+)
+
+// mailConfig holds the email delivery settings read from the environment
+type mailConfig struct {
+	transport string
+	from      *mail.Address
+	smtpHost  string
+	smtpPort  int
+	smtpUser  string
+	smtpPass  string
+	fileDir   string
+}
+
+// loadMailConfig reads the email delivery settings from the environment:
+//
+//   - MAIL_TRANSPORT: smtp, file, or empty to leave queued email undelivered
+//   - SUPPORT_EMAIL: the From address of all email
+//   - SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD: the SMTP server, for the smtp transport
+//   - MAIL_FILE_DIR: the directory to write .eml files to, for the file transport
+func loadMailConfig() (mailConfig, error) {
+	config := mailConfig{
+		transport: os.Getenv("MAIL_TRANSPORT"),
+		smtpHost:  os.Getenv("SMTP_HOST"),
+		smtpPort:  defaultSMTPPort,
+		smtpUser:  os.Getenv("SMTP_USERNAME"),
+		smtpPass:  os.Getenv("SMTP_PASSWORD"),
+		fileDir:   defaultMailFileDir,
+	}
+	if config.transport == "" {
+		return config, nil
+	}
+
+	from, err := mail.ParseAddress(os.Getenv("SUPPORT_EMAIL"))
+	if err != nil {
+		return mailConfig{}, fmt.Errorf("invalid SUPPORT_EMAIL %q", os.Getenv("SUPPORT_EMAIL"))
+	}
+	config.from = from
+
+	switch config.transport {
+	case "smtp":
+		if config.smtpHost == "" {
+			return mailConfig{}, fmt.Errorf("SMTP_HOST is required for MAIL_TRANSPORT=smtp")
+		}
+		if v := os.Getenv("SMTP_PORT"); v != "" {
+			if config.smtpPort, err = strconv.Atoi(v); err != nil || config.smtpPort <= 0 {
+				return mailConfig{}, fmt.Errorf("invalid SMTP_PORT %q", v)
+			}
+		}
+	case "file":
+		if v := os.Getenv("MAIL_FILE_DIR"); v != "" {
+			config.fileDir = v
+		}
+	default:
+		return mailConfig{}, fmt.Errorf("invalid MAIL_TRANSPORT %q, expected smtp or file", config.transport)
+	}
+	return config, nil
+}
+
+// sender returns the EmailSender for the configured transport, or nil if email delivery is disabled
+func (m mailConfig) sender() app.EmailSender {
+	switch m.transport {
+	case "smtp":
+		return mailer.SMTPSender{
+			From:     m.from,
+			Host:     m.smtpHost,
+			Port:     m.smtpPort,
+			Username: m.smtpUser,
+			Password: m.smtpPass,
+		}
+	case "file":
+		return mailer.FileSender{From: m.from, Dir: m.fileDir}
+	}
+	return nil
+}
+
+// newOutbox returns the email outbox and starts delivering it, or returns nil if email delivery is disabled
+func (s *Server) newOutbox(config mailConfig) *db.Outbox {
+	sender := config.sender()
+	if sender == nil || s.db == nil {
+		s.Logger.Warn("email delivery is disabled, queued email will not be sent until MAIL_TRANSPORT is set")
+		return nil
+	}
+	outbox := db.NewOutbox(s.db, sender)
+	outbox.Start(outboxRetryInterval, func(err error) {
+		s.Logger.Errorf("email delivery error: %s", err)
+	})
+	return outbox
+}
+
+// queueEmail renders the named email template and queues the email to the given address in the request
+// transaction
+func queueEmail(c echo.Context, to, template string, data any) error {
+	email, err := mailer.Render(template, data)
+	if err != nil {
+		return fmt.Errorf("render %s email: %w", template, err)
+	}
+	email.To = to
+	return db.QueueEmail(c, email)
+}
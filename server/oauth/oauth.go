@@ -2,8 +2,11 @@ package oauth
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
+	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"golang.org/x/oauth2"
@@ -13,7 +16,9 @@ import (
 type Authenticator struct {
 	*oidc.Provider
 	oauth2.Config
-	scopes string
+	scopes                string
+	endSessionURL         string
+	postLogoutRedirectURL string
 }
 
 // Manager is an interface that defines a user identity manager service
@@ -38,16 +43,36 @@ type Profile struct {
 	ID       string
 	Email    string
 	Verified bool
+
+	// SessionID is the IdP session ID (sid claim), if the provider supplies one
+	SessionID string
+
+	// IDToken is the raw ID token, kept for use as id_token_hint on logout
+	IDToken string
+}
+
+// LogoutClaims holds the identifying claims of a verified back-channel logout token
+type LogoutClaims struct {
+	// ID is the unique ID of the logout token (jti claim), for rejecting replays of it
+	ID string
+
+	Subject   string
+	SessionID string
+	ExpiresAt time.Time
 }
 
 type Config struct {
-	Issuer       string
-	ClientID     string
-	ClientSecret string
-	RedirectURL  string
-	Scopes       string
+	Issuer                string
+	ClientID              string
+	ClientSecret          string
+	RedirectURL           string
+	PostLogoutRedirectURL string
+	Scopes                string
 }
 
+// backChannelLogoutEvent is the event type required in the events claim of a logout token
+const backChannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
 var authenticator *Authenticator
 
 // Init initializes the Authenticator.
@@ -73,10 +98,20 @@ func Init(config Config) error {
 		Scopes:       []string{oidc.ScopeOpenID, "profile"},
 	}
 
+	// end_session_endpoint is optional, so a missing claim is not an error
+	var claims struct {
+		EndSessionURL string `json:"end_session_endpoint"`
+	}
+	if err = provider.Claims(&claims); err != nil {
+		return fmt.Errorf("oauth provider claims error: %w", err)
+	}
+
 	authenticator = &Authenticator{
-		Provider: provider,
-		Config:   conf,
-		scopes:   config.Scopes,
+		Provider:              provider,
+		Config:                conf,
+		scopes:                config.Scopes,
+		endSessionURL:         claims.EndSessionURL,
+		postLogoutRedirectURL: config.PostLogoutRedirectURL,
 	}
 
 	return nil
@@ -108,6 +143,74 @@ func AuthCodeURL(state string) string {
 	return authenticator.AuthCodeURL(state, options)
 }
 
+// EndSessionURL returns the URL for RP-initiated logout at the provider, or an empty string if the provider
+// does not advertise an end_session_endpoint.
+func EndSessionURL(idTokenHint string) string {
+	if authenticator.endSessionURL == "" {
+		return ""
+	}
+
+	u, err := url.Parse(authenticator.endSessionURL)
+	if err != nil {
+		return ""
+	}
+
+	q := u.Query()
+	q.Set("client_id", authenticator.ClientID)
+	if idTokenHint != "" {
+		q.Set("id_token_hint", idTokenHint)
+	}
+	if authenticator.postLogoutRedirectURL != "" {
+		q.Set("post_logout_redirect_uri", authenticator.postLogoutRedirectURL)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// VerifyLogoutToken validates a back-channel logout token as described in OpenID Connect Back-Channel Logout 1.0
+// section 2.6, and returns its ID, subject, and session ID. Replays of the token are not detected here.
+func VerifyLogoutToken(ctx context.Context, rawToken string) (LogoutClaims, error) {
+	verifier := authenticator.Verifier(&oidc.Config{ClientID: authenticator.ClientID})
+	return verifyLogoutToken(ctx, verifier, rawToken)
+}
+
+func verifyLogoutToken(ctx context.Context, verifier *oidc.IDTokenVerifier, rawToken string) (LogoutClaims, error) {
+	token, err := verifier.Verify(ctx, rawToken)
+	if err != nil {
+		return LogoutClaims{}, fmt.Errorf("failed to verify logout token: %w", err)
+	}
+
+	var claims struct {
+		ID        string                     `json:"jti"`
+		SessionID string                     `json:"sid"`
+		Events    map[string]json.RawMessage `json:"events"`
+		Nonce     *string                    `json:"nonce"`
+	}
+	if err = token.Claims(&claims); err != nil {
+		return LogoutClaims{}, fmt.Errorf("failed to get claims from logout token: %w", err)
+	}
+
+	if _, ok := claims.Events[backChannelLogoutEvent]; !ok {
+		return LogoutClaims{}, errors.New("logout token does not contain a back-channel logout event")
+	}
+	if claims.Nonce != nil {
+		return LogoutClaims{}, errors.New("logout token must not contain a nonce")
+	}
+	if token.Subject == "" && claims.SessionID == "" {
+		return LogoutClaims{}, errors.New("logout token must contain a sub or sid claim")
+	}
+	if claims.ID == "" {
+		return LogoutClaims{}, errors.New("logout token must contain a jti claim")
+	}
+
+	return LogoutClaims{
+		ID:        claims.ID,
+		Subject:   token.Subject,
+		SessionID: claims.SessionID,
+		ExpiresAt: token.Expiry,
+	}, nil
+}
+
 func GetProfile(ctx context.Context, code string) (Profile, error) {
 	var ap Profile
 
@@ -150,5 +253,10 @@ func GetProfile(ctx context.Context, code string) (Profile, error) {
 		return ap, err
 	}
 
+	// sid is optional, and only present if the provider supports session-bound logout
+	ap.SessionID, _ = profile["sid"].(string)
+
+	ap.IDToken, _ = token.Extra("id_token").(string)
+
 	return ap, nil
 }
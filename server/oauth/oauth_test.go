@@ -0,0 +1,90 @@
+package oauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testIssuer   = "https://issuer.example.com"
+	testClientID = "client"
+)
+
+// signRS256 returns a JWT with the given claims, signed with the key
+func signRS256(t *testing.T, key *rsa.PrivateKey, claims map[string]any) string {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "logout+jwt"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func Test_verifyLogoutToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keySet := &oidc.StaticKeySet{PublicKeys: []crypto.PublicKey{&key.PublicKey}}
+	verifier := oidc.NewVerifier(testIssuer, keySet, &oidc.Config{ClientID: testClientID})
+
+	expiresAt := time.Now().Add(time.Minute).Truncate(time.Second)
+	logoutClaims := func() map[string]any {
+		return map[string]any{
+			"iss":    testIssuer,
+			"aud":    testClientID,
+			"iat":    time.Now().Unix(),
+			"exp":    expiresAt.Unix(),
+			"jti":    "logout-1",
+			"sub":    "auth-1",
+			"sid":    "session-1",
+			"events": map[string]any{backChannelLogoutEvent: map[string]any{}},
+		}
+	}
+
+	claims, err := verifyLogoutToken(context.Background(), verifier, signRS256(t, key, logoutClaims()))
+	require.NoError(t, err)
+	require.Equal(t, LogoutClaims{
+		ID:        "logout-1",
+		Subject:   "auth-1",
+		SessionID: "session-1",
+		ExpiresAt: expiresAt,
+	}, claims)
+
+	tests := []struct {
+		name   string
+		modify func(map[string]any)
+	}{
+		{"no jti", func(c map[string]any) { delete(c, "jti") }},
+		{"no sub or sid", func(c map[string]any) { delete(c, "sub"); delete(c, "sid") }},
+		{"no logout event", func(c map[string]any) { c["events"] = map[string]any{} }},
+		{"nonce", func(c map[string]any) { c["nonce"] = "n" }},
+		{"other audience", func(c map[string]any) { c["aud"] = "other" }},
+		{"expired", func(c map[string]any) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := logoutClaims()
+			tt.modify(c)
+			_, err := verifyLogoutToken(context.Background(), verifier, signRS256(t, key, c))
+			require.Error(t, err)
+		})
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, err = verifyLogoutToken(context.Background(), verifier, signRS256(t, other, logoutClaims()))
+	require.Error(t, err, "a token signed by another key must be rejected")
+}
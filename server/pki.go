@@ -0,0 +1,353 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+	"github.com/briskt/keygo/pki"
+)
+
+// PKICRLPath is the distribution point of a tenant's revocation list, named in the certificates it issues. It is
+// served without authentication, so that relying parties can check for revocations.
+const PKICRLPath = "/api/pki/:id/crl"
+
+const (
+	// crlRefreshInterval is how often revocation lists are checked for their next update
+	crlRefreshInterval = time.Hour
+
+	// crlRefreshMargin is how long before its next update a revocation list is signed again
+	crlRefreshMargin = pki.CRLValidity / 2
+)
+
+// startCRLRefresh signs the revocation lists of all tenants again before they reach their next update, while the
+// server is unsealed, until the returned function is called
+func (s *Server) startCRLRefresh() (stop func()) {
+	done := make(chan struct{})
+	if s.db == nil {
+		return func() { close(done) }
+	}
+
+	ticker := time.NewTicker(crlRefreshInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+			if s.barrier.Sealed() {
+				continue
+			}
+			n, err := db.RefreshCRLs(s.db, s.barrier, time.Now().Add(crlRefreshMargin))
+			if err != nil {
+				s.Logger.Errorf("CRL refresh error: %s", err)
+			}
+			if n > 0 {
+				s.Logger.Infof("refreshed %d CRLs", n)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// crlURL returns the distribution point of a tenant's revocation list, or "" if HOST is not configured
+func crlURL(tenantID string) string {
+	host := env("HOST", false)
+	if host == "" {
+		return ""
+	}
+	return host + strings.Replace(PKICRLPath, ":id", url.PathEscape(tenantID), 1)
+}
+
+func (s *Server) tenantsPKICAGetHandler(c echo.Context) error {
+	ca, err := db.FindCA(c, c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+	return s.respondCA(c, ca)
+}
+
+func (s *Server) tenantsPKICAGenerateHandler(c echo.Context) error {
+	var input app.CAGenerateInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	tenantID := c.Param("id")
+	ca, err := db.GenerateCA(c, tenantID, s.barrier, input)
+	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s generated CA %s in tenant %s", app.CurrentUser(c).ID, ca.ID, tenantID)
+
+	return s.respondCA(c, ca)
+}
+
+func (s *Server) tenantsPKICAImportHandler(c echo.Context) error {
+	var input app.CAImportInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	tenantID := c.Param("id")
+	ca, err := db.ImportCA(c, tenantID, s.barrier, input)
+	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s imported CA %s (%q) in tenant %s", app.CurrentUser(c).ID, ca.ID, ca.CommonName,
+		tenantID)
+
+	return s.respondCA(c, ca)
+}
+
+func (s *Server) tenantsPKITemplatesListHandler(c echo.Context) error {
+	templates, err := db.FindCertificateTemplates(c, c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	out := make([]app.CertificateTemplate, len(templates))
+	for i, t := range templates {
+		if out[i], err = db.ConvertCertificateTemplate(c, t); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, out)
+}
+
+func (s *Server) tenantsPKITemplatesCreateHandler(c echo.Context) error {
+	var input app.CertificateTemplateInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	tenantID := c.Param("id")
+	template, err := db.CreateCertificateTemplate(c, tenantID, input)
+	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s created certificate template %q in tenant %s", app.CurrentUser(c).ID, template.Name,
+		tenantID)
+
+	return s.respondCertificateTemplate(c, template)
+}
+
+func (s *Server) tenantsPKITemplatesUpdateHandler(c echo.Context) error {
+	var input app.CertificateTemplateInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	tenantID := c.Param("id")
+	template, err := db.UpdateCertificateTemplate(c, tenantID, c.Param("name"), input)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	case app.ErrorCode(err) == app.ERR_INVALID:
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+	case err != nil:
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s updated certificate template %q in tenant %s", app.CurrentUser(c).ID, template.Name,
+		tenantID)
+
+	return s.respondCertificateTemplate(c, template)
+}
+
+func (s *Server) tenantsPKITemplatesDeleteHandler(c echo.Context) error {
+	tenantID, name := c.Param("id"), c.Param("name")
+	err := db.DeleteCertificateTemplate(c, tenantID, name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s deleted certificate template %q in tenant %s", app.CurrentUser(c).ID, name, tenantID)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (s *Server) tenantsPKIIssueHandler(c echo.Context) error {
+	var input app.CertificateIssueInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	actor := app.CurrentUser(c)
+	tenantID := c.Param("id")
+	cert, err := db.IssueCertificate(c, tenantID, actor.ID, s.barrier, crlURL(tenantID), input)
+	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s issued certificate %s for %q with template %q in tenant %s", actor.ID,
+		cert.SerialNumber, cert.CommonName, cert.TemplateName, tenantID)
+
+	return s.respondCertificate(c, cert)
+}
+
+// tenantsPKICertsListHandler lists the certificates issued in a tenant, filtered by the "serial", "revoked",
+// "expires_before" and "expires_after" parameters. Times are in RFC 3339 format.
+func (s *Server) tenantsPKICertsListHandler(c echo.Context) error {
+	var filter app.CertificateFilter
+	if serial := c.QueryParam("serial"); serial != "" {
+		filter.SerialNumber = &serial
+	}
+	if v := c.QueryParam("revoked"); v != "" {
+		revoked, err := strconv.ParseBool(v)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: "revoked must be true or false"})
+		}
+		filter.Revoked = &revoked
+	}
+	for param, t := range map[string]**time.Time{
+		"expires_before": &filter.ExpiresBefore,
+		"expires_after":  &filter.ExpiresAfter,
+	} {
+		if v := c.QueryParam(param); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: param + " must be an RFC 3339 time"})
+			}
+			*t = &parsed
+		}
+	}
+
+	certs, err := db.FindCertificates(c, c.Param("id"), filter)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	out := make([]app.Certificate, len(certs))
+	for i, cert := range certs {
+		if out[i], err = db.ConvertCertificate(c, cert); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, out)
+}
+
+func (s *Server) tenantsPKICertsGetHandler(c echo.Context) error {
+	cert, err := db.FindCertificateBySerial(c, c.Param("id"), c.Param("serial"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+	return s.respondCertificate(c, cert)
+}
+
+func (s *Server) tenantsPKICertsRevokeHandler(c echo.Context) error {
+	tenantID := c.Param("id")
+	cert, err := db.RevokeCertificate(c, tenantID, c.Param("serial"), s.barrier)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	case app.ErrorCode(err) == app.ERR_INVALID:
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+	case err != nil:
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s revoked certificate %s in tenant %s", app.CurrentUser(c).ID, cert.SerialNumber,
+		tenantID)
+
+	return s.respondCertificate(c, cert)
+}
+
+// tenantsPKICRLHandler responds with the latest CRL of the tenant's CA, PEM encoded, or DER encoded if the
+// "format" parameter is "der"
+func (s *Server) tenantsPKICRLHandler(c echo.Context) error {
+	format := c.QueryParam("format")
+	if format != "" && format != "pem" && format != "der" {
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: "format must be pem or der"})
+	}
+
+	crl, err := db.FindCRL(c, c.Param("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	if format == "der" {
+		return c.Blob(http.StatusOK, "application/pkix-crl", crl)
+	}
+	return c.Blob(http.StatusOK, "application/x-pem-file", []byte(pki.EncodePEM("X509 CRL", crl)))
+}
+
+// pkiCRLHandler responds with the latest CRL of a tenant's CA, DER encoded, at its distribution point. It is not
+// authenticated, so the request transaction is restricted to the tenant's rows.
+func (s *Server) pkiCRLHandler(c echo.Context) error {
+	tenantID := c.Param("id")
+	if err := db.SetRLSActor(c, tenantID, ""); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	crl, err := db.FindCRL(c, tenantID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+	return c.Blob(http.StatusOK, "application/pkix-crl", crl)
+}
+
+func (s *Server) respondCA(c echo.Context, ca db.CertificateAuthority) error {
+	out, err := db.ConvertCA(c, ca)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, out)
+}
+
+func (s *Server) respondCertificateTemplate(c echo.Context, template db.CertificateTemplate) error {
+	out, err := db.ConvertCertificateTemplate(c, template)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, out)
+}
+
+func (s *Server) respondCertificate(c echo.Context, cert db.Certificate) error {
+	out, err := db.ConvertCertificate(c, cert)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, out)
+}
@@ -0,0 +1,125 @@
+package server_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/briskt/keygo/app"
+)
+
+func (ts *TestSuite) Test_tenantsPKI() {
+	tenant := ts.createTenantFixture()
+	tenantAdmin := ts.createTenantUserFixture(tenant.ID, app.UserRoleTenantAdmin)
+	member := ts.createTenantUserFixture(tenant.ID, app.UserRoleBasic)
+	otherTenant := ts.createTenantFixture()
+	otherAdmin := ts.createTenantUserFixture(otherTenant.ID, app.UserRoleTenantAdmin)
+
+	path := fmt.Sprintf("/api/tenants/%s/pki", tenant.ID)
+
+	_, status := ts.request(http.MethodPost, path+"/ca/generate", member.Email,
+		app.CAGenerateInput{CommonName: "Root"})
+	ts.Equal(http.StatusNotFound, status, "a member cannot create a CA")
+
+	body, status := ts.request(http.MethodPost, path+"/ca/generate", tenantAdmin.Email,
+		app.CAGenerateInput{CommonName: "Root", TTL: "8760h"})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var ca app.CertificateAuthority
+	ts.NoError(json.Unmarshal(body, &ca))
+	ts.Contains(ca.Certificate, "BEGIN CERTIFICATE")
+
+	body, status = ts.request(http.MethodPost, path+"/templates", tenantAdmin.Email, app.CertificateTemplateInput{
+		Name:           "services",
+		AllowedDomains: []string{"*.svc.internal"},
+		MaxTTL:         "72h",
+		ExtKeyUsages:   []string{app.ExtKeyUsageClientAuth},
+	})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ts.NoError(err)
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "billing.svc.internal"},
+		DNSNames: []string{"billing.svc.internal"},
+	}, key)
+	ts.NoError(err)
+	issueInput := app.CertificateIssueInput{
+		Template: "services",
+		CSR:      string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+		TTL:      "1h",
+	}
+
+	_, status = ts.request(http.MethodPost, fmt.Sprintf("/api/tenants/%s/pki/issue", otherTenant.ID),
+		otherAdmin.Email, issueInput)
+	ts.Equal(http.StatusBadRequest, status, "another tenant has no such template")
+
+	body, status = ts.request(http.MethodPost, path+"/issue", tenantAdmin.Email, issueInput)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var cert app.Certificate
+	ts.NoError(json.Unmarshal(body, &cert))
+	ts.Equal("services", cert.TemplateName)
+	ts.Equal([]string{"billing.svc.internal"}, cert.DNSNames)
+
+	block, _ := pem.Decode([]byte(cert.Certificate))
+	ts.NotNil(block)
+	issued, err := x509.ParseCertificate(block.Bytes)
+	ts.NoError(err)
+	ts.Equal([]x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, issued.ExtKeyUsage)
+	crlURL := os.Getenv("HOST") + "/api/pki/" + tenant.ID + "/crl"
+	ts.Equal([]string{crlURL}, issued.CRLDistributionPoints)
+
+	issueInput.TTL = "96h"
+	_, status = ts.request(http.MethodPost, path+"/issue", tenantAdmin.Email, issueInput)
+	ts.Equal(http.StatusBadRequest, status, "the TTL is limited by the template")
+
+	body, status = ts.request(http.MethodGet, path+"/certs?serial="+cert.SerialNumber, tenantAdmin.Email, nil)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var certs []app.Certificate
+	ts.NoError(json.Unmarshal(body, &certs))
+	ts.Len(certs, 1)
+
+	_, status = ts.request(http.MethodGet, path+"/certs?expires_before=yesterday", tenantAdmin.Email, nil)
+	ts.Equal(http.StatusBadRequest, status)
+
+	_, status = ts.request(http.MethodPost, path+"/certs/"+cert.SerialNumber+"/revoke", member.Email, nil)
+	ts.Equal(http.StatusNotFound, status, "a member cannot revoke")
+
+	body, status = ts.request(http.MethodPost, path+"/certs/"+cert.SerialNumber+"/revoke", tenantAdmin.Email, nil)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	ts.NoError(json.Unmarshal(body, &cert))
+	ts.NotNil(cert.RevokedAt)
+
+	body, status = ts.request(http.MethodGet, path+"/certs?revoked=true", tenantAdmin.Email, nil)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	ts.NoError(json.Unmarshal(body, &certs))
+	ts.Len(certs, 1)
+
+	body, status = ts.request(http.MethodGet, path+"/crl", tenantAdmin.Email, nil)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	block, _ = pem.Decode(body)
+	ts.NotNil(block)
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	ts.NoError(err)
+	ts.Len(crl.RevokedCertificates, 1)
+	ts.Equal(cert.SerialNumber, crl.RevokedCertificates[0].SerialNumber.Text(16))
+
+	body, status = ts.request(http.MethodGet, "/api/pki/"+tenant.ID+"/crl", "", nil)
+	ts.Equal(http.StatusOK, status, "the CRL distribution point needs no login, body: %s", body)
+	published, err := x509.ParseRevocationList(body)
+	ts.NoError(err)
+	ts.Equal(crl.Number, published.Number, "fetching the CRL does not sign a new one")
+
+	_, status = ts.request(http.MethodGet, "/api/pki/"+otherTenant.ID+"/crl", "", nil)
+	ts.Equal(http.StatusNotFound, status)
+
+	_, status = ts.request(http.MethodGet, fmt.Sprintf("/api/tenants/%s/pki/crl", otherTenant.ID),
+		otherAdmin.Email, nil)
+	ts.Equal(http.StatusNotFound, status, "the other tenant has no CA")
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/server/ratelimit"
+)
+
+const rateLimitCleanupInterval = time.Hour
+
+// rateLimitConfig holds the rate limits read from the environment
+type rateLimitConfig struct {
+	enabled bool
+
+	// store is "memory" (the default) or "postgres"
+	store string
+
+	// auth limits requests per client IP to the /api/auth routes
+	auth ratelimit.Limit
+
+	// api limits requests per client IP, and per bearer token, to the other API routes
+	api ratelimit.Limit
+
+	// user limits requests per authenticated user
+	user ratelimit.Limit
+
+	// failures limits failed bearer token lookups per client IP. Clients exceeding it are locked out until the
+	// bucket refills.
+	failures ratelimit.Limit
+}
+
+// loadRateLimitConfig reads the rate limits from the environment. Limits are in the form "<count>/<unit>", where
+// unit is s, m, or h.
+//
+//   - RATE_LIMIT_ENABLED: "true" (default) or "false"
+//   - RATE_LIMIT_STORE: "memory" (default) or "postgres" for limits shared by multiple instances
+//   - RATE_LIMIT_AUTH, RATE_LIMIT_API, RATE_LIMIT_USER, RATE_LIMIT_AUTH_FAILURES
+func loadRateLimitConfig() (rateLimitConfig, error) {
+	config := rateLimitConfig{enabled: true, store: "memory"}
+
+	if v := os.Getenv("RATE_LIMIT_ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return rateLimitConfig{}, fmt.Errorf("invalid RATE_LIMIT_ENABLED %q: %w", v, err)
+		}
+		config.enabled = enabled
+	}
+
+	if v := os.Getenv("RATE_LIMIT_STORE"); v != "" {
+		if v != "memory" && v != "postgres" {
+			return rateLimitConfig{}, fmt.Errorf("invalid RATE_LIMIT_STORE %q", v)
+		}
+		config.store = v
+	}
+
+	limits := []struct {
+		key   string
+		def   string
+		limit *ratelimit.Limit
+	}{
+		{"RATE_LIMIT_AUTH", "20/m", &config.auth},
+		{"RATE_LIMIT_API", "600/m", &config.api},
+		{"RATE_LIMIT_USER", "600/m", &config.user},
+		{"RATE_LIMIT_AUTH_FAILURES", "10/h", &config.failures},
+	}
+	for _, l := range limits {
+		v := os.Getenv(l.key)
+		if v == "" {
+			v = l.def
+		}
+		limit, err := ratelimit.ParseLimit(v)
+		if err != nil {
+			return rateLimitConfig{}, fmt.Errorf("invalid %s: %w", l.key, err)
+		}
+		*l.limit = limit
+	}
+
+	return config, nil
+}
+
+// rateLimitStore returns the configured rate limit store
+func (s *Server) rateLimitStore() ratelimit.Store {
+	if s.rateLimitConfig.store != "postgres" || s.db == nil {
+		return ratelimit.NewMemoryStore()
+	}
+
+	store := ratelimit.NewPostgresStore(s.db)
+	store.Start(rateLimitCleanupInterval, func(err error) {
+		s.Logger.Errorf("rate limit cleanup error: %s", err)
+	})
+	return store
+}
+
+// RateLimitMiddleware limits API requests by client IP and bearer token, and locks out clients making too many
+// failed bearer token lookups.
+func (s *Server) RateLimitMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !s.rateLimitConfig.enabled {
+			return next(c)
+		}
+
+		ip := c.RealIP()
+		if strings.HasPrefix(c.Path(), "/api/auth") {
+			if err := s.rateLimit(c, "auth:ip:"+ip, s.rateLimitConfig.auth); err != nil {
+				return err
+			}
+			return next(c)
+		}
+
+		if err := s.rateLimit(c, "api:ip:"+ip, s.rateLimitConfig.api); err != nil {
+			return err
+		}
+
+		if bearer := getBearerToken(c); bearer != "" {
+			if err := s.checkLockout(c, ip); err != nil {
+				return err
+			}
+			key := fmt.Sprintf("api:token:%x", sha256.Sum256([]byte(bearer)))
+			if err := s.rateLimit(c, key, s.rateLimitConfig.api); err != nil {
+				return err
+			}
+		}
+
+		return next(c)
+	}
+}
+
+// UserRateLimitMiddleware limits API requests by authenticated user. It must follow AuthnMiddleware.
+func (s *Server) UserRateLimitMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := app.CurrentUser(c)
+		if !s.rateLimitConfig.enabled || user.ID == "" {
+			return next(c)
+		}
+
+		if err := s.rateLimit(c, "api:user:"+user.ID, s.rateLimitConfig.user); err != nil {
+			return err
+		}
+		return next(c)
+	}
+}
+
+// rateLimit takes a token from the bucket for key, and returns a 429 error if none is available. Store errors
+// are logged, and the request is allowed.
+func (s *Server) rateLimit(c echo.Context, key string, limit ratelimit.Limit) error {
+	res, err := s.rateLimiter.Take(c.Request().Context(), key, limit, 1)
+	if err != nil {
+		s.Logger.Errorf("rate limit error: %s", err)
+		return nil
+	}
+	if !res.Allowed {
+		return tooManyRequests(c, res.RetryAfter)
+	}
+	return nil
+}
+
+// checkLockout returns a 429 error if the client IP has used up its failed bearer token lookups
+func (s *Server) checkLockout(c echo.Context, ip string) error {
+	res, err := s.rateLimiter.Take(c.Request().Context(), "authfail:ip:"+ip, s.rateLimitConfig.failures, 0)
+	if err != nil {
+		s.Logger.Errorf("rate limit error: %s", err)
+		return nil
+	}
+	if res.Remaining < 1 {
+		s.Logger.Warnf("client %s is locked out after failed token lookups", ip)
+		return tooManyRequests(c, res.RetryAfter)
+	}
+	return nil
+}
+
+// recordAuthFailure counts a failed bearer token lookup against the client IP
+func (s *Server) recordAuthFailure(c echo.Context) {
+	if !s.rateLimitConfig.enabled {
+		return
+	}
+	_, err := s.rateLimiter.Take(c.Request().Context(), "authfail:ip:"+c.RealIP(), s.rateLimitConfig.failures, 1)
+	if err != nil {
+		s.Logger.Errorf("rate limit error: %s", err)
+	}
+}
+
+func tooManyRequests(c echo.Context, retryAfter time.Duration) error {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Response().Header().Set("Retry-After", strconv.Itoa(seconds))
+	return echo.NewHTTPError(http.StatusTooManyRequests, AuthError{Error: "too many requests"})
+}
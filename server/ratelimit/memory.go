@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pruneInterval is how often the memory store drops idle buckets
+const pruneInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// MemoryStore keeps token buckets in process memory. Limits are not shared between server instances.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+
+	// now returns the current time, and may be replaced for tests
+	now func() time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+// Take implements Store
+func (m *MemoryStore) Take(_ context.Context, key string, limit Limit, n float64) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.prune(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: limit.Burst, last: now}
+		m.buckets[key] = b
+	}
+
+	var result Result
+	b.tokens, result = take(b.tokens, b.last, now, limit, n)
+	b.last = now
+	b.limit = limit
+	return result, nil
+}
+
+// prune drops buckets that have refilled completely, since a new bucket starts full anyway
+func (m *MemoryStore) prune(now time.Time) {
+	if now.Sub(m.lastPrune) < pruneInterval {
+		return
+	}
+	m.lastPrune = now
+
+	for key, b := range m.buckets {
+		if b.limit.Rate <= 0 {
+			continue
+		}
+		refill := time.Duration((b.limit.Burst - b.tokens) / b.limit.Rate * float64(time.Second))
+		if now.Sub(b.last) >= refill {
+			delete(m.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// bucketRecord is a token bucket in the rate_limits table
+type bucketRecord struct {
+	Key       string `gorm:"primaryKey"`
+	Tokens    float64
+	UpdatedAt time.Time `gorm:"autoUpdateTime:false"`
+}
+
+func (bucketRecord) TableName() string {
+	return "rate_limits"
+}
+
+// takeSQL creates a bucket, or refills an existing bucket and takes tokens from it, only if enough tokens are
+// available. It returns the tokens left, or no row if the tokens were not taken.
+const takeSQL = `
+	INSERT INTO rate_limits AS r (key, tokens, updated_at)
+		VALUES (@key, CAST(@burst AS double precision) - CAST(@n AS double precision), @now)
+	ON CONFLICT (key) DO UPDATE
+		SET tokens = LEAST(@burst, r.tokens + GREATEST(EXTRACT(EPOCH FROM @now - r.updated_at), 0) * @rate) - @n,
+			updated_at = @now
+		WHERE LEAST(@burst, r.tokens + GREATEST(EXTRACT(EPOCH FROM @now - r.updated_at), 0) * @rate) >= @n
+	RETURNING tokens`
+
+// PostgresStore keeps token buckets in the rate_limits table, so that limits are shared between server instances.
+// It uses its own statements rather than the request transaction, so that tokens taken by a failed request stay
+// taken.
+type PostgresStore struct {
+	db *gorm.DB
+}
+
+// NewPostgresStore returns a PostgresStore using the given database connection
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Take implements Store. Tokens are taken with a single statement, which locks the bucket only while it runs. A
+// bucket left unchanged because it lacks tokens is read to report when it will have them.
+func (p *PostgresStore) Take(ctx context.Context, key string, limit Limit, n float64) (Result, error) {
+	now := time.Now()
+	if n <= limit.Burst {
+		var taken []bucketRecord
+		err := p.db.WithContext(ctx).Raw(takeSQL, sql.Named("key", key), sql.Named("burst", limit.Burst),
+			sql.Named("rate", limit.Rate), sql.Named("n", n), sql.Named("now", now)).Scan(&taken).Error
+		if err != nil {
+			return Result{}, err
+		}
+		if len(taken) > 0 {
+			_, result := take(taken[0].Tokens, now, now, limit, 0)
+			return result, nil
+		}
+	}
+
+	b := bucketRecord{Tokens: limit.Burst, UpdatedAt: now}
+	err := p.db.WithContext(ctx).First(&b, "key = ?", key).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return Result{}, err
+	}
+	_, result := take(b.Tokens, b.UpdatedAt, now, limit, n)
+	return result, nil
+}
+
+// DeleteIdle removes buckets not used since the given time. Such buckets are assumed to have refilled.
+func (p *PostgresStore) DeleteIdle(ctx context.Context, before time.Time) (int64, error) {
+	result := p.db.WithContext(ctx).Where("updated_at < ?", before).Delete(&bucketRecord{})
+	return result.RowsAffected, result.Error
+}
+
+// Start removes buckets idle for longer than the given interval, at that interval, until the returned function is
+// called. Errors are reported to onError.
+func (p *PostgresStore) Start(interval time.Duration, onError func(error)) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+			if _, err := p.DeleteIdle(context.Background(), time.Now().Add(-interval)); err != nil {
+				onError(err)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
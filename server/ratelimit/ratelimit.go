@@ -0,0 +1,89 @@
+// Package ratelimit implements token-bucket rate limiting with pluggable bucket storage
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit defines a token bucket holding up to Burst tokens, refilled at Rate tokens per second
+type Limit struct {
+	Rate  float64
+	Burst float64
+}
+
+// Result is the outcome of a Take
+type Result struct {
+	// Allowed is true if the requested tokens were taken
+	Allowed bool
+
+	// Remaining is the number of tokens left in the bucket
+	Remaining float64
+
+	// RetryAfter is the time until the bucket holds at least one token (or the requested amount, if not allowed)
+	RetryAfter time.Duration
+}
+
+// Store holds the state of the token buckets
+type Store interface {
+	// Take removes n tokens from the bucket identified by key. If the bucket holds fewer than n tokens, nothing is
+	// removed and the result is not allowed. A new bucket starts full.
+	Take(ctx context.Context, key string, limit Limit, n float64) (Result, error)
+}
+
+// ParseLimit parses a limit in the form "<count>/<unit>", e.g. "20/m", where unit is s, m, or h. The bucket
+// holds count tokens, and refills completely over one unit of time.
+func ParseLimit(s string) (Limit, error) {
+	countStr, unit, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, expected <count>/<unit>", s)
+	}
+
+	count, err := strconv.ParseFloat(countStr, 64)
+	if err != nil || count <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit count %q", countStr)
+	}
+
+	var period time.Duration
+	switch unit {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	default:
+		return Limit{}, fmt.Errorf("invalid rate limit unit %q, expected s, m, or h", unit)
+	}
+
+	return Limit{Rate: count / period.Seconds(), Burst: count}, nil
+}
+
+// take applies the token bucket algorithm to a bucket holding tokens as of last, and returns the new token
+// count along with the result
+func take(tokens float64, last, now time.Time, limit Limit, n float64) (float64, Result) {
+	if elapsed := now.Sub(last).Seconds(); elapsed > 0 {
+		tokens = math.Min(limit.Burst, tokens+elapsed*limit.Rate)
+	}
+
+	allowed := tokens >= n
+	if allowed {
+		tokens -= n
+	}
+
+	want := 1.0
+	if !allowed {
+		want = n
+	}
+
+	var retryAfter time.Duration
+	if tokens < want && limit.Rate > 0 {
+		retryAfter = time.Duration((want - tokens) / limit.Rate * float64(time.Second))
+	}
+
+	return tokens, Result{Allowed: allowed, Remaining: tokens, RetryAfter: retryAfter}
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr bool
+	}{
+		{in: "20/m", want: Limit{Rate: 20.0 / 60, Burst: 20}},
+		{in: "10/h", want: Limit{Rate: 10.0 / 3600, Burst: 10}},
+		{in: "5/s", want: Limit{Rate: 5, Burst: 5}},
+		{in: "5", wantErr: true},
+		{in: "0/m", wantErr: true},
+		{in: "x/m", wantErr: true},
+		{in: "5/d", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseLimit(tt.in)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.InDelta(t, tt.want.Rate, got.Rate, 1e-9)
+			require.Equal(t, tt.want.Burst, got.Burst)
+		})
+	}
+}
+
+func TestMemoryStore_Take(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	limit := Limit{Rate: 1, Burst: 3}
+
+	// a new bucket starts full
+	for i := 0; i < 3; i++ {
+		res, err := store.Take(ctx, "k", limit, 1)
+		require.NoError(t, err)
+		require.True(t, res.Allowed, "take %d", i)
+	}
+
+	res, err := store.Take(ctx, "k", limit, 1)
+	require.NoError(t, err)
+	require.False(t, res.Allowed)
+	require.Equal(t, time.Second, res.RetryAfter)
+
+	// other keys have their own bucket
+	res, err = store.Take(ctx, "other", limit, 1)
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+
+	// taking zero tokens reports the remaining tokens without using any
+	res, err = store.Take(ctx, "k", limit, 0)
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+	require.Zero(t, res.Remaining)
+
+	// the bucket refills over time, up to the burst size
+	now = now.Add(1500 * time.Millisecond)
+	res, err = store.Take(ctx, "k", limit, 1)
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+	require.InDelta(t, 0.5, res.Remaining, 1e-9)
+
+	now = now.Add(time.Hour)
+	res, err = store.Take(ctx, "k", limit, 0)
+	require.NoError(t, err)
+	require.Equal(t, 3.0, res.Remaining)
+}
+
+func TestMemoryStore_prune(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	_, err := store.Take(ctx, "k", Limit{Rate: 1, Burst: 3}, 3)
+	require.NoError(t, err)
+	require.Len(t, store.buckets, 1)
+
+	now = now.Add(2 * time.Second)
+	_, err = store.Take(ctx, "other", Limit{Rate: 1, Burst: 3}, 1)
+	require.NoError(t, err)
+	require.Len(t, store.buckets, 2, "partially refilled bucket should be kept")
+
+	now = now.Add(2 * time.Minute)
+	_, err = store.Take(ctx, "other", Limit{Rate: 1, Burst: 3}, 1)
+	require.NoError(t, err)
+	require.Len(t, store.buckets, 1, "refilled bucket should be dropped")
+}
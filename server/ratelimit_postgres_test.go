@@ -0,0 +1,90 @@
+package server_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/briskt/keygo/server/ratelimit"
+)
+
+func (ts *TestSuite) Test_PostgresStore() {
+	ctx := context.Background()
+	ts.NoError(ts.tx.Exec("DELETE FROM rate_limits").Error)
+	store := ratelimit.NewPostgresStore(ts.tx)
+	limit := ratelimit.Limit{Rate: 1, Burst: 3}
+
+	// age moves the last use of a bucket back in time
+	age := func(key, interval string) {
+		err := ts.tx.Exec("UPDATE rate_limits SET updated_at = updated_at - CAST(? AS interval) WHERE key = ?",
+			interval, key).Error
+		ts.NoError(err)
+	}
+
+	// a new bucket starts full
+	for i := 0; i < 3; i++ {
+		res, err := store.Take(ctx, "k", limit, 1)
+		ts.NoError(err)
+		ts.True(res.Allowed, "take %d", i)
+		ts.InDelta(float64(2-i), res.Remaining, 0.1)
+	}
+
+	res, err := store.Take(ctx, "k", limit, 1)
+	ts.NoError(err)
+	ts.False(res.Allowed)
+	ts.InDelta(time.Second.Seconds(), res.RetryAfter.Seconds(), 0.1)
+
+	// other keys have their own bucket
+	res, err = store.Take(ctx, "other", limit, 1)
+	ts.NoError(err)
+	ts.True(res.Allowed)
+
+	// more tokens than the bucket holds are never allowed
+	res, err = store.Take(ctx, "new", limit, 4)
+	ts.NoError(err)
+	ts.False(res.Allowed)
+
+	// the bucket refills over time, up to the burst size
+	age("k", "1500 milliseconds")
+	res, err = store.Take(ctx, "k", limit, 1)
+	ts.NoError(err)
+	ts.True(res.Allowed)
+	ts.InDelta(0.5, res.Remaining, 0.1)
+
+	age("k", "1 hour")
+	res, err = store.Take(ctx, "k", limit, 0)
+	ts.NoError(err)
+	ts.InDelta(3.0, res.Remaining, 0.1)
+
+	// idle buckets are removed
+	age("other", "1 hour")
+	n, err := store.DeleteIdle(ctx, time.Now().Add(-time.Minute))
+	ts.NoError(err)
+	ts.Equal(int64(1), n)
+}
+
+func (ts *TestSuite) Test_PostgresStore_lockout() {
+	ctx := context.Background()
+	ts.NoError(ts.tx.Exec("DELETE FROM rate_limits").Error)
+	store := ratelimit.NewPostgresStore(ts.tx)
+	failures := ratelimit.Limit{Rate: 1.0 / 3600, Burst: 2}
+
+	// a lockout check takes no tokens
+	res, err := store.Take(ctx, "authfail:ip:10.0.0.1", failures, 0)
+	ts.NoError(err)
+	ts.InDelta(2.0, res.Remaining, 0.01)
+
+	for i := 0; i < 2; i++ {
+		_, err = store.Take(ctx, "authfail:ip:10.0.0.1", failures, 1)
+		ts.NoError(err)
+	}
+
+	// with no failures left, the client is locked out until a token refills
+	res, err = store.Take(ctx, "authfail:ip:10.0.0.1", failures, 0)
+	ts.NoError(err)
+	ts.Less(res.Remaining, 1.0)
+	ts.InDelta(time.Hour.Seconds(), res.RetryAfter.Seconds(), 5)
+
+	res, err = store.Take(ctx, "authfail:ip:10.0.0.2", failures, 0)
+	ts.NoError(err)
+	ts.InDelta(2.0, res.Remaining, 0.01, "other clients are not locked out")
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/briskt/keygo/server/ratelimit"
+)
+
+func Test_RateLimitMiddleware(t *testing.T) {
+	s := &Server{
+		Echo: echo.New(),
+		rateLimitConfig: rateLimitConfig{
+			enabled:  true,
+			auth:     ratelimit.Limit{Rate: 1.0 / 60, Burst: 1},
+			api:      ratelimit.Limit{Rate: 2.0 / 60, Burst: 2},
+			failures: ratelimit.Limit{Rate: 1.0 / 3600, Burst: 1},
+		},
+		rateLimiter: ratelimit.NewMemoryStore(),
+	}
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	s.GET("/api/auth/login", ok, s.RateLimitMiddleware)
+	s.GET("/api/users", ok, s.RateLimitMiddleware)
+
+	request := func(path, ip, bearer string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		if bearer != "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+bearer)
+		}
+		res := httptest.NewRecorder()
+		s.ServeHTTP(res, req)
+		return res
+	}
+
+	// auth routes have their own budget
+	require.Equal(t, http.StatusOK, request("/api/auth/login", "10.0.0.1", "").Code)
+	res := request("/api/auth/login", "10.0.0.1", "")
+	require.Equal(t, http.StatusTooManyRequests, res.Code)
+	requireRetryAfter(t, res, 60)
+
+	// API routes are limited per IP
+	require.Equal(t, http.StatusOK, request("/api/users", "10.0.0.1", "").Code)
+	require.Equal(t, http.StatusOK, request("/api/users", "10.0.0.1", "").Code)
+	require.Equal(t, http.StatusTooManyRequests, request("/api/users", "10.0.0.1", "").Code)
+	require.Equal(t, http.StatusOK, request("/api/users", "10.0.0.2", "").Code)
+
+	// failed bearer token lookups lock out the client IP
+	require.Equal(t, http.StatusOK, request("/api/users", "10.0.0.3", "guess").Code)
+	c := s.NewContext(httptest.NewRequest(http.MethodGet, "/api/users", nil), httptest.NewRecorder())
+	c.Request().RemoteAddr = "10.0.0.3:1234"
+	s.recordAuthFailure(c)
+	res = request("/api/users", "10.0.0.3", "guess")
+	require.Equal(t, http.StatusTooManyRequests, res.Code)
+	requireRetryAfter(t, res, 3600)
+}
+
+// requireRetryAfter checks the Retry-After header, allowing for the time taken by the test
+func requireRetryAfter(t *testing.T, res *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	got, err := strconv.Atoi(res.Header().Get("Retry-After"))
+	require.NoError(t, err)
+	require.InDelta(t, want, got, 1)
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"encoding/base64"
+	"net/http"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+	"github.com/briskt/keygo/keys"
+)
+
+// rekeyState is a rekey in progress: the new share set, and the current shares given so far
+type rekeyState struct {
+	mu     sync.Mutex
+	input  *app.MasterKeySharesInput
+	shares keys.ShareCollector
+}
+
+// sysInitHandler splits the master key into shares, generating a new master key if there is none yet. An existing
+// master key can be split only while the server is unsealed. The shares are of a new unseal key, under which the
+// master key is wrapped, and are returned only once.
+func (s *Server) sysInitHandler(c echo.Context) error {
+	var input app.MasterKeySharesInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+	if err = input.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+	}
+
+	check, initialized, err := s.findMasterKeyCheck()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+	if check.Threshold > 0 {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			AuthError{Error: "the master key is already split into shares, rekey to change them"})
+	}
+
+	if !initialized {
+		key, err := keys.NewKey()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+		}
+		if err = s.unseal(key); err != nil {
+			if app.ErrorCode(err) == app.ERR_INVALID {
+				return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+		}
+	} else if s.barrier.Sealed() {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, AuthError{Error: keys.ErrSealed.Error()})
+	}
+
+	unsealKey, err := keys.NewKey()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+	wrappedMasterKey, err := s.barrier.WrapMaster(unsealKey)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+	shares, err := keys.SplitSecret(unsealKey, input.ShareCount, input.Threshold)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+	err = db.SetMasterKeyShares(s.db, s.barrier, wrappedMasterKey, input.ShareCount, input.Threshold)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s split the master key into %d shares with a threshold of %d",
+		app.CurrentUser(c).ID, input.ShareCount, input.Threshold)
+	if s.sealConfig.provider != masterKeyProviderSealed {
+		s.Logger.Warnf("set MASTER_KEY_PROVIDER=%s and remove the master key from the environment before restarting",
+			masterKeyProviderSealed)
+	}
+
+	return c.JSON(http.StatusOK, app.MasterKeyShares{Shares: encodeShares(shares), Threshold: input.Threshold})
+}
+
+func (s *Server) sysRekeyStatusHandler(c echo.Context) error {
+	return s.respondRekeyStatus(c)
+}
+
+// sysRekeyInitHandler starts a rekey to a new share set. The rekey completes once the threshold of the current
+// shares has been given.
+func (s *Server) sysRekeyInitHandler(c echo.Context) error {
+	var input app.MasterKeySharesInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+	if err = input.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+	}
+
+	check, _, err := s.findMasterKeyCheck()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+	if check.Threshold == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: "the master key is not split into shares"})
+	}
+
+	s.rekey.mu.Lock()
+	if s.rekey.input != nil {
+		s.rekey.mu.Unlock()
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: "a rekey is already in progress"})
+	}
+	s.rekey.input = &input
+	s.rekey.shares.Reset()
+	s.rekey.mu.Unlock()
+
+	s.Logger.Infof("user %s started a rekey to %d shares with a threshold of %d", app.CurrentUser(c).ID,
+		input.ShareCount, input.Threshold)
+
+	return s.respondRekeyStatus(c)
+}
+
+// sysRekeyHandler takes one of the current shares. Once enough are given, the master key they unwrap is wrapped
+// under a new unseal key, which is split into the new share set and returned only once. The current shares no longer
+// unseal. The master key itself is unchanged, so no data is re-encrypted.
+func (s *Server) sysRekeyHandler(c echo.Context) error {
+	var input app.ShareInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+	share, err := base64.StdEncoding.DecodeString(input.Share)
+	if err != nil || len(share) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: "share must be base64 encoded"})
+	}
+
+	check, _, err := s.findMasterKeyCheck()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	actor := app.CurrentUser(c)
+	s.rekey.mu.Lock()
+	defer s.rekey.mu.Unlock()
+	if s.rekey.input == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: "no rekey is in progress"})
+	}
+
+	key, progress, err := s.rekey.shares.Add(share, check.Threshold)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: err.Error()})
+	}
+	if key == nil {
+		s.Logger.Infof("user %s gave rekey share %d of %d", actor.ID, progress, check.Threshold)
+		return s.respondRekeyStatusLocked(c, check)
+	}
+
+	key, err = masterKeyFromShares(check, key)
+	var master *keys.MasterKey
+	if err == nil {
+		master, err = keys.NewMasterKey(key)
+	}
+	if err == nil {
+		err = db.VerifyMasterKey(s.db, master)
+	}
+	if err != nil {
+		s.Logger.Warnf("user %s failed to rekey: %s", actor.ID, err)
+		return echo.NewHTTPError(http.StatusBadRequest,
+			AuthError{Error: "the shares do not reconstruct the master key"})
+	}
+
+	newInput := *s.rekey.input
+	unsealKey, err := keys.NewKey()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+	wrappedMasterKey, err := keys.WrapMasterKey(unsealKey, key)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+	shares, err := keys.SplitSecret(unsealKey, newInput.ShareCount, newInput.Threshold)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+	err = db.SetMasterKeyShares(s.db, master, wrappedMasterKey, newInput.ShareCount, newInput.Threshold)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+	s.rekey.input = nil
+
+	// unseal shares given so far are of the old unseal key
+	s.unsealShares.Reset()
+
+	s.Logger.Infof("user %s completed a rekey to %d shares with a threshold of %d", actor.ID,
+		newInput.ShareCount, newInput.Threshold)
+
+	return c.JSON(http.StatusOK, app.RekeyStatus{
+		ShareCount: newInput.ShareCount,
+		Threshold:  newInput.Threshold,
+		Shares:     encodeShares(shares),
+	})
+}
+
+func (s *Server) sysRekeyCancelHandler(c echo.Context) error {
+	s.rekey.mu.Lock()
+	s.rekey.input = nil
+	s.rekey.shares.Reset()
+	s.rekey.mu.Unlock()
+
+	s.Logger.Infof("user %s canceled the rekey", app.CurrentUser(c).ID)
+
+	return s.respondRekeyStatus(c)
+}
+
+func (s *Server) respondRekeyStatus(c echo.Context) error {
+	check, _, err := s.findMasterKeyCheck()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+	s.rekey.mu.Lock()
+	defer s.rekey.mu.Unlock()
+	return s.respondRekeyStatusLocked(c, check)
+}
+
+// respondRekeyStatusLocked responds with the rekey status. The caller must hold s.rekey.mu.
+func (s *Server) respondRekeyStatusLocked(c echo.Context, check db.MasterKeyCheck) error {
+	status := app.RekeyStatus{Required: check.Threshold}
+	if s.rekey.input != nil {
+		status.Started = true
+		status.ShareCount = s.rekey.input.ShareCount
+		status.Threshold = s.rekey.input.Threshold
+		status.Progress = s.rekey.shares.Progress()
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+// encodeShares returns the shares base64 encoded
+func encodeShares(shares [][]byte) []string {
+	encoded := make([]string, len(shares))
+	for i, share := range shares {
+		encoded[i] = base64.StdEncoding.EncodeToString(share)
+	}
+	return encoded
+}
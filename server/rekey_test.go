@@ -0,0 +1,123 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"github.com/briskt/keygo/app"
+)
+
+func (ts *TestSuite) Test_sysRekeyHandler() {
+	admin := ts.createUserFixture(app.UserRoleAdmin)
+	user := ts.createUserFixture(app.UserRoleBasic)
+
+	// the master key check is shared by the whole suite, so leave the master key unsplit and the server unsealed
+	defer func() {
+		ts.NoError(ts.tx.Exec("UPDATE master_key_check SET share_count = 0, threshold = 0").Error)
+		_, _ = ts.request(http.MethodDelete, "/api/sys/rekey", admin.Email, nil)
+		_, _ = ts.request(http.MethodPost, "/api/sys/seal", admin.Email, nil)
+		_, status := ts.request(http.MethodPost, "/api/sys/unseal", admin.Email,
+			app.UnsealInput{Key: os.Getenv("MASTER_KEY")})
+		ts.Equal(http.StatusOK, status)
+	}()
+
+	initInput := app.MasterKeySharesInput{ShareCount: 3, Threshold: 2}
+	_, status := ts.request(http.MethodPost, "/api/sys/init", user.Email, initInput)
+	ts.Equal(http.StatusNotFound, status, "only operators may split the master key")
+
+	_, status = ts.request(http.MethodPost, "/api/sys/init", admin.Email, app.MasterKeySharesInput{ShareCount: 3})
+	ts.Equal(http.StatusBadRequest, status, "a threshold of at least 2 is required")
+
+	body, status := ts.request(http.MethodPost, "/api/sys/init", admin.Email, initInput)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var shares app.MasterKeyShares
+	ts.NoError(json.Unmarshal(body, &shares))
+	ts.Len(shares.Shares, 3)
+	ts.Equal(2, shares.Threshold)
+
+	_, status = ts.request(http.MethodPost, "/api/sys/init", admin.Email, initInput)
+	ts.Equal(http.StatusBadRequest, status, "the master key is already split")
+
+	// unseal with shares
+	_, status = ts.request(http.MethodPost, "/api/sys/seal", admin.Email, nil)
+	ts.Equal(http.StatusOK, status)
+
+	_, status = ts.request(http.MethodPost, "/api/sys/unseal", admin.Email,
+		app.UnsealInput{Key: os.Getenv("MASTER_KEY")})
+	ts.Equal(http.StatusBadRequest, status, "the whole key is refused once it is split")
+
+	body, status = ts.request(http.MethodPost, "/api/sys/unseal", admin.Email, app.UnsealInput{Share: shares.Shares[2]})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var sealStatus app.SealStatus
+	ts.NoError(json.Unmarshal(body, &sealStatus))
+	ts.True(sealStatus.Sealed)
+	ts.Equal(1, sealStatus.Progress)
+	ts.Equal(2, sealStatus.Threshold)
+	ts.Equal(3, sealStatus.ShareCount)
+
+	_, status = ts.request(http.MethodPost, "/api/sys/unseal", admin.Email, app.UnsealInput{Share: shares.Shares[2]})
+	ts.Equal(http.StatusBadRequest, status, "the same share is not counted twice")
+
+	body, status = ts.request(http.MethodPost, "/api/sys/unseal", admin.Email, app.UnsealInput{Share: shares.Shares[0]})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	sealStatus = app.SealStatus{}
+	ts.NoError(json.Unmarshal(body, &sealStatus))
+	ts.False(sealStatus.Sealed)
+	ts.Equal(0, sealStatus.Progress)
+
+	// rekey to a new share set
+	_, status = ts.request(http.MethodPost, "/api/sys/rekey", admin.Email, app.ShareInput{Share: shares.Shares[0]})
+	ts.Equal(http.StatusBadRequest, status, "no rekey is in progress")
+
+	rekeyInput := app.MasterKeySharesInput{ShareCount: 5, Threshold: 3}
+	_, status = ts.request(http.MethodPost, "/api/sys/rekey/init", user.Email, rekeyInput)
+	ts.Equal(http.StatusNotFound, status, "only operators may rekey")
+
+	body, status = ts.request(http.MethodPost, "/api/sys/rekey/init", admin.Email, rekeyInput)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var rekeyStatus app.RekeyStatus
+	ts.NoError(json.Unmarshal(body, &rekeyStatus))
+	ts.True(rekeyStatus.Started)
+	ts.Equal(2, rekeyStatus.Required)
+
+	body, status = ts.request(http.MethodPost, "/api/sys/rekey", admin.Email, app.ShareInput{Share: shares.Shares[1]})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	rekeyStatus = app.RekeyStatus{}
+	ts.NoError(json.Unmarshal(body, &rekeyStatus))
+	ts.Equal(1, rekeyStatus.Progress)
+	ts.Empty(rekeyStatus.Shares)
+
+	body, status = ts.request(http.MethodPost, "/api/sys/rekey", admin.Email, app.ShareInput{Share: shares.Shares[2]})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	rekeyStatus = app.RekeyStatus{}
+	ts.NoError(json.Unmarshal(body, &rekeyStatus))
+	ts.False(rekeyStatus.Started)
+	ts.Len(rekeyStatus.Shares, 5)
+
+	// the new shares unseal the same master key
+	_, status = ts.request(http.MethodPost, "/api/sys/seal", admin.Email, nil)
+	ts.Equal(http.StatusOK, status)
+	for _, share := range rekeyStatus.Shares[2:] {
+		body, status = ts.request(http.MethodPost, "/api/sys/unseal", admin.Email, app.UnsealInput{Share: share})
+		ts.Equal(http.StatusOK, status, "body: %s", body)
+	}
+	sealStatus = app.SealStatus{}
+	ts.NoError(json.Unmarshal(body, &sealStatus))
+	ts.False(sealStatus.Sealed)
+	ts.Equal(3, sealStatus.Threshold)
+
+	// the old shares are revoked, even though they reconstruct the old unseal key
+	_, status = ts.request(http.MethodPost, "/api/sys/seal", admin.Email, nil)
+	ts.Equal(http.StatusOK, status)
+	for _, share := range shares.Shares[:2] {
+		body, status = ts.request(http.MethodPost, "/api/sys/unseal", admin.Email, app.UnsealInput{Share: share})
+	}
+	ts.Equal(http.StatusBadRequest, status, "old shares no longer unseal, body: %s", body)
+	body, status = ts.request(http.MethodGet, "/api/sys/seal-status", admin.Email, nil)
+	ts.Equal(http.StatusOK, status)
+	sealStatus = app.SealStatus{}
+	ts.NoError(json.Unmarshal(body, &sealStatus))
+	ts.True(sealStatus.Sealed)
+	ts.Equal(0, sealStatus.Progress)
+}
@@ -0,0 +1,17 @@
+package server
+
+import (
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+)
+
+// bypassRLS lifts row-level security for the rest of the request transaction. It is used for operations on behalf
+// of global permissions, and for system operations that must see rows of all tenants, such as login. Every use is
+// logged, and recorded in the rls_bypasses table once the request transaction ends.
+func bypassRLS(c echo.Context, reason string) error {
+	user := app.CurrentUser(c)
+	c.Logger().Infof("RLS bypass by user %q: %s (%s %s)", user.ID, reason, c.Request().Method, c.Request().URL.Path)
+	return db.BypassRLS(c, user.ID, reason)
+}
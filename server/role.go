@@ -0,0 +1,136 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+)
+
+func (s *Server) rolesListHandler(c echo.Context) error {
+	roles, err := db.FindRoles(c, app.RoleFilter{})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	out := make([]app.Role, len(roles))
+	for i, role := range roles {
+		out[i], err = db.ConvertRole(c, role)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, out)
+}
+
+func (s *Server) rolesCreateHandler(c echo.Context) error {
+	var input app.RoleCreateInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	if !canGrant(app.CurrentUser(c), input.Permissions) {
+		return echo.NewHTTPError(http.StatusForbidden, AuthError{Error: "cannot grant permissions you do not hold"})
+	}
+
+	role, err := db.CreateRole(c, input)
+	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	r, err := db.ConvertRole(c, role)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	s.Logger.Infof("created role (name %q, id %q, permissions %v)", role.Name, role.ID, role.Permissions)
+
+	return c.JSON(http.StatusOK, r)
+}
+
+func (s *Server) usersRoleAssignHandler(c echo.Context) error {
+	var input app.UserRoleAssignInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	return s.assignRole(c, c.Param("id"), input)
+}
+
+// assignRole assigns a role to a user on behalf of the current user, and writes the updated user to the response
+func (s *Server) assignRole(c echo.Context, userID string, input app.UserRoleAssignInput) error {
+	actor := app.CurrentUser(c)
+	if userID == actor.ID {
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: "cannot change your own role"})
+	}
+
+	role, err := db.FindRoleByID(c, input.RoleID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: "role does not exist"})
+	}
+	if !canGrant(actor, role.Permissions) {
+		return echo.NewHTTPError(http.StatusForbidden, AuthError{Error: "cannot grant permissions you do not hold"})
+	}
+
+	// the target's current permissions are revoked, so the actor must hold those too, or e.g. anyone who can assign
+	// roles could demote an Admin
+	target, err := db.FindUserByID(c, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+	currentRole, err := db.FindRoleByID(c, target.RoleID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+	if !canGrant(actor, currentRole.Permissions) {
+		return echo.NewHTTPError(http.StatusForbidden, AuthError{Error: "cannot revoke permissions you do not hold"})
+	}
+
+	updatedUser, err := db.AssignUserRole(c, userID, input)
+	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	user, err := db.ConvertUser(c, updatedUser)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	s.Logger.Infof("user %s assigned role %q to user %s", actor.ID, user.Role, user.ID)
+
+	return c.JSON(http.StatusOK, user)
+}
+
+// canGrant returns true if the actor holds every one of the given permissions, preventing privilege escalation
+// through role management
+func canGrant(actor app.User, permissions []string) bool {
+	for _, p := range permissions {
+		if !actor.HasPermission(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// canGrantInTenant returns true if the actor holds every one of the given permissions, either globally or through
+// their membership role in the given tenant
+func canGrantInTenant(actor app.User, tenantID string, permissions []string) bool {
+	m, _ := actor.Membership(tenantID)
+	for _, p := range permissions {
+		if !actor.HasPermission(p) && !app.HasPermission(m.Permissions, p) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,157 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+)
+
+func (ts *TestSuite) Test_RequirePermission() {
+	role, err := db.CreateRole(ts.ctx, app.RoleCreateInput{
+		Name:        "Tenant Viewer " + RandStr(6),
+		Permissions: []string{app.PermissionTenantsList},
+	})
+	ts.NoError(err)
+
+	viewer := ts.createUserFixture(app.UserRoleBasic)
+	_, err = db.AssignUserRole(ts.ctx, viewer.ID, app.UserRoleAssignInput{RoleID: role.ID})
+	ts.NoError(err)
+
+	_, status := ts.request(http.MethodGet, "/api/tenants", viewer.Email, nil)
+	ts.Equal(http.StatusOK, status, "role with tenants.list should list tenants")
+
+	_, status = ts.request(http.MethodPost, "/api/tenants", viewer.Email, app.TenantCreateInput{Name: "x"})
+	ts.Equal(http.StatusNotFound, status, "role without tenants.create should not create tenants")
+}
+
+func (ts *TestSuite) Test_rolesCreateHandler() {
+	user := ts.createUserFixture(app.UserRoleBasic)
+	admin := ts.createUserFixture(app.UserRoleAdmin)
+
+	tests := []struct {
+		name       string
+		actor      db.User
+		input      app.RoleCreateInput
+		wantStatus int
+	}{
+		{
+			name:       "a user cannot create a role",
+			actor:      user,
+			input:      app.RoleCreateInput{Name: "Viewer", Permissions: []string{app.PermissionTenantsList}},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "unknown permission",
+			actor:      admin,
+			input:      app.RoleCreateInput{Name: "Bogus", Permissions: []string{"bogus"}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "admin can create a role",
+			actor:      admin,
+			input:      app.RoleCreateInput{Name: "Viewer", Permissions: []string{app.PermissionTenantsList}},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		ts.T().Run(tt.name, func(t *testing.T) {
+			body, status := ts.request(http.MethodPost, "/api/roles", tt.actor.Email, tt.input)
+			ts.Equal(tt.wantStatus, status, "incorrect http status, body: \n%s", body)
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var got app.Role
+			ts.NoError(json.Unmarshal(body, &got))
+			ts.Equal(tt.input.Name, got.Name)
+			ts.Equal(tt.input.Permissions, got.Permissions)
+		})
+	}
+}
+
+func (ts *TestSuite) Test_usersRoleAssignHandler() {
+	user := ts.createUserFixture(app.UserRoleBasic)
+	admin := ts.createUserFixture(app.UserRoleAdmin)
+
+	assigner, err := db.CreateRole(ts.ctx, app.RoleCreateInput{
+		Name:        "Assigner " + RandStr(6),
+		Permissions: []string{app.PermissionRolesAssign},
+	})
+	ts.NoError(err)
+	manager := ts.createUserFixture(app.UserRoleBasic)
+	_, err = db.AssignUserRole(ts.ctx, manager.ID, app.UserRoleAssignInput{RoleID: assigner.ID})
+	ts.NoError(err)
+
+	roles, err := db.FindRoles(ts.ctx, app.RoleFilter{})
+	ts.NoError(err)
+	roleIDs := map[string]string{}
+	for _, r := range roles {
+		roleIDs[r.Name] = r.ID
+	}
+
+	tests := []struct {
+		name       string
+		actor      db.User
+		userID     string
+		roleID     string
+		wantStatus int
+	}{
+		{
+			name:       "a user cannot assign roles",
+			actor:      user,
+			userID:     user.ID,
+			roleID:     roleIDs[app.UserRoleAdmin],
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "cannot grant permissions the actor does not hold",
+			actor:      manager,
+			userID:     user.ID,
+			roleID:     roleIDs[app.UserRoleAdmin],
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "cannot revoke permissions the actor does not hold",
+			actor:      manager,
+			userID:     admin.ID,
+			roleID:     roleIDs[app.UserRoleBasic],
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "unknown role",
+			actor:      admin,
+			userID:     user.ID,
+			roleID:     "nope",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "admin can assign a role",
+			actor:      admin,
+			userID:     user.ID,
+			roleID:     assigner.ID,
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		ts.T().Run(tt.name, func(t *testing.T) {
+			input := app.UserRoleAssignInput{RoleID: tt.roleID}
+			body, status := ts.request(http.MethodPut, "/api/users/"+tt.userID+"/role", tt.actor.Email, input)
+			ts.Equal(tt.wantStatus, status, "incorrect http status, body: \n%s", body)
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var got app.User
+			ts.NoError(json.Unmarshal(body, &got))
+			ts.Equal(tt.roleID, got.RoleID)
+			ts.Equal([]string{app.PermissionRolesAssign}, got.Permissions)
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package server
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+	"github.com/briskt/keygo/keys"
+)
+
+// Master key providers, selected by MASTER_KEY_PROVIDER
+const (
+	masterKeyProviderEnv        = "env"
+	masterKeyProviderFile       = "file"
+	masterKeyProviderPassphrase = "passphrase"
+	masterKeyProviderSealed     = "sealed"
+)
+
+// sealConfig holds the master key settings read from the environment
+type sealConfig struct {
+	provider   string
+	keyFile    string
+	passphrase string
+	salt       []byte
+}
+
+// loadSealConfig reads the master key settings from the environment:
+//
+//   - MASTER_KEY_PROVIDER: env (MASTER_KEY), file (MASTER_KEY_FILE), passphrase (MASTER_KEY_PASSPHRASE), or sealed to
+//     start sealed until an operator unseals the server. Defaults to env if MASTER_KEY is set, and otherwise sealed.
+//     Must be sealed once the master key is split into shares.
+//   - MASTER_KEY_SALT: the base64-encoded salt from which a passphrase derives the master key, for the passphrase
+//     provider or to unseal with a passphrase
+func loadSealConfig() (sealConfig, error) {
+	config := sealConfig{
+		provider:   os.Getenv("MASTER_KEY_PROVIDER"),
+		keyFile:    os.Getenv("MASTER_KEY_FILE"),
+		passphrase: os.Getenv("MASTER_KEY_PASSPHRASE"),
+	}
+	if config.provider == "" {
+		config.provider = masterKeyProviderSealed
+		if os.Getenv("MASTER_KEY") != "" {
+			config.provider = masterKeyProviderEnv
+		}
+	}
+
+	if v := os.Getenv("MASTER_KEY_SALT"); v != "" {
+		salt, err := base64.StdEncoding.DecodeString(v)
+		if err != nil || len(salt) < keys.MinSaltSize {
+			return sealConfig{}, fmt.Errorf("MASTER_KEY_SALT must be at least %d base64-encoded bytes", keys.MinSaltSize)
+		}
+		config.salt = salt
+	}
+
+	switch config.provider {
+	case masterKeyProviderEnv, masterKeyProviderSealed:
+	case masterKeyProviderFile:
+		if config.keyFile == "" {
+			return sealConfig{}, fmt.Errorf("MASTER_KEY_FILE is required for MASTER_KEY_PROVIDER=file")
+		}
+	case masterKeyProviderPassphrase:
+		if config.passphrase == "" || config.salt == nil {
+			return sealConfig{}, fmt.Errorf(
+				"MASTER_KEY_PASSPHRASE and MASTER_KEY_SALT are required for MASTER_KEY_PROVIDER=passphrase")
+		}
+	default:
+		return sealConfig{}, fmt.Errorf("invalid MASTER_KEY_PROVIDER %q, expected env, file, passphrase, or sealed",
+			config.provider)
+	}
+	return config, nil
+}
+
+// keyProvider returns the configured master key provider, or nil if the server starts sealed
+func (c sealConfig) keyProvider() keys.Provider {
+	switch c.provider {
+	case masterKeyProviderEnv:
+		return keys.EnvProvider{Name: "MASTER_KEY"}
+	case masterKeyProviderFile:
+		return keys.FileProvider{Path: c.keyFile}
+	case masterKeyProviderPassphrase:
+		return keys.PassphraseProvider{Passphrase: c.passphrase, Salt: c.salt}
+	}
+	return nil
+}
+
+// startBarrier unseals the barrier with the master key from the configured provider, unless the server starts
+// sealed. Once the master key is split into shares, only the shares may unseal it, so the server must start sealed.
+func (s *Server) startBarrier() error {
+	provider := s.sealConfig.keyProvider()
+	if provider == nil {
+		s.Logger.Warn("starting sealed, tenant key operations are refused until an operator unseals the server")
+		return nil
+	}
+	check, _, err := s.findMasterKeyCheck()
+	if err != nil {
+		return err
+	}
+	if check.Threshold > 0 {
+		return fmt.Errorf("the master key is split into shares, so MASTER_KEY_PROVIDER must be %s, not %s",
+			masterKeyProviderSealed, s.sealConfig.provider)
+	}
+	key, err := provider.MasterKey()
+	if err != nil {
+		return err
+	}
+	return s.unseal(key)
+}
+
+// unseal verifies the master key against the database, and gives it to the barrier
+func (s *Server) unseal(key []byte) error {
+	master, err := keys.NewMasterKey(key)
+	if err != nil {
+		return app.Errorf(app.ERR_INVALID, "Invalid master key: %s", err)
+	}
+	if s.db != nil {
+		if err = db.VerifyMasterKey(s.db, master); err != nil {
+			return err
+		}
+	}
+	return s.barrier.Unseal(key)
+}
+
+// masterKeyFromShares returns the master key, given the secret reconstructed from its shares. The secret is the
+// unseal key that the master key is wrapped with, or the master key itself if it was split before unseal keys were
+// introduced.
+func masterKeyFromShares(check db.MasterKeyCheck, secret []byte) ([]byte, error) {
+	if check.WrappedMasterKey == nil {
+		return secret, nil
+	}
+	key, err := keys.UnwrapMasterKey(secret, check.WrappedMasterKey)
+	if err != nil {
+		return nil, app.Errorf(app.ERR_INVALID, "The shares do not reconstruct the unseal key")
+	}
+	return key, nil
+}
+
+// RequireUnsealed is a middleware that responds "service unavailable" while the server is sealed
+func (s *Server) RequireUnsealed(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if s.barrier.Sealed() {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, AuthError{Error: keys.ErrSealed.Error()})
+		}
+		return next(c)
+	}
+}
+
+func (s *Server) sysSealStatusHandler(c echo.Context) error {
+	return s.respondSealStatus(c)
+}
+
+// sysUnsealHandler unseals this server instance, with the master key, its passphrase, or one share at a time if
+// the master key is split into shares. Each instance holds the master key and the shares given so far in its own
+// memory, so each must be unsealed.
+func (s *Server) sysUnsealHandler(c echo.Context) error {
+	var input app.UnsealInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+	if err = input.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+	}
+
+	check, _, err := s.findMasterKeyCheck()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+	if (input.Share != "") != (check.Threshold > 0) {
+		if input.Share != "" {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: "the master key is not split into shares"})
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: "the master key must be unsealed with shares"})
+	}
+
+	var key []byte
+	switch {
+	case input.Share != "":
+		var share []byte
+		if share, err = base64.StdEncoding.DecodeString(input.Share); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: "share must be base64 encoded"})
+		}
+		var progress int
+		key, progress, err = s.unsealShares.Add(share, check.Threshold)
+		if err == nil && key == nil {
+			s.Logger.Infof("user %s gave unseal share %d of %d", app.CurrentUser(c).ID, progress, check.Threshold)
+			return s.respondSealStatus(c)
+		}
+		if err == nil {
+			if key, err = masterKeyFromShares(check, key); err != nil {
+				s.Logger.Warnf("user %s failed to unseal: %s", app.CurrentUser(c).ID, err)
+				return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+			}
+		}
+	case input.Key != "":
+		key, err = keys.DecodeKey(input.Key)
+	default:
+		if s.sealConfig.salt == nil {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: "MASTER_KEY_SALT is not configured"})
+		}
+		key, err = keys.PassphraseProvider{Passphrase: input.Passphrase, Salt: s.sealConfig.salt}.MasterKey()
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: err.Error()})
+	}
+
+	actor := app.CurrentUser(c)
+	if err = s.unseal(key); err != nil {
+		s.Logger.Warnf("user %s failed to unseal: %s", actor.ID, err)
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s unsealed the server", actor.ID)
+
+	return s.respondSealStatus(c)
+}
+
+func (s *Server) sysSealHandler(c echo.Context) error {
+	s.barrier.Seal()
+	s.unsealShares.Reset()
+
+	s.Logger.Infof("user %s sealed the server", app.CurrentUser(c).ID)
+
+	return s.respondSealStatus(c)
+}
+
+func (s *Server) respondSealStatus(c echo.Context) error {
+	check, initialized, err := s.findMasterKeyCheck()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+	return c.JSON(http.StatusOK, app.SealStatus{
+		Sealed:      s.barrier.Sealed(),
+		Provider:    s.sealConfig.provider,
+		Initialized: initialized,
+		ShareCount:  check.ShareCount,
+		Threshold:   check.Threshold,
+		Progress:    s.unsealShares.Progress(),
+	})
+}
+
+// findMasterKeyCheck returns the master key check, and false if there is no master key yet
+func (s *Server) findMasterKeyCheck() (db.MasterKeyCheck, bool, error) {
+	if s.db == nil {
+		return db.MasterKeyCheck{}, !s.barrier.Sealed(), nil
+	}
+	return db.FindMasterKeyCheck(s.db)
+}
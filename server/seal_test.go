@@ -0,0 +1,84 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_loadSealConfig(t *testing.T) {
+	const salt = "MDEyMzQ1Njc4OWFiY2RlZg=="
+
+	tests := []struct {
+		name         string
+		provider     string
+		masterKey    string
+		keyFile      string
+		passphrase   string
+		salt         string
+		wantErr      bool
+		wantProvider string
+	}{
+		{
+			name:         "sealed by default",
+			wantProvider: masterKeyProviderSealed,
+		},
+		{
+			name:         "env if MASTER_KEY is set",
+			masterKey:    "x",
+			wantProvider: masterKeyProviderEnv,
+		},
+		{
+			name:     "file requires a path",
+			provider: masterKeyProviderFile,
+			wantErr:  true,
+		},
+		{
+			name:         "file",
+			provider:     masterKeyProviderFile,
+			keyFile:      "/run/secrets/master.key",
+			wantProvider: masterKeyProviderFile,
+		},
+		{
+			name:       "passphrase requires a salt",
+			provider:   masterKeyProviderPassphrase,
+			passphrase: "correct horse",
+			wantErr:    true,
+		},
+		{
+			name:         "passphrase",
+			provider:     masterKeyProviderPassphrase,
+			passphrase:   "correct horse",
+			salt:         salt,
+			wantProvider: masterKeyProviderPassphrase,
+		},
+		{
+			name:     "short salt",
+			provider: masterKeyProviderSealed,
+			salt:     "c2hvcnQ=",
+			wantErr:  true,
+		},
+		{
+			name:     "unknown provider",
+			provider: "vault",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MASTER_KEY_PROVIDER", tt.provider)
+			t.Setenv("MASTER_KEY", tt.masterKey)
+			t.Setenv("MASTER_KEY_FILE", tt.keyFile)
+			t.Setenv("MASTER_KEY_PASSPHRASE", tt.passphrase)
+			t.Setenv("MASTER_KEY_SALT", tt.salt)
+
+			got, err := loadSealConfig()
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantProvider, got.provider)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+)
+
+func (s *Server) tenantsSecretsListHandler(c echo.Context) error {
+	secrets, err := db.FindSecrets(c, c.Param("id"), c.QueryParam("prefix"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	out := make([]app.Secret, len(secrets))
+	for i, secret := range secrets {
+		if out[i], err = db.ConvertSecret(c, secret); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, out)
+}
+
+func (s *Server) tenantsSecretsMetadataHandler(c echo.Context) error {
+	secret, err := db.FindSecretByPath(c, c.Param("id"), c.Param("*"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+	return s.respondSecret(c, secret)
+}
+
+// tenantsSecretsReadHandler responds with the data of the current version of a secret, or of the version given in
+// the "version" query parameter
+func (s *Server) tenantsSecretsReadHandler(c echo.Context) error {
+	version := 0
+	if v := c.QueryParam("version"); v != "" {
+		var err error
+		if version, err = strconv.Atoi(v); err != nil || version < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: "invalid version"})
+		}
+	}
+
+	data, err := db.ReadSecret(c, c.Param("id"), c.Param("*"), version, s.barrier)
+	if errors.Is(err, gorm.ErrRecordNotFound) || app.ErrorCode(err) == app.ERR_NOTFOUND {
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, data)
+}
+
+func (s *Server) tenantsSecretsWriteHandler(c echo.Context) error {
+	var input app.SecretWriteInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	actor := app.CurrentUser(c)
+	secret, err := db.WriteSecret(c, c.Param("id"), c.Param("*"), actor.ID, s.barrier, input)
+	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s wrote version %d of secret %s", actor.ID, secret.CurrentVersion, secret.ID)
+
+	return s.respondSecret(c, secret)
+}
+
+func (s *Server) tenantsSecretsRollbackHandler(c echo.Context) error {
+	var input app.SecretRollbackInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	actor := app.CurrentUser(c)
+	secret, err := db.RollbackSecret(c, c.Param("id"), c.Param("*"), actor.ID, s.barrier, input)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	case app.ErrorCode(err) == app.ERR_INVALID || app.ErrorCode(err) == app.ERR_NOTFOUND:
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+	case err != nil:
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s rolled back secret %s to version %d, as version %d", actor.ID, secret.ID, input.Version,
+		secret.CurrentVersion)
+
+	return s.respondSecret(c, secret)
+}
+
+func (s *Server) respondSecret(c echo.Context, secret db.Secret) error {
+	out, err := db.ConvertSecret(c, secret)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, out)
+}
@@ -0,0 +1,93 @@
+package server_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/briskt/keygo/app"
+)
+
+func (ts *TestSuite) Test_tenantsSecrets() {
+	tenant := ts.createTenantFixture()
+	tenantAdmin := ts.createTenantUserFixture(tenant.ID, app.UserRoleTenantAdmin)
+	member := ts.createTenantUserFixture(tenant.ID, app.UserRoleBasic)
+	otherTenant := ts.createTenantFixture()
+	otherAdmin := ts.createTenantUserFixture(otherTenant.ID, app.UserRoleTenantAdmin)
+
+	path := fmt.Sprintf("/api/tenants/%s/secrets", tenant.ID)
+	input := app.SecretWriteInput{Data: map[string]string{"password": "hunter2"}}
+
+	_, status := ts.request(http.MethodPut, path+"/data/db/main", member.Email, input)
+	ts.Equal(http.StatusNotFound, status, "a member needs a grant to write secrets")
+
+	body, status := ts.request(http.MethodPut, path+"/data/db/main", tenantAdmin.Email, input)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	body, status = ts.request(http.MethodPut, path+"/data/db/main", tenantAdmin.Email,
+		app.SecretWriteInput{Data: map[string]string{"password": "correct horse"}})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var secret app.Secret
+	ts.NoError(json.Unmarshal(body, &secret))
+	ts.Equal(2, secret.CurrentVersion)
+
+	_, status = ts.request(http.MethodGet, fmt.Sprintf("/api/tenants/%s/secrets/data/db/main", otherTenant.ID),
+		otherAdmin.Email, nil)
+	ts.Equal(http.StatusNotFound, status, "another tenant cannot read the secret")
+
+	body, status = ts.request(http.MethodGet, path+"/data/db/main?version=1", tenantAdmin.Email, nil)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var data app.SecretData
+	ts.NoError(json.Unmarshal(body, &data))
+	ts.Equal("hunter2", data.Data["password"])
+
+	body, status = ts.request(http.MethodPost, path+"/rollback/db/main", tenantAdmin.Email,
+		app.SecretRollbackInput{Version: 1})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	ts.NoError(json.Unmarshal(body, &secret))
+	ts.Equal(3, secret.CurrentVersion)
+
+	body, status = ts.request(http.MethodGet, path+"/data/db/main", tenantAdmin.Email, nil)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	ts.NoError(json.Unmarshal(body, &data))
+	ts.Equal(3, data.Version)
+	ts.Equal("hunter2", data.Data["password"])
+
+	_, status = ts.request(http.MethodPost, path+"/rollback/db/main", tenantAdmin.Email,
+		app.SecretRollbackInput{Version: 9})
+	ts.Equal(http.StatusBadRequest, status)
+
+	body, status = ts.request(http.MethodGet, path+"?prefix=db/", tenantAdmin.Email, nil)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var secrets []app.Secret
+	ts.NoError(json.Unmarshal(body, &secrets))
+	ts.Len(secrets, 1)
+	ts.Len(secrets[0].Versions, 3)
+
+	// the key ring encrypting secrets is not available through the key routes
+	keysPath := fmt.Sprintf("/api/tenants/%s/keys", tenant.ID)
+	body, status = ts.request(http.MethodGet, keysPath, tenantAdmin.Email, nil)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var rings []app.KeyRing
+	ts.NoError(json.Unmarshal(body, &rings))
+	ts.Empty(rings)
+
+	_, status = ts.request(http.MethodGet, keysPath+"/.secrets", tenantAdmin.Email, nil)
+	ts.Equal(http.StatusNotFound, status)
+	_, status = ts.request(http.MethodPost, keysPath+"/.secrets/rotate", tenantAdmin.Email, nil)
+	ts.Equal(http.StatusNotFound, status)
+	_, status = ts.request(http.MethodPost, keysPath+"/.secrets/encrypt", tenantAdmin.Email,
+		app.EncryptInput{Plaintext: "aGk="})
+	ts.Equal(http.StatusNotFound, status)
+
+	// a well-formed ciphertext, so that the decrypt request is refused for the key alone
+	_, status = ts.request(http.MethodPost, keysPath, tenantAdmin.Email, app.KeyRingCreateInput{Name: "app"})
+	ts.Equal(http.StatusOK, status)
+	body, status = ts.request(http.MethodPost, keysPath+"/app/encrypt", tenantAdmin.Email,
+		app.EncryptInput{Plaintext: "aGk="})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var encrypted app.EncryptOutput
+	ts.NoError(json.Unmarshal(body, &encrypted))
+	_, status = ts.request(http.MethodPost, keysPath+"/.secrets/decrypt", tenantAdmin.Email,
+		app.DecryptInput{Ciphertext: encrypted.Ciphertext})
+	ts.Equal(http.StatusNotFound, status, "reserved keys cannot be used to decrypt secret ciphertext")
+}
@@ -3,16 +3,31 @@ package server
 import (
 	"os"
 
-	"github.com/gorilla/sessions"
 	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"gorm.io/gorm"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+	"github.com/briskt/keygo/keys"
+	"github.com/briskt/keygo/server/authz"
+	"github.com/briskt/keygo/server/ratelimit"
 )
 
 type Server struct {
 	*echo.Echo
-	db *gorm.DB
+	db              *gorm.DB
+	sessionConfig   sessionConfig
+	corsConfig      corsConfig
+	rateLimitConfig rateLimitConfig
+	rateLimiter     ratelimit.Store
+	authorizer      authz.Authorizer
+	outbox          *db.Outbox
+	sealConfig      sealConfig
+	barrier         *keys.Barrier
+	unsealShares    keys.ShareCollector
+	rekey           rekeyState
 }
 
 const loggerFormat = "${time_rfc3339} ${status} ${method} ${uri} ${error}\n"
@@ -38,6 +53,56 @@ func New(options ...Option) *Server {
 		opt(svr)
 	}
 
+	sessionConfig, err := loadSessionConfig()
+	if err != nil {
+		panic("invalid session configuration: " + err.Error())
+	}
+	svr.sessionConfig = sessionConfig
+	svr.corsConfig = loadCORSConfig()
+
+	rateLimitConfig, err := loadRateLimitConfig()
+	if err != nil {
+		panic("invalid rate limit configuration: " + err.Error())
+	}
+	svr.rateLimitConfig = rateLimitConfig
+	svr.rateLimiter = svr.rateLimitStore()
+
+	authzConfig, err := loadAuthzConfig()
+	if err != nil {
+		panic("invalid authorization configuration: " + err.Error())
+	}
+	svr.authorizer, err = svr.newAuthorizer(authzConfig)
+	if err != nil {
+		panic("failed to load authorization policy: " + err.Error())
+	}
+
+	mailConfig, err := loadMailConfig()
+	if err != nil {
+		panic("invalid mail configuration: " + err.Error())
+	}
+	svr.outbox = svr.newOutbox(mailConfig)
+
+	authCacheConfig, err := loadAuthCacheConfig()
+	if err != nil {
+		panic("invalid auth cache configuration: " + err.Error())
+	}
+	svr.startAuthCache(authCacheConfig)
+
+	svr.sealConfig, err = loadSealConfig()
+	if err != nil {
+		panic("invalid master key configuration: " + err.Error())
+	}
+	svr.barrier = &keys.Barrier{}
+	if err = svr.startBarrier(); err != nil {
+		panic("failed to unseal: " + err.Error())
+	}
+	svr.startCRLRefresh()
+
+	e.IPExtractor, err = ipExtractor()
+	if err != nil {
+		panic("invalid trusted proxy configuration: " + err.Error())
+	}
+
 	// Logger Middleware
 	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{Format: loggerFormat}))
 
@@ -45,10 +110,14 @@ func New(options ...Option) *Server {
 	e.Use(middleware.Recover())
 
 	// Session Middleware
-	e.Use(session.Middleware(sessions.NewCookieStore([]byte(os.Getenv("SESSION_SECRET")))))
+	e.Use(session.Middleware(svr.sessionStore()))
 
 	// DB Transaction Middleware
-	e.Use(TxMiddleware(svr.db))
+	e.Use(TxMiddleware(svr.db, svr.outbox))
+
+	// CORS Middleware, registered globally so that it also sees preflight requests for routes without an OPTIONS
+	// handler
+	e.Use(svr.CORSMiddleware)
 
 	if os.Getenv("GO_ENV") == "development" {
 		e.Debug = true
@@ -69,20 +138,162 @@ func New(options ...Option) *Server {
 }
 
 func (s *Server) registerAPIRoutes() {
-	api := s.Group("/api", s.AuthnMiddleware)
+	api := s.Group("/api", s.RateLimitMiddleware, s.CSRFMiddleware(), s.AuthnMiddleware, s.UserRateLimitMiddleware)
 
 	api.GET("/auth", s.authStatus)
 	api.GET("/auth/login", s.authLogin)
 	api.GET("/auth/callback", s.authCallback)
 	api.GET("/auth/logout", s.authLogout)
+	api.POST("/auth/backchannel-logout", s.authBackChannelLogout)
+	api.PUT("/auth/tenant", s.authTenantHandler)
+
+	api.POST("/tenants", s.tenantsCreateHandler, s.RequirePermission(app.PermissionTenantsCreate))
+	api.GET("/tenants", s.tenantsListHandler, s.RequirePermission(app.PermissionTenantsList))
+
+	// routes for a single tenant are also available to tenant administrators of that tenant
+	api.GET("/tenants/:id", s.tenantsGetHandler, s.RequireTenantPermission(app.PermissionTenantsRead))
+	api.PUT("/tenants/:id", s.tenantsUpdateHandler, s.RequireTenantPermission(app.PermissionTenantsUpdate))
+
+	api.GET("/tenants/:id/users", s.tenantsUsersListHandler,
+		s.RequireTenantPermission(app.PermissionTenantsUsersList))
+	api.PUT("/tenants/:id/users/:user_id/role", s.tenantsUsersRoleAssignHandler,
+		s.RequireTenantPermission(app.PermissionTenantsUsersAssignRole))
+	api.DELETE("/tenants/:id/users/:user_id", s.tenantsUsersDeleteHandler,
+		s.RequireTenantPermission(app.PermissionTenantsUsersRemove))
+
+	// users join a tenant by accepting an invitation
+	api.GET("/tenants/:id/invitations", s.tenantsInvitationsListHandler,
+		s.RequireTenantPermission(app.PermissionTenantsUsersList))
+	api.POST("/tenants/:id/invitations", s.tenantsInvitationsCreateHandler,
+		s.RequireTenantPermission(app.PermissionTenantsUsersCreate))
+	api.POST("/tenants/:id/invitations/:invitation_id/resend", s.tenantsInvitationsResendHandler,
+		s.RequireTenantPermission(app.PermissionTenantsUsersCreate))
+	api.DELETE("/tenants/:id/invitations/:invitation_id", s.tenantsInvitationsRevokeHandler,
+		s.RequireTenantPermission(app.PermissionTenantsUsersCreate))
+	api.POST("/invitations/accept", s.invitationsAcceptHandler)
+
+	// any user may request a temporary role, which takes effect once approved
+	api.GET("/elevations", s.elevationsListHandler)
+	api.POST("/elevations", s.elevationsCreateHandler)
+	api.POST("/elevations/:id/approve", s.elevationsApproveHandler,
+		s.RequirePermission(app.PermissionElevationsApprove))
+	api.POST("/elevations/:id/deny", s.elevationsDenyHandler, s.RequirePermission(app.PermissionElevationsApprove))
+	api.POST("/elevations/:id/revoke", s.elevationsRevokeHandler)
+
+	api.GET("/tenants/:id/groups", s.tenantsGroupsListHandler,
+		s.RequireTenantPermission(app.PermissionTenantsGroupsRead))
+	api.POST("/tenants/:id/groups", s.tenantsGroupsCreateHandler,
+		s.RequireTenantPermission(app.PermissionTenantsGroupsManage))
+	api.GET("/tenants/:id/groups/:group_id", s.tenantsGroupsGetHandler,
+		s.RequireTenantPermission(app.PermissionTenantsGroupsRead))
+	api.PUT("/tenants/:id/groups/:group_id", s.tenantsGroupsUpdateHandler,
+		s.RequireTenantPermission(app.PermissionTenantsGroupsManage))
+	api.DELETE("/tenants/:id/groups/:group_id", s.tenantsGroupsDeleteHandler,
+		s.RequireTenantPermission(app.PermissionTenantsGroupsManage))
+	api.POST("/tenants/:id/groups/:group_id/members", s.tenantsGroupsMembersAddHandler,
+		s.RequireTenantPermission(app.PermissionTenantsGroupsManage))
+	api.DELETE("/tenants/:id/groups/:group_id/members/:user_id", s.tenantsGroupsMembersDeleteHandler,
+		s.RequireTenantPermission(app.PermissionTenantsGroupsManage))
+
+	// tenant key operations need the master key, which unwraps the key material, so they are refused while sealed
+	keyRoutes := api.Group("/tenants/:id/keys", s.RequireUnsealed)
+	keyRoutes.GET("", s.tenantsKeysListHandler, s.RequireTenantPermission(app.PermissionTenantsKeysRead))
+	keyRoutes.POST("", s.tenantsKeysCreateHandler, s.RequireTenantPermission(app.PermissionTenantsKeysManage))
+	keyRoutes.GET("/:name", s.tenantsKeysGetHandler, s.RequireTenantPermission(app.PermissionTenantsKeysRead))
+	keyRoutes.POST("/:name/rotate", s.tenantsKeysRotateHandler,
+		s.RequireTenantPermission(app.PermissionTenantsKeysManage))
+	keyRoutes.POST("/:name/encrypt", s.tenantsKeysEncryptHandler,
+		s.RequireTenantPermission(app.PermissionTenantsKeysUse))
+	keyRoutes.POST("/:name/decrypt", s.tenantsKeysDecryptHandler,
+		s.RequireTenantPermission(app.PermissionTenantsKeysUse))
+	keyRoutes.POST("/:name/sign", s.tenantsKeysSignHandler, s.RequireTenantPermission(app.PermissionTenantsKeysUse))
+	keyRoutes.POST("/:name/verify", s.tenantsKeysVerifyHandler,
+		s.RequireTenantPermission(app.PermissionTenantsKeysUse))
+	keyRoutes.GET("/:name/public-key", s.tenantsKeysPublicKeyHandler,
+		s.RequireTenantPermission(app.PermissionTenantsKeysRead))
+
+	// secret paths are hierarchical, e.g. /tenants/:id/secrets/data/billing/stripe
+	api.GET("/tenants/:id/secrets", s.tenantsSecretsListHandler,
+		s.RequireTenantPermission(app.PermissionTenantsSecretsRead))
+	api.GET("/tenants/:id/secrets/metadata/*", s.tenantsSecretsMetadataHandler,
+		s.RequireTenantPermission(app.PermissionTenantsSecretsRead))
+	api.GET("/tenants/:id/secrets/data/*", s.tenantsSecretsReadHandler, s.RequireUnsealed,
+		s.RequireTenantPermission(app.PermissionTenantsSecretsRead))
+	api.PUT("/tenants/:id/secrets/data/*", s.tenantsSecretsWriteHandler, s.RequireUnsealed,
+		s.RequireTenantPermission(app.PermissionTenantsSecretsWrite))
+	api.POST("/tenants/:id/secrets/rollback/*", s.tenantsSecretsRollbackHandler, s.RequireUnsealed,
+		s.RequireTenantPermission(app.PermissionTenantsSecretsWrite))
+
+	// a tenant's X.509 CA. Operations with its private key are refused while sealed.
+	pkiRoutes := api.Group("/tenants/:id/pki")
+	pkiRoutes.GET("/ca", s.tenantsPKICAGetHandler, s.RequireTenantPermission(app.PermissionTenantsPKIRead))
+	pkiRoutes.POST("/ca/generate", s.tenantsPKICAGenerateHandler, s.RequireUnsealed,
+		s.RequireTenantPermission(app.PermissionTenantsPKIManage))
+	pkiRoutes.POST("/ca/import", s.tenantsPKICAImportHandler, s.RequireUnsealed,
+		s.RequireTenantPermission(app.PermissionTenantsPKIManage))
+	pkiRoutes.GET("/templates", s.tenantsPKITemplatesListHandler,
+		s.RequireTenantPermission(app.PermissionTenantsPKIRead))
+	pkiRoutes.POST("/templates", s.tenantsPKITemplatesCreateHandler,
+		s.RequireTenantPermission(app.PermissionTenantsPKIManage))
+	pkiRoutes.PUT("/templates/:name", s.tenantsPKITemplatesUpdateHandler,
+		s.RequireTenantPermission(app.PermissionTenantsPKIManage))
+	pkiRoutes.DELETE("/templates/:name", s.tenantsPKITemplatesDeleteHandler,
+		s.RequireTenantPermission(app.PermissionTenantsPKIManage))
+	pkiRoutes.POST("/issue", s.tenantsPKIIssueHandler, s.RequireUnsealed,
+		s.RequireTenantPermission(app.PermissionTenantsPKIIssue))
+	pkiRoutes.GET("/certs", s.tenantsPKICertsListHandler, s.RequireTenantPermission(app.PermissionTenantsPKIRead))
+	pkiRoutes.GET("/certs/:serial", s.tenantsPKICertsGetHandler,
+		s.RequireTenantPermission(app.PermissionTenantsPKIRead))
+	pkiRoutes.POST("/certs/:serial/revoke", s.tenantsPKICertsRevokeHandler, s.RequireUnsealed,
+		s.RequireTenantPermission(app.PermissionTenantsPKIManage))
+	pkiRoutes.GET("/crl", s.tenantsPKICRLHandler, s.RequireTenantPermission(app.PermissionTenantsPKIRead))
+	api.GET(PKICRLPath, s.pkiCRLHandler)
+
+	sshRoutes := api.Group("/tenants/:id/ssh")
+	sshRoutes.GET("/ca", s.tenantsSSHCAGetHandler, s.RequireTenantPermission(app.PermissionTenantsSSHRead))
+	sshRoutes.GET("/ca/public-key", s.tenantsSSHCAPublicKeyHandler,
+		s.RequireTenantPermission(app.PermissionTenantsSSHRead))
+	sshRoutes.POST("/ca/generate", s.tenantsSSHCAGenerateHandler, s.RequireUnsealed,
+		s.RequireTenantPermission(app.PermissionTenantsSSHManage))
+	sshRoutes.PUT("/ca", s.tenantsSSHCAUpdateHandler, s.RequireTenantPermission(app.PermissionTenantsSSHManage))
+	sshRoutes.POST("/sign/user", s.tenantsSSHSignUserHandler, s.RequireUnsealed,
+		s.RequireTenantPermission(app.PermissionTenantsSSHLogin))
+	sshRoutes.POST("/sign/host", s.tenantsSSHSignHostHandler, s.RequireUnsealed,
+		s.RequireTenantPermission(app.PermissionTenantsSSHIssue))
+
+	// API keys are issued by a tenant to its own customers, and are unrelated to keygo login tokens
+	api.GET("/tenants/:id/api-key-types", s.tenantsAPIKeyTypesListHandler,
+		s.RequireTenantPermission(app.PermissionTenantsAPIKeysRead))
+	api.POST("/tenants/:id/api-key-types", s.tenantsAPIKeyTypesCreateHandler,
+		s.RequireTenantPermission(app.PermissionTenantsAPIKeysManage))
+	api.PUT("/tenants/:id/api-key-types/:name", s.tenantsAPIKeyTypesUpdateHandler,
+		s.RequireTenantPermission(app.PermissionTenantsAPIKeysManage))
+	api.DELETE("/tenants/:id/api-key-types/:name", s.tenantsAPIKeyTypesDeleteHandler,
+		s.RequireTenantPermission(app.PermissionTenantsAPIKeysManage))
+	apiKeyRoutes := api.Group("/tenants/:id/api-keys")
+	apiKeyRoutes.GET("", s.tenantsAPIKeysListHandler, s.RequireTenantPermission(app.PermissionTenantsAPIKeysRead))
+	apiKeyRoutes.POST("", s.tenantsAPIKeysIssueHandler, s.RequireTenantPermission(app.PermissionTenantsAPIKeysManage))
+	apiKeyRoutes.POST("/verify", s.tenantsAPIKeysVerifyHandler,
+		s.RequireTenantPermission(app.PermissionTenantsAPIKeysVerify))
+	apiKeyRoutes.GET("/:keyID", s.tenantsAPIKeysGetHandler, s.RequireTenantPermission(app.PermissionTenantsAPIKeysRead))
+	apiKeyRoutes.POST("/:keyID/revoke", s.tenantsAPIKeysRevokeHandler,
+		s.RequireTenantPermission(app.PermissionTenantsAPIKeysManage))
 
-	api.POST("/tenants", s.tenantsCreateHandler)
-	api.GET("/tenants", s.tenantsListHandler)
-	api.GET("/tenants/:id", s.tenantsGetHandler)
+	api.GET("/sys/seal-status", s.sysSealStatusHandler)
+	api.POST("/sys/unseal", s.sysUnsealHandler, s.RequirePermission(app.PermissionSystemUnseal))
+	api.POST("/sys/seal", s.sysSealHandler, s.RequirePermission(app.PermissionSystemSeal))
+	api.POST("/sys/init", s.sysInitHandler, s.RequirePermission(app.PermissionSystemInit))
+	api.GET("/sys/rekey", s.sysRekeyStatusHandler, s.RequirePermission(app.PermissionSystemRekey))
+	api.POST("/sys/rekey/init", s.sysRekeyInitHandler, s.RequirePermission(app.PermissionSystemRekey))
+	api.POST("/sys/rekey", s.sysRekeyHandler, s.RequirePermission(app.PermissionSystemRekey))
+	api.DELETE("/sys/rekey", s.sysRekeyCancelHandler, s.RequirePermission(app.PermissionSystemRekey))
 
-	api.POST("/tenants/:id/users", s.tenantsUsersCreateHandler)
+	api.GET("/roles", s.rolesListHandler, s.RequirePermission(app.PermissionRolesList))
+	api.POST("/roles", s.rolesCreateHandler, s.RequirePermission(app.PermissionRolesCreate))
 
+	// user routes check authorization in the handler, since users may access their own record
 	api.GET("/users", s.usersListHandler)
 	api.GET("/users/:id", s.userHandler)
 	api.PUT("/users/:id", s.usersUpdateHandler)
+	api.PUT("/users/:id/role", s.usersRoleAssignHandler, s.RequirePermission(app.PermissionRolesAssign))
 }
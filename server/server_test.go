@@ -43,6 +43,7 @@ func (ts *TestSuite) SetupTest() {
 	ts.Assertions = require.New(ts.T())
 
 	ts.NoError(ts.tx.Exec("TRUNCATE TABLE tenants CASCADE").Error)
+	ts.NoError(ts.tx.Exec("DELETE FROM roles WHERE NOT builtin").Error)
 }
 
 func Test_RunSuite(t *testing.T) {
@@ -77,6 +78,21 @@ func (ts *TestSuite) createUserFixture(role string) db.User {
 	return createdUser
 }
 
+// createTenantUserFixture creates a user with the Basic global role, and the given role in the given tenant
+func (ts *TestSuite) createTenantUserFixture(tenantID, tenantRole string) db.User {
+	fakeUserCreate := app.UserCreateInput{
+		Email:      fmt.Sprintf("test%s@example.com", RandStr(6)),
+		TenantID:   tenantID,
+		TenantRole: tenantRole,
+	}
+	createdUser, err := db.CreateUser(ts.ctx, fakeUserCreate)
+	ts.NoError(err)
+
+	ts.createTokenFixture(createdUser.Email, createdUser.ID)
+
+	return createdUser
+}
+
 func (ts *TestSuite) createTenantFixture() db.Tenant {
 	fakeTenantCreate := app.TenantCreateInput{
 		Name: "Test Tenant",
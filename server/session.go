@@ -1,25 +1,139 @@
 package server
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v4"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
 )
 
-const sessionName = "session"
+const (
+	sessionName            = "session"
+	sessionMaxAge          = 86400 * 7
+	sessionCleanupInterval = time.Hour
+
+	// minSessionAuthKeyLength is the shortest session authentication key accepted outside of development
+	minSessionAuthKeyLength = 32
+)
+
+// sessionConfig holds the session cookie settings read from the environment
+type sessionConfig struct {
+	// keyPairs holds alternating authentication and encryption keys, newest first. New cookies use the first pair,
+	// and all pairs are tried when verifying a cookie.
+	keyPairs [][]byte
+	secure   bool
+	sameSite http.SameSite
+}
+
+// loadSessionConfig reads the session configuration from the environment:
+//
+//   - SESSION_SECRET: comma-separated list of keys, newest first. Each entry is an authentication key, optionally
+//     followed by a colon and a 16, 24, or 32 byte encryption key, e.g. "newAuth:newEnc,oldAuth:oldEnc"
+//   - SESSION_COOKIE_SECURE: "true" or "false", defaults to true outside of development
+//   - SESSION_COOKIE_SAMESITE: "lax" (default), "strict", or "none"
+func loadSessionConfig() (sessionConfig, error) {
+	isDevelopment := os.Getenv("GO_ENV") == "development"
+
+	config := sessionConfig{secure: !isDevelopment, sameSite: http.SameSiteLaxMode}
+
+	secret := strings.TrimSpace(os.Getenv("SESSION_SECRET"))
+	if secret == "" {
+		return sessionConfig{}, fmt.Errorf("SESSION_SECRET is not set")
+	}
+	for i, entry := range strings.Split(secret, ",") {
+		authKey, encryptionKey, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		if authKey == "" {
+			return sessionConfig{}, fmt.Errorf("SESSION_SECRET key %d is empty", i+1)
+		}
+		if !isDevelopment && len(authKey) < minSessionAuthKeyLength {
+			return sessionConfig{}, fmt.Errorf("SESSION_SECRET key %d must be at least %d characters",
+				i+1, minSessionAuthKeyLength)
+		}
+
+		var encKey []byte
+		if encryptionKey != "" {
+			switch len(encryptionKey) {
+			case 16, 24, 32:
+				encKey = []byte(encryptionKey)
+			default:
+				return sessionConfig{}, fmt.Errorf("SESSION_SECRET encryption key %d must be 16, 24, or 32 characters", i+1)
+			}
+		}
+		config.keyPairs = append(config.keyPairs, []byte(authKey), encKey)
+	}
+
+	if v := os.Getenv("SESSION_COOKIE_SECURE"); v != "" {
+		secure, err := strconv.ParseBool(v)
+		if err != nil {
+			return sessionConfig{}, fmt.Errorf("invalid SESSION_COOKIE_SECURE %q: %w", v, err)
+		}
+		config.secure = secure
+	}
+
+	switch strings.ToLower(os.Getenv("SESSION_COOKIE_SAMESITE")) {
+	case "", "lax":
+		config.sameSite = http.SameSiteLaxMode
+	case "strict":
+		config.sameSite = http.SameSiteStrictMode
+	case "none":
+		if !config.secure {
+			return sessionConfig{}, fmt.Errorf("SESSION_COOKIE_SAMESITE=none requires a secure cookie")
+		}
+		config.sameSite = http.SameSiteNoneMode
+	default:
+		return sessionConfig{}, fmt.Errorf("invalid SESSION_COOKIE_SAMESITE %q", os.Getenv("SESSION_COOKIE_SAMESITE"))
+	}
+
+	return config, nil
+}
+
+// options returns the default cookie options for new sessions
+func (sc sessionConfig) options() *sessions.Options {
+	return &sessions.Options{
+		Path:     "/",
+		MaxAge:   sessionMaxAge,
+		HttpOnly: true,
+		Secure:   sc.secure,
+		SameSite: sc.sameSite,
+	}
+}
+
+// sessionStore returns the store for session data. Sessions are kept in the database when one is configured, so
+// the cookie holds only an opaque session ID.
+func (s *Server) sessionStore() sessions.Store {
+	config := s.sessionConfig
+	if s.db == nil {
+		store := sessions.NewCookieStore(config.keyPairs...)
+		store.Options = config.options()
+		store.MaxAge(sessionMaxAge)
+		return store
+	}
+
+	store := db.NewSessionStore(s.db, config.keyPairs...)
+	store.Options = config.options()
+	store.MaxAge(sessionMaxAge)
+	store.StartCleanup(sessionCleanupInterval, func(err error) {
+		s.Logger.Errorf("session cleanup error: %s", err)
+	})
+	return store
+}
 
 func sessionSetValue(c echo.Context, key, value interface{}) error {
 	sess, err := getSession(c)
 	if err != nil {
 		return err
 	}
-	sess.Options = &sessions.Options{
-		Path:     "/",
-		MaxAge:   86400 * 7,
-		HttpOnly: true,
-	}
 	sess.Values[key] = value
 	if err = sess.Save(c.Request(), c.Response()); err != nil {
 		return fmt.Errorf("sessionSetValue error, %w", err)
@@ -47,10 +161,29 @@ func sessionGetValue(c echo.Context, key interface{}) (interface{}, error) {
 	}
 }
 
+// getSession returns the session of the request. A session cookie that cannot be decoded, e.g. one made with keys
+// or a cookie format no longer in use, is discarded, and a new session is started in its place.
 func getSession(c echo.Context) (*sessions.Session, error) {
-	if sess, err := session.Get(sessionName, c); err != nil {
-		return nil, fmt.Errorf("error getting session from context: %w", err)
-	} else {
+	sess, err := session.Get(sessionName, c)
+	if err == nil {
 		return sess, nil
 	}
+
+	var cookieErr securecookie.Error
+	if sess == nil || !errors.As(err, &cookieErr) || !cookieErr.IsDecode() {
+		return nil, fmt.Errorf("error getting session from context: %w", err)
+	}
+
+	// the same session and error are returned for the rest of the request, so it is only reset once
+	if c.Get(app.ContextKeySessionDiscarded) == nil {
+		c.Set(app.ContextKeySessionDiscarded, true)
+		sess.ID = ""
+		sess.Values = map[interface{}]interface{}{}
+		sess.IsNew = true
+		http.SetCookie(c.Response(), sessions.NewCookie(sessionName, "", &sessions.Options{
+			Path:   sess.Options.Path,
+			MaxAge: -1,
+		}))
+	}
+	return sess, nil
 }
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_loadSessionConfig(t *testing.T) {
+	const authKey = "abcdefghijklmnopqrstuvwxyz012345"
+	const encKey = "0123456789abcdef"
+
+	tests := []struct {
+		name         string
+		env          string
+		secret       string
+		secure       string
+		sameSite     string
+		wantErr      bool
+		wantPairs    int
+		wantSecure   bool
+		wantSameSite http.SameSite
+	}{
+		{
+			name:    "empty secret",
+			env:     "development",
+			wantErr: true,
+		},
+		{
+			name:         "short secret allowed in development",
+			env:          "development",
+			secret:       "abc123",
+			wantPairs:    1,
+			wantSecure:   false,
+			wantSameSite: http.SameSiteLaxMode,
+		},
+		{
+			name:    "short secret rejected in production",
+			env:     "production",
+			secret:  "abc123",
+			wantErr: true,
+		},
+		{
+			name:    "bad encryption key length",
+			env:     "production",
+			secret:  authKey + ":short",
+			wantErr: true,
+		},
+		{
+			name:         "rotated key pairs",
+			env:          "production",
+			secret:       authKey + ":" + encKey + "," + authKey + "old",
+			wantPairs:    2,
+			wantSecure:   true,
+			wantSameSite: http.SameSiteLaxMode,
+		},
+		{
+			name:         "secure and samesite from config",
+			env:          "development",
+			secret:       authKey,
+			secure:       "true",
+			sameSite:     "strict",
+			wantPairs:    1,
+			wantSecure:   true,
+			wantSameSite: http.SameSiteStrictMode,
+		},
+		{
+			name:     "samesite none requires secure",
+			env:      "production",
+			secret:   authKey,
+			secure:   "false",
+			sameSite: "none",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GO_ENV", tt.env)
+			t.Setenv("SESSION_SECRET", tt.secret)
+			t.Setenv("SESSION_COOKIE_SECURE", tt.secure)
+			t.Setenv("SESSION_COOKIE_SAMESITE", tt.sameSite)
+
+			got, err := loadSessionConfig()
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, got.keyPairs, tt.wantPairs*2)
+			require.Equal(t, tt.wantSecure, got.secure)
+			require.Equal(t, tt.wantSameSite, got.sameSite)
+		})
+	}
+}
+
+func Test_getSession_undecodableCookie(t *testing.T) {
+	oldStore := sessions.NewCookieStore([]byte("old-authentication-key"))
+	store := sessions.NewCookieStore([]byte("new-authentication-key"))
+
+	// a cookie made before the session keys changed
+	rec := httptest.NewRecorder()
+	oldSession, err := oldStore.New(httptest.NewRequest(http.MethodGet, "/", nil), sessionName)
+	require.NoError(t, err)
+	oldSession.Values[SessionKeyReturnTo] = "/old"
+	require.NoError(t, oldSession.Save(httptest.NewRequest(http.MethodGet, "/", nil), rec))
+	oldCookie := rec.Result().Cookies()[0]
+
+	e := echo.New()
+	e.Use(session.Middleware(store))
+	e.GET("/", func(c echo.Context) error {
+		if err := sessionSetValue(c, SessionKeyReturnTo, "/new"); err != nil {
+			return err
+		}
+		if err := sessionSetValue(c, SessionKeyState, "state"); err != nil {
+			return err
+		}
+		path, err := sessionGetString(c, SessionKeyReturnTo)
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, path)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(oldCookie)
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	require.Equal(t, http.StatusOK, res.Code, "body: %s", res.Body.String())
+	require.Equal(t, "/new", res.Body.String(), "values set in the new session are kept for the rest of the request")
+
+	// the old cookie is replaced by the new session
+	cookies := res.Result().Cookies()
+	require.NotEmpty(t, cookies)
+	newCookie := cookies[len(cookies)-1]
+	require.Equal(t, sessionName, newCookie.Name)
+	require.NotEqual(t, oldCookie.Value, newCookie.Value)
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(newCookie)
+	sess, err := store.Get(req, sessionName)
+	require.NoError(t, err)
+	require.Equal(t, "state", sess.Values[SessionKeyState])
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+
+	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
+)
+
+func (s *Server) tenantsSSHCAGetHandler(c echo.Context) error {
+	ca, err := db.FindSSHCA(c, c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+	out, err := db.ConvertSSHCA(c, ca)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, out)
+}
+
+// tenantsSSHCAPublicKeyHandler responds with the public key of the tenant's SSH CA as a line of text, ready for the
+// TrustedUserCAKeys file of sshd
+func (s *Server) tenantsSSHCAPublicKeyHandler(c echo.Context) error {
+	ca, err := db.FindSSHCA(c, c.Param("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+	return c.String(http.StatusOK, ca.PublicKey+"\n")
+}
+
+func (s *Server) tenantsSSHCAGenerateHandler(c echo.Context) error {
+	var input app.SSHCAInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	tenantID := c.Param("id")
+	ca, err := db.GenerateSSHCA(c, tenantID, s.barrier, input)
+	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s generated SSH CA %s in tenant %s", app.CurrentUser(c).ID, ca.ID, tenantID)
+
+	out, err := db.ConvertSSHCA(c, ca)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, out)
+}
+
+// tenantsSSHCAUpdateHandler replaces the policy of the tenant's SSH CA for issuing host certificates
+func (s *Server) tenantsSSHCAUpdateHandler(c echo.Context) error {
+	var input app.SSHCAInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	tenantID := c.Param("id")
+	ca, err := db.UpdateSSHCA(c, tenantID, input)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	case app.ErrorCode(err) == app.ERR_INVALID:
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+	case err != nil:
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s updated SSH CA %s in tenant %s to allow hosts %v", app.CurrentUser(c).ID, ca.ID, tenantID,
+		ca.AllowedHostDomains)
+
+	out, err := db.ConvertSSHCA(c, ca)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, out)
+}
+
+func (s *Server) tenantsSSHSignUserHandler(c echo.Context) error {
+	var input app.SSHUserCertificateInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	actor := app.CurrentUser(c)
+	tenantID := c.Param("id")
+	cert, err := db.SignSSHUserKey(c, tenantID, actor.ID, s.barrier, input)
+	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s obtained SSH user certificate %d for principals %v in tenant %s", actor.ID, cert.Serial,
+		cert.ValidPrincipals, tenantID)
+
+	return s.respondSSHCertificate(c, cert)
+}
+
+func (s *Server) tenantsSSHSignHostHandler(c echo.Context) error {
+	var input app.SSHHostCertificateInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	}
+
+	tenantID := c.Param("id")
+	cert, err := db.SignSSHHostKey(c, tenantID, s.barrier, input)
+	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	s.Logger.Infof("user %s issued SSH host certificate %d for %v in tenant %s", app.CurrentUser(c).ID,
+		cert.Serial, cert.ValidPrincipals, tenantID)
+
+	return s.respondSSHCertificate(c, cert)
+}
+
+func (s *Server) respondSSHCertificate(c echo.Context, cert *ssh.Certificate) error {
+	out, err := db.ConvertSSHCertificate(c, cert)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	return c.JSON(http.StatusOK, out)
+}
@@ -0,0 +1,84 @@
+package server_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/briskt/keygo/app"
+)
+
+func (ts *TestSuite) Test_tenantsSSH() {
+	tenant := ts.createTenantFixture()
+	tenantAdmin := ts.createTenantUserFixture(tenant.ID, app.UserRoleTenantAdmin)
+	member := ts.createTenantUserFixture(tenant.ID, app.UserRoleBasic)
+	otherTenant := ts.createTenantFixture()
+	outsider := ts.createTenantUserFixture(otherTenant.ID, app.UserRoleTenantAdmin)
+
+	path := fmt.Sprintf("/api/tenants/%s/ssh", tenant.ID)
+
+	_, status := ts.request(http.MethodPost, path+"/ca/generate", member.Email, nil)
+	ts.Equal(http.StatusNotFound, status, "a member cannot create an SSH CA")
+
+	body, status := ts.request(http.MethodPost, path+"/ca/generate", tenantAdmin.Email,
+		app.SSHCAInput{AllowedHostDomains: []string{"*.example.com"}})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var ca app.SSHCertificateAuthority
+	ts.NoError(json.Unmarshal(body, &ca))
+	ts.Equal([]string{"*.example.com"}, ca.AllowedHostDomains)
+
+	body, status = ts.request(http.MethodGet, path+"/ca/public-key", member.Email, nil)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	ts.Equal(ca.PublicKey, strings.TrimSpace(string(body)))
+
+	_, status = ts.request(http.MethodGet, path+"/ca/public-key", outsider.Email, nil)
+	ts.Equal(http.StatusNotFound, status, "the SSH CA is visible to members only")
+
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	ts.NoError(err)
+	sshPublic, err := ssh.NewPublicKey(public)
+	ts.NoError(err)
+	publicKey := string(ssh.MarshalAuthorizedKey(sshPublic))
+
+	body, status = ts.request(http.MethodPost, path+"/sign/user", member.Email,
+		app.SSHUserCertificateInput{PublicKey: publicKey, TTL: "30m"})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	var cert app.SSHCertificate
+	ts.NoError(json.Unmarshal(body, &cert))
+	ts.Equal(member.Email, cert.KeyID)
+	ts.Equal([]string{app.SSHPrincipal(app.UserRoleBasic)}, cert.Principals)
+
+	parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(cert.Certificate))
+	ts.NoError(err)
+	ts.IsType(&ssh.Certificate{}, parsed)
+
+	_, status = ts.request(http.MethodPost, path+"/sign/user", outsider.Email,
+		app.SSHUserCertificateInput{PublicKey: publicKey})
+	ts.Equal(http.StatusNotFound, status, "only members get a user certificate")
+
+	hostInput := app.SSHHostCertificateInput{PublicKey: publicKey, Hostnames: []string{"web1.example.com"}}
+	_, status = ts.request(http.MethodPost, path+"/sign/host", member.Email, hostInput)
+	ts.Equal(http.StatusNotFound, status, "a member cannot issue host certificates")
+
+	body, status = ts.request(http.MethodPost, path+"/sign/host", tenantAdmin.Email, hostInput)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	ts.NoError(json.Unmarshal(body, &cert))
+	ts.Equal([]string{"web1.example.com"}, cert.Principals)
+
+	hostInput.Hostnames = []string{"10.0.0.1"}
+	_, status = ts.request(http.MethodPost, path+"/sign/host", tenantAdmin.Email, hostInput)
+	ts.Equal(http.StatusBadRequest, status, "the SSH CA does not allow IP addresses")
+
+	_, status = ts.request(http.MethodPut, path+"/ca", member.Email, app.SSHCAInput{AllowHostIPs: true})
+	ts.Equal(http.StatusNotFound, status, "a member cannot change the SSH CA")
+
+	body, status = ts.request(http.MethodPut, path+"/ca", tenantAdmin.Email, app.SSHCAInput{AllowHostIPs: true})
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+	body, status = ts.request(http.MethodPost, path+"/sign/host", tenantAdmin.Email, hostInput)
+	ts.Equal(http.StatusOK, status, "body: %s", body)
+}
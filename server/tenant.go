@@ -10,11 +10,6 @@ import (
 )
 
 func (s *Server) tenantsCreateHandler(c echo.Context) error {
-	user := app.CurrentUser(c)
-	if user.Role != app.UserRoleAdmin {
-		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
-	}
-
 	var input app.TenantCreateInput
 	err := (&echo.DefaultBinder{}).BindBody(c, &input)
 	if err != nil {
@@ -32,11 +27,6 @@ func (s *Server) tenantsCreateHandler(c echo.Context) error {
 }
 
 func (s *Server) tenantsListHandler(c echo.Context) error {
-	user := app.CurrentUser(c)
-	if user.Role != app.UserRoleAdmin {
-		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
-	}
-
 	tenants, err := db.FindTenants(c, app.TenantFilter{})
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
@@ -48,15 +38,33 @@ func (s *Server) tenantsListHandler(c echo.Context) error {
 }
 
 func (s *Server) tenantsGetHandler(c echo.Context) error {
-	user := app.CurrentUser(c)
+	id := c.Param("id")
+	tenant, err := db.FindTenantByID(c, id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
 
-	if user.Role != app.UserRoleAdmin {
-		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	t, err := db.ConvertTenant(c, tenant)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, t)
+}
+
+func (s *Server) tenantsUpdateHandler(c echo.Context) error {
+	var input app.TenantUpdateInput
+	err := (&echo.DefaultBinder{}).BindBody(c, &input)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
 	}
 
 	id := c.Param("id")
-	tenant, err := db.FindTenantByID(c, id)
+	tenant, err := db.UpdateTenant(c, id, input)
 	if err != nil {
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
 		return echo.NewHTTPError(http.StatusNotFound, err)
 	}
 
@@ -65,28 +73,83 @@ func (s *Server) tenantsGetHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
+	s.Logger.Infof("updated tenant (name %q, id %q)", tenant.Name, tenant.ID)
+
 	return c.JSON(http.StatusOK, t)
 }
 
-func (s *Server) tenantsUsersCreateHandler(c echo.Context) error {
-	user := app.CurrentUser(c)
-	if user.Role != app.UserRoleAdmin {
+func (s *Server) tenantsUsersListHandler(c echo.Context) error {
+	tenantID := c.Param("id")
+	if _, err := db.FindTenantByID(c, tenantID); err != nil {
 		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
 	}
 
-	var input app.TenantUserCreateInput
+	users, err := db.FindUsers(c, app.UserFilter{TenantID: &tenantID})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+
+	out, err := db.ConvertUsers(c, users)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, out)
+}
+
+func (s *Server) tenantsUsersRoleAssignHandler(c echo.Context) error {
+	var input app.UserRoleAssignInput
 	err := (&echo.DefaultBinder{}).BindBody(c, &input)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
 	}
 
 	tenantID := c.Param("id")
-	tenantUser, err := db.CreateTenantUser(c, tenantID, input)
+	userID := c.Param("user_id")
+	actor := app.CurrentUser(c)
+	if userID == actor.ID {
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: "cannot change your own role"})
+	}
+
+	role, err := db.FindRoleByID(c, input.RoleID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: "role does not exist"})
+	}
+	if !canGrantInTenant(actor, tenantID, role.Permissions) {
+		return echo.NewHTTPError(http.StatusForbidden, AuthError{Error: "cannot grant permissions you do not hold"})
+	}
+
+	membership, err := db.AssignMembershipRole(c, tenantID, userID, input)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		if app.ErrorCode(err) == app.ERR_INVALID {
+			return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: app.ErrorMessage(err)})
+		}
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	}
+
+	m, err := db.ConvertTenantMembership(c, membership)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	s.Logger.Infof("user %s assigned role %q to user %s in tenant %s", actor.ID, m.Role, userID, tenantID)
+
+	return c.JSON(http.StatusOK, m)
+}
+
+func (s *Server) tenantsUsersDeleteHandler(c echo.Context) error {
+	tenantID := c.Param("id")
+	userID := c.Param("user_id")
+	actor := app.CurrentUser(c)
+	if userID == actor.ID {
+		return echo.NewHTTPError(http.StatusBadRequest, AuthError{Error: "cannot remove yourself from a tenant"})
+	}
+
+	if err := db.DeleteTenantMembership(c, tenantID, userID); err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
 	}
 
-	s.Logger.Infof("created tenant user (email %q, id %q)", tenantUser.Email, tenantUser.ID)
+	s.Logger.Infof("user %s removed user %s from tenant %s", actor.ID, userID, tenantID)
 
-	return c.JSON(http.StatusOK, tenantUser)
+	return c.NoContent(http.StatusNoContent)
 }
@@ -101,6 +101,19 @@ func (ts *TestSuite) Test_tenantsGetHandler() {
 	}
 }
 
+func (ts *TestSuite) Test_tenantsGetHandler_rlsBypassRecorded() {
+	admin := ts.createUserFixture(app.UserRoleAdmin)
+
+	body, status := ts.request(http.MethodGet, "/api/tenants/unknown", admin.Email, nil)
+	ts.Equal(http.StatusNotFound, status, "incorrect http status, body: \n%s", body)
+
+	var bypasses []db.RLSBypass
+	ts.NoError(ts.tx.Where("user_id = ?", admin.ID).Find(&bypasses).Error)
+	ts.Len(bypasses, 1, "the bypass of a rolled back request is recorded")
+	ts.Equal("/api/tenants/unknown", bypasses[0].Path)
+	ts.Equal(http.StatusNotFound, bypasses[0].Status)
+}
+
 func (ts *TestSuite) Test_tenantsListHandler() {
 	user := ts.createUserFixture(app.UserRoleBasic)
 	admin := ts.createUserFixture(app.UserRoleAdmin)
@@ -145,7 +158,7 @@ func (ts *TestSuite) Test_tenantsListHandler() {
 	}
 }
 
-func (ts *TestSuite) Test_tenantsUsersCreateHandler() {
+func (ts *TestSuite) Test_tenantsUpdateHandler() {
 	user := ts.createUserFixture(app.UserRoleBasic)
 	admin := ts.createUserFixture(app.UserRoleAdmin)
 	tenant := ts.createTenantFixture()
@@ -153,40 +166,202 @@ func (ts *TestSuite) Test_tenantsUsersCreateHandler() {
 	tests := []struct {
 		name       string
 		actor      db.User
+		origins    []string
 		wantStatus int
 	}{
 		{
-			name:       "not a valid user",
-			wantStatus: http.StatusUnauthorized,
-		},
-		{
-			name:       "a user cannot access a tenant",
+			name:       "a user cannot update a tenant",
 			actor:      user,
+			origins:    []string{"https://a.example.com"},
 			wantStatus: http.StatusNotFound,
 		},
 		{
-			name:       "admin can access a tenant",
+			name:       "invalid origin",
 			actor:      admin,
+			origins:    []string{"https://a.example.com/path"},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "admin can update a tenant",
+			actor:      admin,
+			origins:    []string{"https://a.example.com", "http://localhost:3000"},
 			wantStatus: http.StatusOK,
 		},
 	}
 	for _, tt := range tests {
-		ts.T().Run(tt.name, func(t *testing.T) {
-			input := app.TenantUserCreateInput{Email: "tenant_user@example.com"}
-			path := fmt.Sprintf("/api/tenants/%s/users", tenant.ID)
-			body, status := ts.request(http.MethodPost, path, tt.actor.Email, input)
-
-			// Assertions
+		ts.Run(tt.name, func() {
+			input := app.TenantUpdateInput{AllowedOrigins: &tt.origins}
+			body, status := ts.request(http.MethodPut, "/api/tenants/"+tenant.ID, tt.actor.Email, input)
 			ts.Equal(tt.wantStatus, status, "incorrect http status, body: \n%s", body)
 
 			if tt.wantStatus != http.StatusOK {
 				return
 			}
 
-			var user db.User
-			ts.NoError(json.Unmarshal(body, &user))
-			ts.Equal(input.Email, user.Email, "incorrect user Email, body: \n%s", body)
-			ts.Equal(tenant.ID, *user.TenantID, "incorrect user TenantID, body: \n%s", body)
+			dbTenant, err := db.FindTenantByID(ts.ctx, tenant.ID)
+			ts.NoError(err)
+			ts.Equal(tt.origins, []string(dbTenant.AllowedOrigins))
 		})
 	}
 }
+
+func (ts *TestSuite) Test_tenantAdminScope() {
+	tenant := ts.createTenantFixture()
+	otherTenant := ts.createTenantFixture()
+	tenantAdmin := ts.createTenantUserFixture(tenant.ID, app.UserRoleTenantAdmin)
+	member := ts.createTenantUserFixture(tenant.ID, app.UserRoleBasic)
+	otherMember := ts.createTenantUserFixture(otherTenant.ID, app.UserRoleBasic)
+
+	roles, err := db.FindRoles(ts.ctx, app.RoleFilter{})
+	ts.NoError(err)
+	roleIDs := map[string]string{}
+	for _, r := range roles {
+		roleIDs[r.Name] = r.ID
+	}
+
+	name := "renamed"
+	tests := []struct {
+		name       string
+		actor      db.User
+		method     string
+		path       string
+		input      any
+		wantStatus int
+	}{
+		{
+			name:       "member cannot read own tenant",
+			actor:      member,
+			method:     http.MethodGet,
+			path:       "/api/tenants/" + tenant.ID,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "tenant admin can read own tenant",
+			actor:      tenantAdmin,
+			method:     http.MethodGet,
+			path:       "/api/tenants/" + tenant.ID,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "tenant admin cannot read other tenant",
+			actor:      tenantAdmin,
+			method:     http.MethodGet,
+			path:       "/api/tenants/" + otherTenant.ID,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "tenant admin cannot list tenants",
+			actor:      tenantAdmin,
+			method:     http.MethodGet,
+			path:       "/api/tenants",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "tenant admin can update own tenant",
+			actor:      tenantAdmin,
+			method:     http.MethodPut,
+			path:       "/api/tenants/" + tenant.ID,
+			input:      app.TenantUpdateInput{Name: &name},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "tenant admin cannot update other tenant",
+			actor:      tenantAdmin,
+			method:     http.MethodPut,
+			path:       "/api/tenants/" + otherTenant.ID,
+			input:      app.TenantUpdateInput{Name: &name},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "tenant admin can list own members",
+			actor:      tenantAdmin,
+			method:     http.MethodGet,
+			path:       "/api/tenants/" + tenant.ID + "/users",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "tenant admin cannot list other members",
+			actor:      tenantAdmin,
+			method:     http.MethodGet,
+			path:       "/api/tenants/" + otherTenant.ID + "/users",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "tenant admin can invite a member",
+			actor:      tenantAdmin,
+			method:     http.MethodPost,
+			path:       "/api/tenants/" + tenant.ID + "/invitations",
+			input:      app.InvitationCreateInput{Email: "new_member@example.com"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "tenant admin cannot invite a member to other tenant",
+			actor:      tenantAdmin,
+			method:     http.MethodPost,
+			path:       "/api/tenants/" + otherTenant.ID + "/invitations",
+			input:      app.InvitationCreateInput{Email: "intruder@example.com"},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "tenant admin cannot grant global admin",
+			actor:      tenantAdmin,
+			method:     http.MethodPut,
+			path:       "/api/tenants/" + tenant.ID + "/users/" + member.ID + "/role",
+			input:      app.UserRoleAssignInput{RoleID: roleIDs[app.UserRoleAdmin]},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "tenant admin cannot assign role to user of other tenant",
+			actor:      tenantAdmin,
+			method:     http.MethodPut,
+			path:       "/api/tenants/" + tenant.ID + "/users/" + otherMember.ID + "/role",
+			input:      app.UserRoleAssignInput{RoleID: roleIDs[app.UserRoleTenantAdmin]},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "tenant admin cannot remove a member of other tenant",
+			actor:      tenantAdmin,
+			method:     http.MethodDelete,
+			path:       "/api/tenants/" + otherTenant.ID + "/users/" + otherMember.ID,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "tenant admin can promote a member",
+			actor:      tenantAdmin,
+			method:     http.MethodPut,
+			path:       "/api/tenants/" + tenant.ID + "/users/" + member.ID + "/role",
+			input:      app.UserRoleAssignInput{RoleID: roleIDs[app.UserRoleTenantAdmin]},
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		ts.T().Run(tt.name, func(t *testing.T) {
+			body, status := ts.request(tt.method, tt.path, tt.actor.Email, tt.input)
+			ts.Equal(tt.wantStatus, status, "incorrect http status, body: \n%s", body)
+		})
+	}
+}
+
+func (ts *TestSuite) Test_tenantsUsersDeleteHandler() {
+	tenant := ts.createTenantFixture()
+	tenantAdmin := ts.createTenantUserFixture(tenant.ID, app.UserRoleTenantAdmin)
+	member := ts.createTenantUserFixture(tenant.ID, app.UserRoleBasic)
+
+	path := fmt.Sprintf("/api/tenants/%s/users/", tenant.ID)
+
+	_, status := ts.request(http.MethodDelete, path+member.ID, member.Email, nil)
+	ts.Equal(http.StatusNotFound, status, "a member cannot remove members")
+
+	_, status = ts.request(http.MethodDelete, path+tenantAdmin.ID, tenantAdmin.Email, nil)
+	ts.Equal(http.StatusBadRequest, status, "a tenant admin cannot remove themselves")
+
+	_, status = ts.request(http.MethodDelete, path+member.ID, tenantAdmin.Email, nil)
+	ts.Equal(http.StatusNoContent, status)
+
+	users, err := db.FindUsers(ts.ctx, app.UserFilter{TenantID: &tenant.ID})
+	ts.NoError(err)
+	ts.Len(users, 1)
+
+	_, status = ts.request(http.MethodDelete, path+member.ID, tenantAdmin.Email, nil)
+	ts.Equal(http.StatusNotFound, status, "the user is no longer a member")
+}
@@ -2,22 +2,31 @@ package server
 
 import (
 	"errors"
+	"net/http"
 
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
 
 	"github.com/briskt/keygo/app"
+	"github.com/briskt/keygo/db"
 )
 
-func TxMiddleware(db *gorm.DB) echo.MiddlewareFunc {
+// TxMiddleware runs each request in a database transaction, which is committed if the response status is a 2xx or
+// 3xx. The transaction runs as the row-level security role, so until the request is authenticated it can see
+// nothing but its own token. Email queued in the transaction is handed to the outbox, if any, once committed. An RLS
+// bypass is recorded once the transaction ends, whether committed or not.
+func TxMiddleware(conn *gorm.DB, outbox *db.Outbox) echo.MiddlewareFunc {
 	errNotOK := errors.New("http error, rolling back transaction")
 
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			if db == nil {
+			if conn == nil {
 				return next(c)
 			}
-			err := db.Transaction(func(tx *gorm.DB) error {
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := db.BeginRLS(tx); err != nil {
+					return err
+				}
 				c.Set(app.ContextKeyTx, tx)
 
 				if err := next(c); err != nil {
@@ -34,13 +43,34 @@ func TxMiddleware(db *gorm.DB) echo.MiddlewareFunc {
 
 				return nil
 			})
+			if rerr := db.RecordRLSBypass(conn, c, responseStatus(c, err)); rerr != nil {
+				c.Logger().Errorf("failed to record RLS bypass: %s", rerr)
+			}
 			if err != nil {
 				if errors.Unwrap(err) == errNotOK {
 					return nil
 				}
 				return err
 			}
+			if outbox != nil && db.EmailQueued(c) {
+				outbox.Notify()
+			}
 			return nil
 		}
 	}
 }
+
+// responseStatus returns the status of the response to a request, given the error returned by its handler, which
+// has not yet been written to the response
+func responseStatus(c echo.Context, err error) int {
+	var httpErr *echo.HTTPError
+	switch {
+	case c.Response().Committed:
+		return c.Response().Status
+	case errors.As(err, &httpErr):
+		return httpErr.Code
+	case err != nil:
+		return http.StatusInternalServerError
+	}
+	return c.Response().Status
+}
@@ -7,14 +7,21 @@ import (
 
 	"github.com/briskt/keygo/app"
 	"github.com/briskt/keygo/db"
+	"github.com/briskt/keygo/server/authz"
 )
 
 func (s *Server) usersListHandler(c echo.Context) error {
 	user := app.CurrentUser(c)
-	if user.Role != app.UserRoleAdmin {
-		return echo.NewHTTPError(http.StatusOK, []app.User{})
+	resource := authz.Resource{Type: resourceType(app.PermissionUsersList), TenantID: user.TenantID}
+	d, err := s.decide(c, app.PermissionUsersList, resource)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
+	}
+	if !d.Allowed {
+		return c.JSON(http.StatusOK, []app.User{})
 	}
 
+	// row-level security limits the list to the scope of the decision
 	users, err := db.FindUsers(c, app.UserFilter{})
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, AuthError{Error: err.Error()})
@@ -22,28 +29,33 @@ func (s *Server) usersListHandler(c echo.Context) error {
 
 	s.Logger.Infof("found %d users", len(users))
 
-	return c.JSON(http.StatusOK, users)
+	out, err := db.ConvertUsers(c, users)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, out)
 }
 
 func (s *Server) userHandler(c echo.Context) error {
-	actor := app.CurrentUser(c)
-	var user app.User
-
 	id := c.Param("id")
+	if err := s.authorize(c, app.PermissionUsersRead, userResource(c, id)); err != nil {
+		return err
+	}
+
+	actor := app.CurrentUser(c)
 	if id == actor.ID {
-		user = actor
-	} else if actor.Role != app.UserRoleAdmin {
-		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
-	} else {
-		dbUser, err := db.FindUserByID(c, id)
-		if err != nil {
-			return echo.NewHTTPError(http.StatusNotFound, err)
-		}
-
-		user, err = db.ConvertUser(c, dbUser)
-		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, err)
-		}
+		return c.JSON(http.StatusOK, actor)
+	}
+
+	dbUser, err := db.FindUserByID(c, id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	user, err := db.ConvertUser(c, dbUser)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
 	return c.JSON(http.StatusOK, user)
@@ -58,9 +70,8 @@ func (s *Server) usersUpdateHandler(c echo.Context) error {
 	}
 
 	id := c.Param("id")
-	actor := app.CurrentUser(c)
-	if id != actor.ID && actor.Role != app.UserRoleAdmin {
-		return echo.NewHTTPError(http.StatusNotFound, AuthError{Error: "not found"})
+	if err = s.authorize(c, app.PermissionUsersUpdate, userResource(c, id)); err != nil {
+		return err
 	}
 
 	updatedUser, err := db.UpdateUser(c, id, input)
@@ -75,3 +86,17 @@ func (s *Server) usersUpdateHandler(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, user)
 }
+
+// userResource returns the authorization resource for a user. The user is attributed to the current user's active
+// tenant if they are a member of it, which row-level security reveals by letting the user be found.
+func userResource(c echo.Context, id string) authz.Resource {
+	resource := authz.Resource{Type: resourceType(app.PermissionUsersRead), ID: id, OwnerID: id}
+	actor := app.CurrentUser(c)
+	if id == actor.ID || actor.TenantID == "" {
+		return resource
+	}
+	if _, err := db.FindUserByID(c, id); err == nil {
+		resource.TenantID = actor.TenantID
+	}
+	return resource
+}